@@ -2,6 +2,7 @@ package main
 
 import (
 	"archi/internal/event"
+	"archi/internal/service/sms/async"
 
 	"github.com/gin-gonic/gin"
 	"github.com/robfig/cron/v3"
@@ -11,4 +12,6 @@ type App struct {
 	engine    *gin.Engine
 	consumers []event.Consumer
 	cron      *cron.Cron
+	// asyncSMS 转异步的短信由它在后台发送
+	asyncSMS *async.Service
 }
@@ -1,5 +1,7 @@
 package domain
 
+import "time"
+
 // Scene 定义 AI 业务场景
 type Scene string
 
@@ -7,4 +9,72 @@ const (
 	SceneArticleSummary Scene = "article_summary" // 读者侧：文章总结
 	SceneArticleQA      Scene = "article_qa"      // 读者侧：文章问答 QA
 	SceneAuthorHelper   Scene = "author_helper"   // 创作者侧：创作助手
+	// SceneContentModeration 平台侧：内容审核
+	SceneContentModeration Scene = "content_moderation"
+)
+
+// PromptTemplate 版本化的 Prompt 模板
+// 同一场景下可以同时存在多个版本，按 Weight 进行 A/B 实验分流
+type PromptTemplate struct {
+	Scene   Scene
+	Version string
+	// Content 使用 text/template 语法，变量由各场景的 PromptVars 结构体提供
+	Content string
+	// Weight 实验流量权重，为 0 表示该版本不参与分流
+	Weight int
+}
+
+// RenderedPrompt 渲染完成的 Prompt，携带版本号用于效果对比
+type RenderedPrompt struct {
+	Scene   Scene
+	Version string
+	Content string
+}
+
+// AiResponse 记录每一次 AI 响应使用的 Prompt 版本
+type AiResponse struct {
+	ID            int64
+	Scene         Scene
+	PromptVersion string
+	Uid           int64
+	BizId         int64
+	// Duration 从调用模型到拿到结果（或开始流式输出）的耗时
+	Duration time.Duration
+	Success  bool
+	Ctime    time.Time
+}
+
+// AiActionKind AI 助手发起的写操作类型
+type AiActionKind string
+
+const (
+	AiActionAttachTags AiActionKind = "attach_tags" // 给文章绑定标签
+	AiActionSaveDraft  AiActionKind = "save_draft"  // 保存修改后的草稿（含标题）
 )
+
+// AiPendingAction AI 助手提议、等待用户确认的写操作
+// 工具调用只会生成提议，真正的写入只在用户显式确认后发生
+type AiPendingAction struct {
+	ID        string
+	Kind      AiActionKind
+	Uid       int64
+	ArticleID int64
+	Title     string
+	Content   string
+	TagIDs    []int64
+	// ArticleUtime 提议时文章的更新时间，确认的时候文章已经被修改过就拒绝，避免覆盖用户之后的编辑
+	ArticleUtime time.Time
+	Ctime        time.Time
+}
+
+// AiToolAudit AI 工具调用以及确认操作的审计记录
+type AiToolAudit struct {
+	Uid       int64
+	ArticleID int64
+	Tool      string
+	// Args 工具调用的原始 JSON 参数
+	Args    string
+	Result  string
+	Success bool
+	Ctime   time.Time
+}
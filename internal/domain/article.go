@@ -11,6 +11,10 @@ const (
 	ArticleStatusPublished
 	// ArticleStatusPrivate 仅自己可见
 	ArticleStatusPrivate
+	// ArticleStatusPendingReview 内容审核命中，等待人工复审
+	ArticleStatusPendingReview
+	// ArticleStatusRejected 人工复审驳回
+	ArticleStatusRejected
 )
 
 type ArticleStatus uint8
@@ -30,14 +34,18 @@ type Article struct {
 	Content string
 	Author  Author
 	Status  ArticleStatus
-	Ctime   time.Time
-	Utime   time.Time
+	// Mentions 正文中 @ 到的用户，只有线上库的文章会加载
+	Mentions []Mention
+	Ctime    time.Time
+	Utime    time.Time
 }
 
 // ArticleSummary 作为文章的价值对象，存放 AI 总结内容
 type ArticleSummary struct {
 	Content         string   `json:"content"`
 	GoldenSentences []string `json:"golden_sentences"`
+	// PromptVersion 生成该总结所使用的 Prompt 版本
+	PromptVersion string `json:"prompt_version"`
 }
 
 func (a Article) Abstract() string {
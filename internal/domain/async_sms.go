@@ -1,9 +1,17 @@
 package domain
 
+import "time"
+
 type AsyncSMS struct {
 	ID       int64
 	TplId    string
 	Args     []string
 	Numbers  []string
+	RetryCnt int // 已经尝试发送的次数，抢占的时候加一
 	RetryMax int // 重试的配置
+	// LastErr 最后一次发送失败的原因
+	LastErr     string
+	NextRetryAt time.Time
+	Ctime       time.Time
+	Utime       time.Time
 }
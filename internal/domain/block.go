@@ -0,0 +1,31 @@
+package domain
+
+import "time"
+
+// BlockType 屏蔽关系的类型
+type BlockType uint8
+
+const (
+	BlockTypeUnknown BlockType = iota
+	// BlockTypeBlock 拉黑，双方互相看不到对方的内容，也不能关注和评论对方
+	BlockTypeBlock
+	// BlockTypeMute 静音，只是自己看不到对方的内容，对方没有任何感知
+	BlockTypeMute
+)
+
+func (t BlockType) ToUint8() uint8 {
+	return uint8(t)
+}
+
+func (t BlockType) Valid() bool {
+	return t == BlockTypeBlock || t == BlockTypeMute
+}
+
+// BlockRelation Uid 拉黑或者静音了 Target
+type BlockRelation struct {
+	ID     int64
+	Uid    int64
+	Target int64
+	Type   BlockType
+	Ctime  time.Time
+}
@@ -1,6 +1,13 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type CommentatorInfo struct {
 	ID   int64  `json:"id"`
@@ -22,6 +29,134 @@ type Comment struct {
 	// 父评论
 	ParentComment *Comment  `json:"parentComment"`
 	Children      []Comment `json:"children"`
-	CTime         time.Time `json:"ctime"`
-	UTime         time.Time `json:"utime"`
+	// ReplyCnt 一级评论下面未删除的回复数
+	ReplyCnt int64 `json:"replyCnt"`
+	// Mentions 内容中 @ 到的用户
+	Mentions []Mention `json:"mentions"`
+	// 点赞数，冗余自 interactive，用于热度排序
+	LikeCnt  int64 `json:"likeCnt"`
+	HotScore int64 `json:"hotScore"`
+	// Liked 当前用户是否点赞过
+	Liked bool `json:"liked"`
+	// Pinned 是否被内容作者置顶，每个业务对象最多一条
+	Pinned bool          `json:"pinned"`
+	Status CommentStatus `json:"status"`
+	// EditCnt 编辑次数，大于 0 说明内容被修改过
+	EditCnt int64     `json:"editCnt"`
+	CTime   time.Time `json:"ctime"`
+	UTime   time.Time `json:"utime"`
+}
+
+// CommentTombstone 被删除的评论对外展示的内容，保留节点是为了不打断回复链
+const CommentTombstone = "[deleted]"
+
+// CommentPendingPlaceholder 等待复审的评论对评论者以外的人展示的内容
+const CommentPendingPlaceholder = "[under review]"
+
+type CommentStatus uint8
+
+const (
+	CommentStatusNormal CommentStatus = iota
+	// CommentStatusDeleted 用户删除或者复审驳回，只保留墓碑
+	CommentStatusDeleted
+	// CommentStatusPendingReview 命中复审规则，复审通过之前只有评论者自己能看到内容
+	CommentStatusPendingReview
+)
+
+func (s CommentStatus) ToUint8() uint8 {
+	return uint8(s)
+}
+
+func (c Comment) Deleted() bool {
+	return c.Status == CommentStatusDeleted
+}
+
+func (c Comment) PendingReview() bool {
+	return c.Status == CommentStatusPendingReview
+}
+
+// CommentEdit 评论的编辑历史，Content 是编辑之前的内容
+type CommentEdit struct {
+	ID      int64
+	Cid     int64
+	Uid     int64
+	Content string
+	Ctime   time.Time
+}
+
+// Cursor 以当前评论作为下一页的起点
+func (c Comment) Cursor() CommentCursor {
+	return CommentCursor{
+		Score: c.HotScore,
+		ID:    c.Id,
+	}
+}
+
+const (
+	// commentHotGravity 点赞数每增加 10 倍，相当于晚发表这么多秒
+	commentHotGravity = 45000
+	// commentHotScale 热度是浮点数，放大之后按整数存储，方便建索引和做游标
+	commentHotScale = 1e6
+)
+
+// CommentHotScore 参考 reddit 的热度算法，点赞数取对数之后和发表时间相加，
+// 新评论不会被早期的高赞评论一直压在下面
+func CommentHotScore(likeCnt int64, ctime time.Time) int64 {
+	likes := math.Log10(float64(max(likeCnt, 0) + 1))
+	return int64((likes + float64(ctime.Unix())/commentHotGravity) * commentHotScale)
+}
+
+// CommentSort 评论列表的排序方式
+type CommentSort string
+
+const (
+	// CommentSortNew 按发表时间倒序
+	CommentSortNew CommentSort = "new"
+	// CommentSortHot 按热度倒序
+	CommentSortHot CommentSort = "hot"
+)
+
+func (s CommentSort) Valid() bool {
+	return s == CommentSortNew || s == CommentSortHot
+}
+
+// CommentCursor 评论列表分页游标
+// 按时间排序的时候只用到 ID，按热度排序的时候按 (Score, ID) 倒序翻页
+// 零值表示从第一页开始
+type CommentCursor struct {
+	Score int64
+	ID    int64
+}
+
+var errInvalidCommentCursor = errors.New("非法的评论游标")
+
+// ParseCommentCursor 解析 String 生成的游标，空字符串返回零值
+func ParseCommentCursor(s string) (CommentCursor, error) {
+	if s == "" {
+		return CommentCursor{}, nil
+	}
+	scoreStr, idStr, ok := strings.Cut(s, "_")
+	if !ok {
+		return CommentCursor{}, fmt.Errorf("%w, cursor %s", errInvalidCommentCursor, s)
+	}
+	score, err := strconv.ParseInt(scoreStr, 10, 64)
+	if err != nil {
+		return CommentCursor{}, fmt.Errorf("%w, cursor %s", errInvalidCommentCursor, s)
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return CommentCursor{}, fmt.Errorf("%w, cursor %s", errInvalidCommentCursor, s)
+	}
+	return CommentCursor{Score: score, ID: id}, nil
+}
+
+func (c CommentCursor) IsZero() bool {
+	return c.Score == 0 && c.ID == 0
+}
+
+func (c CommentCursor) String() string {
+	if c.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(c.Score, 10) + "_" + strconv.FormatInt(c.ID, 10)
 }
@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommentHotScore(t *testing.T) {
+	base := time.Unix(1_700_000_000, 0)
+	testCases := []struct {
+		name   string
+		higher int64
+		lower  int64
+	}{
+		{
+			name:   "同一时间点赞多的更热",
+			higher: CommentHotScore(10, base),
+			lower:  CommentHotScore(9, base),
+		},
+		{
+			name:   "点赞数相同新发表的更热",
+			higher: CommentHotScore(10, base.Add(time.Second)),
+			lower:  CommentHotScore(10, base),
+		},
+		{
+			name:   "晚发表一个周期抵得上十倍的点赞",
+			higher: CommentHotScore(10, base.Add(commentHotGravity*time.Second+time.Second)),
+			lower:  CommentHotScore(100, base),
+		},
+		{
+			name:   "高赞的旧评论不会一直压着新评论",
+			higher: CommentHotScore(0, base.Add(time.Hour*24*7)),
+			lower:  CommentHotScore(1000, base),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Greater(t, tc.higher, tc.lower)
+		})
+	}
+	// 负数按 0 处理
+	assert.Equal(t, CommentHotScore(0, base), CommentHotScore(-1, base))
+}
+
+func TestParseCommentCursor(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cursor  string
+		want    CommentCursor
+		wantErr error
+	}{
+		{
+			name: "空字符串从第一页开始",
+		},
+		{
+			name:   "正常解析",
+			cursor: "37779000000_12",
+			want:   CommentCursor{Score: 37779000000, ID: 12},
+		},
+		{
+			name:   "按时间排序热度是 0",
+			cursor: "0_12",
+			want:   CommentCursor{ID: 12},
+		},
+		{
+			name:    "没有分隔符",
+			cursor:  "12",
+			wantErr: errInvalidCommentCursor,
+		},
+		{
+			name:    "热度不是数字",
+			cursor:  "abc_12",
+			wantErr: errInvalidCommentCursor,
+		},
+		{
+			name:    "ID 不是数字",
+			cursor:  "100_abc",
+			wantErr: errInvalidCommentCursor,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cursor, err := ParseCommentCursor(tc.cursor)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.want, cursor)
+			assert.Equal(t, tc.cursor, cursor.String())
+		})
+	}
+}
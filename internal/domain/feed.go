@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/ecodeclub/ekit"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,7 +17,7 @@ func (f ExtendFields) Get(key string) ekit.AnyValue {
 	val, ok := f[key]
 	if !ok {
 		return ekit.AnyValue{
-			Err: fmt.Errorf("%w, key %s", errKeyNotFound),
+			Err: fmt.Errorf("%w, key %s", errKeyNotFound, key),
 		}
 	}
 	return ekit.AnyValue{Val: val}
@@ -23,6 +25,9 @@ func (f ExtendFields) Get(key string) ekit.AnyValue {
 
 type FeedEvent struct {
 	ID int64
+	// EventId 事件的全局唯一 id，同一个事件推拉两份以及异步扩散的每一批都共用这个 id，
+	// 翻页的时候用来给同一毫秒的事件排序，合并推拉两份的时候用来去重
+	EventId string
 	// 以 A 发表了一篇文章为例
 	// 如果是 Pull Event，也就是拉模型，那么 Uid 是 A 的id
 	// 如果是 Push Event，也就是推模型，那么 Uid 是 A 的某个粉丝的 id
@@ -31,3 +36,83 @@ type FeedEvent struct {
 	Ctime time.Time
 	Ext   ExtendFields
 }
+
+// FeedLegacyEventIdPrefix 引入 EventId 之前的历史事件，按表名和行 id 回填的 EventId 以它开头，
+// 推拉两份是不同的 id，合并的时候只能按内容去重
+const FeedLegacyEventIdPrefix = "legacy-"
+
+// Legacy 是否是回填了 EventId 的历史事件
+func (e FeedEvent) Legacy() bool {
+	return strings.HasPrefix(e.EventId, FeedLegacyEventIdPrefix)
+}
+
+// Cursor 以当前事件作为下一页的起点
+func (e FeedEvent) Cursor() FeedCursor {
+	return FeedCursor{
+		Ctime:   e.Ctime.UnixMilli(),
+		EventId: e.EventId,
+	}
+}
+
+// Before 按 (Ctime, EventId) 倒序排列时，e 是否排在 o 前面
+func (e FeedEvent) Before(o FeedEvent) bool {
+	if e.Ctime.UnixMilli() != o.Ctime.UnixMilli() {
+		return e.Ctime.UnixMilli() > o.Ctime.UnixMilli()
+	}
+	return e.EventId > o.EventId
+}
+
+// FeedCursor feed 流分页游标
+// 按 (Ctime, EventId) 倒序翻页。推拉两张表的自增 id 互相独立，不能用来比较，
+// EventId 推拉两份是一样的，同一毫秒内产生的多个事件也不会被跳过或重复返回
+// 零值表示从最新的事件开始
+type FeedCursor struct {
+	// Ctime 毫秒级时间戳
+	Ctime   int64
+	EventId string
+}
+
+var errInvalidFeedCursor = errors.New("非法的 feed 游标")
+
+// ParseFeedCursor 解析 String 生成的游标，空字符串返回零值
+func ParseFeedCursor(s string) (FeedCursor, error) {
+	if s == "" {
+		return FeedCursor{}, nil
+	}
+	ctimeStr, eventId, ok := strings.Cut(s, "_")
+	if !ok || eventId == "" {
+		return FeedCursor{}, fmt.Errorf("%w, cursor %s", errInvalidFeedCursor, s)
+	}
+	ctime, err := strconv.ParseInt(ctimeStr, 10, 64)
+	if err != nil {
+		return FeedCursor{}, fmt.Errorf("%w, cursor %s", errInvalidFeedCursor, s)
+	}
+	return FeedCursor{Ctime: ctime, EventId: eventId}, nil
+}
+
+func (c FeedCursor) IsZero() bool {
+	return c.Ctime == 0 && c.EventId == ""
+}
+
+func (c FeedCursor) String() string {
+	if c.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(c.Ctime, 10) + "_" + c.EventId
+}
+
+// Precedes 事件是否位于游标之后，也就是属于下一页
+func (c FeedCursor) Precedes(e FeedEvent) bool {
+	if c.IsZero() {
+		return true
+	}
+	ctime := e.Ctime.UnixMilli()
+	return ctime < c.Ctime || (ctime == c.Ctime && e.EventId < c.EventId)
+}
+
+// FeedEnrichment 一页 feed 事件中引用到的用户和文章，批量加载后随事件一起返回，
+// 客户端不需要再按 Ext 里面的 id 逐个查询
+type FeedEnrichment struct {
+	Users    map[int64]User
+	Articles map[int64]Article
+}
@@ -0,0 +1,129 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFeedCursor(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cursor  string
+		want    FeedCursor
+		wantErr error
+	}{
+		{
+			name: "空字符串从头开始",
+		},
+		{
+			name:   "正常解析",
+			cursor: "1700000000123_0b8f1c2e-6a3d-4e4f-9a51-3c7d2f1e0a9b",
+			want:   FeedCursor{Ctime: 1700000000123, EventId: "0b8f1c2e-6a3d-4e4f-9a51-3c7d2f1e0a9b"},
+		},
+		{
+			name:   "回填了 EventId 的历史事件",
+			cursor: "1700000000000_legacy-pull-12",
+			want:   FeedCursor{Ctime: 1700000000000, EventId: "legacy-pull-12"},
+		},
+		{
+			name:    "缺少 EventId",
+			cursor:  "1700000000123_",
+			wantErr: errInvalidFeedCursor,
+		},
+		{
+			name:    "没有分隔符",
+			cursor:  "1700000000123",
+			wantErr: errInvalidFeedCursor,
+		},
+		{
+			name:    "时间不是数字",
+			cursor:  "abc_def",
+			wantErr: errInvalidFeedCursor,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cursor, err := ParseFeedCursor(tc.cursor)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.want, cursor)
+			assert.Equal(t, tc.cursor, cursor.String())
+		})
+	}
+}
+
+func TestFeedCursor_Precedes(t *testing.T) {
+	base := time.UnixMilli(1_700_000_000_123)
+	cursor := FeedEvent{EventId: "m", Ctime: base}.Cursor()
+	testCases := []struct {
+		name string
+		evt  FeedEvent
+		want bool
+	}{
+		{
+			name: "更早的毫秒",
+			evt:  FeedEvent{EventId: "z", Ctime: base.Add(-time.Millisecond)},
+			want: true,
+		},
+		{
+			name: "同一秒里更晚的毫秒",
+			evt:  FeedEvent{EventId: "a", Ctime: base.Add(time.Millisecond)},
+		},
+		{
+			name: "同一毫秒 EventId 更小",
+			evt:  FeedEvent{EventId: "l", Ctime: base},
+			want: true,
+		},
+		{
+			name: "游标自己",
+			evt:  FeedEvent{EventId: "m", Ctime: base},
+		},
+		{
+			name: "同一毫秒 EventId 更大",
+			evt:  FeedEvent{EventId: "n", Ctime: base},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, cursor.Precedes(tc.evt))
+		})
+	}
+	assert.True(t, FeedCursor{}.Precedes(FeedEvent{Ctime: base}))
+}
+
+// TestFeedCursor_PrecedesLegacy 历史数据的秒级时间戳换算成毫秒之后大量重复，靠回填的 EventId 逐条翻页
+func TestFeedCursor_PrecedesLegacy(t *testing.T) {
+	base := time.UnixMilli(1_700_000_000_000)
+	events := []FeedEvent{
+		{EventId: "legacy-push-9", Ctime: base},
+		{EventId: "legacy-pull-3", Ctime: base},
+		{EventId: "legacy-pull-12", Ctime: base},
+		{EventId: "legacy-pull-10", Ctime: base},
+	}
+	var (
+		cursor FeedCursor
+		got    []string
+	)
+	for i := 0; i < len(events)+1; i++ {
+		var next *FeedEvent
+		for j := range events {
+			e := events[j]
+			if cursor.Precedes(e) && (next == nil || e.Before(*next)) {
+				next = &e
+			}
+		}
+		if next == nil {
+			break
+		}
+		assert.True(t, next.Legacy())
+		got = append(got, next.EventId)
+		var err error
+		cursor, err = ParseFeedCursor(next.Cursor().String())
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"legacy-push-9", "legacy-pull-3", "legacy-pull-12", "legacy-pull-10"}, got)
+}
@@ -2,6 +2,7 @@ package domain
 
 // FollowRelation 关注数据
 type FollowRelation struct {
+	ID int64
 	// 关注的人
 	Follower int64
 	// 被关注的人
@@ -17,3 +18,16 @@ type FollowStatics struct {
 	// 自己关注了多少人
 	Followees int64
 }
+
+// FollowState 当前用户和另一个用户之间的关注状态
+type FollowState struct {
+	// 我关注了对方
+	Following bool
+	// 对方关注了我
+	FollowedBy bool
+}
+
+// Mutual 互相关注
+func (s FollowState) Mutual() bool {
+	return s.Following && s.FollowedBy
+}
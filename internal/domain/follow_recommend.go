@@ -0,0 +1,20 @@
+package domain
+
+// FollowRecommendReason 推荐的来源，分数最高的来源作为展示给用户的理由
+type FollowRecommendReason string
+
+const (
+	// FollowRecommendReasonSecondDegree 关注的人也关注了他
+	FollowRecommendReasonSecondDegree FollowRecommendReason = "second_degree"
+	// FollowRecommendReasonTag 和你关注同样的标签
+	FollowRecommendReasonTag FollowRecommendReason = "tag"
+	// FollowRecommendReasonLiked 你点赞过他的文章
+	FollowRecommendReasonLiked FollowRecommendReason = "liked"
+)
+
+// FollowRecommendation 可能认识的人
+type FollowRecommendation struct {
+	Uid    int64                 `json:"uid"`
+	Score  float64               `json:"score"`
+	Reason FollowRecommendReason `json:"reason"`
+}
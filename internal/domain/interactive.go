@@ -5,6 +5,8 @@ type Interactive struct {
 	ReadCnt    int64
 	LikeCnt    int64
 	CollectCnt int64
+	// CommentCnt 未删除的评论数，包括回复
+	CommentCnt int64
 	Liked      bool
 	Collected  bool
 }
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+// MaxMentions 一段内容最多解析的 @ 数量，超过的部分按普通文本处理
+const MaxMentions = 10
+
+// mentionPattern @ 后面跟着昵称，昵称由文字、数字、下划线和中划线组成
+var mentionPattern = regexp.MustCompile(`@([\p{L}\p{N}_-]{1,32})`)
+
+// Mention 内容中 @ 到的用户
+// Start 和 End 是 "@昵称" 在内容中的字符下标（按 rune 计算），左闭右开
+type Mention struct {
+	Uid      int64  `json:"uid"`
+	Nickname string `json:"nickname"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+// ParseMentions 找出内容中全部的 @昵称，返回的 Mention 还没有 Uid
+func ParseMentions(content string) []Mention {
+	idxs := mentionPattern.FindAllStringSubmatchIndex(content, MaxMentions)
+	res := make([]Mention, 0, len(idxs))
+	// 逐段累加 rune 数量，避免每次都从头计算
+	bytePos, runePos := 0, 0
+	for _, idx := range idxs {
+		runePos += utf8.RuneCountInString(content[bytePos:idx[0]])
+		start := runePos
+		runePos += utf8.RuneCountInString(content[idx[0]:idx[1]])
+		bytePos = idx[1]
+		res = append(res, Mention{
+			Nickname: content[idx[2]:idx[3]],
+			Start:    start,
+			End:      runePos,
+		})
+	}
+	return res
+}
@@ -0,0 +1,76 @@
+package domain
+
+import "time"
+
+// ModerationVerdict 内容审核结论
+type ModerationVerdict uint8
+
+const (
+	// ModerationVerdictPass 通过
+	ModerationVerdictPass ModerationVerdict = iota + 1
+	// ModerationVerdictReview 需要人工复审
+	ModerationVerdictReview
+	// ModerationVerdictBlock 直接拦截
+	ModerationVerdictBlock
+)
+
+func (v ModerationVerdict) ToUint8() uint8 {
+	return uint8(v)
+}
+
+func (v ModerationVerdict) String() string {
+	switch v {
+	case ModerationVerdictPass:
+		return "pass"
+	case ModerationVerdictReview:
+		return "review"
+	case ModerationVerdictBlock:
+		return "block"
+	default:
+		return "unknown"
+	}
+}
+
+// ModerationStatus 审核记录在复审队列中的状态
+type ModerationStatus uint8
+
+const (
+	ModerationStatusUnknown ModerationStatus = iota
+	// ModerationStatusPassed 机审通过，不需要人工处理
+	ModerationStatusPassed
+	// ModerationStatusPending 等待人工复审
+	ModerationStatusPending
+	// ModerationStatusApproved 人工复审通过
+	ModerationStatusApproved
+	// ModerationStatusRejected 人工复审驳回
+	ModerationStatusRejected
+)
+
+func (s ModerationStatus) ToUint8() uint8 {
+	return uint8(s)
+}
+
+// ModerationSource 审核结论的来源
+type ModerationSource string
+
+const (
+	ModerationSourceLocal    ModerationSource = "local"    // 本地关键词、正则过滤
+	ModerationSourceLLM      ModerationSource = "llm"      // 大模型分类
+	ModerationSourceReviewer ModerationSource = "reviewer" // 人工复审
+)
+
+// Moderation 一条业务内容的审核记录，同一个 (Biz, BizId) 只有一条
+type Moderation struct {
+	ID       int64
+	Biz      string
+	BizId    int64
+	Uid      int64 // 内容作者
+	Content  string
+	Verdict  ModerationVerdict
+	Reasons  []string
+	Source   ModerationSource
+	Status   ModerationStatus
+	Reviewer int64
+	Ctime    time.Time
+	Utime    time.Time
+}
@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"strconv"
+	"time"
+)
+
+// NotificationType 通知类型，同时也是用户免打扰设置的粒度
+type NotificationType string
+
+const (
+	NotificationTypeFollow  NotificationType = "follow"
+	NotificationTypeLike    NotificationType = "like"
+	NotificationTypeComment NotificationType = "comment"
+	NotificationTypeReward  NotificationType = "reward"
+	NotificationTypeMention NotificationType = "mention"
+)
+
+// NotificationTypes 全部的通知类型
+var NotificationTypes = []NotificationType{
+	NotificationTypeFollow,
+	NotificationTypeLike,
+	NotificationTypeComment,
+	NotificationTypeReward,
+	NotificationTypeMention,
+}
+
+func (t NotificationType) Valid() bool {
+	for _, typ := range NotificationTypes {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Notification 一条聚合后的通知
+// 关注和点赞会按 GroupKey 聚合，展示成 "X 和其他 12 人赞了你的文章"；
+// 评论回复、打赏和 @ 每一条都是独立的通知
+type Notification struct {
+	ID int64
+	// Uid 接收通知的人
+	Uid  int64
+	Type NotificationType
+	// GroupKey 聚合键，同一个用户下唯一
+	GroupKey string
+	Biz      string
+	BizId    int64
+	// Actors 最近触发通知的几个人，最新的在前面
+	Actors []Actor
+	// ActorCnt 聚合的总人次
+	ActorCnt int64
+	// UnreadCnt 聚合进来还没有读的条数，为 0 说明已读
+	UnreadCnt int64
+	// Ext 最近一次事件的附加信息，例如评论 id、打赏金额
+	Ext   ExtendFields
+	Ctime time.Time
+	Utime time.Time
+}
+
+// Actor 触发通知的人，昵称和头像在查询的时候补全
+type Actor struct {
+	ID       int64
+	Nickname string
+	Avatar   string
+}
+
+// NotificationGroupKey 计算聚合键
+// key 是同类通知中区分不同事件的标识，例如评论 id、打赏 id，关注和点赞不需要
+// @ 以被 @ 的内容作为标识，同一条内容编辑多次也只有一条通知
+func NotificationGroupKey(typ NotificationType, biz string, bizId int64, key string) string {
+	switch typ {
+	case NotificationTypeFollow:
+		return string(typ)
+	case NotificationTypeLike, NotificationTypeMention:
+		return string(typ) + ":" + biz + ":" + strconv.FormatInt(bizId, 10)
+	default:
+		return string(typ) + ":" + key
+	}
+}
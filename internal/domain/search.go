@@ -12,6 +12,8 @@ type ArticleES struct {
 	Status  int32
 	Content string
 	Tags    []string
+	// AuthorId 作者，搜索结果需要过滤掉当前用户看不到的作者
+	AuthorId int64
 }
 
 type SearchResult struct {
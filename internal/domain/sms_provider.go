@@ -0,0 +1,17 @@
+package domain
+
+import "time"
+
+// SMSProviderState 短信服务商当前的熔断状态与健康分
+type SMSProviderState struct {
+	Name  string
+	State string
+	// Score 健康分，0 到 1，越高越优先使用
+	Score      float64
+	Total      int64
+	Failed     int64
+	ErrorRate  float64
+	AvgLatency time.Duration
+	// OpenUntil 熔断打开时，什么时候进入半开
+	OpenUntil time.Time
+}
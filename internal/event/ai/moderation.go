@@ -0,0 +1,56 @@
+package ai
+
+import (
+	"archi/internal/event/moderation"
+	"archi/internal/service"
+	aisvc "archi/internal/service/ai"
+	"archi/pkg/logger"
+	"archi/pkg/saramax"
+	"context"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+const topicModerationEvent = "content_moderation_event"
+
+// ModerationEventConsumer 消费待审核内容，交给大模型复核后回写审核结论
+type ModerationEventConsumer struct {
+	aiSvc  aisvc.AiService
+	modSvc service.ModerationService
+	client sarama.Client
+	l      logger.Logger
+}
+
+func NewModerationEventConsumer(aiSvc aisvc.AiService, modSvc service.ModerationService,
+	client sarama.Client, l logger.Logger) *ModerationEventConsumer {
+	return &ModerationEventConsumer{
+		aiSvc:  aiSvc,
+		modSvc: modSvc,
+		client: client,
+		l:      l,
+	}
+}
+
+func (c *ModerationEventConsumer) Start() error {
+	cg, err := sarama.NewConsumerGroupFromClient("content_moderation", c.client)
+	if err != nil {
+		return err
+	}
+	go func() {
+		_ = cg.Consume(context.Background(),
+			[]string{topicModerationEvent},
+			saramax.NewHandler[moderation.Event](c.l, c.Consume))
+	}()
+	return nil
+}
+
+func (c *ModerationEventConsumer) Consume(msg *sarama.ConsumerMessage, evt moderation.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	verdict, reasons, err := c.aiSvc.ModerateContent(ctx, evt.Uid, evt.Biz, evt.BizId, evt.Content)
+	if err != nil {
+		return err
+	}
+	return c.modSvc.ApplyVerdict(ctx, evt.Biz, evt.BizId, verdict, reasons)
+}
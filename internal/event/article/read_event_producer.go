@@ -14,6 +14,8 @@ type ArticleEvent struct {
 	Title   string `json:"title"`
 	Status  int32  `json:"status"`
 	Content string `json:"content"`
+	// AuthorId 搜索的时候要过滤掉拉黑和静音的作者
+	AuthorId int64 `json:"author_id"`
 }
 
 type Producer interface {
@@ -44,10 +46,11 @@ func (s *SaramaSyncProducer) ProduceReadEvent(evt ReadEvent) error {
 // ProduceSyncEvent 发送一个文章同步事件
 func (p *SaramaSyncProducer) ProduceSyncEvent(ctx context.Context, art domain.Article) error {
 	val, err := json.Marshal(ArticleEvent{
-		Id:      art.ID,
-		Title:   art.Title,
-		Status:  int32(art.Status),
-		Content: art.Content,
+		Id:       art.ID,
+		Title:    art.Title,
+		Status:   int32(art.Status),
+		Content:  art.Content,
+		AuthorId: art.Author.ID,
 	})
 	if err != nil {
 		return err
@@ -0,0 +1,55 @@
+package fanout
+
+import (
+	"encoding/json"
+	"github.com/IBM/sarama"
+	"strconv"
+)
+
+// topicFanoutEvent 粉丝较多时，推模型按批异步写收件箱
+const topicFanoutEvent = "feed_fanout_event"
+
+// Event 一批需要写入收件箱的粉丝
+type Event struct {
+	// Type feed 事件类型
+	Type string            `json:"type"`
+	Ext  map[string]string `json:"ext"`
+	// EventId 同一个事件的所有批次以及拉模型的那一份共用
+	EventId string `json:"event_id"`
+	// Ctime 事件发生时间，毫秒。同一个事件的所有批次保持一致，也用于统计扩散延迟
+	Ctime     int64   `json:"ctime"`
+	Followers []int64 `json:"followers"`
+}
+
+type Producer interface {
+	ProduceFanoutEvents(evts []Event) error
+}
+
+type SaramaFanoutEventProducer struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+func NewFanoutEventProducer(producer sarama.SyncProducer) Producer {
+	return &SaramaFanoutEventProducer{
+		producer: producer,
+		topic:    topicFanoutEvent,
+	}
+}
+
+func (p *SaramaFanoutEventProducer) ProduceFanoutEvents(evts []Event) error {
+	msgs := make([]*sarama.ProducerMessage, 0, len(evts))
+	for i, evt := range evts {
+		val, err := json.Marshal(evt)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, &sarama.ProducerMessage{
+			Topic: p.topic,
+			// 同一个事件的不同批次打散到不同分区，并行消费
+			Key:   sarama.StringEncoder(evt.EventId + ":" + strconv.Itoa(i)),
+			Value: sarama.StringEncoder(val),
+		})
+	}
+	return p.producer.SendMessages(msgs)
+}
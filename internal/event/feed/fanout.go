@@ -0,0 +1,75 @@
+package feed
+
+import (
+	"archi/internal/domain"
+	"archi/internal/event/fanout"
+	"archi/internal/service/feed"
+	"archi/pkg/logger"
+	"archi/pkg/saramax"
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+const topicFanoutEvent = "feed_fanout_event"
+
+// FanoutEventConsumer 异步扩散，把事件写入一批粉丝的收件箱
+type FanoutEventConsumer struct {
+	feedSvc feed.Service
+	client  sarama.Client
+	l       logger.Logger
+	// lag 从事件发生到写入收件箱的延迟
+	lag *prometheus.SummaryVec
+}
+
+func NewFanoutEventConsumer(svc feed.Service, client sarama.Client, log logger.Logger) *FanoutEventConsumer {
+	lag := prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace: "sinsoledad",
+		Subsystem: "archi",
+		Name:      "feed_fanout_lag",
+		Help:      "feed 异步扩散延迟，单位毫秒",
+		Objectives: map[float64]float64{
+			0.5:  0.01,
+			0.9:  0.01,
+			0.99: 0.001,
+		},
+	}, []string{"type"})
+	prometheus.MustRegister(lag)
+	return &FanoutEventConsumer{
+		feedSvc: svc,
+		client:  client,
+		l:       log,
+		lag:     lag,
+	}
+}
+
+func (f *FanoutEventConsumer) Start() error {
+	cg, err := sarama.NewConsumerGroupFromClient("feed_fanout", f.client)
+	if err != nil {
+		return err
+	}
+	go func() {
+		_ = cg.Consume(context.Background(),
+			[]string{topicFanoutEvent},
+			saramax.NewHandler[fanout.Event](f.l, f.Consume))
+	}()
+	return nil
+}
+
+func (f *FanoutEventConsumer) Consume(msg *sarama.ConsumerMessage, evt fanout.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	ctime := time.UnixMilli(evt.Ctime)
+	err := f.feedSvc.FanoutPush(ctx, domain.FeedEvent{
+		EventId: evt.EventId,
+		Type:    evt.Type,
+		Ctime:   ctime,
+		Ext:     evt.Ext,
+	}, evt.Followers)
+	if err != nil {
+		return err
+	}
+	f.lag.WithLabelValues(evt.Type).Observe(float64(time.Since(ctime).Milliseconds()))
+	return nil
+}
@@ -0,0 +1,51 @@
+package feed
+
+import (
+	"archi/internal/domain"
+	"archi/internal/event/feedevent"
+	"archi/internal/service/feed"
+	"archi/pkg/logger"
+	"archi/pkg/saramax"
+	"context"
+	"github.com/IBM/sarama"
+	"time"
+)
+
+const topicFeedEvent = "feed_event"
+
+// FeedEventConsumer 消费评论、打赏、收藏等业务方产生的 feed 事件
+type FeedEventConsumer struct {
+	feedSvc feed.Service
+	client  sarama.Client
+	l       logger.Logger
+}
+
+func NewFeedEventConsumer(svc feed.Service, client sarama.Client, log logger.Logger) *FeedEventConsumer {
+	return &FeedEventConsumer{
+		feedSvc: svc,
+		client:  client,
+		l:       log,
+	}
+}
+
+func (f *FeedEventConsumer) Start() error {
+	cg, err := sarama.NewConsumerGroupFromClient("feed_event", f.client)
+	if err != nil {
+		return err
+	}
+	go func() {
+		_ = cg.Consume(context.Background(),
+			[]string{topicFeedEvent},
+			saramax.NewHandler[feedevent.Event](f.l, f.Consume))
+	}()
+	return nil
+}
+
+func (f *FeedEventConsumer) Consume(msg *sarama.ConsumerMessage, evt feedevent.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	return f.feedSvc.CreateFeedEvent(ctx, domain.FeedEvent{
+		Type: evt.Type,
+		Ext:  evt.Ext,
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"context"
 	"github.com/IBM/sarama"
 	"strconv"
+	"time"
 )
 
 const topicFollowEvent = "feed_follow_event"
@@ -53,3 +54,39 @@ func (f *FollowEventConsumer) Consume(msg *sarama.ConsumerMessage, evt FollowEve
 		},
 	})
 }
+
+const topicUnfollowEvent = "feed_unfollow_event"
+
+// UnfollowEventConsumer 取消关注之后清理收件箱
+type UnfollowEventConsumer struct {
+	feedSvc feed.Service
+	client  sarama.Client
+	l       logger.Logger
+}
+
+func NewUnfollowEventConsumer(svc feed.Service, client sarama.Client, log logger.Logger) *UnfollowEventConsumer {
+	return &UnfollowEventConsumer{
+		feedSvc: svc,
+		client:  client,
+		l:       log,
+	}
+}
+
+func (u *UnfollowEventConsumer) Start() error {
+	cg, err := sarama.NewConsumerGroupFromClient("feed_unfollow_event", u.client)
+	if err != nil {
+		return err
+	}
+	go func() {
+		_ = cg.Consume(context.Background(),
+			[]string{topicUnfollowEvent},
+			saramax.NewHandler[FollowEvent](u.l, u.Consume))
+	}()
+	return nil
+}
+
+func (u *UnfollowEventConsumer) Consume(msg *sarama.ConsumerMessage, evt FollowEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	return u.feedSvc.Unfollow(ctx, evt.Follower, evt.Followee)
+}
@@ -0,0 +1,54 @@
+package feedevent
+
+import (
+	"encoding/json"
+	"github.com/IBM/sarama"
+)
+
+// topicFeedEvent 业务方产生的通用 feed 事件，由 feed 服务按 Type 分发给对应的 Handler
+const topicFeedEvent = "feed_event"
+
+// 业务方可以产生的 feed 事件类型
+const (
+	// TypeLike 内容被点赞
+	TypeLike = "like_event"
+	// TypeComment 评论被回复
+	TypeComment = "comment_event"
+	// TypeReward 收到打赏
+	TypeReward = "reward_event"
+	// TypeCollect 内容被收藏
+	TypeCollect = "collect_event"
+)
+
+type Event struct {
+	Type string            `json:"type"`
+	Ext  map[string]string `json:"ext"`
+}
+
+type Producer interface {
+	ProduceFeedEvent(evt Event) error
+}
+
+type SaramaFeedEventProducer struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+func NewFeedEventProducer(producer sarama.SyncProducer) Producer {
+	return &SaramaFeedEventProducer{
+		producer: producer,
+		topic:    topicFeedEvent,
+	}
+}
+
+func (p *SaramaFeedEventProducer) ProduceFeedEvent(evt Event) error {
+	val, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	_, _, err = p.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: p.topic,
+		Value: sarama.StringEncoder(val),
+	})
+	return err
+}
@@ -8,6 +8,9 @@ import (
 // topicFollowEvent 定义了事件的名称
 const topicFollowEvent = "feed_follow_event"
 
+// topicUnfollowEvent 取消关注，feed 据此异步清理收件箱
+const topicUnfollowEvent = "feed_unfollow_event"
+
 // Event 定义了关注事件的数据结构
 type Event struct {
 	Follower int64 `json:"follower"`
@@ -17,6 +20,7 @@ type Event struct {
 // Producer 定义了生产者接口
 type Producer interface {
 	ProduceFollowEvent(evt Event) error
+	ProduceUnfollowEvent(evt Event) error
 }
 
 type SaramaFollowEventProducer struct {
@@ -32,12 +36,20 @@ func NewFollowEventProducer(producer sarama.SyncProducer) Producer {
 }
 
 func (p *SaramaFollowEventProducer) ProduceFollowEvent(evt Event) error {
+	return p.produce(p.topic, evt)
+}
+
+func (p *SaramaFollowEventProducer) ProduceUnfollowEvent(evt Event) error {
+	return p.produce(topicUnfollowEvent, evt)
+}
+
+func (p *SaramaFollowEventProducer) produce(topic string, evt Event) error {
 	val, err := json.Marshal(evt)
 	if err != nil {
 		return err
 	}
 	_, _, err = p.producer.SendMessage(&sarama.ProducerMessage{
-		Topic: p.topic,
+		Topic: topic,
 		Value: sarama.StringEncoder(val),
 	})
 	return err
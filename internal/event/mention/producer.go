@@ -0,0 +1,47 @@
+package mention
+
+import (
+	"encoding/json"
+	"github.com/IBM/sarama"
+)
+
+// topicMentionEvent 内容中 @ 了某个用户
+const topicMentionEvent = "mention_event"
+
+// Event 每个被 @ 的用户一条事件
+type Event struct {
+	Biz   string `json:"biz"`
+	BizId int64  `json:"bizId"`
+	// Mentioner 发表内容的人
+	Mentioner int64 `json:"mentioner"`
+	// Mentioned 被 @ 的人
+	Mentioned int64 `json:"mentioned"`
+}
+
+type Producer interface {
+	ProduceMentionEvent(evt Event) error
+}
+
+type SaramaMentionEventProducer struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+func NewMentionEventProducer(producer sarama.SyncProducer) Producer {
+	return &SaramaMentionEventProducer{
+		producer: producer,
+		topic:    topicMentionEvent,
+	}
+}
+
+func (p *SaramaMentionEventProducer) ProduceMentionEvent(evt Event) error {
+	val, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	_, _, err = p.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: p.topic,
+		Value: sarama.StringEncoder(val),
+	})
+	return err
+}
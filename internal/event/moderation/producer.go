@@ -0,0 +1,49 @@
+package moderation
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/IBM/sarama"
+)
+
+// topicModerationEvent 需要大模型复核的内容
+const topicModerationEvent = "content_moderation_event"
+
+// Event 待大模型审核的内容
+type Event struct {
+	Biz     string `json:"biz"`
+	BizId   int64  `json:"biz_id"`
+	Uid     int64  `json:"uid"`
+	Content string `json:"content"`
+}
+
+type Producer interface {
+	ProduceModerationEvent(evt Event) error
+}
+
+type SaramaModerationEventProducer struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+func NewModerationEventProducer(producer sarama.SyncProducer) Producer {
+	return &SaramaModerationEventProducer{
+		producer: producer,
+		topic:    topicModerationEvent,
+	}
+}
+
+func (p *SaramaModerationEventProducer) ProduceModerationEvent(evt Event) error {
+	val, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	_, _, err = p.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: p.topic,
+		// 同一个业务对象的审核事件落到同一个分区，保证顺序
+		Key:   sarama.StringEncoder(evt.Biz + ":" + strconv.FormatInt(evt.BizId, 10)),
+		Value: sarama.StringEncoder(val),
+	})
+	return err
+}
@@ -0,0 +1,127 @@
+package notification
+
+import (
+	"archi/internal/domain"
+	"archi/internal/event/feedevent"
+	"archi/internal/event/follow"
+	"archi/internal/event/mention"
+	"archi/internal/service"
+	"archi/pkg/logger"
+	"archi/pkg/saramax"
+	"context"
+	"github.com/IBM/sarama"
+	"time"
+)
+
+const (
+	topicFollowEvent  = "feed_follow_event"
+	topicFeedEvent    = "feed_event"
+	topicMentionEvent = "mention_event"
+)
+
+// Consumer 和 feed 使用不同的消费者组消费同一批事件，生成通知
+type Consumer struct {
+	svc    service.NotificationService
+	client sarama.Client
+	l      logger.Logger
+}
+
+func NewConsumer(svc service.NotificationService, client sarama.Client, l logger.Logger) *Consumer {
+	return &Consumer{
+		svc:    svc,
+		client: client,
+		l:      l,
+	}
+}
+
+func (c *Consumer) Start() error {
+	followCg, err := sarama.NewConsumerGroupFromClient("notification_follow", c.client)
+	if err != nil {
+		return err
+	}
+	feedCg, err := sarama.NewConsumerGroupFromClient("notification_feed_event", c.client)
+	if err != nil {
+		return err
+	}
+	mentionCg, err := sarama.NewConsumerGroupFromClient("notification_mention", c.client)
+	if err != nil {
+		return err
+	}
+	go func() {
+		_ = followCg.Consume(context.Background(),
+			[]string{topicFollowEvent},
+			saramax.NewHandler[follow.Event](c.l, c.ConsumeFollow))
+	}()
+	go func() {
+		_ = feedCg.Consume(context.Background(),
+			[]string{topicFeedEvent},
+			saramax.NewHandler[feedevent.Event](c.l, c.ConsumeFeedEvent))
+	}()
+	go func() {
+		_ = mentionCg.Consume(context.Background(),
+			[]string{topicMentionEvent},
+			saramax.NewHandler[mention.Event](c.l, c.ConsumeMention))
+	}()
+	return nil
+}
+
+func (c *Consumer) ConsumeMention(msg *sarama.ConsumerMessage, evt mention.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return c.svc.Notify(ctx, domain.Notification{
+		Uid:      evt.Mentioned,
+		Type:     domain.NotificationTypeMention,
+		GroupKey: domain.NotificationGroupKey(domain.NotificationTypeMention, evt.Biz, evt.BizId, ""),
+		Biz:      evt.Biz,
+		BizId:    evt.BizId,
+	}, evt.Mentioner)
+}
+
+func (c *Consumer) ConsumeFollow(msg *sarama.ConsumerMessage, evt follow.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return c.svc.Notify(ctx, domain.Notification{
+		Uid:      evt.Followee,
+		Type:     domain.NotificationTypeFollow,
+		GroupKey: domain.NotificationGroupKey(domain.NotificationTypeFollow, "", 0, ""),
+	}, evt.Follower)
+}
+
+func (c *Consumer) ConsumeFeedEvent(msg *sarama.ConsumerMessage, evt feedevent.Event) error {
+	var (
+		typ                   domain.NotificationType
+		uidKey, actorKey, key string
+	)
+	switch evt.Type {
+	case feedevent.TypeLike:
+		typ, uidKey, actorKey = domain.NotificationTypeLike, "liked", "liker"
+	case feedevent.TypeComment:
+		typ, uidKey, actorKey, key = domain.NotificationTypeComment, "replied", "commentator", "cid"
+	case feedevent.TypeReward:
+		typ, uidKey, actorKey, key = domain.NotificationTypeReward, "target", "uid", "rid"
+	default:
+		// 收藏等事件只进 feed，不单独通知
+		return nil
+	}
+	ext := domain.ExtendFields(evt.Ext)
+	uid, err := ext.Get(uidKey).AsInt64()
+	if err != nil {
+		return err
+	}
+	actor, err := ext.Get(actorKey).AsInt64()
+	if err != nil {
+		return err
+	}
+	biz := evt.Ext["biz"]
+	bizId, _ := ext.Get("bizId").AsInt64()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return c.svc.Notify(ctx, domain.Notification{
+		Uid:      uid,
+		Type:     typ,
+		GroupKey: domain.NotificationGroupKey(typ, biz, bizId, evt.Ext[key]),
+		Biz:      biz,
+		BizId:    bizId,
+		Ext:      ext,
+	}, actor)
+}
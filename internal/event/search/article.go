@@ -27,10 +27,11 @@ func NewArticleConsumer(client sarama.Client, l logger.Logger, svc service.SyncS
 }
 
 type ArticleEvent struct {
-	Id      int64  `json:"id"`
-	Title   string `json:"title"`
-	Status  int32  `json:"status"`
-	Content string `json:"content"`
+	Id       int64  `json:"id"`
+	Title    string `json:"title"`
+	Status   int32  `json:"status"`
+	Content  string `json:"content"`
+	AuthorId int64  `json:"author_id"`
 }
 
 func (a *ArticleConsumer) Start() error {
@@ -57,9 +58,10 @@ func (a *ArticleConsumer) Consume(sg *sarama.ConsumerMessage, evt ArticleEvent)
 
 func (a *ArticleConsumer) toDomain(article ArticleEvent) domain.ArticleES {
 	return domain.ArticleES{
-		Id:      article.Id,
-		Title:   article.Title,
-		Status:  article.Status,
-		Content: article.Content,
+		Id:       article.Id,
+		Title:    article.Title,
+		Status:   article.Status,
+		Content:  article.Content,
+		AuthorId: article.AuthorId,
 	}
 }
@@ -0,0 +1,56 @@
+package security
+
+import (
+	"encoding/json"
+
+	"github.com/IBM/sarama"
+)
+
+// topicSecurityAuditEvent 账号安全相关的审计事件，交给下游的风控和审计系统
+const topicSecurityAuditEvent = "security_audit_event"
+
+const (
+	// EventLoginFailed 密码登录失败
+	EventLoginFailed = "login_failed"
+	// EventAccountLocked 失败次数过多，账号被临时锁定
+	EventAccountLocked = "account_locked"
+	// EventAccountUnlocked 通过验证码解锁
+	EventAccountUnlocked = "account_unlocked"
+)
+
+type AuditEvent struct {
+	Type string `json:"type"`
+	// Account 登录时输入的账号，账号不存在时 Uid 为 0
+	Account string `json:"account"`
+	Uid     int64  `json:"uid"`
+	IP      string `json:"ip"`
+	Ctime   int64  `json:"ctime"`
+}
+
+type Producer interface {
+	ProduceAuditEvent(evt AuditEvent) error
+}
+
+type SaramaAuditEventProducer struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+func NewAuditEventProducer(producer sarama.SyncProducer) Producer {
+	return &SaramaAuditEventProducer{
+		producer: producer,
+		topic:    topicSecurityAuditEvent,
+	}
+}
+
+func (p *SaramaAuditEventProducer) ProduceAuditEvent(evt AuditEvent) error {
+	val, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	_, _, err = p.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: p.topic,
+		Value: sarama.StringEncoder(val),
+	})
+	return err
+}
@@ -0,0 +1,60 @@
+package job
+
+import (
+	"archi/internal/service/feed"
+	"archi/pkg/logger"
+	"context"
+	rlock "github.com/gotomicro/redis-lock"
+	"time"
+)
+
+// FeedArchiveJob 定期把超过保留期的 feed 事件搬到归档表
+// 多个实例同时运行时靠分布式锁保证只有一个在搬
+type FeedArchiveJob struct {
+	feedSvc feed.Service
+	logger  logger.Logger
+	timeout time.Duration
+	client  *rlock.Client
+	lockKey string
+}
+
+func NewFeedArchiveJob(svc feed.Service, l logger.Logger, client *rlock.Client, timeout time.Duration) *FeedArchiveJob {
+	return &FeedArchiveJob{
+		feedSvc: svc,
+		logger:  l,
+		timeout: timeout,
+		client:  client,
+		lockKey: "job:feed_archive",
+	}
+}
+
+func (f *FeedArchiveJob) Name() string {
+	return "feed_archive"
+}
+
+func (f *FeedArchiveJob) Run() error {
+	lctx, cancel := context.WithTimeout(context.Background(), time.Second*4)
+	defer cancel()
+	// 不重试，抢不到说明别的实例在搬
+	lock, err := f.client.Lock(lctx, f.lockKey, f.timeout+time.Minute, &rlock.FixIntervalRetry{
+		Interval: time.Millisecond * 100,
+		Max:      0,
+	}, time.Second)
+	if err != nil {
+		f.logger.Debug("获取分布式锁失败，跳过本次归档", logger.Error(err))
+		return nil
+	}
+	defer func() {
+		uctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if er := lock.Unlock(uctx); er != nil {
+			f.logger.Warn("释放分布式锁失败", logger.Error(er))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+	cnt, err := f.feedSvc.Archive(ctx)
+	f.logger.Info("feed 事件归档完成", logger.Int64("count", cnt))
+	return err
+}
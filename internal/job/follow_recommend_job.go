@@ -0,0 +1,60 @@
+package job
+
+import (
+	"archi/internal/service"
+	"archi/pkg/logger"
+	"context"
+	rlock "github.com/gotomicro/redis-lock"
+	"time"
+)
+
+// FollowRecommendJob 定期给全部用户重新计算关注推荐
+// 多个实例同时运行时靠分布式锁保证只有一个在算
+type FollowRecommendJob struct {
+	svc     service.FollowRecommendService
+	logger  logger.Logger
+	timeout time.Duration
+	client  *rlock.Client
+	lockKey string
+}
+
+func NewFollowRecommendJob(svc service.FollowRecommendService, l logger.Logger, client *rlock.Client, timeout time.Duration) *FollowRecommendJob {
+	return &FollowRecommendJob{
+		svc:     svc,
+		logger:  l,
+		timeout: timeout,
+		client:  client,
+		lockKey: "job:follow_recommend",
+	}
+}
+
+func (f *FollowRecommendJob) Name() string {
+	return "follow_recommend"
+}
+
+func (f *FollowRecommendJob) Run() error {
+	lctx, cancel := context.WithTimeout(context.Background(), time.Second*4)
+	defer cancel()
+	// 不重试，抢不到说明别的实例在算
+	lock, err := f.client.Lock(lctx, f.lockKey, f.timeout+time.Minute, &rlock.FixIntervalRetry{
+		Interval: time.Millisecond * 100,
+		Max:      0,
+	}, time.Second)
+	if err != nil {
+		f.logger.Debug("获取分布式锁失败，跳过本次推荐计算", logger.Error(err))
+		return nil
+	}
+	defer func() {
+		uctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if er := lock.Unlock(uctx); er != nil {
+			f.logger.Warn("释放分布式锁失败", logger.Error(er))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+	cnt, err := f.svc.Refresh(ctx)
+	f.logger.Info("关注推荐计算完成", logger.Int64("count", cnt))
+	return err
+}
@@ -3,21 +3,35 @@ package repository
 import (
 	"archi/internal/domain"
 	"archi/internal/repository/cache"
+	"archi/internal/repository/dao"
 	"context"
+	"time"
 )
 
 type AiRepository interface {
 	GetArticleSummary(ctx context.Context, artId int64) (domain.ArticleSummary, error)
 	SetArticleSummary(ctx context.Context, artId int64, summary domain.ArticleSummary) error
+	// RecordResponse 记录一次 AI 响应及其 Prompt 版本
+	RecordResponse(ctx context.Context, r domain.AiResponse) error
+	SavePendingAction(ctx context.Context, action domain.AiPendingAction) error
+	GetPendingAction(ctx context.Context, id string) (domain.AiPendingAction, error)
+	// ConsumePendingAction 删除待确认操作，返回 false 表示已经被其他请求处理过
+	ConsumePendingAction(ctx context.Context, id string) (bool, error)
+	RecordToolAudit(ctx context.Context, a domain.AiToolAudit) error
 }
 
+// pendingActionExpiration 待确认操作的有效期，超时未确认视为放弃
+const pendingActionExpiration = time.Minute * 30
+
 type CachedAiRepository struct {
 	cache cache.AiCache
+	dao   dao.AiDAO
 }
 
-func NewCachedAiRepository(cache cache.AiCache) AiRepository {
+func NewCachedAiRepository(cache cache.AiCache, dao dao.AiDAO) AiRepository {
 	return &CachedAiRepository{
 		cache: cache,
+		dao:   dao,
 	}
 }
 
@@ -28,3 +42,37 @@ func (c *CachedAiRepository) GetArticleSummary(ctx context.Context, artId int64)
 func (c *CachedAiRepository) SetArticleSummary(ctx context.Context, artId int64, summary domain.ArticleSummary) error {
 	return c.cache.SetArticleSummary(ctx, artId, summary)
 }
+
+func (c *CachedAiRepository) RecordResponse(ctx context.Context, r domain.AiResponse) error {
+	return c.dao.InsertResponse(ctx, dao.AiResponse{
+		Scene:         string(r.Scene),
+		PromptVersion: r.PromptVersion,
+		Uid:           r.Uid,
+		BizId:         r.BizId,
+		Duration:      r.Duration.Milliseconds(),
+		Success:       r.Success,
+	})
+}
+
+func (c *CachedAiRepository) SavePendingAction(ctx context.Context, action domain.AiPendingAction) error {
+	return c.cache.SetPendingAction(ctx, action, pendingActionExpiration)
+}
+
+func (c *CachedAiRepository) GetPendingAction(ctx context.Context, id string) (domain.AiPendingAction, error) {
+	return c.cache.GetPendingAction(ctx, id)
+}
+
+func (c *CachedAiRepository) ConsumePendingAction(ctx context.Context, id string) (bool, error) {
+	return c.cache.DelPendingAction(ctx, id)
+}
+
+func (c *CachedAiRepository) RecordToolAudit(ctx context.Context, a domain.AiToolAudit) error {
+	return c.dao.InsertToolAudit(ctx, dao.AiToolAudit{
+		Uid:       a.Uid,
+		ArticleId: a.ArticleID,
+		Tool:      a.Tool,
+		Args:      a.Args,
+		Result:    a.Result,
+		Success:   a.Success,
+	})
+}
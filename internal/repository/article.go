@@ -18,6 +18,8 @@ type ArticleRepository interface {
 	GetByAuthor(ctx context.Context, uid int64, offset int, limit int) ([]domain.Article, error)
 	GetById(ctx context.Context, id int64) (domain.Article, error)
 	GetPubById(ctx context.Context, id int64) (domain.Article, error)
+	// GetPubByIds 批量查询已发表的文章，不包含作者信息，没有发表的文章直接跳过
+	GetPubByIds(ctx context.Context, ids []int64) ([]domain.Article, error)
 	ListPub(ctx context.Context, start time.Time, offset int, limit int) ([]domain.Article, error)
 }
 
@@ -58,6 +60,10 @@ func (c *CachedArticleRepository) Update(ctx context.Context, art domain.Article
 		if er := c.cache.DelFirstPage(ctx, art.Author.ID); er != nil {
 			// 也要记录日志
 		}
+		// 详情缓存里面的 Utime 用来判断 AI 助手的提议是否过期，修改之后必须失效
+		if er := c.cache.Del(ctx, art.ID); er != nil {
+			// 也要记录日志
+		}
 	}
 	return err
 }
@@ -68,11 +74,19 @@ func (c *CachedArticleRepository) Sync(ctx context.Context, art domain.Article)
 		if er := c.cache.DelFirstPage(ctx, art.Author.ID); er != nil {
 			// 也要记录日志
 		}
+		if er := c.cache.Del(ctx, id); er != nil {
+			// 也要记录日志
+		}
 	}
 	// 在这里尝试，设置缓存
 	go func() {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 		defer cancel()
+		// 待审核等非发表状态不能进入线上缓存，否则读者还能看到
+		if art.Status != domain.ArticleStatusPublished {
+			_ = c.cache.Del(ctx, id)
+			return
+		}
 		// 你可以灵活设置过期时间
 		user, er := c.userRepo.FindById(ctx, art.Author.ID)
 		if er != nil {
@@ -97,6 +111,9 @@ func (c *CachedArticleRepository) SyncStatus(ctx context.Context, uid int64, id
 		if er != nil {
 			// 也要记录日志
 		}
+		if er = c.cache.Del(ctx, id); er != nil {
+			// 也要记录日志
+		}
 	}
 	return err
 }
@@ -195,6 +212,18 @@ func (c *CachedArticleRepository) GetPubById(ctx context.Context, id int64) (dom
 	}()
 	return res, nil
 }
+func (c *CachedArticleRepository) GetPubByIds(ctx context.Context, ids []int64) ([]domain.Article, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	arts, err := c.dao.GetPubByIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.PublishedArticle, domain.Article](arts, func(idx int, src dao.PublishedArticle) domain.Article {
+		return c.toDomain(dao.Article(src))
+	}), nil
+}
 func (c *CachedArticleRepository) ListPub(ctx context.Context, start time.Time, offset int, limit int) ([]domain.Article, error) {
 	arts, err := c.dao.ListPub(ctx, start, offset, limit)
 	if err != nil {
@@ -4,18 +4,28 @@ import (
 	"archi/internal/domain"
 	"archi/internal/repository/dao"
 	"context"
+	"time"
+
+	"github.com/ecodeclub/ekit/slice"
 	"github.com/ecodeclub/ekit/sqlx"
 )
 
-var ErrWaitingSMSNotFound = dao.ErrWaitingSMSNotFound
-
-//go:generate mockgen -source=./async_sms_repository.go -package=repomocks -destination=mocks/async_sms_repository.mock.go AsyncSmsRepository
+//go:generate mockgen -source=./async_sms.go -package=repomocks -destination=./mocks/async_sms.mock.go AsyncSMSRepository
 type AsyncSMSRepository interface {
 	// Add 添加一个异步 SMS 记录。
 	// 你叫做 Create 或者 Insert 也可以
 	Add(ctx context.Context, s domain.AsyncSMS) error
-	PreemptWaitingSMS(ctx context.Context) (domain.AsyncSMS, error)
-	ReportScheduleResult(ctx context.Context, id int64, success bool) error
+	// PreemptBatch 批量抢占到期的短信，lease 之内不会被别的实例重复抢占
+	PreemptBatch(ctx context.Context, limit int, lease time.Duration) ([]domain.AsyncSMS, error)
+	MarkSuccess(ctx context.Context, id int64) error
+	// MarkRetry 发送失败，等到 nextRetryAt 再重试
+	MarkRetry(ctx context.Context, id int64, nextRetryAt time.Time, reason string) error
+	// MarkDead 重试次数用完，进入死信
+	MarkDead(ctx context.Context, id int64, reason string) error
+	// FindDead 按 id 倒序分页查询死信
+	FindDead(ctx context.Context, maxId int64, limit int) ([]domain.AsyncSMS, error)
+	// Requeue 死信重新入队，返回 false 说明这条短信不在死信里面
+	Requeue(ctx context.Context, id int64) (bool, error)
 }
 type DefaultAsyncSMSRepository struct {
 	dao dao.AsyncSMSDAO
@@ -40,23 +50,53 @@ func (a *DefaultAsyncSMSRepository) Add(ctx context.Context, s domain.AsyncSMS)
 	})
 }
 
-func (a *DefaultAsyncSMSRepository) PreemptWaitingSMS(ctx context.Context) (domain.AsyncSMS, error) {
-	as, err := a.dao.GetWaitingSMS(ctx)
+func (a *DefaultAsyncSMSRepository) PreemptBatch(ctx context.Context, limit int, lease time.Duration) ([]domain.AsyncSMS, error) {
+	res, err := a.dao.PreemptBatch(ctx, limit, lease)
 	if err != nil {
-		return domain.AsyncSMS{}, err
+		return nil, err
 	}
-	return domain.AsyncSMS{
-		ID:       as.ID,
-		TplId:    as.Config.Val.TplId,
-		Numbers:  as.Config.Val.Numbers,
-		Args:     as.Config.Val.Args,
-		RetryMax: as.RetryMax,
-	}, nil
+	return slice.Map(res, func(idx int, src dao.AsyncSMS) domain.AsyncSMS {
+		return a.toDomain(src)
+	}), nil
+}
+
+func (a *DefaultAsyncSMSRepository) MarkSuccess(ctx context.Context, id int64) error {
+	return a.dao.MarkSuccess(ctx, id)
+}
+
+func (a *DefaultAsyncSMSRepository) MarkRetry(ctx context.Context, id int64, nextRetryAt time.Time, reason string) error {
+	return a.dao.MarkRetry(ctx, id, nextRetryAt.UnixMilli(), reason)
+}
+
+func (a *DefaultAsyncSMSRepository) MarkDead(ctx context.Context, id int64, reason string) error {
+	return a.dao.MarkDead(ctx, id, reason)
+}
+
+func (a *DefaultAsyncSMSRepository) FindDead(ctx context.Context, maxId int64, limit int) ([]domain.AsyncSMS, error) {
+	res, err := a.dao.FindDead(ctx, maxId, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(res, func(idx int, src dao.AsyncSMS) domain.AsyncSMS {
+		return a.toDomain(src)
+	}), nil
+}
+
+func (a *DefaultAsyncSMSRepository) Requeue(ctx context.Context, id int64) (bool, error) {
+	return a.dao.Requeue(ctx, id)
 }
 
-func (a *DefaultAsyncSMSRepository) ReportScheduleResult(ctx context.Context, id int64, success bool) error {
-	if success {
-		return a.dao.MarkSuccess(ctx, id)
+func (a *DefaultAsyncSMSRepository) toDomain(as dao.AsyncSMS) domain.AsyncSMS {
+	return domain.AsyncSMS{
+		ID:          as.ID,
+		TplId:       as.Config.Val.TplId,
+		Numbers:     as.Config.Val.Numbers,
+		Args:        as.Config.Val.Args,
+		RetryCnt:    as.RetryCnt,
+		RetryMax:    as.RetryMax,
+		LastErr:     as.LastErr,
+		NextRetryAt: time.UnixMilli(as.NextRetryAt),
+		Ctime:       time.UnixMilli(as.Ctime),
+		Utime:       time.UnixMilli(as.Utime),
 	}
-	return a.dao.MarkFailed(ctx, id)
 }
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"archi/internal/domain"
+	"archi/internal/repository/cache"
+	"archi/internal/repository/dao"
+	"archi/pkg/logger"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ecodeclub/ekit/slice"
+)
+
+type BlockRepository interface {
+	Add(ctx context.Context, r domain.BlockRelation) error
+	Remove(ctx context.Context, r domain.BlockRelation) error
+	// List 按关系 ID 倒序分页，cursor 为上一页最后一条关系的 ID，第一页传 0
+	List(ctx context.Context, uid int64, typ domain.BlockType, cursor, limit int64) ([]domain.BlockRelation, error)
+	// IsBlocked a 和 b 之间是否有任意一方拉黑了另一方
+	IsBlocked(ctx context.Context, a, b int64) (bool, error)
+	// HiddenUids uid 看不到的用户：自己拉黑的、静音的，以及拉黑了自己的
+	HiddenUids(ctx context.Context, uid int64) ([]int64, error)
+}
+
+type CachedBlockRepository struct {
+	dao   dao.BlockRelationDAO
+	cache cache.BlockCache
+	l     logger.Logger
+}
+
+func NewCachedBlockRepository(dao dao.BlockRelationDAO, cache cache.BlockCache, l logger.Logger) BlockRepository {
+	return &CachedBlockRepository{
+		dao:   dao,
+		cache: cache,
+		l:     l,
+	}
+}
+
+func (repo *CachedBlockRepository) Add(ctx context.Context, r domain.BlockRelation) error {
+	err := repo.dao.Upsert(ctx, dao.BlockRelation{
+		Uid:    r.Uid,
+		Target: r.Target,
+		Type:   r.Type.ToUint8(),
+	})
+	if err != nil {
+		return err
+	}
+	repo.invalidate(ctx, r)
+	return nil
+}
+
+func (repo *CachedBlockRepository) Remove(ctx context.Context, r domain.BlockRelation) error {
+	err := repo.dao.Delete(ctx, r.Uid, r.Target, r.Type.ToUint8())
+	if err != nil {
+		return err
+	}
+	repo.invalidate(ctx, r)
+	return nil
+}
+
+// invalidate 静音只影响自己，拉黑对双方都有影响
+func (repo *CachedBlockRepository) invalidate(ctx context.Context, r domain.BlockRelation) {
+	uids := []int64{r.Uid}
+	if r.Type == domain.BlockTypeBlock {
+		uids = append(uids, r.Target)
+	}
+	if err := repo.cache.DelHidden(ctx, uids...); err != nil {
+		repo.l.Error("删除不可见用户缓存失败",
+			logger.Error(err),
+			logger.Int64("uid", r.Uid),
+			logger.Int64("target", r.Target))
+	}
+}
+
+func (repo *CachedBlockRepository) List(ctx context.Context, uid int64, typ domain.BlockType, cursor, limit int64) ([]domain.BlockRelation, error) {
+	rs, err := repo.dao.List(ctx, uid, typ.ToUint8(), cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(rs, func(idx int, src dao.BlockRelation) domain.BlockRelation {
+		return repo.toDomain(src)
+	}), nil
+}
+
+func (repo *CachedBlockRepository) IsBlocked(ctx context.Context, a, b int64) (bool, error) {
+	return repo.dao.ExistsEither(ctx, a, b, domain.BlockTypeBlock.ToUint8())
+}
+
+func (repo *CachedBlockRepository) HiddenUids(ctx context.Context, uid int64) ([]int64, error) {
+	res, err := repo.cache.GetHidden(ctx, uid)
+	if err == nil {
+		return res, nil
+	}
+	if !errors.Is(err, cache.ErrBlockHiddenNotFound) {
+		repo.l.Error("查询不可见用户缓存失败", logger.Error(err), logger.Int64("uid", uid))
+	}
+	targets, err := repo.dao.FindTargets(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	blockers, err := repo.dao.FindSources(ctx, uid, domain.BlockTypeBlock.ToUint8())
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[int64]struct{}, len(targets)+len(blockers))
+	res = make([]int64, 0, len(targets)+len(blockers))
+	for _, id := range append(slice.Map(targets, func(idx int, src dao.BlockRelation) int64 {
+		return src.Target
+	}), blockers...) {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		res = append(res, id)
+	}
+	if err = repo.cache.SetHidden(ctx, uid, res); err != nil {
+		repo.l.Error("缓存不可见用户失败", logger.Error(err), logger.Int64("uid", uid))
+	}
+	return res, nil
+}
+
+func (repo *CachedBlockRepository) toDomain(r dao.BlockRelation) domain.BlockRelation {
+	return domain.BlockRelation{
+		ID:     r.ID,
+		Uid:    r.Uid,
+		Target: r.Target,
+		Type:   domain.BlockType(r.Type),
+		Ctime:  time.UnixMilli(r.Ctime),
+	}
+}
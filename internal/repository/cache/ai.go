@@ -12,6 +12,10 @@ import (
 type AiCache interface {
 	GetArticleSummary(ctx context.Context, artId int64) (domain.ArticleSummary, error)
 	SetArticleSummary(ctx context.Context, artId int64, summary domain.ArticleSummary) error
+	SetPendingAction(ctx context.Context, action domain.AiPendingAction, expiration time.Duration) error
+	GetPendingAction(ctx context.Context, id string) (domain.AiPendingAction, error)
+	// DelPendingAction 返回 true 表示本次调用真正删除了 key，用于保证操作只被确认一次
+	DelPendingAction(ctx context.Context, id string) (bool, error)
 }
 
 type RedisAiCache struct {
@@ -48,3 +52,30 @@ func (r *RedisAiCache) SetArticleSummary(ctx context.Context, artId int64, summa
 func (r *RedisAiCache) summaryKey(artId int64) string {
 	return fmt.Sprintf("ai:article_summary:%d", artId)
 }
+
+func (r *RedisAiCache) SetPendingAction(ctx context.Context, action domain.AiPendingAction, expiration time.Duration) error {
+	val, err := json.Marshal(action)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, r.pendingActionKey(action.ID), val, expiration).Err()
+}
+
+func (r *RedisAiCache) GetPendingAction(ctx context.Context, id string) (domain.AiPendingAction, error) {
+	val, err := r.client.Get(ctx, r.pendingActionKey(id)).Bytes()
+	if err != nil {
+		return domain.AiPendingAction{}, err
+	}
+	var res domain.AiPendingAction
+	err = json.Unmarshal(val, &res)
+	return res, err
+}
+
+func (r *RedisAiCache) DelPendingAction(ctx context.Context, id string) (bool, error) {
+	cnt, err := r.client.Del(ctx, r.pendingActionKey(id)).Result()
+	return cnt > 0, err
+}
+
+func (r *RedisAiCache) pendingActionKey(id string) string {
+	return fmt.Sprintf("ai:pending_action:%s", id)
+}
@@ -18,6 +18,8 @@ type ArticleCache interface {
 	Set(ctx context.Context, art domain.Article) error
 	GetPub(ctx context.Context, id int64) (domain.Article, error)
 	SetPub(ctx context.Context, res domain.Article) error
+	// Del 删除文章详情和线上库详情缓存，文章状态变更时使用
+	Del(ctx context.Context, id int64) error
 }
 
 type RedisArticleCache struct {
@@ -101,6 +103,10 @@ func (r *RedisArticleCache) SetPub(ctx context.Context, art domain.Article) erro
 	return r.client.Set(ctx, r.pubKey(art.ID), val, time.Minute*10).Err()
 }
 
+func (r *RedisArticleCache) Del(ctx context.Context, id int64) error {
+	return r.client.Del(ctx, r.key(id), r.pubKey(id)).Err()
+}
+
 func (r *RedisArticleCache) pubKey(id int64) string {
 	return fmt.Sprintf("article:pub:detail:%d", id)
 }
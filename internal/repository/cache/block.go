@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+const blockHiddenExpiration = 30 * time.Minute
+
+// ErrBlockHiddenNotFound 不可见用户列表没有缓存
+var ErrBlockHiddenNotFound = redis.Nil
+
+type BlockCache interface {
+	// GetHidden uid 看不到的全部用户
+	GetHidden(ctx context.Context, uid int64) ([]int64, error)
+	SetHidden(ctx context.Context, uid int64, uids []int64) error
+	// DelHidden 拉黑或者静音关系变化之后，相关用户的缓存失效
+	DelHidden(ctx context.Context, uids ...int64) error
+}
+
+type RedisBlockCache struct {
+	client redis.Cmdable
+}
+
+func NewRedisBlockCache(client redis.Cmdable) BlockCache {
+	return &RedisBlockCache{
+		client: client,
+	}
+}
+
+func (r *RedisBlockCache) GetHidden(ctx context.Context, uid int64) ([]int64, error) {
+	val, err := r.client.Get(ctx, r.hiddenKey(uid)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrBlockHiddenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var res []int64
+	err = json.Unmarshal(val, &res)
+	return res, err
+}
+
+func (r *RedisBlockCache) SetHidden(ctx context.Context, uid int64, uids []int64) error {
+	// 没有拉黑任何人的时候也缓存空数组，避免每次刷 feed 都回源
+	if uids == nil {
+		uids = []int64{}
+	}
+	val, err := json.Marshal(uids)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, r.hiddenKey(uid), val, blockHiddenExpiration).Err()
+}
+
+func (r *RedisBlockCache) DelHidden(ctx context.Context, uids ...int64) error {
+	keys := make([]string, 0, len(uids))
+	for _, uid := range uids {
+		keys = append(keys, r.hiddenKey(uid))
+	}
+	return r.client.Del(ctx, keys...).Err()
+}
+
+func (r *RedisBlockCache) hiddenKey(uid int64) string {
+	return fmt.Sprintf("block:hidden:%d", uid)
+}
@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CaptchaCache 图形验证码通过之后的凭证，以及触发图形验证码的失败计数
+type CaptchaCache interface {
+	// SetToken 保存通过图形验证码之后签发的一次性凭证
+	SetToken(ctx context.Context, token string, expiration time.Duration) error
+	// ConsumeToken 使用凭证，凭证不存在或者已经被使用过时返回 false
+	ConsumeToken(ctx context.Context, token string) (bool, error)
+	// IncrFailure 失败次数加一，计数在 window 之后过期
+	IncrFailure(ctx context.Context, scene string, subjects []string, window time.Duration) error
+	// Failures 每个主体当前的失败次数
+	Failures(ctx context.Context, scene string, subjects []string) ([]int64, error)
+	ResetFailures(ctx context.Context, scene string, subjects []string) error
+}
+
+type RedisCaptchaCache struct {
+	client redis.Cmdable
+}
+
+func NewRedisCaptchaCache(client redis.Cmdable) CaptchaCache {
+	return &RedisCaptchaCache{
+		client: client,
+	}
+}
+
+func (c *RedisCaptchaCache) SetToken(ctx context.Context, token string, expiration time.Duration) error {
+	return c.client.Set(ctx, c.tokenKey(token), 1, expiration).Err()
+}
+
+func (c *RedisCaptchaCache) ConsumeToken(ctx context.Context, token string) (bool, error) {
+	// 用 DEL 的返回值判断，并发使用同一个凭证只会有一个成功
+	n, err := c.client.Del(ctx, c.tokenKey(token)).Result()
+	return n > 0, err
+}
+
+func (c *RedisCaptchaCache) IncrFailure(ctx context.Context, scene string, subjects []string, window time.Duration) error {
+	pipe := c.client.Pipeline()
+	for _, sub := range subjects {
+		key := c.failureKey(scene, sub)
+		pipe.Incr(ctx, key)
+		// 只在第一次失败的时候设置过期时间，窗口从第一次失败开始算
+		pipe.ExpireNX(ctx, key, window)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *RedisCaptchaCache) Failures(ctx context.Context, scene string, subjects []string) ([]int64, error) {
+	if len(subjects) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(subjects))
+	for _, sub := range subjects {
+		keys = append(keys, c.failureKey(scene, sub))
+	}
+	vals, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	res := make([]int64, len(vals))
+	for i, val := range vals {
+		// 不存在的 key 是 nil
+		if s, ok := val.(string); ok {
+			_, _ = fmt.Sscan(s, &res[i])
+		}
+	}
+	return res, nil
+}
+
+func (c *RedisCaptchaCache) ResetFailures(ctx context.Context, scene string, subjects []string) error {
+	if len(subjects) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(subjects))
+	for _, sub := range subjects {
+		keys = append(keys, c.failureKey(scene, sub))
+	}
+	return c.client.Del(ctx, keys...).Err()
+}
+
+func (c *RedisCaptchaCache) tokenKey(token string) string {
+	return fmt.Sprintf("captcha:token:%s", token)
+}
+
+func (c *RedisCaptchaCache) failureKey(scene, subject string) string {
+	return fmt.Sprintf("captcha:failure:%s:%s", scene, subject)
+}
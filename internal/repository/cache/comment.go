@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"archi/internal/domain"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+const (
+	// CommentFirstPageSize 每个业务对象缓存的第一页一级评论数量，不包括置顶评论
+	CommentFirstPageSize  = 50
+	commentPageExpiration = 10 * time.Minute
+)
+
+// ErrCommentPageNotFound 第一页没有缓存
+var ErrCommentPageNotFound = redis.Nil
+
+type CommentCache interface {
+	// GetFirstPage 第一页评论，置顶评论在最前面，每条一级评论带着回复预览和回复数
+	GetFirstPage(ctx context.Context, biz string, bizId int64, sort domain.CommentSort) ([]domain.Comment, error)
+	SetFirstPage(ctx context.Context, biz string, bizId int64, sort domain.CommentSort, comments []domain.Comment) error
+	// DelFirstPage 删除所有排序方式下的第一页，业务对象下任意评论变化时调用
+	DelFirstPage(ctx context.Context, biz string, bizId int64) error
+}
+
+type RedisCommentCache struct {
+	client redis.Cmdable
+}
+
+func NewRedisCommentCache(client redis.Cmdable) CommentCache {
+	return &RedisCommentCache{
+		client: client,
+	}
+}
+
+func (r *RedisCommentCache) GetFirstPage(ctx context.Context, biz string, bizId int64, sort domain.CommentSort) ([]domain.Comment, error) {
+	val, err := r.client.Get(ctx, r.firstPageKey(biz, bizId, sort)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var res []domain.Comment
+	err = json.Unmarshal(val, &res)
+	return res, err
+}
+
+func (r *RedisCommentCache) SetFirstPage(ctx context.Context, biz string, bizId int64, sort domain.CommentSort, comments []domain.Comment) error {
+	val, err := json.Marshal(comments)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, r.firstPageKey(biz, bizId, sort), val, commentPageExpiration).Err()
+}
+
+func (r *RedisCommentCache) DelFirstPage(ctx context.Context, biz string, bizId int64) error {
+	return r.client.Del(ctx,
+		r.firstPageKey(biz, bizId, domain.CommentSortNew),
+		r.firstPageKey(biz, bizId, domain.CommentSortHot)).Err()
+}
+
+func (r *RedisCommentCache) firstPageKey(biz string, bizId int64, sort domain.CommentSort) string {
+	return fmt.Sprintf("comment:first_page:%s:%d:%s", biz, bizId, sort)
+}
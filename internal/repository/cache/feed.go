@@ -1,21 +1,57 @@
 package cache
 
 import (
+	"archi/internal/domain"
 	"context"
+	_ "embed"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/redis/go-redis/v9"
+	"sort"
+	"strconv"
 	"time"
 )
 
+var (
+	//go:embed lua/feed_inbox_add.lua
+	luaFeedInboxAdd string
+)
+
 const FolloweeKeyExpiration = 10 * time.Minute
 
+const (
+	// FeedInboxSize 每个用户每种事件的收件箱最多缓存的事件数量
+	FeedInboxSize       = 500
+	feedInboxExpiration = 30 * time.Minute
+)
+
+// feedActiveUsersKey 最近活跃的用户，score 是最后一次活跃的时间戳，推模型只推给这些用户
+const feedActiveUsersKey = "feed_active_users"
+
 var FolloweesNotFound = redis.Nil
 
+// ErrFeedInboxNotFound 收件箱没有缓存
+var ErrFeedInboxNotFound = redis.Nil
+
 type FeedEventCache interface {
 	SetFollowees(ctx context.Context, follower int64, followees []int64) error
 	GetFollowees(ctx context.Context, follower int64) ([]int64, error)
+	DelFollowees(ctx context.Context, follower int64) error
+
+	// AppendInbox 把推事件追加到对应用户的收件箱，收件箱没有缓存时直接忽略
+	AppendInbox(ctx context.Context, events []domain.FeedEvent) error
+	// SetInbox 使用最新的事件重建收件箱，events 最多 FeedInboxSize 条
+	SetInbox(ctx context.Context, uid int64, typ string, events []domain.FeedEvent) error
+	// GetInbox 返回游标之后的事件，complete 为 false 说明缓存中的数据不足以覆盖本次查询
+	GetInbox(ctx context.Context, uid int64, typ string, cursor domain.FeedCursor, limit int64) (events []domain.FeedEvent, complete bool, err error)
+	// DelInbox 收件箱中的事件被删除之后，整个收件箱失效，下次查询从数据库重建
+	DelInbox(ctx context.Context, uid int64, typ string) error
+
+	// MarkActive 记录用户最近一次活跃的时间，并清理 expireBefore 之前的记录
+	MarkActive(ctx context.Context, uid int64, at, expireBefore time.Time) error
+	// FilterActive 过滤出 since 之后活跃过的用户
+	FilterActive(ctx context.Context, uids []int64, since time.Time) ([]int64, error)
 }
 
 type feedEventCache struct {
@@ -43,6 +79,9 @@ func (f *feedEventCache) GetFollowees(ctx context.Context, follower int64) ([]in
 	if errors.Is(err, redis.Nil) {
 		return nil, FolloweesNotFound
 	}
+	if err != nil {
+		return nil, err
+	}
 	var followees []int64
 	err = json.Unmarshal([]byte(res), &followees)
 	if err != nil {
@@ -51,6 +90,144 @@ func (f *feedEventCache) GetFollowees(ctx context.Context, follower int64) ([]in
 	return followees, nil
 }
 
+func (f *feedEventCache) DelFollowees(ctx context.Context, follower int64) error {
+	return f.client.Del(ctx, f.getFolloweeKey(follower)).Err()
+}
+
+func (f *feedEventCache) AppendInbox(ctx context.Context, events []domain.FeedEvent) error {
+	type inboxKey struct {
+		uid int64
+		typ string
+	}
+	groups := make(map[inboxKey][]any)
+	for _, evt := range events {
+		member, err := json.Marshal(evt)
+		if err != nil {
+			return err
+		}
+		k := inboxKey{uid: evt.Uid, typ: evt.Type}
+		groups[k] = append(groups[k], evt.Ctime.UnixMilli(), member)
+	}
+	pipe := f.client.Pipeline()
+	for k, members := range groups {
+		args := append([]any{FeedInboxSize, int(feedInboxExpiration.Seconds())}, members...)
+		pipe.Eval(ctx, luaFeedInboxAdd, []string{f.getInboxKey(k.uid, k.typ)}, args...)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (f *feedEventCache) SetInbox(ctx context.Context, uid int64, typ string, events []domain.FeedEvent) error {
+	key := f.getInboxKey(uid, typ)
+	members := make([]redis.Z, 0, len(events))
+	for _, evt := range events {
+		member, err := json.Marshal(evt)
+		if err != nil {
+			return err
+		}
+		members = append(members, redis.Z{Score: float64(evt.Ctime.UnixMilli()), Member: member})
+	}
+	pipe := f.client.TxPipeline()
+	pipe.Del(ctx, key)
+	// 没有事件的时候不创建 key，下次查询还是会回源
+	if len(members) > 0 {
+		pipe.ZAdd(ctx, key, members...)
+		pipe.Expire(ctx, key, feedInboxExpiration)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (f *feedEventCache) GetInbox(ctx context.Context, uid int64, typ string,
+	cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, bool, error) {
+	key := f.getInboxKey(uid, typ)
+	pipe := f.client.Pipeline()
+	cardCmd := pipe.ZCard(ctx, key)
+	var cmds []*redis.StringSliceCmd
+	if cursor.IsZero() {
+		cmds = append(cmds, pipe.ZRevRange(ctx, key, 0, limit-1))
+	} else {
+		ctime := strconv.FormatInt(cursor.Ctime, 10)
+		// 和游标同一毫秒的事件需要再按 EventId 过滤，score 相同的成员在 Redis 里面按 member 排序，不是按 EventId
+		cmds = append(cmds,
+			pipe.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: ctime, Max: ctime}),
+			pipe.ZRevRangeByScore(ctx, key, &redis.ZRangeBy{
+				Max:   "(" + ctime,
+				Min:   "-inf",
+				Count: limit,
+			}))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, false, err
+	}
+	card := cardCmd.Val()
+	if card == 0 {
+		return nil, false, ErrFeedInboxNotFound
+	}
+
+	res := make([]domain.FeedEvent, 0, limit)
+	for _, cmd := range cmds {
+		for _, member := range cmd.Val() {
+			var evt domain.FeedEvent
+			if err := json.Unmarshal([]byte(member), &evt); err != nil {
+				return nil, false, err
+			}
+			if cursor.Precedes(evt) {
+				res = append(res, evt)
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Before(res[j])
+	})
+	if int64(len(res)) > limit {
+		res = res[:limit]
+	}
+	// 缓存没有被截断过，说明已经是这个用户的全部事件
+	complete := int64(len(res)) == limit || card < FeedInboxSize
+	return res, complete, nil
+}
+
+func (f *feedEventCache) DelInbox(ctx context.Context, uid int64, typ string) error {
+	return f.client.Del(ctx, f.getInboxKey(uid, typ)).Err()
+}
+
+func (f *feedEventCache) MarkActive(ctx context.Context, uid int64, at, expireBefore time.Time) error {
+	pipe := f.client.TxPipeline()
+	pipe.ZAdd(ctx, feedActiveUsersKey, redis.Z{Score: float64(at.Unix()), Member: uid})
+	pipe.ZRemRangeByScore(ctx, feedActiveUsersKey, "-inf", "("+strconv.FormatInt(expireBefore.Unix(), 10))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (f *feedEventCache) FilterActive(ctx context.Context, uids []int64, since time.Time) ([]int64, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	members := make([]string, 0, len(uids))
+	for _, uid := range uids {
+		members = append(members, strconv.FormatInt(uid, 10))
+	}
+	// 不存在的成员 score 为 0，自然会被过滤掉
+	scores, err := f.client.ZMScore(ctx, feedActiveUsersKey, members...).Result()
+	if err != nil {
+		return nil, err
+	}
+	threshold := float64(since.Unix())
+	res := make([]int64, 0, len(uids))
+	for i, score := range scores {
+		if score >= threshold {
+			res = append(res, uids[i])
+		}
+	}
+	return res, nil
+}
+
 func (f *feedEventCache) getFolloweeKey(follower int64) string {
 	return fmt.Sprintf("feed_event:%d", follower)
 }
+
+func (f *feedEventCache) getInboxKey(uid int64, typ string) string {
+	// score 从秒改成了毫秒，换一个前缀，旧的收件箱等它自然过期
+	return fmt.Sprintf("feed_inbox:v2:%d:%s", uid, typ)
+}
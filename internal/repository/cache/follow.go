@@ -3,9 +3,16 @@ package cache
 import (
 	"archi/internal/domain"
 	"context"
+	_ "embed"
 	"fmt"
 	"github.com/redis/go-redis/v9"
 	"strconv"
+	"time"
+)
+
+var (
+	//go:embed lua/follow_set_update.lua
+	luaFollowSetUpdate string
 )
 
 const (
@@ -17,11 +24,28 @@ const (
 
 var ErrFollowKeyNotExist = redis.Nil
 
+const (
+	// FollowSetMaxSize 关注集合超过这个大小就不缓存了，大 V 的粉丝直接查数据库
+	FollowSetMaxSize    = 5000
+	followSetExpiration = 30 * time.Minute
+	// followSetPlaceholder 占位成员，保证没有关注任何人的时候 key 也存在，不会一直回源
+	followSetPlaceholder = 0
+)
+
 type FollowCache interface {
 	StaticsInfo(ctx context.Context, uid int64) (domain.FollowStatics, error)
 	SetStaticsInfo(ctx context.Context, uid int64, statics domain.FollowStatics) error
 	Follow(ctx context.Context, follower, followee int64) error
 	CancelFollow(ctx context.Context, follower, followee int64) error
+
+	// SetFollowees 缓存 follower 关注的全部用户
+	SetFollowees(ctx context.Context, follower int64, followees []int64) error
+	// SetFollowers 缓存 followee 的全部粉丝
+	SetFollowers(ctx context.Context, followee int64, followers []int64) error
+	// IsFollowing 判断 follower 是否关注了 followees 里面的每一个人，没有缓存时返回 ErrFollowKeyNotExist
+	IsFollowing(ctx context.Context, follower int64, followees []int64) ([]bool, error)
+	// IsFollowedBy 判断 followers 里面的每一个人是否关注了 followee，没有缓存时返回 ErrFollowKeyNotExist
+	IsFollowedBy(ctx context.Context, followee int64, followers []int64) ([]bool, error)
 }
 type RedisFollowCache struct {
 	client redis.Cmdable
@@ -68,9 +92,70 @@ func (r *RedisFollowCache) updateStaticsInfo(ctx context.Context, follower, foll
 	tx.HIncrBy(ctx, r.staticsKey(follower), fieldFolloweeCnt, delta)
 	// 增加 followee 被多少人关注的数量
 	tx.HIncrBy(ctx, r.staticsKey(followee), fieldFollowerCnt, delta)
+	// 同步更新两边已经缓存的关注集合
+	tx.Eval(ctx, luaFollowSetUpdate, []string{r.followeesKey(follower), r.followersKey(followee)},
+		delta, followee, follower)
+	_, err := tx.Exec(ctx)
+	return err
+}
+
+func (r *RedisFollowCache) SetFollowees(ctx context.Context, follower int64, followees []int64) error {
+	return r.setMembers(ctx, r.followeesKey(follower), followees)
+}
+
+func (r *RedisFollowCache) SetFollowers(ctx context.Context, followee int64, followers []int64) error {
+	return r.setMembers(ctx, r.followersKey(followee), followers)
+}
+
+func (r *RedisFollowCache) setMembers(ctx context.Context, key string, uids []int64) error {
+	members := make([]any, 0, len(uids)+1)
+	members = append(members, followSetPlaceholder)
+	for _, uid := range uids {
+		members = append(members, uid)
+	}
+	tx := r.client.TxPipeline()
+	tx.Del(ctx, key)
+	tx.SAdd(ctx, key, members...)
+	tx.Expire(ctx, key, followSetExpiration)
 	_, err := tx.Exec(ctx)
 	return err
 }
+
+func (r *RedisFollowCache) IsFollowing(ctx context.Context, follower int64, followees []int64) ([]bool, error) {
+	return r.isMembers(ctx, r.followeesKey(follower), followees)
+}
+
+func (r *RedisFollowCache) IsFollowedBy(ctx context.Context, followee int64, followers []int64) ([]bool, error) {
+	return r.isMembers(ctx, r.followersKey(followee), followers)
+}
+
+func (r *RedisFollowCache) isMembers(ctx context.Context, key string, uids []int64) ([]bool, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	members := make([]any, 0, len(uids))
+	for _, uid := range uids {
+		members = append(members, uid)
+	}
+	pipe := r.client.Pipeline()
+	existsCmd := pipe.Exists(ctx, key)
+	memberCmd := pipe.SMIsMember(ctx, key, members...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	if existsCmd.Val() == 0 {
+		return nil, ErrFollowKeyNotExist
+	}
+	return memberCmd.Val(), nil
+}
+
+func (r *RedisFollowCache) followeesKey(uid int64) string {
+	return fmt.Sprintf("follow:followees:%d", uid)
+}
+
+func (r *RedisFollowCache) followersKey(uid int64) string {
+	return fmt.Sprintf("follow:followers:%d", uid)
+}
 func (r *RedisFollowCache) staticsKey(uid int64) string {
 	return fmt.Sprintf("follow:statics:%d", uid)
 }
@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"archi/internal/domain"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+const (
+	// followRecommendExpiration 比任务的执行间隔长，任务失败一两次也还有数据
+	followRecommendExpiration = 48 * time.Hour
+	// followRecommendDismissExpiration 不感兴趣的人一段时间内都不再推荐
+	followRecommendDismissExpiration = 30 * 24 * time.Hour
+	// followRecommendRefreshCursorKey 定时任务的断点，超时之后下一次从这里继续
+	followRecommendRefreshCursorKey = "follow:recommend:refresh_cursor"
+)
+
+// ErrFollowRecommendNotFound 还没有计算过推荐
+var ErrFollowRecommendNotFound = redis.Nil
+
+type FollowRecommendCache interface {
+	Get(ctx context.Context, uid int64) ([]domain.FollowRecommendation, error)
+	// Set 整体替换，recs 需要已经按分数倒序排好
+	Set(ctx context.Context, uid int64, recs []domain.FollowRecommendation) error
+	// Dismiss 标记不感兴趣
+	Dismiss(ctx context.Context, uid, target int64) error
+	// Dismissed 全部不感兴趣的人
+	Dismissed(ctx context.Context, uid int64) ([]int64, error)
+	// GetRefreshCursor 定时任务上一次处理到的用户 id，没有记录返回 0
+	GetRefreshCursor(ctx context.Context) (int64, error)
+	SetRefreshCursor(ctx context.Context, uid int64) error
+}
+
+type RedisFollowRecommendCache struct {
+	client redis.Cmdable
+}
+
+func NewRedisFollowRecommendCache(client redis.Cmdable) FollowRecommendCache {
+	return &RedisFollowRecommendCache{
+		client: client,
+	}
+}
+
+func (r *RedisFollowRecommendCache) Get(ctx context.Context, uid int64) ([]domain.FollowRecommendation, error) {
+	val, err := r.client.Get(ctx, r.key(uid)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrFollowRecommendNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var res []domain.FollowRecommendation
+	err = json.Unmarshal(val, &res)
+	return res, err
+}
+
+func (r *RedisFollowRecommendCache) Set(ctx context.Context, uid int64, recs []domain.FollowRecommendation) error {
+	// 没有推荐结果也要缓存，避免每次请求都重新计算
+	if recs == nil {
+		recs = []domain.FollowRecommendation{}
+	}
+	val, err := json.Marshal(recs)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, r.key(uid), val, followRecommendExpiration).Err()
+}
+
+func (r *RedisFollowRecommendCache) Dismiss(ctx context.Context, uid, target int64) error {
+	key := r.dismissKey(uid)
+	pipe := r.client.TxPipeline()
+	pipe.SAdd(ctx, key, target)
+	pipe.Expire(ctx, key, followRecommendDismissExpiration)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisFollowRecommendCache) Dismissed(ctx context.Context, uid int64) ([]int64, error) {
+	members, err := r.client.SMembers(ctx, r.dismissKey(uid)).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]int64, 0, len(members))
+	for _, m := range members {
+		id, er := strconv.ParseInt(m, 10, 64)
+		if er != nil {
+			continue
+		}
+		res = append(res, id)
+	}
+	return res, nil
+}
+
+func (r *RedisFollowRecommendCache) GetRefreshCursor(ctx context.Context) (int64, error) {
+	uid, err := r.client.Get(ctx, followRecommendRefreshCursorKey).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return uid, err
+}
+
+func (r *RedisFollowRecommendCache) SetRefreshCursor(ctx context.Context, uid int64) error {
+	return r.client.Set(ctx, followRecommendRefreshCursorKey, uid, followRecommendExpiration).Err()
+}
+
+func (r *RedisFollowRecommendCache) key(uid int64) string {
+	return fmt.Sprintf("follow:recommend:%d", uid)
+}
+
+func (r *RedisFollowRecommendCache) dismissKey(uid int64) string {
+	return fmt.Sprintf("follow:recommend:dismissed:%d", uid)
+}
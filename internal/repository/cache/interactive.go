@@ -18,6 +18,7 @@ var (
 const fieldReadCnt = "read_cnt"
 const fieldLikeCnt = "like_cnt"
 const fieldCollectCnt = "collect_cnt"
+const fieldCommentCnt = "comment_cnt"
 
 type InteractiveCache interface {
 	IncrReadCntIfPresent(ctx context.Context, biz string, bizId int64) error
@@ -25,6 +26,8 @@ type InteractiveCache interface {
 	DecrLikeCntIfPresent(ctx context.Context, biz string, id int64) error
 	IncrCollectCntIfPresent(ctx context.Context, biz string, id int64) error
 	DecrCollectCntIfPresent(ctx context.Context, biz string, id int64) error
+	// IncrCommentCntIfPresent 删除子树的时候一次会减少多条，所以需要传入 delta
+	IncrCommentCntIfPresent(ctx context.Context, biz string, id int64, delta int64) error
 	Get(ctx context.Context, biz string, id int64) (domain.Interactive, error)
 	Set(ctx context.Context, biz string, bizId int64, res domain.Interactive) error
 }
@@ -61,6 +64,10 @@ func (i *RedisInteractiveCache) DecrCollectCntIfPresent(ctx context.Context, biz
 	key := i.key(biz, id)
 	return i.client.Eval(ctx, luaIncrCnt, []string{key}, fieldCollectCnt, -1).Err()
 }
+func (i *RedisInteractiveCache) IncrCommentCntIfPresent(ctx context.Context, biz string, id int64, delta int64) error {
+	key := i.key(biz, id)
+	return i.client.Eval(ctx, luaIncrCnt, []string{key}, fieldCommentCnt, delta).Err()
+}
 func (i *RedisInteractiveCache) Get(ctx context.Context, biz string, id int64) (domain.Interactive, error) {
 	key := i.key(biz, id)
 	res, err := i.client.HGetAll(ctx, key).Result()
@@ -75,6 +82,7 @@ func (i *RedisInteractiveCache) Get(ctx context.Context, biz string, id int64) (
 	intr.CollectCnt, _ = strconv.ParseInt(res[fieldCollectCnt], 10, 64)
 	intr.LikeCnt, _ = strconv.ParseInt(res[fieldLikeCnt], 10, 64)
 	intr.ReadCnt, _ = strconv.ParseInt(res[fieldReadCnt], 10, 64)
+	intr.CommentCnt, _ = strconv.ParseInt(res[fieldCommentCnt], 10, 64)
 	return intr, nil
 }
 func (i *RedisInteractiveCache) Set(ctx context.Context, biz string, bizId int64, res domain.Interactive) error {
@@ -83,6 +91,7 @@ func (i *RedisInteractiveCache) Set(ctx context.Context, biz string, bizId int64
 		fieldCollectCnt, res.CollectCnt,
 		fieldReadCnt, res.ReadCnt,
 		fieldLikeCnt, res.LikeCnt,
+		fieldCommentCnt, res.CommentCnt,
 	).Err()
 	if err != nil {
 		return err
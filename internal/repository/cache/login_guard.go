@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LoginGuardStatus 账号锁定剩余的时间，以及账号和 IP 下一次可以尝试还要等多久，都为 0 说明可以登录
+type LoginGuardStatus struct {
+	Locked      time.Duration
+	AccountWait time.Duration
+	IPWait      time.Duration
+}
+
+// LoginGuardCache 密码登录的失败计数、退避与锁定
+// 计数按登录时输入的账号统计，不管账号存不存在，避免通过计数判断账号是否注册过
+type LoginGuardCache interface {
+	Status(ctx context.Context, account, ip string) (LoginGuardStatus, error)
+	// RecordFailure 失败次数加一，返回窗口内账号与 IP 的失败次数
+	RecordFailure(ctx context.Context, account, ip string, window time.Duration) (int64, int64, error)
+	// Delay 账号和 IP 分别在多久之后才能再次尝试，为 0 的不设置
+	Delay(ctx context.Context, account, ip string, accountDelay, ipDelay time.Duration) error
+	Lock(ctx context.Context, account string, duration time.Duration) error
+	// Reset 清空账号的失败次数、退避与锁定，IP 的保留
+	Reset(ctx context.Context, account string) error
+}
+
+type RedisLoginGuardCache struct {
+	client redis.Cmdable
+}
+
+func NewRedisLoginGuardCache(client redis.Cmdable) LoginGuardCache {
+	return &RedisLoginGuardCache{
+		client: client,
+	}
+}
+
+func (c *RedisLoginGuardCache) Status(ctx context.Context, account, ip string) (LoginGuardStatus, error) {
+	pipe := c.client.Pipeline()
+	locked := pipe.PTTL(ctx, c.lockKey(account))
+	accountWait := pipe.PTTL(ctx, c.delayKey("account", account))
+	ipWait := pipe.PTTL(ctx, c.delayKey("ip", ip))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return LoginGuardStatus{}, err
+	}
+	// key 不存在的时候 PTTL 返回负数
+	return LoginGuardStatus{
+		Locked:      max(locked.Val(), 0),
+		AccountWait: max(accountWait.Val(), 0),
+		IPWait:      max(ipWait.Val(), 0),
+	}, nil
+}
+
+func (c *RedisLoginGuardCache) RecordFailure(ctx context.Context, account, ip string, window time.Duration) (int64, int64, error) {
+	accountKey, ipKey := c.failureKey("account", account), c.failureKey("ip", ip)
+	pipe := c.client.Pipeline()
+	accountCnt := pipe.Incr(ctx, accountKey)
+	pipe.ExpireNX(ctx, accountKey, window)
+	ipCnt := pipe.Incr(ctx, ipKey)
+	pipe.ExpireNX(ctx, ipKey, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, 0, err
+	}
+	return accountCnt.Val(), ipCnt.Val(), nil
+}
+
+func (c *RedisLoginGuardCache) Delay(ctx context.Context, account, ip string, accountDelay, ipDelay time.Duration) error {
+	pipe := c.client.Pipeline()
+	if accountDelay > 0 {
+		pipe.Set(ctx, c.delayKey("account", account), 1, accountDelay)
+	}
+	if ipDelay > 0 {
+		pipe.Set(ctx, c.delayKey("ip", ip), 1, ipDelay)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *RedisLoginGuardCache) Lock(ctx context.Context, account string, duration time.Duration) error {
+	return c.client.Set(ctx, c.lockKey(account), 1, duration).Err()
+}
+
+func (c *RedisLoginGuardCache) Reset(ctx context.Context, account string) error {
+	return c.client.Del(ctx,
+		c.failureKey("account", account),
+		c.delayKey("account", account),
+		c.lockKey(account)).Err()
+}
+
+func (c *RedisLoginGuardCache) failureKey(typ, subject string) string {
+	return fmt.Sprintf("login_guard:failure:%s:%s", typ, subject)
+}
+
+func (c *RedisLoginGuardCache) delayKey(typ, subject string) string {
+	return fmt.Sprintf("login_guard:delay:%s:%s", typ, subject)
+}
+
+func (c *RedisLoginGuardCache) lockKey(account string) string {
+	return fmt.Sprintf("login_guard:lock:%s", account)
+}
@@ -0,0 +1,18 @@
+-- 收件箱存在时才追加事件，避免缓存里只有部分数据
+local key = KEYS[1]
+-- 收件箱最多保留的事件数量
+local size = tonumber(ARGV[1])
+local expiration = tonumber(ARGV[2])
+
+if redis.call("EXISTS", key) == 0 then
+    return 0
+end
+
+-- ARGV[3] 开始每两个参数是一组 score member
+for i = 3, #ARGV, 2 do
+    redis.call("ZADD", key, ARGV[i], ARGV[i + 1])
+end
+-- 只保留最新的 size 条
+redis.call("ZREMRANGEBYRANK", key, 0, -size - 1)
+redis.call("EXPIRE", key, expiration)
+return 1
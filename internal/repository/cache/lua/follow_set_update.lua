@@ -0,0 +1,14 @@
+-- 只更新已经缓存的关注集合，没有缓存的等下次查询的时候整个回源
+-- KEYS[1] follower 的关注集合，KEYS[2] followee 的粉丝集合
+-- ARGV[1] 1 是关注，-1 是取消关注；ARGV[2] followee；ARGV[3] follower
+local delta = tonumber(ARGV[1])
+for i, key in ipairs(KEYS) do
+    if redis.call("EXISTS", key) == 1 then
+        if delta > 0 then
+            redis.call("SADD", key, ARGV[i + 1])
+        else
+            redis.call("SREM", key, ARGV[i + 1])
+        end
+    end
+end
+return 0
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"archi/internal/domain"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// notificationPushChannel 新通知通过 Redis 发布订阅广播到所有实例，
+// 再由持有该用户长连接的实例推给客户端
+const notificationPushChannel = "notification_push"
+
+const notificationUnreadExpiration = time.Hour * 24
+
+var errSubscribeNotSupported = errors.New("redis 客户端不支持发布订阅")
+
+type NotificationCache interface {
+	// IncrUnreadIfPresent 未读计数没有缓存时直接忽略，下次查询从数据库重建
+	IncrUnreadIfPresent(ctx context.Context, uid int64, typ domain.NotificationType, delta int64) error
+	// GetUnread 按类型返回未读数，没有缓存时返回 ErrKeyNotExist
+	GetUnread(ctx context.Context, uid int64) (map[domain.NotificationType]int64, error)
+	SetUnread(ctx context.Context, uid int64, cnts map[domain.NotificationType]int64) error
+	DelUnread(ctx context.Context, uid int64) error
+
+	Publish(ctx context.Context, n domain.Notification) error
+	// Subscribe 订阅所有实例发布的新通知，ctx 取消后停止订阅
+	Subscribe(ctx context.Context) (<-chan domain.Notification, error)
+}
+
+// redisSubscriber Cmdable 里面没有订阅，*redis.Client 和 *redis.ClusterClient 都实现了
+type redisSubscriber interface {
+	Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+}
+
+type RedisNotificationCache struct {
+	client redis.Cmdable
+}
+
+func NewRedisNotificationCache(client redis.Cmdable) NotificationCache {
+	return &RedisNotificationCache{
+		client: client,
+	}
+}
+
+func (r *RedisNotificationCache) IncrUnreadIfPresent(ctx context.Context, uid int64, typ domain.NotificationType, delta int64) error {
+	return r.client.Eval(ctx, luaIncrCnt, []string{r.unreadKey(uid)}, string(typ), delta).Err()
+}
+
+func (r *RedisNotificationCache) GetUnread(ctx context.Context, uid int64) (map[domain.NotificationType]int64, error) {
+	data, err := r.client.HGetAll(ctx, r.unreadKey(uid)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrKeyNotExist
+	}
+	res := make(map[domain.NotificationType]int64, len(data))
+	for typ, val := range data {
+		// 占位字段，保证没有未读的时候 key 也存在
+		if typ == "" {
+			continue
+		}
+		cnt, _ := strconv.ParseInt(val, 10, 64)
+		res[domain.NotificationType(typ)] = cnt
+	}
+	return res, nil
+}
+
+func (r *RedisNotificationCache) SetUnread(ctx context.Context, uid int64, cnts map[domain.NotificationType]int64) error {
+	key := r.unreadKey(uid)
+	vals := make([]any, 0, len(cnts)*2+2)
+	vals = append(vals, "", 0)
+	for typ, cnt := range cnts {
+		vals = append(vals, string(typ), cnt)
+	}
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, vals...)
+	pipe.Expire(ctx, key, notificationUnreadExpiration)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisNotificationCache) DelUnread(ctx context.Context, uid int64) error {
+	return r.client.Del(ctx, r.unreadKey(uid)).Err()
+}
+
+func (r *RedisNotificationCache) Publish(ctx context.Context, n domain.Notification) error {
+	val, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(ctx, notificationPushChannel, val).Err()
+}
+
+func (r *RedisNotificationCache) Subscribe(ctx context.Context) (<-chan domain.Notification, error) {
+	sub, ok := r.client.(redisSubscriber)
+	if !ok {
+		return nil, errSubscribeNotSupported
+	}
+	ps := sub.Subscribe(ctx, notificationPushChannel)
+	// 确认订阅成功再返回
+	if _, err := ps.Receive(ctx); err != nil {
+		_ = ps.Close()
+		return nil, err
+	}
+	res := make(chan domain.Notification, 64)
+	go func() {
+		defer close(res)
+		defer ps.Close()
+		msgs := ps.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				var n domain.Notification
+				if err := json.Unmarshal([]byte(msg.Payload), &n); err != nil {
+					continue
+				}
+				select {
+				case res <- n:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return res, nil
+}
+
+func (r *RedisNotificationCache) unreadKey(uid int64) string {
+	return fmt.Sprintf("notification_unread:%d", uid)
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"archi/internal/repository/cache"
+	"context"
+	"time"
+)
+
+type CaptchaRepository interface {
+	SetToken(ctx context.Context, token string, expiration time.Duration) error
+	ConsumeToken(ctx context.Context, token string) (bool, error)
+	IncrFailure(ctx context.Context, scene string, subjects []string, window time.Duration) error
+	Failures(ctx context.Context, scene string, subjects []string) ([]int64, error)
+	ResetFailures(ctx context.Context, scene string, subjects []string) error
+}
+
+type CachedCaptchaRepository struct {
+	cache cache.CaptchaCache
+}
+
+func NewCachedCaptchaRepository(c cache.CaptchaCache) CaptchaRepository {
+	return &CachedCaptchaRepository{
+		cache: c,
+	}
+}
+
+func (c *CachedCaptchaRepository) SetToken(ctx context.Context, token string, expiration time.Duration) error {
+	return c.cache.SetToken(ctx, token, expiration)
+}
+
+func (c *CachedCaptchaRepository) ConsumeToken(ctx context.Context, token string) (bool, error) {
+	return c.cache.ConsumeToken(ctx, token)
+}
+
+func (c *CachedCaptchaRepository) IncrFailure(ctx context.Context, scene string, subjects []string, window time.Duration) error {
+	return c.cache.IncrFailure(ctx, scene, subjects, window)
+}
+
+func (c *CachedCaptchaRepository) Failures(ctx context.Context, scene string, subjects []string) ([]int64, error) {
+	return c.cache.Failures(ctx, scene, subjects)
+}
+
+func (c *CachedCaptchaRepository) ResetFailures(ctx context.Context, scene string, subjects []string) error {
+	return c.cache.ResetFailures(ctx, scene, subjects)
+}
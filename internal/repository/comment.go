@@ -2,19 +2,43 @@ package repository
 
 import (
 	"archi/internal/domain"
+	"archi/internal/repository/cache"
 	"archi/internal/repository/dao"
 	"archi/pkg/logger"
 	"context"
 	"database/sql"
+	"errors"
+	"github.com/ecodeclub/ekit/slice"
 	"golang.org/x/sync/errgroup"
+	"math"
 	"time"
 )
 
+// ErrCommentNotFound 评论不存在
+var ErrCommentNotFound = dao.ErrDataNotFound
+
 type CommentRepository interface {
-	// FindByBiz 根据 ID 倒序查找 并且会返回每个评论的三条直接回复
-	FindByBiz(ctx context.Context, biz string, bizId, minID, limit int64) ([]domain.Comment, error)
-	// DeleteComment 删除评论，删除本评论何其子评论
-	DeleteComment(ctx context.Context, comment domain.Comment) error
+	// FindByBiz 按照排序方式查找一级评论，并且会返回每个评论的三条直接回复和回复数
+	// 第一页会把置顶评论放在最前面，置顶评论不占用 limit
+	FindByBiz(ctx context.Context, biz string, bizId int64, sort domain.CommentSort,
+		cursor domain.CommentCursor, limit int64) ([]domain.Comment, error)
+	// SetPinned 置顶或者取消置顶，同一个业务对象只会有一条置顶评论
+	SetPinned(ctx context.Context, comment domain.Comment, pinned bool) error
+	// UpdateLikeCnt 回写点赞数，并根据点赞数重新计算热度
+	UpdateLikeCnt(ctx context.Context, comment domain.Comment) error
+	// SoftDelete 删除评论，只保留墓碑，回复不受影响
+	SoftDelete(ctx context.Context, id int64) error
+	// HardDelete 物理删除评论以及它下面的全部回复，并留下审计记录，返回被删除的评论数量
+	HardDelete(ctx context.Context, operator, id int64, reason string) (int, error)
+	// Edit 修改评论内容，编辑之前的内容会记录到编辑历史里面
+	// comment 处于待复审状态时，修改之后的评论也是待复审状态
+	Edit(ctx context.Context, comment domain.Comment, content string) error
+	// SetPendingReview 进入或者退出待复审状态，已经删除的评论保持不变
+	SetPendingReview(ctx context.Context, id int64, pending bool) error
+	// MarkReplyNotified 待复审的回复复审通过之后补发通知，返回 true 表示之前没有通知过，需要调用方发通知
+	MarkReplyNotified(ctx context.Context, id int64) (bool, error)
+	// FindEdits 编辑历史，按时间倒序
+	FindEdits(ctx context.Context, cid int64) ([]domain.CommentEdit, error)
 	// CreateComment 创建评论
 	CreateComment(ctx context.Context, comment domain.Comment) (domain.Comment, error)
 	// GetCommentByIds 获取单条评论 支持批量获取
@@ -22,90 +46,280 @@ type CommentRepository interface {
 	GetMoreReplies(ctx context.Context, rid int64, id int64, limit int64) ([]domain.Comment, error)
 }
 
+// commentReplyPreviewSize 每条一级评论带出来的回复数量
+const commentReplyPreviewSize = 3
+
 type CachedCommentRepository struct {
-	dao dao.CommentDAO
-	l   logger.Logger
+	dao       dao.CommentDAO
+	cache     cache.CommentCache
+	intrCache cache.InteractiveCache
+	l         logger.Logger
 }
 
-func NewCachedCommentRepository(commentDAO dao.CommentDAO, l logger.Logger) CommentRepository {
+func NewCachedCommentRepository(commentDAO dao.CommentDAO, commentCache cache.CommentCache,
+	intrCache cache.InteractiveCache, l logger.Logger) CommentRepository {
 	return &CachedCommentRepository{
-		dao: commentDAO,
-		l:   l,
+		dao:       commentDAO,
+		cache:     commentCache,
+		intrCache: intrCache,
+		l:         l,
 	}
 }
 
-func (c *CachedCommentRepository) FindByBiz(ctx context.Context, biz string, bizId, minID, limit int64) ([]domain.Comment, error) {
-	daoComments, err := c.dao.FindByBiz(ctx, biz, bizId, minID, limit)
+func (c *CachedCommentRepository) FindByBiz(ctx context.Context, biz string, bizId int64, sort domain.CommentSort,
+	cursor domain.CommentCursor, limit int64) ([]domain.Comment, error) {
+	if !cursor.IsZero() {
+		return c.findPage(ctx, biz, bizId, sort, cursor, limit)
+	}
+	if limit > cache.CommentFirstPageSize {
+		return c.findFirstPage(ctx, biz, bizId, sort, limit)
+	}
+	res, err := c.cache.GetFirstPage(ctx, biz, bizId, sort)
+	if err == nil {
+		return c.truncateFirstPage(res, limit), nil
+	}
+	if !errors.Is(err, cache.ErrCommentPageNotFound) {
+		c.l.Error("查询评论第一页缓存失败",
+			logger.String("biz", biz),
+			logger.Int64("biz_id", bizId),
+			logger.Error(err))
+	}
+	// 缓存的是完整的第一页，不同的 limit 共用一份
+	res, err = c.findFirstPage(ctx, biz, bizId, sort, cache.CommentFirstPageSize)
 	if err != nil {
 		return nil, err
 	}
+	// 降级模式下没有回复预览，不能放进缓存
+	if ctx.Value("downgraded") != "true" {
+		if er := c.cache.SetFirstPage(ctx, biz, bizId, sort, res); er != nil {
+			c.l.Error("回写评论第一页缓存失败",
+				logger.String("biz", biz),
+				logger.Int64("biz_id", bizId),
+				logger.Error(er))
+		}
+	}
+	return c.truncateFirstPage(res, limit), nil
+}
+
+// findFirstPage 置顶评论加上按照排序方式的前 limit 条一级评论
+func (c *CachedCommentRepository) findFirstPage(ctx context.Context, biz string, bizId int64,
+	sort domain.CommentSort, limit int64) ([]domain.Comment, error) {
+	res, err := c.findPage(ctx, biz, bizId, sort, domain.CommentCursor{}, limit)
+	if err != nil {
+		return nil, err
+	}
+	pinned, err := c.dao.FindPinned(ctx, biz, bizId)
+	switch {
+	case err == nil:
+		ps, err := c.withReplies(ctx, []dao.Comment{pinned})
+		if err != nil {
+			return nil, err
+		}
+		return append(ps, res...), nil
+	case errors.Is(err, dao.ErrDataNotFound):
+		return res, nil
+	default:
+		return nil, err
+	}
+}
+
+func (c *CachedCommentRepository) truncateFirstPage(comments []domain.Comment, limit int64) []domain.Comment {
+	if len(comments) > 0 && comments[0].Pinned {
+		limit++
+	}
+	if int64(len(comments)) > limit {
+		return comments[:limit]
+	}
+	return comments
+}
+
+// findPage 不包含置顶评论
+func (c *CachedCommentRepository) findPage(ctx context.Context, biz string, bizId int64, sort domain.CommentSort,
+	cursor domain.CommentCursor, limit int64) ([]domain.Comment, error) {
+	var (
+		daoComments []dao.Comment
+		err         error
+	)
+	// 零值游标表示第一页
+	maxID, maxScore := cursor.ID, cursor.Score
+	if cursor.IsZero() {
+		maxID, maxScore = math.MaxInt64, math.MaxInt64
+	}
+	if sort == domain.CommentSortHot {
+		daoComments, err = c.dao.FindHotByBiz(ctx, biz, bizId, maxScore, maxID, limit)
+	} else {
+		daoComments, err = c.dao.FindByBiz(ctx, biz, bizId, maxID, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.withReplies(ctx, daoComments)
+}
+
+func (c *CachedCommentRepository) SetPinned(ctx context.Context, comment domain.Comment, pinned bool) error {
+	err := c.dao.SetPinned(ctx, comment.Id, pinned)
+	if err == nil {
+		c.delFirstPage(ctx, comment.Biz, comment.BizID)
+	}
+	return err
+}
+
+func (c *CachedCommentRepository) UpdateLikeCnt(ctx context.Context, comment domain.Comment) error {
+	err := c.dao.UpdateLikeCnt(ctx, comment.Id, comment.LikeCnt,
+		domain.CommentHotScore(comment.LikeCnt, comment.CTime))
+	if err == nil {
+		c.delFirstPage(ctx, comment.Biz, comment.BizID)
+	}
+	return err
+}
+
+// withReplies 转换成领域对象，并且批量加载每个评论的回复预览和回复数
+func (c *CachedCommentRepository) withReplies(ctx context.Context, daoComments []dao.Comment) ([]domain.Comment, error) {
 	// 如果没有父评论，直接返回，避免不必要的工作
 	if len(daoComments) == 0 {
 		return []domain.Comment{}, nil
 	}
+	res := make([]domain.Comment, 0, len(daoComments))
+	for _, d := range daoComments {
+		res = append(res, c.toDomain(d))
+	}
 
 	downgraded := ctx.Value("downgraded") == "true"
 	if downgraded {
-		// 降级模式下，直接转换并返回，不查询子评论
-		res := make([]domain.Comment, 0, len(daoComments))
-		for _, d := range daoComments {
-			res = append(res, c.toDomain(d))
-		}
+		// 降级模式下，直接返回，不查询子评论
 		return res, nil
 	}
 
-	// --- 更安全的并发获取子评论 ---
-
-	// 1. 创建一个临时的、二维的切片来存放每个 goroutine 的结果
-	// replies 的每个元素对应一个父评论的子评论列表
-	replies := make([][]domain.Comment, len(daoComments))
-	var eg errgroup.Group
-	for i, d := range daoComments {
-		// 捕获循环变量，防止闭包问题
-		i, d := i, d
-		eg.Go(func() error {
-			// 每个 goroutine 只负责查询一个父评论的子评论
-			rs, err := c.dao.FindRepliesByPid(ctx, d.ID, 0, 3)
-			if err != nil {
-				c.l.Error("查询子评论失败", logger.Error(err))
-				// 这是一个可容忍的错误，不将 error 返回给 errgroup
-				// 这个父评论的子评论将为空
-				return nil
-			}
-			children := make([]domain.Comment, 0, len(rs))
-			for _, r := range rs {
-				children = append(children, c.toDomain(r))
-			}
-
-			// 2. 将结果存放到临时的、专属于自己的位置
-			// 这里没有竞争，因为每个 goroutine 操作的是不同的索引 i
-			if len(children) > 0 {
-				replies[i] = children
-			}
-			return nil
-		})
-	}
-
-	// 等待所有 goroutine 完成
-	if err := eg.Wait(); err != nil {
-		return nil, err
+	ids := make([]int64, 0, len(daoComments))
+	for _, d := range daoComments {
+		ids = append(ids, d.ID)
 	}
+	// 回复预览和回复数都是可以容忍的错误，查询失败的时候只是不展示
+	var (
+		eg       errgroup.Group
+		replies  []dao.Comment
+		replyCnt map[int64]int64
+	)
+	eg.Go(func() error {
+		var err error
+		replies, err = c.dao.FindRepliesByPids(ctx, ids, commentReplyPreviewSize)
+		if err != nil {
+			c.l.Error("查询子评论失败", logger.Error(err))
+		}
+		return nil
+	})
+	eg.Go(func() error {
+		var err error
+		replyCnt, err = c.dao.CountRepliesByRids(ctx, ids)
+		if err != nil {
+			c.l.Error("查询回复数失败", logger.Error(err))
+		}
+		return nil
+	})
+	_ = eg.Wait()
 
-	// 3. 在主线程中，安全地将父评论和子评论组装起来
-	res := make([]domain.Comment, 0, len(daoComments))
-	for i, d := range daoComments {
-		comment := c.toDomain(d)
-		// 从临时切片中取出对应的子评论并赋值
-		comment.Children = replies[i]
-		res = append(res, comment)
+	children := make(map[int64][]domain.Comment, len(ids))
+	for _, r := range replies {
+		children[r.PID.Int64] = append(children[r.PID.Int64], c.toDomain(r))
+	}
+	for i := range res {
+		res[i].Children = children[res[i].Id]
+		res[i].ReplyCnt = replyCnt[res[i].Id]
 	}
-
 	return res, nil
 }
-func (c *CachedCommentRepository) DeleteComment(ctx context.Context, comment domain.Comment) error {
-	return c.dao.Delete(ctx, dao.Comment{
-		ID: comment.Id,
+
+func (c *CachedCommentRepository) SoftDelete(ctx context.Context, id int64) error {
+	cm, err := c.dao.SoftDelete(ctx, id)
+	if err != nil {
+		return err
+	}
+	c.delFirstPage(ctx, cm.Biz, cm.BizID)
+	if cm.Status != domain.CommentStatusDeleted.ToUint8() {
+		c.incrCommentCnt(ctx, cm.Biz, cm.BizID, -1)
+	}
+	return nil
+}
+
+func (c *CachedCommentRepository) HardDelete(ctx context.Context, operator, id int64, reason string) (int, error) {
+	deleted, err := c.dao.DeleteSubtree(ctx, id, dao.CommentAudit{
+		Operator: operator,
+		Reason:   reason,
+	})
+	if err != nil {
+		return 0, err
+	}
+	root := deleted[0]
+	c.delFirstPage(ctx, root.Biz, root.BizID)
+	var alive int64
+	for _, cm := range deleted {
+		if cm.Status != domain.CommentStatusDeleted.ToUint8() {
+			alive++
+		}
+	}
+	if alive > 0 {
+		c.incrCommentCnt(ctx, root.Biz, root.BizID, -alive)
+	}
+	return len(deleted), nil
+}
+
+func (c *CachedCommentRepository) Edit(ctx context.Context, comment domain.Comment, content string) error {
+	err := c.dao.UpdateContent(ctx, comment.Id, content, comment.PendingReview(), dao.CommentEdit{
+		Uid:     comment.Commentator.ID,
+		Content: comment.Content,
 	})
+	if err == nil {
+		c.delFirstPage(ctx, comment.Biz, comment.BizID)
+	}
+	return err
+}
+
+func (c *CachedCommentRepository) SetPendingReview(ctx context.Context, id int64, pending bool) error {
+	cm, err := c.dao.SetPendingReview(ctx, id, pending)
+	if err == nil {
+		c.delFirstPage(ctx, cm.Biz, cm.BizID)
+	}
+	return err
+}
+
+func (c *CachedCommentRepository) MarkReplyNotified(ctx context.Context, id int64) (bool, error) {
+	return c.dao.MarkReplyNotified(ctx, id)
+}
+
+// delFirstPage 业务对象下任意评论变化之后，第一页缓存失效
+func (c *CachedCommentRepository) delFirstPage(ctx context.Context, biz string, bizId int64) {
+	if err := c.cache.DelFirstPage(ctx, biz, bizId); err != nil {
+		c.l.Error("删除评论第一页缓存失败",
+			logger.String("biz", biz),
+			logger.Int64("biz_id", bizId),
+			logger.Error(err))
+	}
+}
+
+// incrCommentCnt 数据库中的评论数已经在同一个事务里面更新过了，这里只同步缓存
+func (c *CachedCommentRepository) incrCommentCnt(ctx context.Context, biz string, bizId int64, delta int64) {
+	if err := c.intrCache.IncrCommentCntIfPresent(ctx, biz, bizId, delta); err != nil {
+		c.l.Error("更新评论数缓存失败",
+			logger.String("biz", biz),
+			logger.Int64("biz_id", bizId),
+			logger.Error(err))
+	}
+}
+
+func (c *CachedCommentRepository) FindEdits(ctx context.Context, cid int64) ([]domain.CommentEdit, error) {
+	edits, err := c.dao.FindEdits(ctx, cid)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(edits, func(idx int, src dao.CommentEdit) domain.CommentEdit {
+		return domain.CommentEdit{
+			ID:      src.ID,
+			Cid:     src.Cid,
+			Uid:     src.Uid,
+			Content: src.Content,
+			Ctime:   time.UnixMilli(src.Ctime),
+		}
+	}), nil
 }
 func (c *CachedCommentRepository) CreateComment(ctx context.Context, comment domain.Comment) (domain.Comment, error) {
 	entity := c.toEntity(comment)
@@ -114,6 +328,8 @@ func (c *CachedCommentRepository) CreateComment(ctx context.Context, comment dom
 		// 如果插入失败，直接返回错误
 		return domain.Comment{}, err
 	}
+	c.delFirstPage(ctx, entity.Biz, entity.BizID)
+	c.incrCommentCnt(ctx, entity.Biz, entity.BizID, 1)
 	// 2. 根据这个 ID，立刻查询完整的领域对象
 	comments, err := c.GetCommentByIds(ctx, []int64{id})
 	if err != nil {
@@ -123,6 +339,10 @@ func (c *CachedCommentRepository) CreateComment(ctx context.Context, comment dom
 		// 尽管查询失败，但创建是成功的，可以返回一个只包含ID的对象作为降级方案
 		return domain.Comment{Id: id}, nil
 	}
+	if len(comments) == 0 {
+		c.l.Error("创建评论后查询不到，数据不一致", logger.Int64("comment_id", id))
+		return domain.Comment{Id: id}, nil
+	}
 	// 正常情况下，返回查询到的完整对象
 	return comments[0], nil
 }
@@ -155,11 +375,16 @@ func (c *CachedCommentRepository) toDomain(daoComment dao.Comment) domain.Commen
 		Commentator: domain.CommentatorInfo{
 			ID: daoComment.Uid,
 		},
-		Biz:     daoComment.Biz,
-		BizID:   daoComment.BizID,
-		Content: daoComment.Content,
-		CTime:   time.UnixMilli(daoComment.Ctime),
-		UTime:   time.UnixMilli(daoComment.Utime),
+		Biz:      daoComment.Biz,
+		BizID:    daoComment.BizID,
+		Content:  daoComment.Content,
+		LikeCnt:  daoComment.LikeCnt,
+		HotScore: daoComment.HotScore,
+		Pinned:   daoComment.Pinned,
+		Status:   domain.CommentStatus(daoComment.Status),
+		EditCnt:  daoComment.EditCnt,
+		CTime:    time.UnixMilli(daoComment.Ctime),
+		UTime:    time.UnixMilli(daoComment.Utime),
 	}
 	if daoComment.PID.Valid {
 		val.ParentComment = &domain.Comment{
@@ -180,6 +405,9 @@ func (c *CachedCommentRepository) toEntity(domainComment domain.Comment) dao.Com
 		Biz:     domainComment.Biz,
 		BizID:   domainComment.BizID,
 		Content: domainComment.Content,
+		Status:  domainComment.Status.ToUint8(),
+		// 待复审的回复先不通知被回复的人
+		ReplyNotified: !domainComment.PendingReview(),
 	}
 	if domainComment.RootComment != nil {
 		daoComment.RootID = sql.NullInt64{
@@ -193,7 +421,9 @@ func (c *CachedCommentRepository) toEntity(domainComment domain.Comment) dao.Com
 			Int64: domainComment.ParentComment.Id,
 		}
 	}
-	daoComment.Ctime = time.Now().UnixMilli()
-	daoComment.Utime = time.Now().UnixMilli()
+	now := time.Now()
+	daoComment.Ctime = now.UnixMilli()
+	daoComment.Utime = now.UnixMilli()
+	daoComment.HotScore = domain.CommentHotScore(0, now)
 	return daoComment
 }
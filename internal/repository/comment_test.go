@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"archi/internal/domain"
+	"archi/internal/repository/cache"
+	"archi/internal/repository/dao"
+	"archi/pkg/logger"
+	"context"
+	"database/sql"
+	"math"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCommentDAO 一级评论 1~5，热度和 id 相反，评论 9 是置顶评论，评论 1 下面有一条回复
+type fakeCommentDAO struct {
+	dao.CommentDAO
+	// pageCalls 查询一级评论的次数
+	pageCalls int
+	// hotArgs 最近一次按热度查询的 (maxScore, maxID)
+	hotArgs [2]int64
+}
+
+func (d *fakeCommentDAO) topLevel() []dao.Comment {
+	res := make([]dao.Comment, 0, 5)
+	for id := int64(5); id >= 1; id-- {
+		res = append(res, dao.Comment{ID: id, Biz: "article", BizID: 100, HotScore: 10 - id})
+	}
+	return res
+}
+
+func (d *fakeCommentDAO) FindByBiz(ctx context.Context, biz string, bizId, maxID, limit int64) ([]dao.Comment, error) {
+	d.pageCalls++
+	res := make([]dao.Comment, 0, limit)
+	for _, c := range d.topLevel() {
+		if c.ID < maxID && int64(len(res)) < limit {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+func (d *fakeCommentDAO) FindHotByBiz(ctx context.Context, biz string, bizId, maxScore, maxID, limit int64) ([]dao.Comment, error) {
+	d.pageCalls++
+	d.hotArgs = [2]int64{maxScore, maxID}
+	list := d.topLevel()
+	res := make([]dao.Comment, 0, limit)
+	for i := len(list) - 1; i >= 0; i-- {
+		c := list[i]
+		if (c.HotScore < maxScore || (c.HotScore == maxScore && c.ID < maxID)) && int64(len(res)) < limit {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+func (d *fakeCommentDAO) FindPinned(ctx context.Context, biz string, bizId int64) (dao.Comment, error) {
+	return dao.Comment{ID: 9, Biz: biz, BizID: bizId, Pinned: true}, nil
+}
+
+func (d *fakeCommentDAO) FindRepliesByPids(ctx context.Context, pids []int64, limit int) ([]dao.Comment, error) {
+	return []dao.Comment{{ID: 11, PID: sql.NullInt64{Int64: 1, Valid: true}, RootID: sql.NullInt64{Int64: 1, Valid: true}}}, nil
+}
+
+func (d *fakeCommentDAO) CountRepliesByRids(ctx context.Context, rids []int64) (map[int64]int64, error) {
+	return map[int64]int64{1: 1}, nil
+}
+
+func (d *fakeCommentDAO) SetPinned(ctx context.Context, id int64, pinned bool) error {
+	return nil
+}
+
+func newTestCommentRepo(t *testing.T) (CommentRepository, *fakeCommentDAO, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	d := &fakeCommentDAO{}
+	return NewCachedCommentRepository(d, cache.NewRedisCommentCache(client), nil, logger.NewNopLogger()), d, mr
+}
+
+func commentIds(list []domain.Comment) []int64 {
+	res := make([]int64, 0, len(list))
+	for _, c := range list {
+		res = append(res, c.Id)
+	}
+	return res
+}
+
+func TestCachedCommentRepository_FindByBizFirstPage(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sort    domain.CommentSort
+		limit   int64
+		wantIds []int64
+	}{
+		{
+			name:    "按时间，置顶评论不占 limit",
+			sort:    domain.CommentSortNew,
+			limit:   2,
+			wantIds: []int64{9, 5, 4},
+		},
+		{
+			name:    "按热度",
+			sort:    domain.CommentSortHot,
+			limit:   3,
+			wantIds: []int64{9, 1, 2, 3},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo, d, mr := newTestCommentRepo(t)
+			ctx := context.Background()
+			res, err := repo.FindByBiz(ctx, "article", 100, tc.sort, domain.CommentCursor{}, tc.limit)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantIds, commentIds(res))
+			assert.True(t, res[0].Pinned)
+			assert.Equal(t, 1, d.pageCalls)
+			assert.True(t, mr.Exists("comment:first_page:article:100:"+string(tc.sort)))
+
+			// 第二次直接读缓存，不同的 limit 共用一份
+			res, err = repo.FindByBiz(ctx, "article", 100, tc.sort, domain.CommentCursor{}, tc.limit-1)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantIds[:len(tc.wantIds)-1], commentIds(res))
+			assert.Equal(t, 1, d.pageCalls)
+		})
+	}
+}
+
+func TestCachedCommentRepository_FindByBizReplies(t *testing.T) {
+	repo, _, _ := newTestCommentRepo(t)
+	res, err := repo.FindByBiz(context.Background(), "article", 100, domain.CommentSortHot, domain.CommentCursor{}, 1)
+	require.NoError(t, err)
+	require.Equal(t, []int64{9, 1}, commentIds(res))
+	assert.Equal(t, int64(1), res[1].ReplyCnt)
+	assert.Equal(t, []int64{11}, commentIds(res[1].Children))
+	assert.Empty(t, res[0].Children)
+}
+
+func TestCachedCommentRepository_FindByBizHotCursor(t *testing.T) {
+	repo, d, mr := newTestCommentRepo(t)
+	ctx := context.Background()
+	var (
+		cursor domain.CommentCursor
+		got    []int64
+	)
+	for i := 0; i < 10; i++ {
+		res, err := repo.FindByBiz(ctx, "article", 100, domain.CommentSortHot, cursor, 2)
+		require.NoError(t, err)
+		if i == 0 {
+			// 第一页从最大值开始查
+			assert.Equal(t, [2]int64{math.MaxInt64, math.MaxInt64}, d.hotArgs)
+			// 置顶评论只在第一页出现
+			res = res[1:]
+		}
+		if len(res) == 0 {
+			break
+		}
+		got = append(got, commentIds(res)...)
+		cursor = res[len(res)-1].Cursor()
+	}
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, got)
+	// 后面的页不会写缓存，只有第一页有缓存
+	keys := mr.Keys()
+	assert.Equal(t, []string{"comment:first_page:article:100:hot"}, keys)
+}
+
+func TestCachedCommentRepository_SetPinnedInvalidatesFirstPage(t *testing.T) {
+	repo, d, mr := newTestCommentRepo(t)
+	ctx := context.Background()
+	for _, sort := range []domain.CommentSort{domain.CommentSortNew, domain.CommentSortHot} {
+		_, err := repo.FindByBiz(ctx, "article", 100, sort, domain.CommentCursor{}, 2)
+		require.NoError(t, err)
+	}
+	require.Len(t, mr.Keys(), 2)
+
+	err := repo.SetPinned(ctx, domain.Comment{Id: 3, Biz: "article", BizID: 100}, true)
+	require.NoError(t, err)
+	assert.Empty(t, mr.Keys())
+
+	_, err = repo.FindByBiz(ctx, "article", 100, domain.CommentSortNew, domain.CommentCursor{}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, d.pageCalls)
+}
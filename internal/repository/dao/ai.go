@@ -0,0 +1,58 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AiResponse 记录每次 AI 响应所使用的 Prompt 版本，用于 A/B 实验的效果对比
+type AiResponse struct {
+	Id            int64  `gorm:"primaryKey,autoIncrement"`
+	Scene         string `gorm:"type:varchar(64);index:scene_version"`
+	PromptVersion string `gorm:"type:varchar(64);index:scene_version"`
+	Uid           int64  `gorm:"index"`
+	BizId         int64
+	// 耗时，单位毫秒
+	Duration int64
+	Success  bool
+	Ctime    int64
+}
+
+// AiToolAudit AI 工具调用及用户确认的审计记录
+type AiToolAudit struct {
+	Id        int64 `gorm:"primaryKey,autoIncrement"`
+	Uid       int64 `gorm:"index:uid_ctime"`
+	ArticleId int64
+	Tool      string `gorm:"type:varchar(64)"`
+	Args      string `gorm:"type:text"`
+	Result    string `gorm:"type:text"`
+	Success   bool
+	Ctime     int64 `gorm:"index:uid_ctime"`
+}
+
+type AiDAO interface {
+	InsertResponse(ctx context.Context, r AiResponse) error
+	InsertToolAudit(ctx context.Context, a AiToolAudit) error
+}
+
+type GORMAiDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMAiDAO(db *gorm.DB) AiDAO {
+	return &GORMAiDAO{
+		db: db,
+	}
+}
+
+func (dao *GORMAiDAO) InsertResponse(ctx context.Context, r AiResponse) error {
+	r.Ctime = time.Now().UnixMilli()
+	return dao.db.WithContext(ctx).Create(&r).Error
+}
+
+func (dao *GORMAiDAO) InsertToolAudit(ctx context.Context, a AiToolAudit) error {
+	a.Ctime = time.Now().UnixMilli()
+	return dao.db.WithContext(ctx).Create(&a).Error
+}
@@ -33,6 +33,7 @@ type ArticleDAO interface {
 	GetByAuthor(ctx context.Context, uid int64, offset int, limit int) ([]Article, error)
 	GetById(ctx context.Context, id int64) (Article, error)
 	GetPubById(ctx context.Context, id int64) (PublishedArticle, error)
+	GetPubByIds(ctx context.Context, ids []int64) ([]PublishedArticle, error)
 	ListPub(ctx context.Context, start time.Time, offset int, limit int) ([]PublishedArticle, error)
 }
 type GORMArticleDAO struct {
@@ -203,6 +204,12 @@ func (a *GORMArticleDAO) GetPubById(ctx context.Context, id int64) (PublishedArt
 	return res, err
 }
 
+func (a *GORMArticleDAO) GetPubByIds(ctx context.Context, ids []int64) ([]PublishedArticle, error) {
+	var res []PublishedArticle
+	err := a.db.WithContext(ctx).Where("id IN ? AND status = ?", ids, ArticleStatusPublished).Find(&res).Error
+	return res, err
+}
+
 func (a *GORMArticleDAO) ListPub(ctx context.Context, start time.Time, offset int, limit int) ([]PublishedArticle, error) {
 	var res []PublishedArticle
 
@@ -11,13 +11,11 @@ import (
 const (
 	// 因为本身状态没有暴露出去，所以不需要在 domain 里面定义
 	asyncStatusWaiting uint8 = iota
-	// 失败了，并且超过了重试次数
-	asyncStatusFailed
+	// 失败了，并且超过了重试次数，不再自动重试，只能人工检查之后重新入队
+	asyncStatusDead
 	asyncStatusSuccess
 )
 
-var ErrWaitingSMSNotFound = gorm.ErrRecordNotFound
-
 type SMSConfig struct {
 	TplId   string
 	Args    []string
@@ -29,17 +27,29 @@ type AsyncSMS struct {
 	Config   sqlx.JsonColumn[SMSConfig] // 使用我在 ekit 里面支持的 JSON 字段
 	RetryCnt int                        // 重试次数
 	RetryMax int                        // 重试的最大次数
-	Status   uint8
-	Ctime    int64
-	Utime    int64 `gorm:"index"`
+	Status   uint8                      `gorm:"index:status_next_retry"`
+	// NextRetryAt 什么时候可以被抢占，抢占之后会往后推一个租约，失败之后按退避时间往后推
+	NextRetryAt int64 `gorm:"index:status_next_retry"`
+	// LastErr 最后一次发送失败的原因，方便排查进了死信的短信
+	LastErr string `gorm:"type:varchar(512)"`
+	Ctime   int64
+	Utime   int64 `gorm:"index"`
 }
 
 //go:generate mockgen -source=./async_sms.go -package=mocks -destination=mocks/async_sms.mock.go AsyncSmsDAO
 type AsyncSMSDAO interface {
 	Insert(ctx context.Context, s AsyncSMS) error
-	GetWaitingSMS(ctx context.Context) (AsyncSMS, error)
+	// PreemptBatch 抢占最多 limit 条到期的短信，抢到的短信在 lease 之内不会被别的节点抢到
+	PreemptBatch(ctx context.Context, limit int, lease time.Duration) ([]AsyncSMS, error)
 	MarkSuccess(ctx context.Context, id int64) error
-	MarkFailed(ctx context.Context, id int64) error
+	// MarkRetry 发送失败，nextRetryAt 之后再重试
+	MarkRetry(ctx context.Context, id int64, nextRetryAt int64, reason string) error
+	// MarkDead 重试次数用完，进入死信
+	MarkDead(ctx context.Context, id int64, reason string) error
+	// FindDead 按 id 倒序分页查询死信，maxId 为 0 时从头开始
+	FindDead(ctx context.Context, maxId int64, limit int) ([]AsyncSMS, error)
+	// Requeue 把死信重新放回等待队列，重试次数清零，返回是否真的重新入队了
+	Requeue(ctx context.Context, id int64) (bool, error)
 }
 
 type GORMAsyncSMSDAO struct {
@@ -56,35 +66,37 @@ func (g *GORMAsyncSMSDAO) Insert(ctx context.Context, s AsyncSMS) error {
 	now := time.Now().UnixMilli()
 	s.Ctime = now
 	s.Utime = now
-	return g.db.Create(&s).Error
+	s.NextRetryAt = now
+	return g.db.WithContext(ctx).Create(&s).Error
 }
 
-func (g *GORMAsyncSMSDAO) GetWaitingSMS(ctx context.Context) (AsyncSMS, error) {
-	// 如果在高并发情况下,SELECT for UPDATE 对数据库的压力很大
-	// 但是我们不是高并发，因为你部署N台机器，才有 N 个goroutine 来查询
-	// 并发不过百，随便写
-	var s AsyncSMS
+func (g *GORMAsyncSMSDAO) PreemptBatch(ctx context.Context, limit int, lease time.Duration) ([]AsyncSMS, error) {
+	var res []AsyncSMS
 	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// 为了避开一些偶发性的失败，我们只找 1 分钟前的异步短信发送
 		now := time.Now().UnixMilli()
-		endTime := now - time.Minute.Milliseconds()
-		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-			Where("utime < ? and status = ?", endTime, asyncStatusWaiting).First(&s).Error
-		// SELECT xx FROM xxx WHERE xx FOR UPDATE，锁住了
-		if err != nil {
+		// SKIP LOCKED 让多个节点同时抢占的时候互相不等待，各自拿到不同的短信
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_retry_at <= ?", asyncStatusWaiting, now).
+			Order("next_retry_at ASC").Limit(limit).
+			Find(&res).Error
+		if err != nil || len(res) == 0 {
 			return err
 		}
-		// 只要更新了更新时间，根据我们前面的规则，就不可能被别的节点抢占了
-		err = tx.Model(&AsyncSMS{}).
-			Where("id = ?", s.ID).
+		ids := make([]int64, 0, len(res))
+		for i := range res {
+			ids = append(ids, res[i].ID)
+			res[i].RetryCnt++
+		}
+		// 推迟 next_retry_at 相当于加了一个租约，节点在发送过程中崩溃的话，租约到期之后会被重新抢占
+		return tx.Model(&AsyncSMS{}).
+			Where("id IN ?", ids).
 			Updates(map[string]any{
-				// 更新成了当前时间戳，确保我在发送过程中，没人会再次抢到它 也相当于，重试间隔一分钟
-				"retry_cnt": gorm.Expr("retry_cnt + 1"),
-				"utime":     now,
+				"retry_cnt":     gorm.Expr("retry_cnt + 1"),
+				"next_retry_at": now + lease.Milliseconds(),
+				"utime":         now,
 			}).Error
-		return err
 	})
-	return s, err
+	return res, err
 }
 
 func (g *GORMAsyncSMSDAO) MarkSuccess(ctx context.Context, id int64) error {
@@ -97,12 +109,55 @@ func (g *GORMAsyncSMSDAO) MarkSuccess(ctx context.Context, id int64) error {
 		}).Error
 }
 
-func (g *GORMAsyncSMSDAO) MarkFailed(ctx context.Context, id int64) error {
-	now := time.Now().UnixMilli()
+func (g *GORMAsyncSMSDAO) MarkRetry(ctx context.Context, id int64, nextRetryAt int64, reason string) error {
 	return g.db.WithContext(ctx).Model(&AsyncSMS{}).
-		Where("id =? and `retry_cnt`>=`retry_max`", id). // 只有到达了重试次数才会更新
+		Where("id = ? AND status = ?", id, asyncStatusWaiting).
 		Updates(map[string]any{
-			"utime":  now,
-			"status": asyncStatusFailed,
+			"next_retry_at": nextRetryAt,
+			"last_err":      truncateErr(reason),
+			"utime":         time.Now().UnixMilli(),
+		}).Error
+}
+
+func (g *GORMAsyncSMSDAO) MarkDead(ctx context.Context, id int64, reason string) error {
+	return g.db.WithContext(ctx).Model(&AsyncSMS{}).
+		Where("id = ? AND status = ?", id, asyncStatusWaiting).
+		Updates(map[string]any{
+			"status":   asyncStatusDead,
+			"last_err": truncateErr(reason),
+			"utime":    time.Now().UnixMilli(),
 		}).Error
 }
+
+func (g *GORMAsyncSMSDAO) FindDead(ctx context.Context, maxId int64, limit int) ([]AsyncSMS, error) {
+	var res []AsyncSMS
+	query := g.db.WithContext(ctx).Where("status = ?", asyncStatusDead)
+	if maxId > 0 {
+		query = query.Where("id < ?", maxId)
+	}
+	err := query.Order("id DESC").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+func (g *GORMAsyncSMSDAO) Requeue(ctx context.Context, id int64) (bool, error) {
+	now := time.Now().UnixMilli()
+	res := g.db.WithContext(ctx).Model(&AsyncSMS{}).
+		Where("id = ? AND status = ?", id, asyncStatusDead).
+		Updates(map[string]any{
+			"status":        asyncStatusWaiting,
+			"retry_cnt":     0,
+			"next_retry_at": now,
+			"utime":         now,
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+// truncateErr last_err 列最多 512 个字符
+func truncateErr(reason string) string {
+	const maxLen = 512
+	r := []rune(reason)
+	if len(r) > maxLen {
+		return string(r[:maxLen])
+	}
+	return reason
+}
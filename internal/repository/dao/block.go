@@ -0,0 +1,92 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BlockRelation 拉黑和静音关系，取消的时候直接删除
+type BlockRelation struct {
+	ID     int64 `gorm:"primaryKey,autoIncrement"`
+	Uid    int64 `gorm:"uniqueIndex:uid_target_type"`
+	Target int64 `gorm:"uniqueIndex:uid_target_type;index"`
+	Type   uint8 `gorm:"uniqueIndex:uid_target_type"`
+	Ctime  int64
+	Utime  int64
+}
+
+type BlockRelationDAO interface {
+	// Upsert 重复拉黑或者静音只更新时间
+	Upsert(ctx context.Context, r BlockRelation) error
+	Delete(ctx context.Context, uid, target int64, typ uint8) error
+	// List 按 id 倒序分页，maxId 为 0 时从头开始
+	List(ctx context.Context, uid int64, typ uint8, maxId, limit int64) ([]BlockRelation, error)
+	// ExistsEither a 和 b 之间任意一方对另一方有 typ 类型的关系
+	ExistsEither(ctx context.Context, a, b int64, typ uint8) (bool, error)
+	// FindTargets uid 拉黑和静音的全部用户
+	FindTargets(ctx context.Context, uid int64) ([]BlockRelation, error)
+	// FindSources 对 target 有 typ 类型关系的全部用户
+	FindSources(ctx context.Context, target int64, typ uint8) ([]int64, error)
+}
+
+type GORMBlockRelationDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMBlockRelationDAO(db *gorm.DB) BlockRelationDAO {
+	return &GORMBlockRelationDAO{
+		db: db,
+	}
+}
+
+func (g *GORMBlockRelationDAO) Upsert(ctx context.Context, r BlockRelation) error {
+	now := time.Now().UnixMilli()
+	r.Ctime = now
+	r.Utime = now
+	return g.db.WithContext(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]any{
+			"utime": now,
+		}),
+	}).Create(&r).Error
+}
+
+func (g *GORMBlockRelationDAO) Delete(ctx context.Context, uid, target int64, typ uint8) error {
+	return g.db.WithContext(ctx).
+		Where("uid = ? AND target = ? AND type = ?", uid, target, typ).
+		Delete(&BlockRelation{}).Error
+}
+
+func (g *GORMBlockRelationDAO) List(ctx context.Context, uid int64, typ uint8, maxId, limit int64) ([]BlockRelation, error) {
+	var res []BlockRelation
+	query := g.db.WithContext(ctx).Where("uid = ? AND type = ?", uid, typ)
+	if maxId > 0 {
+		query = query.Where("id < ?", maxId)
+	}
+	err := query.Order("id DESC").Limit(int(limit)).Find(&res).Error
+	return res, err
+}
+
+func (g *GORMBlockRelationDAO) ExistsEither(ctx context.Context, a, b int64, typ uint8) (bool, error) {
+	var cnt int64
+	err := g.db.WithContext(ctx).Model(&BlockRelation{}).
+		Where("((uid = ? AND target = ?) OR (uid = ? AND target = ?)) AND type = ?", a, b, b, a, typ).
+		Count(&cnt).Error
+	return cnt > 0, err
+}
+
+func (g *GORMBlockRelationDAO) FindTargets(ctx context.Context, uid int64) ([]BlockRelation, error) {
+	var res []BlockRelation
+	err := g.db.WithContext(ctx).Where("uid = ?", uid).Find(&res).Error
+	return res, err
+}
+
+func (g *GORMBlockRelationDAO) FindSources(ctx context.Context, target int64, typ uint8) ([]int64, error) {
+	var res []int64
+	err := g.db.WithContext(ctx).Model(&BlockRelation{}).
+		Where("target = ? AND type = ?", target, typ).
+		Pluck("uid", &res).Error
+	return res, err
+}
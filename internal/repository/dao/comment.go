@@ -3,7 +3,10 @@ package dao
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
 )
 
 // ErrDataNotFound 通用的数据没找到
@@ -14,17 +17,27 @@ type Comment struct {
 	// 发表评论的用户
 	Uid int64 `gorm:"column:uid;index" json:"uid"`
 	// 发表评论的业务类型
-	Biz string `gorm:"column:biz;index:biz_type_id" json:"biz"`
+	Biz string `gorm:"column:biz;index:biz_type_id;index:biz_hot,priority:1" json:"biz"`
 	// 对应的业务ID
-	BizID int64 `gorm:"column:biz_id;index:biz_type_id" json:"bizID"`
+	BizID int64 `gorm:"column:biz_id;index:biz_type_id;index:biz_hot,priority:2" json:"bizID"`
 	// 根评论为0表示一级评论
 	RootID sql.NullInt64 `gorm:"column:root_id;index" json:"rootID"`
 	// 父级评论
 	PID sql.NullInt64 `gorm:"column:pid;index" json:"pid"`
-	// 外键 用于级联删除
-	ParentComment *Comment `gorm:"foreignKey:PID;references:ID;constraint:OnDelete:CASCADE"`
 	// 评论内容
 	Content string `gorm:"type:text;column:content" json:"content"`
+	// 点赞数，冗余自 interactive 表，点赞之后回写
+	LikeCnt int64 `gorm:"column:like_cnt" json:"likeCnt"`
+	// 热度，点赞数变化的时候重新计算
+	HotScore int64 `gorm:"column:hot_score;index:biz_hot,priority:3" json:"hotScore"`
+	// 是否被内容作者置顶
+	Pinned bool `gorm:"column:pinned" json:"pinned"`
+	// 状态，删除之后只保留墓碑，回复链不受影响
+	Status uint8 `gorm:"column:status" json:"status"`
+	// 编辑次数
+	EditCnt int64 `gorm:"column:edit_cnt" json:"editCnt"`
+	// ReplyNotified 是否已经通知过被回复的人，待复审的回复等复审通过之后再通知
+	ReplyNotified bool `gorm:"column:reply_notified" json:"replyNotified"`
 	// 创建时间
 	Ctime int64 `gorm:"column:ctime;" json:"ctime"`
 	// 更新时间
@@ -35,16 +48,68 @@ func (*Comment) TableName() string {
 	return "comments"
 }
 
+// CommentEdit 评论的编辑历史，保存的是编辑之前的内容
+type CommentEdit struct {
+	ID      int64 `gorm:"primaryKey,autoIncrement"`
+	Cid     int64 `gorm:"index:cid_ctime"`
+	Uid     int64
+	Content string `gorm:"type:text"`
+	Ctime   int64  `gorm:"index:cid_ctime"`
+}
+
+// CommentAudit 管理员物理删除评论的审计记录
+type CommentAudit struct {
+	ID       int64 `gorm:"primaryKey,autoIncrement"`
+	Operator int64 `gorm:"index"`
+	// Cid 被删除的子树的根
+	Cid    int64 `gorm:"index"`
+	Reason string
+	// Snapshot 被删除的全部评论，JSON 数组
+	Snapshot string `gorm:"type:longtext"`
+	Ctime    int64
+}
+
+// 和 domain.CommentStatus 保持一致
+const (
+	commentStatusNormal        = 0
+	commentStatusDeleted       = 1
+	commentStatusPendingReview = 2
+)
+
 //go:generate mockgen -source=./comment.go -package=daomocks -destination=mocks/comment.mock.go CommentDAO
 type CommentDAO interface {
+	// Insert 插入评论，同时增加业务对象的评论数
 	Insert(ctx context.Context, u *Comment) (int64, error)
-	// FindByBiz 只查找一级评论
-	FindByBiz(ctx context.Context, biz string, bizId, minID, limit int64) ([]Comment, error)
+	// FindByBiz 只查找一级评论，按 ID 倒序，不包含置顶评论
+	FindByBiz(ctx context.Context, biz string, bizId, maxID, limit int64) ([]Comment, error)
+	// FindHotByBiz 只查找一级评论，按 (hot_score, id) 倒序，不包含置顶评论
+	FindHotByBiz(ctx context.Context, biz string, bizId, maxScore, maxID, limit int64) ([]Comment, error)
+	// FindPinned 查找业务对象的置顶评论
+	FindPinned(ctx context.Context, biz string, bizId int64) (Comment, error)
+	// SetPinned 置顶或者取消置顶，置顶时会先取消同一个业务对象上原有的置顶
+	SetPinned(ctx context.Context, id int64, pinned bool) error
+	// UpdateLikeCnt 回写点赞数和热度
+	UpdateLikeCnt(ctx context.Context, id, likeCnt, hotScore int64) error
 	// FindCommentList Comment的id为0 获取一级评论，如果不为0获取对应的评论，和其评论的所有回复
 	FindCommentList(ctx context.Context, u Comment) ([]Comment, error)
 	FindRepliesByPid(ctx context.Context, pid int64, offset, limit int) ([]Comment, error)
-	// Delete 删除本节点和其对应的子节点
-	Delete(ctx context.Context, u Comment) error
+	// FindRepliesByPids 批量查找每个评论最新的 limit 条直接回复
+	FindRepliesByPids(ctx context.Context, pids []int64, limit int) ([]Comment, error)
+	// CountRepliesByRids 每个根评论下面未删除的回复数
+	CountRepliesByRids(ctx context.Context, rids []int64) (map[int64]int64, error)
+	// SoftDelete 只修改状态，保留节点和全部回复，同时减少业务对象的评论数
+	// 返回删除之前的评论，如果之前已经是删除状态，则什么都不做
+	SoftDelete(ctx context.Context, id int64) (Comment, error)
+	// UpdateContent 修改内容并记录一条编辑历史，已经删除的评论不会被修改
+	// pending 为 true 时评论同时进入待复审状态，为 false 时保持原来的状态
+	UpdateContent(ctx context.Context, id int64, content string, pending bool, edit CommentEdit) error
+	// SetPendingReview 进入或者退出待复审状态，已经删除的评论不会被修改，返回修改之前的评论
+	SetPendingReview(ctx context.Context, id int64, pending bool) (Comment, error)
+	// MarkReplyNotified 标记已经通知过被回复的人，返回 true 表示这次才标记上
+	MarkReplyNotified(ctx context.Context, id int64) (bool, error)
+	FindEdits(ctx context.Context, cid int64) ([]CommentEdit, error)
+	// DeleteSubtree 物理删除评论以及它下面的全部回复，同时写入审计记录并减少评论数，返回被删除的评论
+	DeleteSubtree(ctx context.Context, id int64, audit CommentAudit) ([]Comment, error)
 	FindOneByIDs(ctx context.Context, id []int64) ([]Comment, error)
 	FindRepliesByRid(ctx context.Context, rid int64, id int64, limit int64) ([]Comment, error)
 }
@@ -59,19 +124,99 @@ func NewGORMCommentDAO(db *gorm.DB) CommentDAO {
 }
 
 func (c *GORMCommentDAO) Insert(ctx context.Context, u *Comment) (int64, error) {
-	err := c.db.WithContext(ctx).Create(u).Error
+	err := c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(u).Error; err != nil {
+			return err
+		}
+		return c.incrCommentCnt(tx, u.Biz, u.BizID, 1)
+	})
 	return u.ID, err
 }
 
+// incrCommentCnt 评论数和点赞数、收藏数一样维护在 interactive 表里面
+func (c *GORMCommentDAO) incrCommentCnt(tx *gorm.DB, biz string, bizId int64, delta int64) error {
+	now := time.Now().UnixMilli()
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "biz_id"}, {Name: "biz"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"comment_cnt": gorm.Expr("`comment_cnt` + ?", delta),
+			"utime":       now,
+		}),
+	}).Create(&Interactive{
+		Biz:        biz,
+		BizID:      bizId,
+		CommentCnt: delta,
+		Ctime:      now,
+		Utime:      now,
+	}).Error
+}
+
 // FindByBiz 只查找一级评论
-func (c *GORMCommentDAO) FindByBiz(ctx context.Context, biz string, bizId, minID, limit int64) ([]Comment, error) {
+func (c *GORMCommentDAO) FindByBiz(ctx context.Context, biz string, bizId, maxID, limit int64) ([]Comment, error) {
 	var res []Comment
 	err := c.db.WithContext(ctx).
-		Where("biz = ? AND biz_id = ? AND id < ? AND pid IS NULL", biz, bizId, minID).
+		Where("biz = ? AND biz_id = ? AND id < ? AND pid IS NULL AND pinned = ?", biz, bizId, maxID, false).
+		Order("id DESC").
 		Limit(int(limit)).Find(&res).Error
 	return res, err
 }
 
+func (c *GORMCommentDAO) FindHotByBiz(ctx context.Context, biz string, bizId, maxScore, maxID, limit int64) ([]Comment, error) {
+	var res []Comment
+	err := c.db.WithContext(ctx).
+		Where("biz = ? AND biz_id = ? AND pid IS NULL AND pinned = ?", biz, bizId, false).
+		Where("hot_score < ? OR (hot_score = ? AND id < ?)", maxScore, maxScore, maxID).
+		Order("hot_score DESC, id DESC").
+		Limit(int(limit)).Find(&res).Error
+	return res, err
+}
+
+func (c *GORMCommentDAO) FindPinned(ctx context.Context, biz string, bizId int64) (Comment, error) {
+	var res Comment
+	err := c.db.WithContext(ctx).
+		Where("biz = ? AND biz_id = ? AND pinned = ?", biz, bizId, true).
+		First(&res).Error
+	return res, err
+}
+
+func (c *GORMCommentDAO) SetPinned(ctx context.Context, id int64, pinned bool) error {
+	now := time.Now().UnixMilli()
+	return c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var cm Comment
+		// 锁住目标评论，避免并发置顶同一个业务对象的两条评论
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", id).First(&cm).Error
+		if err != nil {
+			return err
+		}
+		if pinned {
+			err = tx.Model(&Comment{}).
+				Where("biz = ? AND biz_id = ? AND pinned = ? AND id <> ?", cm.Biz, cm.BizID, true, id).
+				Updates(map[string]any{
+					"pinned": false,
+					"utime":  now,
+				}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&Comment{}).Where("id = ?", id).
+			Updates(map[string]any{
+				"pinned": pinned,
+				"utime":  now,
+			}).Error
+	})
+}
+
+func (c *GORMCommentDAO) UpdateLikeCnt(ctx context.Context, id, likeCnt, hotScore int64) error {
+	// 不更新 utime，utime 表示评论内容的修改时间
+	return c.db.WithContext(ctx).Model(&Comment{}).Where("id = ?", id).
+		Updates(map[string]any{
+			"like_cnt":  likeCnt,
+			"hot_score": hotScore,
+		}).Error
+}
+
 // FindCommentList Comment的id为0 获取一级评论，如果不为0 获取对应的评论，和其评论的所有回复
 func (c *GORMCommentDAO) FindCommentList(ctx context.Context, u Comment) ([]Comment, error) {
 	var res []Comment
@@ -95,14 +240,182 @@ func (c *GORMCommentDAO) FindRepliesByPid(ctx context.Context, pid int64, offset
 		Order("id DESC").Offset(offset).Limit(limit).Find(&res).Error
 	return res, err
 }
-func (c *GORMCommentDAO) Delete(ctx context.Context, u Comment) error {
-	return c.db.WithContext(ctx).Delete(&Comment{
-		ID: u.ID,
-	}).Error
+func (c *GORMCommentDAO) FindRepliesByPids(ctx context.Context, pids []int64, limit int) ([]Comment, error) {
+	var res []Comment
+	if len(pids) == 0 {
+		return res, nil
+	}
+	// 用窗口函数一次查出每个评论的前 limit 条回复，代替逐个评论查询
+	err := c.db.WithContext(ctx).Raw(`SELECT * FROM (
+	SELECT *, ROW_NUMBER() OVER (PARTITION BY pid ORDER BY id DESC) AS rn
+	FROM comments WHERE pid IN ?
+) t WHERE t.rn <= ? ORDER BY t.pid, t.id DESC`, pids, limit).Scan(&res).Error
+	return res, err
+}
+
+func (c *GORMCommentDAO) CountRepliesByRids(ctx context.Context, rids []int64) (map[int64]int64, error) {
+	res := make(map[int64]int64, len(rids))
+	if len(rids) == 0 {
+		return res, nil
+	}
+	var rows []struct {
+		RootID int64
+		Cnt    int64
+	}
+	err := c.db.WithContext(ctx).Model(&Comment{}).
+		Select("root_id, COUNT(*) AS cnt").
+		Where("root_id IN ? AND status <> ?", rids, commentStatusDeleted).
+		Group("root_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		res[row.RootID] = row.Cnt
+	}
+	return res, nil
+}
+
+func (c *GORMCommentDAO) SoftDelete(ctx context.Context, id int64) (Comment, error) {
+	var cm Comment
+	err := c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 锁住评论，避免并发删除重复扣减评论数
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", id).First(&cm).Error
+		if err != nil || cm.Status == commentStatusDeleted {
+			return err
+		}
+		// 墓碑不再保留置顶
+		err = tx.Model(&Comment{}).Where("id = ?", id).
+			Updates(map[string]any{
+				"status": commentStatusDeleted,
+				"pinned": false,
+				"utime":  time.Now().UnixMilli(),
+			}).Error
+		if err != nil {
+			return err
+		}
+		return c.incrCommentCnt(tx, cm.Biz, cm.BizID, -1)
+	})
+	return cm, err
+}
+
+func (c *GORMCommentDAO) UpdateContent(ctx context.Context, id int64, content string, pending bool, edit CommentEdit) error {
+	now := time.Now().UnixMilli()
+	updates := map[string]any{
+		"content":  content,
+		"edit_cnt": gorm.Expr("`edit_cnt` + 1"),
+		"utime":    now,
+	}
+	if pending {
+		updates["status"] = commentStatusPendingReview
+	}
+	return c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Comment{}).
+			Where("id = ? AND status <> ?", id, commentStatusDeleted).
+			Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrDataNotFound
+		}
+		edit.Cid = id
+		edit.Ctime = now
+		return tx.Create(&edit).Error
+	})
+}
+
+func (c *GORMCommentDAO) SetPendingReview(ctx context.Context, id int64, pending bool) (Comment, error) {
+	var cm Comment
+	status := commentStatusNormal
+	if pending {
+		status = commentStatusPendingReview
+	}
+	err := c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", id).First(&cm).Error
+		if err != nil || cm.Status == commentStatusDeleted || cm.Status == uint8(status) {
+			return err
+		}
+		return tx.Model(&Comment{}).Where("id = ?", id).
+			Updates(map[string]any{
+				"status": status,
+				"utime":  time.Now().UnixMilli(),
+			}).Error
+	})
+	return cm, err
+}
+
+func (c *GORMCommentDAO) MarkReplyNotified(ctx context.Context, id int64) (bool, error) {
+	res := c.db.WithContext(ctx).Model(&Comment{}).
+		Where("id = ? AND reply_notified = ?", id, false).
+		Update("reply_notified", true)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (c *GORMCommentDAO) FindEdits(ctx context.Context, cid int64) ([]CommentEdit, error) {
+	var res []CommentEdit
+	err := c.db.WithContext(ctx).Where("cid = ?", cid).
+		Order("ctime DESC").Find(&res).Error
+	return res, err
+}
+
+func (c *GORMCommentDAO) DeleteSubtree(ctx context.Context, id int64, audit CommentAudit) ([]Comment, error) {
+	var deleted []Comment
+	err := c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var root Comment
+		if err := tx.Where("id = ?", id).First(&root).Error; err != nil {
+			return err
+		}
+		deleted = append(deleted, root)
+		// root_id 并不可靠，按照 pid 一层一层往下找
+		ids := []int64{id}
+		for len(ids) > 0 {
+			var children []Comment
+			if err := tx.Where("pid IN ?", ids).Find(&children).Error; err != nil {
+				return err
+			}
+			deleted = append(deleted, children...)
+			ids = ids[:0]
+			for _, child := range children {
+				ids = append(ids, child.ID)
+			}
+		}
+		all := make([]int64, 0, len(deleted))
+		var alive int64
+		for _, cm := range deleted {
+			all = append(all, cm.ID)
+			if cm.Status != commentStatusDeleted {
+				alive++
+			}
+		}
+		snapshot, err := json.Marshal(deleted)
+		if err != nil {
+			return err
+		}
+		audit.Cid = id
+		audit.Snapshot = string(snapshot)
+		audit.Ctime = time.Now().UnixMilli()
+		if err = tx.Create(&audit).Error; err != nil {
+			return err
+		}
+		if err = tx.Where("cid IN ?", all).Delete(&CommentEdit{}).Error; err != nil {
+			return err
+		}
+		if err = tx.Where("id IN ?", all).Delete(&Comment{}).Error; err != nil {
+			return err
+		}
+		// 软删除的时候已经扣减过了
+		if alive == 0 {
+			return nil
+		}
+		return c.incrCommentCnt(tx, root.Biz, root.BizID, -alive)
+	})
+	return deleted, err
 }
 func (c *GORMCommentDAO) FindOneByIDs(ctx context.Context, ids []int64) ([]Comment, error) {
 	var res []Comment
-	err := c.db.WithContext(ctx).Where("id in ?", ids).First(&res).Error
+	err := c.db.WithContext(ctx).Where("id in ?", ids).Find(&res).Error
 	return res, err
 }
 
@@ -0,0 +1,92 @@
+package dao
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func newMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	require.NoError(t, err)
+	return db, mock
+}
+
+func TestGORMCommentDAO_FindHotByBiz(t *testing.T) {
+	const hotQuery = "SELECT * FROM `comments` WHERE (biz = ? AND biz_id = ? AND pid IS NULL AND pinned = ?) " +
+		"AND (hot_score < ? OR (hot_score = ? AND id < ?)) ORDER BY hot_score DESC, id DESC LIMIT ?"
+	testCases := []struct {
+		name     string
+		maxScore int64
+		maxID    int64
+		mock     func(mock sqlmock.Sqlmock, maxScore, maxID int64)
+		wantIds  []int64
+		wantErr  error
+	}{
+		{
+			name:     "第一页",
+			maxScore: math.MaxInt64,
+			maxID:    math.MaxInt64,
+			mock: func(mock sqlmock.Sqlmock, maxScore, maxID int64) {
+				rows := sqlmock.NewRows([]string{"id", "hot_score"}).
+					AddRow(3, 200).AddRow(2, 100).AddRow(1, 100)
+				mock.ExpectQuery(regexp.QuoteMeta(hotQuery)).
+					WithArgs("article", 100, false, maxScore, maxScore, maxID, 3).
+					WillReturnRows(rows)
+			},
+			wantIds: []int64{3, 2, 1},
+		},
+		{
+			name:     "热度相同的评论按 id 翻页",
+			maxScore: 100,
+			maxID:    2,
+			mock: func(mock sqlmock.Sqlmock, maxScore, maxID int64) {
+				rows := sqlmock.NewRows([]string{"id", "hot_score"}).AddRow(1, 100)
+				mock.ExpectQuery(regexp.QuoteMeta(hotQuery)).
+					WithArgs("article", 100, false, maxScore, maxScore, maxID, 3).
+					WillReturnRows(rows)
+			},
+			wantIds: []int64{1},
+		},
+		{
+			name:     "查询失败",
+			maxScore: 100,
+			maxID:    2,
+			mock: func(mock sqlmock.Sqlmock, maxScore, maxID int64) {
+				mock.ExpectQuery(regexp.QuoteMeta(hotQuery)).WillReturnError(assert.AnError)
+			},
+			wantErr: assert.AnError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			tc.mock(mock, tc.maxScore, tc.maxID)
+			res, err := NewGORMCommentDAO(db).FindHotByBiz(context.Background(), "article", 100, tc.maxScore, tc.maxID, 3)
+			assert.ErrorIs(t, err, tc.wantErr)
+			ids := make([]int64, 0, len(res))
+			for _, c := range res {
+				ids = append(ids, c.ID)
+			}
+			if err == nil {
+				assert.Equal(t, tc.wantIds, ids)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
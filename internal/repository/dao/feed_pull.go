@@ -2,22 +2,37 @@ package dao
 
 import (
 	"context"
+	"github.com/ecodeclub/ekit/slice"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type FeedPullEvent struct {
 	Id      int64  `gorm:"primaryKey,autoIncrement"`
-	UID     int64  `gorm:"column:uid;type:int(11);not null;"`
-	Type    string `gorm:"column:type;type:varchar(255);comment:类型"`
+	UID     int64  `gorm:"column:uid;type:int(11);not null;index:idx_pull_uid_type_ctime,priority:1"`
+	Type    string `gorm:"column:type;type:varchar(255);comment:类型;index:idx_pull_uid_type_ctime,priority:2"`
 	Content string `gorm:"column:content;type:text;"`
-	Ctime   int64  `gorm:"column:ctime;comment:发生时间"` // 发生时间
+	// EventId 同一个事件推拉两份共用，作为翻页时同一毫秒内的排序依据
+	EventId string `gorm:"column:event_id;type:varchar(36);not null;default:'';index:idx_pull_uid_type_ctime,priority:4"`
+	Ctime   int64  `gorm:"column:ctime;comment:发生时间;index:idx_pull_uid_type_ctime,priority:3;index:idx_pull_ctime"` // 发生时间，毫秒
+}
+
+// FeedPullEventArchive 超过保留期的拉事件，从线上表搬到这里
+type FeedPullEventArchive FeedPullEvent
+
+func (FeedPullEventArchive) TableName() string {
+	return "feed_pull_event_archives"
 }
 
 // FeedPullEventDAO 拉模型
+// 查询都按 (ctime, event_id) 倒序，ctime 为 0 表示从最新的事件开始，
+// 否则只返回 (ctime, event_id) 严格小于游标的事件
 type FeedPullEventDAO interface {
 	CreatePullEvent(ctx context.Context, event FeedPullEvent) error
-	FindPullEventList(ctx context.Context, uids []int64, timestamp, limit int64) ([]FeedPullEvent, error)
-	FindPullEventListWithTyp(ctx context.Context, typ string, uids []int64, timestamp, limit int64) ([]FeedPullEvent, error)
+	FindPullEventList(ctx context.Context, uids []int64, ctime int64, eventId string, limit int64) ([]FeedPullEvent, error)
+	FindPullEventListWithTyp(ctx context.Context, typ string, uids []int64, ctime int64, eventId string, limit int64) ([]FeedPullEvent, error)
+	// ArchiveBefore 把 ctime 之前的最多 limit 条事件搬到归档表，返回搬走的条数
+	ArchiveBefore(ctx context.Context, ctime int64, limit int) (int64, error)
 }
 
 type feedPullEventDAO struct {
@@ -34,25 +49,60 @@ func (f *feedPullEventDAO) CreatePullEvent(ctx context.Context, event FeedPullEv
 	return f.db.WithContext(ctx).Create(&event).Error
 }
 
-func (f *feedPullEventDAO) FindPullEventList(ctx context.Context, uids []int64, timestamp, limit int64) ([]FeedPullEvent, error) {
+func (f *feedPullEventDAO) FindPullEventList(ctx context.Context, uids []int64, ctime int64, eventId string, limit int64) ([]FeedPullEvent, error) {
 	var events []FeedPullEvent
 	err := f.db.WithContext(ctx).
 		Where("uid in ?", uids).
-		Where("ctime < ?", timestamp).
-		Order("ctime desc").
+		Scopes(feedCursor(ctime, eventId)).
+		Order("ctime desc, event_id desc").
 		Limit(int(limit)).
 		Find(&events).Error
 	return events, err
 }
 
-func (f *feedPullEventDAO) FindPullEventListWithTyp(ctx context.Context, typ string, uids []int64, timestamp, limit int64) ([]FeedPullEvent, error) {
+func (f *feedPullEventDAO) FindPullEventListWithTyp(ctx context.Context, typ string, uids []int64, ctime int64, eventId string, limit int64) ([]FeedPullEvent, error) {
 	var events []FeedPullEvent
 	err := f.db.WithContext(ctx).
 		Where("uid in ?", uids).
-		Where("ctime < ?", timestamp).
 		Where("type = ?", typ).
-		Order("ctime desc").
+		Scopes(feedCursor(ctime, eventId)).
+		Order("ctime desc, event_id desc").
 		Limit(int(limit)).
 		Find(&events).Error
 	return events, err
 }
+
+func (f *feedPullEventDAO) ArchiveBefore(ctx context.Context, ctime int64, limit int) (int64, error) {
+	var cnt int64
+	err := f.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var events []FeedPullEvent
+		err := tx.Where("ctime < ?", ctime).Order("ctime, id").Limit(limit).Find(&events).Error
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		archives := slice.Map(events, func(idx int, src FeedPullEvent) FeedPullEventArchive {
+			return FeedPullEventArchive(src)
+		})
+		err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&archives).Error
+		if err != nil {
+			return err
+		}
+		ids := slice.Map(events, func(idx int, src FeedPullEvent) int64 {
+			return src.Id
+		})
+		res := tx.Where("id IN ?", ids).Delete(&FeedPullEvent{})
+		cnt = res.RowsAffected
+		return res.Error
+	})
+	return cnt, err
+}
+
+// feedCursor 按 (ctime, event_id) 游标过滤
+func feedCursor(ctime int64, eventId string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if ctime <= 0 {
+			return db
+		}
+		return db.Where("(ctime < ? OR (ctime = ? AND event_id < ?))", ctime, ctime, eventId)
+	}
+}
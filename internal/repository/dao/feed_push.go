@@ -2,22 +2,39 @@ package dao
 
 import (
 	"context"
+	"github.com/ecodeclub/ekit/slice"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type FeedPushEvent struct {
 	Id      int64  `gorm:"primaryKey,autoIncrement"`
-	UID     int64  `gorm:"column:uid;type:int(11);not null;"`
-	Type    string `gorm:"column:type;type:varchar(255);comment:类型"`
+	UID     int64  `gorm:"column:uid;type:int(11);not null;index:idx_push_uid_type_ctime,priority:1"`
+	Type    string `gorm:"column:type;type:varchar(255);comment:类型;index:idx_push_uid_type_ctime,priority:2"`
 	Content string `gorm:"column:content;type:text;"`
-	// 发生时间
-	Ctime int64 `gorm:"column:ctime;comment:发生时间"`
+	// EventId 同一个事件推拉两份共用，作为翻页时同一毫秒内的排序依据
+	EventId string `gorm:"column:event_id;type:varchar(36);not null;default:'';index:idx_push_uid_type_ctime,priority:4"`
+	// 发生时间，毫秒
+	Ctime int64 `gorm:"column:ctime;comment:发生时间;index:idx_push_uid_type_ctime,priority:3;index:idx_push_ctime"`
 }
+
+// FeedPushEventArchive 超过保留期的推事件，从线上表搬到这里
+type FeedPushEventArchive FeedPushEvent
+
+func (FeedPushEventArchive) TableName() string {
+	return "feed_push_event_archives"
+}
+
 type FeedPushEventDAO interface {
-	// CreatePushEvents 创建推送事件
+	// CreatePushEvents 创建推送事件，创建成功后 events 中会回填 Id
 	CreatePushEvents(ctx context.Context, events []FeedPushEvent) error
-	GetPushEvents(ctx context.Context, uid int64, timestamp, limit int64) ([]FeedPushEvent, error)
-	GetPushEventsWithTyp(ctx context.Context, typ string, uid int64, timestamp, limit int64) ([]FeedPushEvent, error)
+	// GetPushEvents 按 (ctime, event_id) 倒序，ctime 为 0 表示从最新的事件开始
+	GetPushEvents(ctx context.Context, uid int64, ctime int64, eventId string, limit int64) ([]FeedPushEvent, error)
+	GetPushEventsWithTyp(ctx context.Context, typ string, uid int64, ctime int64, eventId string, limit int64) ([]FeedPushEvent, error)
+	// DeletePushEvents 删除 uid 收件箱中的指定事件
+	DeletePushEvents(ctx context.Context, uid int64, ids []int64) error
+	// ArchiveBefore 把 ctime 之前的最多 limit 条事件搬到归档表，返回搬走的条数
+	ArchiveBefore(ctx context.Context, ctime int64, limit int) (int64, error)
 }
 
 type feedPushEventDAO struct {
@@ -34,24 +51,56 @@ func (f *feedPushEventDAO) CreatePushEvents(ctx context.Context, events []FeedPu
 	return f.db.WithContext(ctx).Create(events).Error
 }
 
-func (f *feedPushEventDAO) GetPushEvents(ctx context.Context, uid int64, timestamp, limit int64) ([]FeedPushEvent, error) {
+func (f *feedPushEventDAO) GetPushEvents(ctx context.Context, uid int64, ctime int64, eventId string, limit int64) ([]FeedPushEvent, error) {
 	var events []FeedPushEvent
 	err := f.db.WithContext(ctx).
 		Where("uid = ?", uid).
-		Where("ctime < ?", timestamp).
-		Order("ctime desc").
+		Scopes(feedCursor(ctime, eventId)).
+		Order("ctime desc, event_id desc").
 		Limit(int(limit)).
 		Find(&events).Error
 	return events, err
 }
-func (f *feedPushEventDAO) GetPushEventsWithTyp(ctx context.Context, typ string, uid int64, timestamp, limit int64) ([]FeedPushEvent, error) {
+func (f *feedPushEventDAO) GetPushEventsWithTyp(ctx context.Context, typ string, uid int64, ctime int64, eventId string, limit int64) ([]FeedPushEvent, error) {
 	var events []FeedPushEvent
 	err := f.db.WithContext(ctx).
 		Where("uid = ?", uid).
-		Where("ctime < ?", timestamp).
 		Where("type = ?", typ).
-		Order("ctime desc").
+		Scopes(feedCursor(ctime, eventId)).
+		Order("ctime desc, event_id desc").
 		Limit(int(limit)).
 		Find(&events).Error
 	return events, err
 }
+
+func (f *feedPushEventDAO) DeletePushEvents(ctx context.Context, uid int64, ids []int64) error {
+	return f.db.WithContext(ctx).
+		Where("uid = ? AND id IN ?", uid, ids).
+		Delete(&FeedPushEvent{}).Error
+}
+
+func (f *feedPushEventDAO) ArchiveBefore(ctx context.Context, ctime int64, limit int) (int64, error) {
+	var cnt int64
+	err := f.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var events []FeedPushEvent
+		err := tx.Where("ctime < ?", ctime).Order("ctime, id").Limit(limit).Find(&events).Error
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		archives := slice.Map(events, func(idx int, src FeedPushEvent) FeedPushEventArchive {
+			return FeedPushEventArchive(src)
+		})
+		// 上一次搬到一半失败重试的时候，归档表里面可能已经有了
+		err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&archives).Error
+		if err != nil {
+			return err
+		}
+		ids := slice.Map(events, func(idx int, src FeedPushEvent) int64 {
+			return src.Id
+		})
+		res := tx.Where("id IN ?", ids).Delete(&FeedPushEvent{})
+		cnt = res.RowsAffected
+		return res.Error
+	})
+	return cnt, err
+}
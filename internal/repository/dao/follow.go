@@ -16,7 +16,8 @@ type FollowRelation struct {
 	ID int64 `gorm:"primaryKey,autoIncrement,column:id"`
 
 	Follower int64 `gorm:"type:int(11);not null;uniqueIndex:follower_followee"`
-	Followee int64 `gorm:"type:int(11);not null;uniqueIndex:follower_followee"`
+	// 查粉丝列表走 followee 上的索引
+	Followee int64 `gorm:"type:int(11);not null;uniqueIndex:follower_followee;index"`
 
 	Status uint8
 
@@ -31,10 +32,22 @@ type FollowRelation struct {
 }
 
 type FollowRelationDao interface {
-	// 获取莫人的粉丝列表
-	GetFollowerList(ctx context.Context, followee int64) ([]FollowRelation, error)
-	// FollowRelationList 获取某人的关注列表
-	FollowRelationList(ctx context.Context, follower, offset, limit int64) ([]FollowRelation, error)
+	// GetFollowerList 按 id 倒序获取某人的粉丝列表，maxId 为 0 时从头开始，否则只返回 id 小于 maxId 的
+	GetFollowerList(ctx context.Context, followee, maxId, limit int64) ([]FollowRelation, error)
+	// GetFollowerBatch 按 id 升序分批获取粉丝，只返回 id 大于 minId 的
+	GetFollowerBatch(ctx context.Context, followee, minId, limit int64) ([]FollowRelation, error)
+	// FollowRelationList 按 id 倒序获取某人的关注列表，maxId 的含义同 GetFollowerList
+	FollowRelationList(ctx context.Context, follower, maxId, limit int64) ([]FollowRelation, error)
+	// MutualList 按 id 倒序获取和 uid 互相关注的关系，返回的是 uid 作为 follower 的那一条
+	MutualList(ctx context.Context, uid, maxId, limit int64) ([]FollowRelation, error)
+	// FolloweeIds 获取某人关注的全部用户 id
+	FolloweeIds(ctx context.Context, follower int64) ([]int64, error)
+	// FollowerIds 获取某人的全部粉丝 id
+	FollowerIds(ctx context.Context, followee int64) ([]int64, error)
+	// FindFolloweesIn 在 followees 中找出 follower 关注了的人
+	FindFolloweesIn(ctx context.Context, follower int64, followees []int64) ([]int64, error)
+	// FindFollowersIn 在 followers 中找出关注了 followee 的人
+	FindFollowersIn(ctx context.Context, followee int64, followers []int64) ([]int64, error)
 	FollowRelationDetail(ctx context.Context, follower int64, followee int64) (FollowRelation, error)
 	// CreateFollowRelation 创建联系人
 	CreateFollowRelation(ctx context.Context, c FollowRelation) error
@@ -54,19 +67,86 @@ func NewGORMFollowRelationDAO(db *gorm.DB) FollowRelationDao {
 		db: db,
 	}
 }
-func (g *GORMFollowRelationDAO) GetFollowerList(ctx context.Context, followee int64) ([]FollowRelation, error) {
+func (g *GORMFollowRelationDAO) GetFollowerList(ctx context.Context, followee, maxId, limit int64) ([]FollowRelation, error) {
 	var res []FollowRelation
-	err := g.db.WithContext(ctx).
-		Where("followee = ? AND status = ?", followee, FollowRelationStatusActive).
-		Find(&res).Error
+	query := g.db.WithContext(ctx).
+		Where("followee = ? AND status = ?", followee, FollowRelationStatusActive)
+	if maxId > 0 {
+		query = query.Where("id < ?", maxId)
+	}
+	err := query.Order("id DESC").Limit(int(limit)).Find(&res).Error
 	return res, err
 }
 
-func (g *GORMFollowRelationDAO) FollowRelationList(ctx context.Context, follower, offset, limit int64) ([]FollowRelation, error) {
+func (g *GORMFollowRelationDAO) GetFollowerBatch(ctx context.Context, followee, minId, limit int64) ([]FollowRelation, error) {
 	var res []FollowRelation
 	err := g.db.WithContext(ctx).
+		Where("followee = ? AND status = ? AND id > ?", followee, FollowRelationStatusActive, minId).
+		Order("id ASC").
+		Limit(int(limit)).Find(&res).Error
+	return res, err
+}
+
+func (g *GORMFollowRelationDAO) FollowRelationList(ctx context.Context, follower, maxId, limit int64) ([]FollowRelation, error) {
+	var res []FollowRelation
+	query := g.db.WithContext(ctx).
+		Where("follower = ? AND status = ?", follower, FollowRelationStatusActive)
+	if maxId > 0 {
+		query = query.Where("id < ?", maxId)
+	}
+	err := query.Order("id DESC").Limit(int(limit)).Find(&res).Error
+	return res, err
+}
+
+func (g *GORMFollowRelationDAO) MutualList(ctx context.Context, uid, maxId, limit int64) ([]FollowRelation, error) {
+	var res []FollowRelation
+	query := g.db.WithContext(ctx).Table("follow_relations AS a").
+		Select("a.*").
+		Joins("JOIN follow_relations AS b ON b.follower = a.followee AND b.followee = a.follower AND b.status = ?",
+			FollowRelationStatusActive).
+		Where("a.follower = ? AND a.status = ?", uid, FollowRelationStatusActive)
+	if maxId > 0 {
+		query = query.Where("a.id < ?", maxId)
+	}
+	err := query.Order("a.id DESC").Limit(int(limit)).Find(&res).Error
+	return res, err
+}
+
+func (g *GORMFollowRelationDAO) FolloweeIds(ctx context.Context, follower int64) ([]int64, error) {
+	var res []int64
+	err := g.db.WithContext(ctx).Model(&FollowRelation{}).
 		Where("follower = ? AND status = ?", follower, FollowRelationStatusActive).
-		Offset(int(offset)).Limit(int(limit)).Find(&res).Error
+		Pluck("followee", &res).Error
+	return res, err
+}
+
+func (g *GORMFollowRelationDAO) FollowerIds(ctx context.Context, followee int64) ([]int64, error) {
+	var res []int64
+	err := g.db.WithContext(ctx).Model(&FollowRelation{}).
+		Where("followee = ? AND status = ?", followee, FollowRelationStatusActive).
+		Pluck("follower", &res).Error
+	return res, err
+}
+
+func (g *GORMFollowRelationDAO) FindFolloweesIn(ctx context.Context, follower int64, followees []int64) ([]int64, error) {
+	var res []int64
+	if len(followees) == 0 {
+		return res, nil
+	}
+	err := g.db.WithContext(ctx).Model(&FollowRelation{}).
+		Where("follower = ? AND followee IN ? AND status = ?", follower, followees, FollowRelationStatusActive).
+		Pluck("followee", &res).Error
+	return res, err
+}
+
+func (g *GORMFollowRelationDAO) FindFollowersIn(ctx context.Context, followee int64, followers []int64) ([]int64, error) {
+	var res []int64
+	if len(followers) == 0 {
+		return res, nil
+	}
+	err := g.db.WithContext(ctx).Model(&FollowRelation{}).
+		Where("followee = ? AND follower IN ? AND status = ?", followee, followers, FollowRelationStatusActive).
+		Pluck("follower", &res).Error
 	return res, err
 }
 
@@ -0,0 +1,78 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// RecommendCandidate 候选人以及命中的次数，比如有几个关注的人关注了他
+type RecommendCandidate struct {
+	Uid int64
+	Cnt int64
+}
+
+// FollowRecommendDAO 关注推荐用到的统计查询，只读，跨关注、标签和点赞几张表
+type FollowRecommendDAO interface {
+	// SecondDegree uid 关注的人关注的人，按共同关注的人数倒序
+	SecondDegree(ctx context.Context, uid int64, limit int) ([]RecommendCandidate, error)
+	// SharedTags 给自己的内容打过和 uid 同名标签的人，按同名标签数倒序
+	SharedTags(ctx context.Context, uid int64, limit int) ([]RecommendCandidate, error)
+	// LikedAuthors uid 点赞过的文章的作者，按点赞数倒序
+	LikedAuthors(ctx context.Context, uid int64, limit int) ([]RecommendCandidate, error)
+	// FindUids 按 id 升序分批获取用户 id，只返回 id 大于 minUid 的
+	FindUids(ctx context.Context, minUid int64, limit int) ([]int64, error)
+}
+
+type GORMFollowRecommendDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMFollowRecommendDAO(db *gorm.DB) FollowRecommendDAO {
+	return &GORMFollowRecommendDAO{
+		db: db,
+	}
+}
+
+func (g *GORMFollowRecommendDAO) SecondDegree(ctx context.Context, uid int64, limit int) ([]RecommendCandidate, error) {
+	var res []RecommendCandidate
+	err := g.db.WithContext(ctx).Table("follow_relations AS a").
+		Select("b.followee AS uid, COUNT(*) AS cnt").
+		Joins("JOIN follow_relations AS b ON b.follower = a.followee AND b.status = ?", FollowRelationStatusActive).
+		Where("a.follower = ? AND a.status = ? AND b.followee <> ?", uid, FollowRelationStatusActive, uid).
+		Group("b.followee").Order("cnt DESC").Limit(limit).
+		Scan(&res).Error
+	return res, err
+}
+
+func (g *GORMFollowRecommendDAO) SharedTags(ctx context.Context, uid int64, limit int) ([]RecommendCandidate, error) {
+	var res []RecommendCandidate
+	err := g.db.WithContext(ctx).Table("tags AS a").
+		Select("tb.uid AS uid, COUNT(DISTINCT b.name) AS cnt").
+		Joins("JOIN tags AS b ON b.name = a.name AND b.uid <> a.uid").
+		Joins("JOIN tag_bizs AS tb ON tb.tid = b.id").
+		Where("a.uid = ?", uid).
+		Group("tb.uid").Order("cnt DESC").Limit(limit).
+		Scan(&res).Error
+	return res, err
+}
+
+func (g *GORMFollowRecommendDAO) LikedAuthors(ctx context.Context, uid int64, limit int) ([]RecommendCandidate, error) {
+	var res []RecommendCandidate
+	err := g.db.WithContext(ctx).Table("user_like_bizs AS l").
+		Select("p.author_id AS uid, COUNT(*) AS cnt").
+		Joins("JOIN published_articles AS p ON p.id = l.biz_id").
+		Where("l.uid = ? AND l.biz = ? AND l.status = ? AND p.author_id <> ?", uid, "article", 1, uid).
+		Group("p.author_id").Order("cnt DESC").Limit(limit).
+		Scan(&res).Error
+	return res, err
+}
+
+func (g *GORMFollowRecommendDAO) FindUids(ctx context.Context, minUid int64, limit int) ([]int64, error) {
+	var res []int64
+	err := g.db.WithContext(ctx).Model(&User{}).
+		Where("id > ?", minUid).
+		Order("id ASC").Limit(limit).
+		Pluck("id", &res).Error
+	return res, err
+}
@@ -1,9 +1,14 @@
 package dao
 
-import "gorm.io/gorm"
+import (
+	"archi/internal/domain"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 func InitTables(db *gorm.DB) error {
-	return db.AutoMigrate(
+	err := db.AutoMigrate(
 		&User{},
 		&Article{},
 		&PublishedArticle{},
@@ -13,10 +18,117 @@ func InitTables(db *gorm.DB) error {
 		&AsyncSMS{},
 		&Job{},
 		&Comment{},
+		&CommentEdit{},
+		&CommentAudit{},
 		&FollowRelation{},
+		&BlockRelation{},
 		&Tag{},
 		&TagBiz{},
 		&FeedPullEvent{},
 		&FeedPushEvent{},
+		&FeedPullEventArchive{},
+		&FeedPushEventArchive{},
+		&AiResponse{},
+		&AiToolAudit{},
+		&Moderation{},
+		&Notification{},
+		&NotificationActor{},
+		&NotificationMute{},
+		&Mention{},
 	)
+	if err != nil {
+		return err
+	}
+	if err = migrateFeedCtimeMilli(db); err != nil {
+		return err
+	}
+	if err = migrateFeedLegacyEventId(db); err != nil {
+		return err
+	}
+	if err = migrateNotifiedFlags(db); err != nil {
+		return err
+	}
+	return migrateCommentHotScore(db)
+}
+
+// feedCtimeMilliBoundary 秒级时间戳在 5138 年之前都小于它，毫秒级时间戳在 1973 年之后都大于它
+const feedCtimeMilliBoundary = 100_000_000_000
+
+// migrateFeedCtimeMilli feed 事件的 ctime 从秒改成了毫秒，把历史数据换算过来，重复执行没有影响
+func migrateFeedCtimeMilli(db *gorm.DB) error {
+	for _, model := range []any{&FeedPullEvent{}, &FeedPushEvent{}, &FeedPullEventArchive{}, &FeedPushEventArchive{}} {
+		err := db.Model(model).
+			Where("ctime > 0 AND ctime < ?", feedCtimeMilliBoundary).
+			Update("ctime", gorm.Expr("ctime * 1000")).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateFeedLegacyEventId 引入 EventId 之前的事件 event_id 是空字符串，翻页游标里面缺了 EventId，
+// 同一毫秒的事件也分不出先后。按表和行 id 回填，归档表的行 id 和线上表一致，回填的结果也一样。
+// 推拉两张表的行 id 互相独立，前缀要区分开，避免不同的事件被当成同一个去重掉。重复执行没有影响
+func migrateFeedLegacyEventId(db *gorm.DB) error {
+	tables := []struct {
+		model  any
+		prefix string
+	}{
+		{model: &FeedPullEvent{}, prefix: domain.FeedLegacyEventIdPrefix + "pull-"},
+		{model: &FeedPullEventArchive{}, prefix: domain.FeedLegacyEventIdPrefix + "pull-"},
+		{model: &FeedPushEvent{}, prefix: domain.FeedLegacyEventIdPrefix + "push-"},
+		{model: &FeedPushEventArchive{}, prefix: domain.FeedLegacyEventIdPrefix + "push-"},
+	}
+	for _, t := range tables {
+		err := db.Model(t.model).
+			Where("event_id = ?", "").
+			Update("event_id", gorm.Expr("CONCAT(?, id)", t.prefix)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateNotifiedFlags 通知标记是后加的字段，历史数据是 NULL，当作已经通知过处理，
+// 避免复审通过或者重新发表的时候重复通知。重复执行没有影响
+func migrateNotifiedFlags(db *gorm.DB) error {
+	err := db.Model(&Mention{}).Where("notified IS NULL").Update("notified", true).Error
+	if err != nil {
+		return err
+	}
+	return db.Model(&Comment{}).Where("reply_notified IS NULL").Update("reply_notified", true).Error
+}
+
+// commentHotScoreBatch 回填评论热度时每批处理的行数
+const commentHotScoreBatch = 500
+
+// migrateCommentHotScore 热度是后加的字段，历史评论都是 0，按热度排序的时候会全部沉到最后。
+// 按点赞数和发表时间回填，只更新仍然是 0 的行，不会覆盖点赞之后重新计算的热度。重复执行没有影响
+func migrateCommentHotScore(db *gorm.DB) error {
+	var maxId int64
+	for {
+		var comments []Comment
+		err := db.Select("id", "like_cnt", "ctime").
+			Where("hot_score = ? AND id > ?", 0, maxId).
+			Order("id").Limit(commentHotScoreBatch).
+			Find(&comments).Error
+		if err != nil {
+			return err
+		}
+		for _, c := range comments {
+			score := domain.CommentHotScore(c.LikeCnt, time.UnixMilli(c.Ctime))
+			err = db.Model(&Comment{}).
+				Where("id = ? AND hot_score = ?", c.ID, 0).
+				Update("hot_score", score).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(comments) < commentHotScoreBatch {
+			return nil
+		}
+		maxId = comments[len(comments)-1].ID
+	}
 }
@@ -0,0 +1,54 @@
+package dao
+
+import (
+	"archi/internal/domain"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateFeedLegacyEventId(t *testing.T) {
+	db, mock := newMockDB(t)
+	tables := []struct {
+		name   string
+		prefix string
+	}{
+		{name: "feed_pull_events", prefix: "legacy-pull-"},
+		{name: "feed_pull_event_archives", prefix: "legacy-pull-"},
+		{name: "feed_push_events", prefix: "legacy-push-"},
+		{name: "feed_push_event_archives", prefix: "legacy-push-"},
+	}
+	for _, tb := range tables {
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE `"+tb.name+"` SET `event_id`=CONCAT(?, id) WHERE event_id = ?")).
+			WithArgs(tb.prefix, "").
+			WillReturnResult(sqlmock.NewResult(0, 3))
+	}
+	require.NoError(t, migrateFeedLegacyEventId(db))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrateCommentHotScore(t *testing.T) {
+	const (
+		selectQuery = "SELECT `id`,`like_cnt`,`ctime` FROM `comments` WHERE hot_score = ? AND id > ? ORDER BY id LIMIT ?"
+		updateQuery = "UPDATE `comments` SET `hot_score`=? WHERE id = ? AND hot_score = ?"
+	)
+	db, mock := newMockDB(t)
+	ctime := time.UnixMilli(1_700_000_000_000)
+	mock.ExpectQuery(regexp.QuoteMeta(selectQuery)).
+		WithArgs(0, 0, commentHotScoreBatch).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "like_cnt", "ctime"}).
+			AddRow(1, 0, ctime.UnixMilli()).
+			AddRow(2, 99, ctime.UnixMilli()))
+	mock.ExpectExec(regexp.QuoteMeta(updateQuery)).
+		WithArgs(domain.CommentHotScore(0, ctime), 1, 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(updateQuery)).
+		WithArgs(domain.CommentHotScore(99, ctime), 2, 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, migrateCommentHotScore(db))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -43,18 +43,23 @@ type Interactive struct {
 	ReadCnt    int64
 	LikeCnt    int64
 	CollectCnt int64
+	CommentCnt int64
 	Utime      int64
 	Ctime      int64
 }
 type InteractiveDAO interface {
 	IncrReadCnt(ctx context.Context, biz string, bizId int64) error
 	BatchIncrReadCnt(ctx context.Context, bizs []string, bizIds []int64) error
-	InsertLikeInfo(ctx context.Context, biz string, id int64, uid int64) error
-	DeleteLikeInfo(ctx context.Context, biz string, id int64, uid int64) error
+	// InsertLikeInfo 点赞，返回 true 表示之前没有点赞，这次点赞生效了，重复点赞什么都不做
+	InsertLikeInfo(ctx context.Context, biz string, id int64, uid int64) (bool, error)
+	// DeleteLikeInfo 取消点赞，返回 true 表示之前点过赞，这次取消生效了
+	DeleteLikeInfo(ctx context.Context, biz string, id int64, uid int64) (bool, error)
 	InsertCollectionBiz(ctx context.Context, cb UserCollectionBiz) error
 	DeleteCollectionBiz(ctx context.Context, biz string, bizId int64, cid int64, uid int64) error
 	GetLikeInfo(ctx context.Context, biz string, id int64, uid int64) (UserLikeBiz, error)
 	GetCollectInfo(ctx context.Context, biz string, id int64, uid int64) (UserCollectionBiz, error)
+	// GetLikedBizIds ids 中用户点赞过的那部分
+	GetLikedBizIds(ctx context.Context, biz string, ids []int64, uid int64) ([]int64, error)
 	Get(ctx context.Context, biz string, id int64) (Interactive, error)
 	GetByIds(ctx context.Context, biz string, ids []int64) ([]Interactive, error)
 }
@@ -98,9 +103,10 @@ func (g *GORMInteractiveDAO) BatchIncrReadCnt(ctx context.Context, bizs []string
 	})
 }
 
-func (g *GORMInteractiveDAO) InsertLikeInfo(ctx context.Context, biz string, id int64, uid int64) error {
+func (g *GORMInteractiveDAO) InsertLikeInfo(ctx context.Context, biz string, id int64, uid int64) (bool, error) {
 	now := time.Now().UnixMilli()
-	return g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	changed := false
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// 尝试查找用户的点赞记录
 		var like UserLikeBiz
 		err := tx.Where("uid = ? AND biz_id = ? AND biz = ?", uid, id, biz).First(&like).Error
@@ -115,7 +121,7 @@ func (g *GORMInteractiveDAO) InsertLikeInfo(ctx context.Context, biz string, id
 		// 情况二：用户曾经取消过点赞，现在重新点赞
 		if err == nil && like.Status == 0 {
 			res := tx.Model(&UserLikeBiz{}).
-				Where("id = ?", like.ID).
+				Where("id = ? AND status = ?", like.ID, 0).
 				Updates(map[string]interface{}{
 					"utime":  now,
 					"status": 1,
@@ -123,6 +129,10 @@ func (g *GORMInteractiveDAO) InsertLikeInfo(ctx context.Context, biz string, id
 			if res.Error != nil {
 				return res.Error
 			}
+			// 并发的重新点赞已经生效了
+			if res.RowsAffected == 0 {
+				return nil
+			}
 		}
 		// 情况三：用户从未点赞过
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -138,6 +148,7 @@ func (g *GORMInteractiveDAO) InsertLikeInfo(ctx context.Context, biz string, id
 				return createErr
 			}
 		}
+		changed = true
 		// 更新点赞计数
 		return tx.Clauses(clause.OnConflict{
 			Columns: []clause.Column{{Name: "biz_id"}, {Name: "biz"}},
@@ -153,10 +164,12 @@ func (g *GORMInteractiveDAO) InsertLikeInfo(ctx context.Context, biz string, id
 			Utime:   now,
 		}).Error
 	})
+	return changed, err
 }
-func (g *GORMInteractiveDAO) DeleteLikeInfo(ctx context.Context, biz string, id int64, uid int64) error {
+func (g *GORMInteractiveDAO) DeleteLikeInfo(ctx context.Context, biz string, id int64, uid int64) (bool, error) {
 	now := time.Now().UnixMilli()
-	return g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	changed := false
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// 直接更新，WHERE子句中包含所有检查条件
 		res := tx.Model(&UserLikeBiz{}).
 			Where("uid = ? AND biz_id = ? AND biz = ? AND status = ?", uid, id, biz, 1).
@@ -172,6 +185,7 @@ func (g *GORMInteractiveDAO) DeleteLikeInfo(ctx context.Context, biz string, id
 			// 这意味着用户没有点过赞，或者已经取消了，无需任何操作
 			return nil
 		}
+		changed = true
 		// 更新总数
 		return tx.Model(&Interactive{}).
 			Where("biz = ? AND biz_id = ?", biz, id).
@@ -180,6 +194,7 @@ func (g *GORMInteractiveDAO) DeleteLikeInfo(ctx context.Context, biz string, id
 				"utime":    now,
 			}).Error
 	})
+	return changed, err
 }
 func (g *GORMInteractiveDAO) InsertCollectionBiz(ctx context.Context, cb UserCollectionBiz) error {
 	now := time.Now().UnixMilli()
@@ -279,6 +294,13 @@ func (g *GORMInteractiveDAO) GetCollectInfo(ctx context.Context, biz string, id
 		First(&res).Error
 	return res, err
 }
+func (g *GORMInteractiveDAO) GetLikedBizIds(ctx context.Context, biz string, ids []int64, uid int64) ([]int64, error) {
+	var res []int64
+	err := g.db.WithContext(ctx).Model(&UserLikeBiz{}).
+		Where("uid = ? AND biz = ? AND biz_id IN ? AND status = ?", uid, biz, ids, 1).
+		Pluck("biz_id", &res).Error
+	return res, err
+}
 func (g *GORMInteractiveDAO) Get(ctx context.Context, biz string, id int64) (Interactive, error) {
 	var res Interactive
 	err := g.db.WithContext(ctx).
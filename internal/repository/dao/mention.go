@@ -0,0 +1,106 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Mention 内容中 @ 到的用户，评论和文章共用
+type Mention struct {
+	ID    int64  `gorm:"primaryKey,autoIncrement"`
+	Biz   string `gorm:"type:varchar(64);index:biz_type_id"`
+	BizId int64  `gorm:"index:biz_type_id"`
+	// Uid 被 @ 的用户
+	Uid      int64  `gorm:"index"`
+	Nickname string `gorm:"type:varchar(128)"`
+	// Start End 在内容中的字符下标
+	Start int
+	End   int
+	// Notified 是否已经通知过被 @ 的人，待复审的内容等复审通过之后再通知
+	Notified bool
+	Ctime    int64
+}
+
+type MentionDAO interface {
+	// Replace 使用新的提及替换掉内容原有的提及，之前已经通知过的人保留通知标记
+	// notify 为 true 时全部标记为已通知，返回这次新标记的提及
+	Replace(ctx context.Context, biz string, bizId int64, mentions []Mention, notify bool) ([]Mention, error)
+	// MarkNotified 把内容中还没有通知过的提及标记为已通知，并返回这些提及
+	MarkNotified(ctx context.Context, biz string, bizId int64) ([]Mention, error)
+	FindByBizIds(ctx context.Context, biz string, bizIds []int64) ([]Mention, error)
+}
+
+type GORMMentionDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMMentionDAO(db *gorm.DB) MentionDAO {
+	return &GORMMentionDAO{
+		db: db,
+	}
+}
+
+func (dao *GORMMentionDAO) Replace(ctx context.Context, biz string, bizId int64,
+	mentions []Mention, notify bool) ([]Mention, error) {
+	var res []Mention
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var old []Mention
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("biz = ? AND biz_id = ?", biz, bizId).Find(&old).Error
+		if err != nil {
+			return err
+		}
+		if len(old) > 0 {
+			err = tx.Where("biz = ? AND biz_id = ?", biz, bizId).Delete(&Mention{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(mentions) == 0 {
+			return nil
+		}
+		notified := make(map[int64]bool, len(old))
+		for _, m := range old {
+			notified[m.Uid] = notified[m.Uid] || m.Notified
+		}
+		now := time.Now().UnixMilli()
+		for i := range mentions {
+			mentions[i].Biz = biz
+			mentions[i].BizId = bizId
+			mentions[i].Ctime = now
+			mentions[i].Notified = notify || notified[mentions[i].Uid]
+			if notify && !notified[mentions[i].Uid] {
+				res = append(res, mentions[i])
+			}
+		}
+		return tx.Create(&mentions).Error
+	})
+	return res, err
+}
+
+func (dao *GORMMentionDAO) MarkNotified(ctx context.Context, biz string, bizId int64) ([]Mention, error) {
+	var res []Mention
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("biz = ? AND biz_id = ? AND notified = ?", biz, bizId, false).
+			Find(&res).Error
+		if err != nil || len(res) == 0 {
+			return err
+		}
+		return tx.Model(&Mention{}).
+			Where("biz = ? AND biz_id = ? AND notified = ?", biz, bizId, false).
+			Update("notified", true).Error
+	})
+	return res, err
+}
+
+func (dao *GORMMentionDAO) FindByBizIds(ctx context.Context, biz string, bizIds []int64) ([]Mention, error) {
+	var res []Mention
+	err := dao.db.WithContext(ctx).
+		Where("biz = ? AND biz_id IN ?", biz, bizIds).
+		Order("biz_id, start").Find(&res).Error
+	return res, err
+}
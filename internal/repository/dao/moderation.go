@@ -0,0 +1,95 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Moderation struct {
+	Id    int64  `gorm:"primaryKey,autoIncrement"`
+	Biz   string `gorm:"type:varchar(64);uniqueIndex:biz_type_id"`
+	BizId int64  `gorm:"uniqueIndex:biz_type_id"`
+	Uid   int64  `gorm:"index"`
+	// 审核时的内容快照，方便复审人员查看
+	Content string `gorm:"type:text"`
+	Verdict uint8
+	// Reasons JSON 数组
+	Reasons  string `gorm:"type:text"`
+	Source   string `gorm:"type:varchar(16)"`
+	Status   uint8  `gorm:"index:status_utime"`
+	Reviewer int64
+	Ctime    int64
+	Utime    int64 `gorm:"index:status_utime"`
+}
+
+type ModerationDAO interface {
+	// Upsert 同一个业务对象只保留最新的一条审核记录
+	Upsert(ctx context.Context, m Moderation) error
+	FindById(ctx context.Context, id int64) (Moderation, error)
+	FindByBiz(ctx context.Context, biz string, bizId int64) (Moderation, error)
+	FindByStatus(ctx context.Context, status uint8, offset, limit int) ([]Moderation, error)
+	// UpdateStatus 只有当前状态为 from 时才会更新，返回是否更新成功，避免重复复审
+	UpdateStatus(ctx context.Context, id int64, from, to uint8, reviewer int64) (bool, error)
+}
+
+type GORMModerationDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMModerationDAO(db *gorm.DB) ModerationDAO {
+	return &GORMModerationDAO{
+		db: db,
+	}
+}
+
+func (dao *GORMModerationDAO) Upsert(ctx context.Context, m Moderation) error {
+	now := time.Now().UnixMilli()
+	m.Ctime = now
+	m.Utime = now
+	return dao.db.WithContext(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]any{
+			"uid":      m.Uid,
+			"content":  m.Content,
+			"verdict":  m.Verdict,
+			"reasons":  m.Reasons,
+			"source":   m.Source,
+			"status":   m.Status,
+			"reviewer": m.Reviewer,
+			"utime":    now,
+		}),
+	}).Create(&m).Error
+}
+
+func (dao *GORMModerationDAO) FindById(ctx context.Context, id int64) (Moderation, error) {
+	var res Moderation
+	err := dao.db.WithContext(ctx).Where("id = ?", id).First(&res).Error
+	return res, err
+}
+
+func (dao *GORMModerationDAO) FindByBiz(ctx context.Context, biz string, bizId int64) (Moderation, error) {
+	var res Moderation
+	err := dao.db.WithContext(ctx).Where("biz = ? AND biz_id = ?", biz, bizId).First(&res).Error
+	return res, err
+}
+
+func (dao *GORMModerationDAO) FindByStatus(ctx context.Context, status uint8, offset, limit int) ([]Moderation, error) {
+	var res []Moderation
+	err := dao.db.WithContext(ctx).Where("status = ?", status).
+		Order("utime ASC").Offset(offset).Limit(limit).Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMModerationDAO) UpdateStatus(ctx context.Context, id int64, from, to uint8, reviewer int64) (bool, error) {
+	res := dao.db.WithContext(ctx).Model(&Moderation{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(map[string]any{
+			"status":   to,
+			"reviewer": reviewer,
+			"source":   "reviewer",
+			"utime":    time.Now().UnixMilli(),
+		})
+	return res.RowsAffected > 0, res.Error
+}
@@ -0,0 +1,226 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// notificationMaxActors 每条聚合通知最多记录几个最近的触发人
+const notificationMaxActors = 3
+
+type Notification struct {
+	Id       int64  `gorm:"primaryKey,autoIncrement"`
+	Uid      int64  `gorm:"uniqueIndex:uid_group_key;index:uid_utime,priority:1"`
+	GroupKey string `gorm:"type:varchar(128);uniqueIndex:uid_group_key"`
+	Type     string `gorm:"type:varchar(32)"`
+	Biz      string `gorm:"type:varchar(64)"`
+	BizId    int64
+	// Actors 最近几个触发人的 id，JSON 数组，最新的在前面
+	Actors    string `gorm:"type:varchar(255)"`
+	ActorCnt  int64
+	UnreadCnt int64
+	// Ext 最近一次事件的附加信息，JSON 对象
+	Ext   string `gorm:"type:text"`
+	Ctime int64
+	Utime int64 `gorm:"index:uid_utime,priority:2"`
+}
+
+// NotificationActor 聚合通知这一轮的全部触发人，用来判断触发人是不是第一次出现，
+// 重复点赞、消息重复投递都不会让触发人数变多。已读之后重新聚合的时候清空
+type NotificationActor struct {
+	Id    int64 `gorm:"primaryKey,autoIncrement"`
+	Nid   int64 `gorm:"uniqueIndex:nid_actor"`
+	Actor int64 `gorm:"uniqueIndex:nid_actor"`
+	Ctime int64
+}
+
+// NotificationMute 用户对某类通知开启了免打扰，有记录就说明开启了
+type NotificationMute struct {
+	Id    int64  `gorm:"primaryKey,autoIncrement"`
+	Uid   int64  `gorm:"uniqueIndex:uid_type"`
+	Type  string `gorm:"type:varchar(32);uniqueIndex:uid_type"`
+	Ctime int64
+}
+
+type NotificationDAO interface {
+	// Merge 把一次事件合并到 (Uid, GroupKey) 对应的通知中，没有就新建
+	// 已读的通知再收到事件时重新开始聚合，返回合并之后的通知
+	Merge(ctx context.Context, n Notification, actor int64) (Notification, error)
+	// List 按最近更新时间倒序
+	List(ctx context.Context, uid int64, offset, limit int) ([]Notification, error)
+	// MarkRead 返回标记之前的通知，调用方据此扣减未读数
+	MarkRead(ctx context.Context, uid, id int64) (Notification, error)
+	MarkAllRead(ctx context.Context, uid int64) error
+	// CountUnread 按类型统计未读条数
+	CountUnread(ctx context.Context, uid int64) (map[string]int64, error)
+
+	GetMutedTypes(ctx context.Context, uid int64) ([]string, error)
+	SetMuted(ctx context.Context, uid int64, typ string, muted bool) error
+}
+
+type GORMNotificationDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMNotificationDAO(db *gorm.DB) NotificationDAO {
+	return &GORMNotificationDAO{
+		db: db,
+	}
+}
+
+func (dao *GORMNotificationDAO) Merge(ctx context.Context, n Notification, actor int64) (Notification, error) {
+	now := time.Now().UnixMilli()
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var old Notification
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("uid = ? AND group_key = ?", n.Uid, n.GroupKey).
+			First(&old).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			n.Actors = encodeActors([]int64{actor})
+			n.ActorCnt = 1
+			n.UnreadCnt = 1
+			n.Ctime = now
+			n.Utime = now
+			if err = tx.Create(&n).Error; err != nil {
+				return err
+			}
+			return tx.Create(&NotificationActor{Nid: n.Id, Actor: actor, Ctime: now}).Error
+		case err != nil:
+			return err
+		}
+		actors := []int64{actor}
+		n.ActorCnt = 1
+		if old.UnreadCnt > 0 {
+			isNew := true
+			for _, a := range decodeActors(old.Actors) {
+				if a == actor {
+					// 引入触发人表之前的通知没有记录，至少最近几个触发人不会重复计数
+					isNew = false
+					continue
+				}
+				if len(actors) < notificationMaxActors {
+					actors = append(actors, a)
+				}
+			}
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&NotificationActor{Nid: old.Id, Actor: actor, Ctime: now})
+			if res.Error != nil {
+				return res.Error
+			}
+			n.ActorCnt = old.ActorCnt
+			if isNew && res.RowsAffected > 0 {
+				n.ActorCnt++
+			}
+		} else {
+			// 已读之后重新开始聚合
+			err = tx.Where("nid = ?", old.Id).Delete(&NotificationActor{}).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Create(&NotificationActor{Nid: old.Id, Actor: actor, Ctime: now}).Error
+			if err != nil {
+				return err
+			}
+		}
+		n.Id = old.Id
+		n.Actors = encodeActors(actors)
+		n.UnreadCnt = old.UnreadCnt + 1
+		n.Ctime = old.Ctime
+		n.Utime = now
+		return tx.Model(&Notification{}).Where("id = ?", old.Id).Updates(map[string]any{
+			"type":       n.Type,
+			"biz":        n.Biz,
+			"biz_id":     n.BizId,
+			"actors":     n.Actors,
+			"actor_cnt":  n.ActorCnt,
+			"unread_cnt": n.UnreadCnt,
+			"ext":        n.Ext,
+			"utime":      now,
+		}).Error
+	})
+	return n, err
+}
+
+func (dao *GORMNotificationDAO) List(ctx context.Context, uid int64, offset, limit int) ([]Notification, error) {
+	var res []Notification
+	err := dao.db.WithContext(ctx).Where("uid = ?", uid).
+		Order("utime DESC, id DESC").Offset(offset).Limit(limit).Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMNotificationDAO) MarkRead(ctx context.Context, uid, id int64) (Notification, error) {
+	var n Notification
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND uid = ?", id, uid).First(&n).Error
+		if err != nil || n.UnreadCnt == 0 {
+			return err
+		}
+		return tx.Model(&Notification{}).Where("id = ?", id).
+			Update("unread_cnt", 0).Error
+	})
+	return n, err
+}
+
+func (dao *GORMNotificationDAO) MarkAllRead(ctx context.Context, uid int64) error {
+	return dao.db.WithContext(ctx).Model(&Notification{}).
+		Where("uid = ? AND unread_cnt > 0", uid).
+		Update("unread_cnt", 0).Error
+}
+
+func (dao *GORMNotificationDAO) CountUnread(ctx context.Context, uid int64) (map[string]int64, error) {
+	var rows []struct {
+		Type string
+		Cnt  int64
+	}
+	err := dao.db.WithContext(ctx).Model(&Notification{}).
+		Select("type, SUM(unread_cnt) AS cnt").
+		Where("uid = ? AND unread_cnt > 0", uid).
+		Group("type").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		res[row.Type] = row.Cnt
+	}
+	return res, nil
+}
+
+func (dao *GORMNotificationDAO) GetMutedTypes(ctx context.Context, uid int64) ([]string, error) {
+	var res []string
+	err := dao.db.WithContext(ctx).Model(&NotificationMute{}).
+		Where("uid = ?", uid).Pluck("type", &res).Error
+	return res, err
+}
+
+func (dao *GORMNotificationDAO) SetMuted(ctx context.Context, uid int64, typ string, muted bool) error {
+	if !muted {
+		return dao.db.WithContext(ctx).
+			Where("uid = ? AND type = ?", uid, typ).
+			Delete(&NotificationMute{}).Error
+	}
+	return dao.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&NotificationMute{
+			Uid:   uid,
+			Type:  typ,
+			Ctime: time.Now().UnixMilli(),
+		}).Error
+}
+
+func encodeActors(actors []int64) string {
+	val, _ := json.Marshal(actors)
+	return string(val)
+}
+
+func decodeActors(val string) []int64 {
+	var actors []int64
+	_ = json.Unmarshal([]byte(val), &actors)
+	return actors
+}
@@ -0,0 +1,98 @@
+package dao
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGORMNotificationDAO_Merge(t *testing.T) {
+	testCases := []struct {
+		name string
+		// actors 已有通知里面最近的触发人
+		actors string
+		// inserted 触发人表是否插入了新的记录，插入冲突说明这一轮已经出现过
+		inserted     bool
+		actor        int64
+		wantActorCnt int64
+		wantActors   string
+	}{
+		{
+			name:         "新的触发人",
+			actors:       "[2]",
+			inserted:     true,
+			actor:        3,
+			wantActorCnt: 3,
+			wantActors:   "[3,2]",
+		},
+		{
+			name:         "重复点赞或者重复投递",
+			actors:       "[3,2]",
+			actor:        2,
+			wantActorCnt: 2,
+			wantActors:   "[2,3]",
+		},
+		{
+			name:         "引入触发人表之前的通知，最近的触发人不重复计数",
+			actors:       "[2]",
+			inserted:     true,
+			actor:        2,
+			wantActorCnt: 2,
+			wantActors:   "[2]",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT \\* FROM `notifications` WHERE uid = \\? AND group_key = \\?.*FOR UPDATE").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "uid", "group_key", "actors", "actor_cnt", "unread_cnt"}).
+					AddRow(1, 100, "like:article:1", tc.actors, 2, 2))
+			var affected int64
+			if tc.inserted {
+				affected = 1
+			}
+			mock.ExpectExec("INSERT INTO `notification_actors`").
+				WillReturnResult(sqlmock.NewResult(0, affected))
+			// map 按 key 排序：actor_cnt, actors, biz, biz_id, ext, type, unread_cnt, utime
+			mock.ExpectExec("UPDATE `notifications` SET").
+				WithArgs(tc.wantActorCnt, tc.wantActors, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+					sqlmock.AnyArg(), int64(3), sqlmock.AnyArg(), int64(1)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			n, err := NewGORMNotificationDAO(db).Merge(context.Background(),
+				Notification{Uid: 100, GroupKey: "like:article:1", Type: "like"}, tc.actor)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantActorCnt, n.ActorCnt)
+			assert.Equal(t, int64(3), n.UnreadCnt)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// TestGORMNotificationDAO_MergeAfterRead 已读之后重新聚合，清空上一轮的触发人
+func TestGORMNotificationDAO_MergeAfterRead(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM `notifications`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "uid", "group_key", "actors", "actor_cnt", "unread_cnt"}).
+			AddRow(1, 100, "like:article:1", "[2,3]", 2, 0))
+	mock.ExpectExec("DELETE FROM `notification_actors` WHERE nid = \\?").WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO `notification_actors`").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE `notifications` SET").
+		WithArgs(int64(1), "[2]", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), int64(1), sqlmock.AnyArg(), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	n, err := NewGORMNotificationDAO(db).Merge(context.Background(),
+		Notification{Uid: 100, GroupKey: "like:article:1", Type: "like"}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n.ActorCnt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
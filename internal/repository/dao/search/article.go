@@ -12,11 +12,12 @@ import (
 const ArticleIndexName = "article_index"
 
 type Article struct {
-	Id      int64    `json:"id"`
-	Title   string   `json:"title"`
-	Status  int32    `json:"status"`
-	Content string   `json:"content"`
-	Tags    []string `json:"tags"`
+	Id       int64    `json:"id"`
+	Title    string   `json:"title"`
+	Status   int32    `json:"status"`
+	Content  string   `json:"content"`
+	Tags     []string `json:"tags"`
+	AuthorId int64    `json:"author_id"`
 }
 
 type ArticleDAO interface {
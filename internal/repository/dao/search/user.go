@@ -19,6 +19,8 @@ type User struct {
 type UserDAO interface {
 	InputUser(ctx context.Context, user User) error
 	Search(ctx context.Context, keywords []string) ([]User, error)
+	// Suggest 按昵称前缀补全，用于 @ 用户时的输入提示
+	Suggest(ctx context.Context, prefix string, limit int) ([]User, error)
 }
 
 type ESUserDAO struct {
@@ -66,6 +68,24 @@ func (h *ESUserDAO) Search(ctx context.Context, keywords []string) ([]User, erro
 	return res, nil
 }
 
+func (h *ESUserDAO) Suggest(ctx context.Context, prefix string, limit int) ([]User, error) {
+	query := elastic.NewMatchPhrasePrefixQuery("nickname", prefix)
+	resp, err := h.client.Search(UserIndexName).Query(query).Size(limit).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]User, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		var ele User
+		err = json.Unmarshal(hit.Source, &ele)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ele)
+	}
+	return res, nil
+}
+
 func (h *ESUserDAO) InputUser(ctx context.Context, user User) error {
 	_, err := h.client.Index().Index(UserIndexName).Id(strconv.FormatInt(user.Id, 10)).BodyJson(user).Do(ctx)
 	return err
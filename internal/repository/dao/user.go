@@ -14,7 +14,7 @@ type User struct {
 	ID       int64          `gorm:"primaryKey,autoIncrement"`
 	Email    sql.NullString `gorm:"unique"` //Email    *string // 代表这是一个可以为 NULL 的列
 	Password string
-	Nickname string         `gorm:"type=varchar(128)"`
+	Nickname string         `gorm:"type:varchar(128);index"`
 	Birthday sql.NullInt64  // YYYY-MM-DD
 	Avatar   string         `gorm:"type:varchar(1024)"` // 头像
 	AboutMe  string         `gorm:"type=varchar(4096)"`
@@ -43,6 +43,8 @@ type UserDAO interface {
 	UpdateAvatar(ctx context.Context, id int64, avatar string) error
 	UpdateById(ctx context.Context, entity User) error
 	FindById(ctx context.Context, uid int64) (User, error)
+	FindByIds(ctx context.Context, uids []int64) ([]User, error)
+	FindByNicknames(ctx context.Context, nicknames []string) ([]User, error)
 	FindByPhone(ctx context.Context, phone string) (User, error)
 	FindByWechat(ctx context.Context, openId string) (User, error)
 }
@@ -114,6 +116,18 @@ func (g *GORMUserDAO) FindById(ctx context.Context, uid int64) (User, error) {
 	return res, err
 }
 
+func (g *GORMUserDAO) FindByIds(ctx context.Context, uids []int64) ([]User, error) {
+	var res []User
+	err := g.db.WithContext(ctx).Where("id IN ?", uids).Find(&res).Error
+	return res, err
+}
+
+func (g *GORMUserDAO) FindByNicknames(ctx context.Context, nicknames []string) ([]User, error) {
+	var res []User
+	err := g.db.WithContext(ctx).Where("nickname IN ?", nicknames).Find(&res).Error
+	return res, err
+}
+
 func (g *GORMUserDAO) FindByPhone(ctx context.Context, phone string) (User, error) {
 	var res User
 	err := g.db.WithContext(ctx).Where("phone = ?", phone).First(&res).Error
@@ -18,13 +18,31 @@ type FeedEventRepo interface {
 	// CreatePullEvent 创建拉事件
 	CreatePullEvent(ctx context.Context, event domain.FeedEvent) error
 	// FindPullEvents 获取拉事件，也就是关注的人发件箱里面的事件
-	FindPullEvents(ctx context.Context, uids []int64, timestamp, limit int64) ([]domain.FeedEvent, error)
+	FindPullEvents(ctx context.Context, uids []int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error)
 	// FindPushEvents 获取推事件，也就是自己收件箱里面的事件
-	FindPushEvents(ctx context.Context, uid, timestamp, limit int64) ([]domain.FeedEvent, error)
+	FindPushEvents(ctx context.Context, uid int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error)
 	// FindPullEventsWithTyp 获取某个类型的拉事件，
-	FindPullEventsWithTyp(ctx context.Context, typ string, uids []int64, timestamp, limit int64) ([]domain.FeedEvent, error)
-	// FindPushEventsWithTyp 获取某个类型的推事件，
-	FindPushEventsWithTyp(ctx context.Context, typ string, uid, timestamp, limit int64) ([]domain.FeedEvent, error)
+	FindPullEventsWithTyp(ctx context.Context, typ string, uids []int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error)
+	// FindPushEventsWithTyp 获取某个类型的推事件，优先从缓存的收件箱中读取
+	FindPushEventsWithTyp(ctx context.Context, typ string, uid int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error)
+	// DeletePushEvents 删除 uid 收件箱中某个类型的指定事件，同时让缓存的收件箱失效
+	DeletePushEvents(ctx context.Context, typ string, uid int64, ids []int64) error
+
+	// ArchivePushEvents 把 before 之前的最多 limit 条推事件搬到归档表，返回搬走的条数
+	ArchivePushEvents(ctx context.Context, before time.Time, limit int) (int64, error)
+	// ArchivePullEvents 把 before 之前的最多 limit 条拉事件搬到归档表，返回搬走的条数
+	ArchivePullEvents(ctx context.Context, before time.Time, limit int) (int64, error)
+
+	// SetFollowees 缓存关注列表，拉模型查询发件箱时使用
+	SetFollowees(ctx context.Context, follower int64, followees []int64) error
+	GetFollowees(ctx context.Context, follower int64) ([]int64, error)
+	// DelFollowees 关注关系变化时删除缓存
+	DelFollowees(ctx context.Context, follower int64) error
+
+	// MarkActive 记录用户活跃，window 之前的活跃记录会被清理
+	MarkActive(ctx context.Context, uid int64, window time.Duration) error
+	// FilterActive 过滤出最近 window 内活跃过的用户
+	FilterActive(ctx context.Context, uids []int64, window time.Duration) ([]int64, error)
 }
 
 type feedEventRepo struct {
@@ -52,20 +70,43 @@ func (f *feedEventRepo) GetFollowees(ctx context.Context, follower int64) ([]int
 	return followees, err
 }
 
+func (f *feedEventRepo) DelFollowees(ctx context.Context, follower int64) error {
+	return f.feedCache.DelFollowees(ctx, follower)
+}
+
+func (f *feedEventRepo) MarkActive(ctx context.Context, uid int64, window time.Duration) error {
+	now := time.Now()
+	return f.feedCache.MarkActive(ctx, uid, now, now.Add(-window))
+}
+
+func (f *feedEventRepo) FilterActive(ctx context.Context, uids []int64, window time.Duration) ([]int64, error) {
+	return f.feedCache.FilterActive(ctx, uids, time.Now().Add(-window))
+}
+
 func (f *feedEventRepo) CreatePushEvents(ctx context.Context, events []domain.FeedEvent) error {
 	pushEvents := make([]dao.FeedPushEvent, 0, len(events))
 	for _, e := range events {
 		pushEvents = append(pushEvents, convertToPushEventDao(e))
 	}
-	return f.pushDao.CreatePushEvents(ctx, pushEvents)
+	err := f.pushDao.CreatePushEvents(ctx, pushEvents)
+	if err != nil {
+		return err
+	}
+	// 插入后才有 id，缓存里面的事件需要带上 id 才能按游标翻页
+	for i := range events {
+		events[i].ID = pushEvents[i].Id
+	}
+	// 缓存追加失败不影响写入，收件箱过期后会从数据库重建
+	_ = f.feedCache.AppendInbox(ctx, events)
+	return nil
 }
 
 func (f *feedEventRepo) CreatePullEvent(ctx context.Context, event domain.FeedEvent) error {
 	return f.pullDao.CreatePullEvent(ctx, convertToPullEventDao(event))
 }
 
-func (f *feedEventRepo) FindPullEvents(ctx context.Context, uids []int64, timestamp, limit int64) ([]domain.FeedEvent, error) {
-	events, err := f.pullDao.FindPullEventList(ctx, uids, timestamp, limit)
+func (f *feedEventRepo) FindPullEvents(ctx context.Context, uids []int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error) {
+	events, err := f.pullDao.FindPullEventList(ctx, uids, cursor.Ctime, cursor.EventId, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -76,8 +117,8 @@ func (f *feedEventRepo) FindPullEvents(ctx context.Context, uids []int64, timest
 	return ans, nil
 }
 
-func (f *feedEventRepo) FindPushEvents(ctx context.Context, uid, timestamp, limit int64) ([]domain.FeedEvent, error) {
-	events, err := f.pushDao.GetPushEvents(ctx, uid, timestamp, limit)
+func (f *feedEventRepo) FindPushEvents(ctx context.Context, uid int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error) {
+	events, err := f.pushDao.GetPushEvents(ctx, uid, cursor.Ctime, cursor.EventId, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -87,8 +128,8 @@ func (f *feedEventRepo) FindPushEvents(ctx context.Context, uid, timestamp, limi
 	}
 	return ans, nil
 }
-func (f *feedEventRepo) FindPullEventsWithTyp(ctx context.Context, typ string, uids []int64, timestamp, limit int64) ([]domain.FeedEvent, error) {
-	events, err := f.pullDao.FindPullEventListWithTyp(ctx, typ, uids, timestamp, limit)
+func (f *feedEventRepo) FindPullEventsWithTyp(ctx context.Context, typ string, uids []int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error) {
+	events, err := f.pullDao.FindPullEventListWithTyp(ctx, typ, uids, cursor.Ctime, cursor.EventId, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -99,8 +140,37 @@ func (f *feedEventRepo) FindPullEventsWithTyp(ctx context.Context, typ string, u
 	return ans, nil
 }
 
-func (f *feedEventRepo) FindPushEventsWithTyp(ctx context.Context, typ string, uid, timestamp, limit int64) ([]domain.FeedEvent, error) {
-	events, err := f.pushDao.GetPushEventsWithTyp(ctx, typ, uid, timestamp, limit)
+func (f *feedEventRepo) FindPushEventsWithTyp(ctx context.Context, typ string, uid int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error) {
+	events, complete, err := f.feedCache.GetInbox(ctx, uid, typ, cursor, limit)
+	if err == nil && complete {
+		return events, nil
+	}
+	if errors.Is(err, cache.ErrFeedInboxNotFound) {
+		// 收件箱没有缓存，用最新的一批事件重建
+		latest, err := f.findPushEventsWithTyp(ctx, typ, uid, domain.FeedCursor{}, cache.FeedInboxSize)
+		if err != nil {
+			return nil, err
+		}
+		_ = f.feedCache.SetInbox(ctx, uid, typ, latest)
+		page := make([]domain.FeedEvent, 0, limit)
+		for _, evt := range latest {
+			if int64(len(page)) == limit {
+				break
+			}
+			if cursor.Precedes(evt) {
+				page = append(page, evt)
+			}
+		}
+		if int64(len(page)) == limit || len(latest) < cache.FeedInboxSize {
+			return page, nil
+		}
+	}
+	// 翻页超出了缓存的范围，或者缓存出错，直接查数据库
+	return f.findPushEventsWithTyp(ctx, typ, uid, cursor, limit)
+}
+
+func (f *feedEventRepo) findPushEventsWithTyp(ctx context.Context, typ string, uid int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error) {
+	events, err := f.pushDao.GetPushEventsWithTyp(ctx, typ, uid, cursor.Ctime, cursor.EventId, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -111,6 +181,24 @@ func (f *feedEventRepo) FindPushEventsWithTyp(ctx context.Context, typ string, u
 	return ans, nil
 }
 
+func (f *feedEventRepo) DeletePushEvents(ctx context.Context, typ string, uid int64, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := f.pushDao.DeletePushEvents(ctx, uid, ids); err != nil {
+		return err
+	}
+	return f.feedCache.DelInbox(ctx, uid, typ)
+}
+
+func (f *feedEventRepo) ArchivePushEvents(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return f.pushDao.ArchiveBefore(ctx, before.UnixMilli(), limit)
+}
+
+func (f *feedEventRepo) ArchivePullEvents(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return f.pullDao.ArchiveBefore(ctx, before.UnixMilli(), limit)
+}
+
 func convertToPushEventDao(event domain.FeedEvent) dao.FeedPushEvent {
 	val, _ := json.Marshal(event.Ext)
 	return dao.FeedPushEvent{
@@ -118,7 +206,8 @@ func convertToPushEventDao(event domain.FeedEvent) dao.FeedPushEvent {
 		UID:     event.Uid,
 		Type:    event.Type,
 		Content: string(val),
-		Ctime:   event.Ctime.Unix(),
+		EventId: event.EventId,
+		Ctime:   event.Ctime.UnixMilli(),
 	}
 }
 
@@ -129,7 +218,8 @@ func convertToPullEventDao(event domain.FeedEvent) dao.FeedPullEvent {
 		UID:     event.Uid,
 		Type:    event.Type,
 		Content: string(val),
-		Ctime:   event.Ctime.Unix(),
+		EventId: event.EventId,
+		Ctime:   event.Ctime.UnixMilli(),
 	}
 
 }
@@ -138,11 +228,12 @@ func convertToPushEventDomain(event dao.FeedPushEvent) domain.FeedEvent {
 	var ext map[string]string
 	_ = json.Unmarshal([]byte(event.Content), &ext)
 	return domain.FeedEvent{
-		ID:    event.Id,
-		Uid:   event.UID,
-		Type:  event.Type,
-		Ctime: time.Unix(event.Ctime, 0),
-		Ext:   ext,
+		ID:      event.Id,
+		EventId: event.EventId,
+		Uid:     event.UID,
+		Type:    event.Type,
+		Ctime:   time.UnixMilli(event.Ctime),
+		Ext:     ext,
 	}
 }
 
@@ -150,10 +241,11 @@ func convertToPullEventDomain(event dao.FeedPullEvent) domain.FeedEvent {
 	var ext map[string]string
 	_ = json.Unmarshal([]byte(event.Content), &ext)
 	return domain.FeedEvent{
-		ID:    event.Id,
-		Uid:   event.UID,
-		Type:  event.Type,
-		Ctime: time.Unix(event.Ctime, 0),
-		Ext:   ext,
+		ID:      event.Id,
+		EventId: event.EventId,
+		Uid:     event.UID,
+		Type:    event.Type,
+		Ctime:   time.UnixMilli(event.Ctime),
+		Ext:     ext,
 	}
 }
@@ -11,9 +11,16 @@ import (
 )
 
 type FollowRepository interface {
-	// GetFollowee 获取某人的关注列表
-	GetFollower(ctx context.Context, followee int64) ([]domain.FollowRelation, error)
-	GetFollowee(ctx context.Context, follower, offset, limit int64) ([]domain.FollowRelation, error)
+	// GetFollower 获取某人的粉丝列表，按关系 ID 倒序，cursor 为上一页最后一条关系的 ID，第一页传 0
+	GetFollower(ctx context.Context, followee, cursor, limit int64) ([]domain.FollowRelation, error)
+	// GetFollowee 获取某人的关注列表，分页方式同 GetFollower
+	GetFollowee(ctx context.Context, follower, cursor, limit int64) ([]domain.FollowRelation, error)
+	// GetMutual 获取和某人互相关注的列表，返回的关系中 Follower 是 uid，分页方式同 GetFollower
+	GetMutual(ctx context.Context, uid, cursor, limit int64) ([]domain.FollowRelation, error)
+	// GetFollowStates 批量查询 uid 和 targets 中每个人的关注状态
+	GetFollowStates(ctx context.Context, uid int64, targets []int64) (map[int64]domain.FollowState, error)
+	// GetFollowerBatch 分批获取粉丝，minId 为上一批最后一条关系的 ID
+	GetFollowerBatch(ctx context.Context, followee, minId, limit int64) ([]domain.FollowRelation, error)
 	// FollowInfo 查看关注人的详情
 	FollowInfo(ctx context.Context, follower int64, followee int64) (domain.FollowRelation, error)
 	// AddFollowRelation 创建关注关系
@@ -37,16 +44,129 @@ func NewCachedFollowRepository(dao dao.FollowRelationDao, cache cache.FollowCach
 	}
 }
 
-func (d *CachedFollowRepository) GetFollower(ctx context.Context, followee int64) ([]domain.FollowRelation, error) {
-	followerList, err := d.dao.GetFollowerList(ctx, followee)
+func (d *CachedFollowRepository) GetFollower(ctx context.Context, followee, cursor, limit int64) ([]domain.FollowRelation, error) {
+	followerList, err := d.dao.GetFollowerList(ctx, followee, cursor, limit)
 	if err != nil {
 		return nil, err
 	}
 	return d.genFollowRelationList(followerList), nil
 }
 
-func (d *CachedFollowRepository) GetFollowee(ctx context.Context, follower, offset, limit int64) ([]domain.FollowRelation, error) {
-	followerList, err := d.dao.FollowRelationList(ctx, follower, offset, limit)
+func (d *CachedFollowRepository) GetFollowee(ctx context.Context, follower, cursor, limit int64) ([]domain.FollowRelation, error) {
+	followerList, err := d.dao.FollowRelationList(ctx, follower, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return d.genFollowRelationList(followerList), nil
+}
+
+func (d *CachedFollowRepository) GetMutual(ctx context.Context, uid, cursor, limit int64) ([]domain.FollowRelation, error) {
+	list, err := d.dao.MutualList(ctx, uid, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return d.genFollowRelationList(list), nil
+}
+
+func (d *CachedFollowRepository) GetFollowStates(ctx context.Context, uid int64, targets []int64) (map[int64]domain.FollowState, error) {
+	res := make(map[int64]domain.FollowState, len(targets))
+	if len(targets) == 0 {
+		return res, nil
+	}
+	following, err := d.matchFollowSet(ctx, uid, targets, followSetLoader{
+		name:   "followees",
+		cached: d.cache.IsFollowing,
+		size:   func(s domain.FollowStatics) int64 { return s.Followees },
+		all:    d.dao.FolloweeIds,
+		set:    d.cache.SetFollowees,
+		findIn: d.dao.FindFolloweesIn,
+	})
+	if err != nil {
+		return nil, err
+	}
+	followedBy, err := d.matchFollowSet(ctx, uid, targets, followSetLoader{
+		name:   "followers",
+		cached: d.cache.IsFollowedBy,
+		size:   func(s domain.FollowStatics) int64 { return s.Followers },
+		all:    d.dao.FollowerIds,
+		set:    d.cache.SetFollowers,
+		findIn: d.dao.FindFollowersIn,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, target := range targets {
+		res[target] = domain.FollowState{
+			Following:  following[target],
+			FollowedBy: followedBy[target],
+		}
+	}
+	return res, nil
+}
+
+// followSetLoader 关注集合的一个方向，uid 关注的人或者 uid 的粉丝
+type followSetLoader struct {
+	name   string
+	cached func(ctx context.Context, uid int64, targets []int64) ([]bool, error)
+	size   func(s domain.FollowStatics) int64
+	all    func(ctx context.Context, uid int64) ([]int64, error)
+	set    func(ctx context.Context, uid int64, uids []int64) error
+	findIn func(ctx context.Context, uid int64, targets []int64) ([]int64, error)
+}
+
+// matchFollowSet 找出 targets 中在 uid 关注集合里面的人。
+// 优先查缓存，未命中时集合不大就整个加载进缓存，太大的只按 targets 查数据库
+func (d *CachedFollowRepository) matchFollowSet(ctx context.Context, uid int64, targets []int64,
+	loader followSetLoader) (map[int64]bool, error) {
+	res := make(map[int64]bool, len(targets))
+	hits, err := loader.cached(ctx, uid, targets)
+	if err == nil {
+		for i, target := range targets {
+			res[target] = hits[i]
+		}
+		return res, nil
+	}
+	if errors.Is(err, cache.ErrFollowKeyNotExist) {
+		statics, er := d.GetFollowStatics(ctx, uid)
+		if er == nil && loader.size(statics) <= cache.FollowSetMaxSize {
+			uids, er := loader.all(ctx, uid)
+			if er != nil {
+				return nil, er
+			}
+			if er = loader.set(ctx, uid, uids); er != nil {
+				d.l.Error("缓存关注集合失败",
+					logger.Error(er),
+					logger.String("set", loader.name),
+					logger.Int64("uid", uid))
+			}
+			members := make(map[int64]struct{}, len(uids))
+			for _, id := range uids {
+				members[id] = struct{}{}
+			}
+			for _, target := range targets {
+				_, res[target] = members[target]
+			}
+			return res, nil
+		}
+	} else {
+		// Redis 出问题的时候直接查数据库
+		d.l.Error("查询关注集合缓存失败",
+			logger.Error(err),
+			logger.String("set", loader.name),
+			logger.Int64("uid", uid))
+	}
+	ids, err := loader.findIn(ctx, uid, targets)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		res[id] = true
+	}
+	return res, nil
+}
+
+func (d *CachedFollowRepository) GetFollowerBatch(ctx context.Context, followee, minId, limit int64) ([]domain.FollowRelation, error) {
+	followerList, err := d.dao.GetFollowerBatch(ctx, followee, minId, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -129,6 +249,7 @@ func (d *CachedFollowRepository) GetFollowStatics(ctx context.Context, uid int64
 }
 func (d *CachedFollowRepository) toDomain(fr dao.FollowRelation) domain.FollowRelation {
 	return domain.FollowRelation{
+		ID:       fr.ID,
 		Followee: fr.Followee,
 		Follower: fr.Follower,
 	}
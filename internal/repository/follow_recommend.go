@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"archi/internal/domain"
+	"archi/internal/repository/cache"
+	"archi/internal/repository/dao"
+	"context"
+)
+
+// ErrFollowRecommendNotFound 还没有给这个用户计算过推荐
+var ErrFollowRecommendNotFound = cache.ErrFollowRecommendNotFound
+
+type FollowRecommendRepository interface {
+	// Candidates 某个来源的候选人，key 是候选人 id，value 是命中的次数
+	Candidates(ctx context.Context, uid int64, reason domain.FollowRecommendReason, limit int) (map[int64]int64, error)
+	// FindUids 按 id 升序分批获取需要计算推荐的用户
+	FindUids(ctx context.Context, minUid int64, limit int) ([]int64, error)
+	// RefreshCursor 定时任务上一次处理到的用户 id，0 表示从头开始
+	RefreshCursor(ctx context.Context) (int64, error)
+	SetRefreshCursor(ctx context.Context, uid int64) error
+	Save(ctx context.Context, uid int64, recs []domain.FollowRecommendation) error
+	Find(ctx context.Context, uid int64) ([]domain.FollowRecommendation, error)
+	Dismiss(ctx context.Context, uid, target int64) error
+	Dismissed(ctx context.Context, uid int64) ([]int64, error)
+}
+
+type CachedFollowRecommendRepository struct {
+	dao   dao.FollowRecommendDAO
+	cache cache.FollowRecommendCache
+}
+
+func NewCachedFollowRecommendRepository(dao dao.FollowRecommendDAO, cache cache.FollowRecommendCache) FollowRecommendRepository {
+	return &CachedFollowRecommendRepository{
+		dao:   dao,
+		cache: cache,
+	}
+}
+
+func (repo *CachedFollowRecommendRepository) Candidates(ctx context.Context, uid int64,
+	reason domain.FollowRecommendReason, limit int) (map[int64]int64, error) {
+	var (
+		cs  []dao.RecommendCandidate
+		err error
+	)
+	switch reason {
+	case domain.FollowRecommendReasonSecondDegree:
+		cs, err = repo.dao.SecondDegree(ctx, uid, limit)
+	case domain.FollowRecommendReasonTag:
+		cs, err = repo.dao.SharedTags(ctx, uid, limit)
+	case domain.FollowRecommendReasonLiked:
+		cs, err = repo.dao.LikedAuthors(ctx, uid, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]int64, len(cs))
+	for _, c := range cs {
+		res[c.Uid] = c.Cnt
+	}
+	return res, nil
+}
+
+func (repo *CachedFollowRecommendRepository) FindUids(ctx context.Context, minUid int64, limit int) ([]int64, error) {
+	return repo.dao.FindUids(ctx, minUid, limit)
+}
+
+func (repo *CachedFollowRecommendRepository) RefreshCursor(ctx context.Context) (int64, error) {
+	return repo.cache.GetRefreshCursor(ctx)
+}
+
+func (repo *CachedFollowRecommendRepository) SetRefreshCursor(ctx context.Context, uid int64) error {
+	return repo.cache.SetRefreshCursor(ctx, uid)
+}
+
+func (repo *CachedFollowRecommendRepository) Save(ctx context.Context, uid int64, recs []domain.FollowRecommendation) error {
+	return repo.cache.Set(ctx, uid, recs)
+}
+
+func (repo *CachedFollowRecommendRepository) Find(ctx context.Context, uid int64) ([]domain.FollowRecommendation, error) {
+	return repo.cache.Get(ctx, uid)
+}
+
+func (repo *CachedFollowRecommendRepository) Dismiss(ctx context.Context, uid, target int64) error {
+	return repo.cache.Dismiss(ctx, uid, target)
+}
+
+func (repo *CachedFollowRecommendRepository) Dismissed(ctx context.Context, uid int64) ([]int64, error) {
+	return repo.cache.Dismissed(ctx, uid)
+}
@@ -18,13 +18,17 @@ type InteractiveRepository interface {
 	IncrReadCnt(ctx context.Context, biz string, bizId int64) error
 	// BatchIncrReadCnt biz 和 bizId 长度必须一致
 	BatchIncrReadCnt(ctx context.Context, biz []string, bizId []int64) error
-	IncrLike(ctx context.Context, biz string, id int64, uid int64) error
-	DecrLike(ctx context.Context, biz string, id int64, uid int64) error
+	// IncrLike 点赞，返回 true 表示点赞状态发生了变化，重复点赞返回 false
+	IncrLike(ctx context.Context, biz string, id int64, uid int64) (bool, error)
+	// DecrLike 取消点赞，返回 true 表示点赞状态发生了变化
+	DecrLike(ctx context.Context, biz string, id int64, uid int64) (bool, error)
 	AddCollectionItem(ctx context.Context, biz string, id int64, cid int64, uid int64) error
 	RemoveCollectionItem(ctx context.Context, biz string, id int64, cid int64, uid int64) error
 	Get(ctx context.Context, biz string, id int64) (domain.Interactive, error)
 	Liked(ctx context.Context, biz string, id int64, uid int64) (bool, error)
 	Collected(ctx context.Context, biz string, id int64, uid int64) (bool, error)
+	// LikedIds ids 中用户点赞过的那部分
+	LikedIds(ctx context.Context, biz string, ids []int64, uid int64) ([]int64, error)
 	GetByIds(ctx context.Context, biz string, ids []int64) ([]domain.Interactive, error)
 }
 type CachedInteractiveRepository struct {
@@ -65,20 +69,20 @@ func (c *CachedInteractiveRepository) BatchIncrReadCnt(ctx context.Context, biz
 	}()
 	return nil
 }
-func (c *CachedInteractiveRepository) IncrLike(ctx context.Context, biz string, id int64, uid int64) error {
-	err := c.dao.InsertLikeInfo(ctx, biz, id, uid)
-	if err != nil {
-		return err
+func (c *CachedInteractiveRepository) IncrLike(ctx context.Context, biz string, id int64, uid int64) (bool, error) {
+	changed, err := c.dao.InsertLikeInfo(ctx, biz, id, uid)
+	if err != nil || !changed {
+		return false, err
 	}
-	return c.cache.IncrLikeCntIfPresent(ctx, biz, id)
+	return true, c.cache.IncrLikeCntIfPresent(ctx, biz, id)
 }
 
-func (c *CachedInteractiveRepository) DecrLike(ctx context.Context, biz string, id int64, uid int64) error {
-	err := c.dao.DeleteLikeInfo(ctx, biz, id, uid)
-	if err != nil {
-		return err
+func (c *CachedInteractiveRepository) DecrLike(ctx context.Context, biz string, id int64, uid int64) (bool, error) {
+	changed, err := c.dao.DeleteLikeInfo(ctx, biz, id, uid)
+	if err != nil || !changed {
+		return false, err
 	}
-	return c.cache.DecrLikeCntIfPresent(ctx, biz, id)
+	return true, c.cache.DecrLikeCntIfPresent(ctx, biz, id)
 }
 func (c *CachedInteractiveRepository) AddCollectionItem(ctx context.Context, biz string, id int64, cid int64, uid int64) error {
 	err := c.dao.InsertCollectionBiz(ctx, dao.UserCollectionBiz{
@@ -156,6 +160,12 @@ func (c *CachedInteractiveRepository) Collected(ctx context.Context, biz string,
 		return false, err
 	}
 }
+func (c *CachedInteractiveRepository) LikedIds(ctx context.Context, biz string, ids []int64, uid int64) ([]int64, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return c.dao.GetLikedBizIds(ctx, biz, ids, uid)
+}
 func (c *CachedInteractiveRepository) GetByIds(ctx context.Context, biz string, ids []int64) ([]domain.Interactive, error) {
 	intrs, err := c.dao.GetByIds(ctx, biz, ids)
 	if err != nil {
@@ -172,5 +182,6 @@ func (c *CachedInteractiveRepository) toDomain(ie dao.Interactive) domain.Intera
 		ReadCnt:    ie.ReadCnt,
 		LikeCnt:    ie.LikeCnt,
 		CollectCnt: ie.CollectCnt,
+		CommentCnt: ie.CommentCnt,
 	}
 }
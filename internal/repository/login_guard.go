@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"archi/internal/repository/cache"
+	"context"
+	"time"
+)
+
+type LoginGuardStatus = cache.LoginGuardStatus
+
+type LoginGuardRepository interface {
+	Status(ctx context.Context, account, ip string) (LoginGuardStatus, error)
+	RecordFailure(ctx context.Context, account, ip string, window time.Duration) (int64, int64, error)
+	Delay(ctx context.Context, account, ip string, accountDelay, ipDelay time.Duration) error
+	Lock(ctx context.Context, account string, duration time.Duration) error
+	Reset(ctx context.Context, account string) error
+}
+
+type CachedLoginGuardRepository struct {
+	cache cache.LoginGuardCache
+}
+
+func NewCachedLoginGuardRepository(c cache.LoginGuardCache) LoginGuardRepository {
+	return &CachedLoginGuardRepository{
+		cache: c,
+	}
+}
+
+func (c *CachedLoginGuardRepository) Status(ctx context.Context, account, ip string) (LoginGuardStatus, error) {
+	return c.cache.Status(ctx, account, ip)
+}
+
+func (c *CachedLoginGuardRepository) RecordFailure(ctx context.Context, account, ip string, window time.Duration) (int64, int64, error) {
+	return c.cache.RecordFailure(ctx, account, ip, window)
+}
+
+func (c *CachedLoginGuardRepository) Delay(ctx context.Context, account, ip string, accountDelay, ipDelay time.Duration) error {
+	return c.cache.Delay(ctx, account, ip, accountDelay, ipDelay)
+}
+
+func (c *CachedLoginGuardRepository) Lock(ctx context.Context, account string, duration time.Duration) error {
+	return c.cache.Lock(ctx, account, duration)
+}
+
+func (c *CachedLoginGuardRepository) Reset(ctx context.Context, account string) error {
+	return c.cache.Reset(ctx, account)
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"archi/internal/domain"
+	"archi/internal/repository/dao"
+	"context"
+
+	"github.com/ecodeclub/ekit/slice"
+)
+
+type MentionRepository interface {
+	// Replace 保存内容的提及，notify 为 true 时返回之前没有通知过、这次需要通知的提及
+	Replace(ctx context.Context, biz string, bizId int64, mentions []domain.Mention, notify bool) ([]domain.Mention, error)
+	// MarkNotified 内容复审通过之后，返回之前没有通知过的提及，并标记为已通知
+	MarkNotified(ctx context.Context, biz string, bizId int64) ([]domain.Mention, error)
+	// FindByBizIds 按内容 id 分组，每组按出现的位置排序
+	FindByBizIds(ctx context.Context, biz string, bizIds []int64) (map[int64][]domain.Mention, error)
+}
+
+type DefaultMentionRepository struct {
+	dao dao.MentionDAO
+}
+
+func NewDefaultMentionRepository(dao dao.MentionDAO) MentionRepository {
+	return &DefaultMentionRepository{
+		dao: dao,
+	}
+}
+
+func (repo *DefaultMentionRepository) Replace(ctx context.Context, biz string, bizId int64,
+	mentions []domain.Mention, notify bool) ([]domain.Mention, error) {
+	res, err := repo.dao.Replace(ctx, biz, bizId, slice.Map(mentions, func(idx int, src domain.Mention) dao.Mention {
+		return dao.Mention{
+			Uid:      src.Uid,
+			Nickname: src.Nickname,
+			Start:    src.Start,
+			End:      src.End,
+		}
+	}), notify)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(res, func(idx int, src dao.Mention) domain.Mention {
+		return repo.toDomain(src)
+	}), nil
+}
+
+func (repo *DefaultMentionRepository) MarkNotified(ctx context.Context, biz string, bizId int64) ([]domain.Mention, error) {
+	res, err := repo.dao.MarkNotified(ctx, biz, bizId)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(res, func(idx int, src dao.Mention) domain.Mention {
+		return repo.toDomain(src)
+	}), nil
+}
+
+func (repo *DefaultMentionRepository) FindByBizIds(ctx context.Context, biz string, bizIds []int64) (map[int64][]domain.Mention, error) {
+	res := make(map[int64][]domain.Mention, len(bizIds))
+	if len(bizIds) == 0 {
+		return res, nil
+	}
+	ms, err := repo.dao.FindByBizIds(ctx, biz, bizIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range ms {
+		res[m.BizId] = append(res[m.BizId], repo.toDomain(m))
+	}
+	return res, nil
+}
+
+func (repo *DefaultMentionRepository) toDomain(m dao.Mention) domain.Mention {
+	return domain.Mention{
+		Uid:      m.Uid,
+		Nickname: m.Nickname,
+		Start:    m.Start,
+		End:      m.End,
+	}
+}
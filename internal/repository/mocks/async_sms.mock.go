@@ -0,0 +1,144 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./async_sms.go
+//
+// Generated by this command:
+//
+//	mockgen -source=./async_sms.go -package=repomocks -destination=./mocks/async_sms.mock.go AsyncSMSRepository
+//
+
+// Package repomocks is a generated GoMock package.
+package repomocks
+
+import (
+	domain "archi/internal/domain"
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockAsyncSMSRepository is a mock of AsyncSMSRepository interface.
+type MockAsyncSMSRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockAsyncSMSRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockAsyncSMSRepositoryMockRecorder is the mock recorder for MockAsyncSMSRepository.
+type MockAsyncSMSRepositoryMockRecorder struct {
+	mock *MockAsyncSMSRepository
+}
+
+// NewMockAsyncSMSRepository creates a new mock instance.
+func NewMockAsyncSMSRepository(ctrl *gomock.Controller) *MockAsyncSMSRepository {
+	mock := &MockAsyncSMSRepository{ctrl: ctrl}
+	mock.recorder = &MockAsyncSMSRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAsyncSMSRepository) EXPECT() *MockAsyncSMSRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Add mocks base method.
+func (m *MockAsyncSMSRepository) Add(ctx context.Context, s domain.AsyncSMS) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Add", ctx, s)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Add indicates an expected call of Add.
+func (mr *MockAsyncSMSRepositoryMockRecorder) Add(ctx, s any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockAsyncSMSRepository)(nil).Add), ctx, s)
+}
+
+// FindDead mocks base method.
+func (m *MockAsyncSMSRepository) FindDead(ctx context.Context, maxId int64, limit int) ([]domain.AsyncSMS, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindDead", ctx, maxId, limit)
+	ret0, _ := ret[0].([]domain.AsyncSMS)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindDead indicates an expected call of FindDead.
+func (mr *MockAsyncSMSRepositoryMockRecorder) FindDead(ctx, maxId, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDead", reflect.TypeOf((*MockAsyncSMSRepository)(nil).FindDead), ctx, maxId, limit)
+}
+
+// MarkDead mocks base method.
+func (m *MockAsyncSMSRepository) MarkDead(ctx context.Context, id int64, reason string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkDead", ctx, id, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkDead indicates an expected call of MarkDead.
+func (mr *MockAsyncSMSRepositoryMockRecorder) MarkDead(ctx, id, reason any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkDead", reflect.TypeOf((*MockAsyncSMSRepository)(nil).MarkDead), ctx, id, reason)
+}
+
+// MarkRetry mocks base method.
+func (m *MockAsyncSMSRepository) MarkRetry(ctx context.Context, id int64, nextRetryAt time.Time, reason string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkRetry", ctx, id, nextRetryAt, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkRetry indicates an expected call of MarkRetry.
+func (mr *MockAsyncSMSRepositoryMockRecorder) MarkRetry(ctx, id, nextRetryAt, reason any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkRetry", reflect.TypeOf((*MockAsyncSMSRepository)(nil).MarkRetry), ctx, id, nextRetryAt, reason)
+}
+
+// MarkSuccess mocks base method.
+func (m *MockAsyncSMSRepository) MarkSuccess(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkSuccess", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkSuccess indicates an expected call of MarkSuccess.
+func (mr *MockAsyncSMSRepositoryMockRecorder) MarkSuccess(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkSuccess", reflect.TypeOf((*MockAsyncSMSRepository)(nil).MarkSuccess), ctx, id)
+}
+
+// PreemptBatch mocks base method.
+func (m *MockAsyncSMSRepository) PreemptBatch(ctx context.Context, limit int, lease time.Duration) ([]domain.AsyncSMS, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PreemptBatch", ctx, limit, lease)
+	ret0, _ := ret[0].([]domain.AsyncSMS)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PreemptBatch indicates an expected call of PreemptBatch.
+func (mr *MockAsyncSMSRepositoryMockRecorder) PreemptBatch(ctx, limit, lease any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PreemptBatch", reflect.TypeOf((*MockAsyncSMSRepository)(nil).PreemptBatch), ctx, limit, lease)
+}
+
+// Requeue mocks base method.
+func (m *MockAsyncSMSRepository) Requeue(ctx context.Context, id int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Requeue", ctx, id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Requeue indicates an expected call of Requeue.
+func (mr *MockAsyncSMSRepositoryMockRecorder) Requeue(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Requeue", reflect.TypeOf((*MockAsyncSMSRepository)(nil).Requeue), ctx, id)
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"archi/internal/domain"
+	"archi/internal/repository/dao"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ecodeclub/ekit/slice"
+)
+
+// ErrModerationNotFound 业务对象还没有审核记录
+var ErrModerationNotFound = dao.ErrDataNotFound
+
+type ModerationRepository interface {
+	Save(ctx context.Context, m domain.Moderation) error
+	FindById(ctx context.Context, id int64) (domain.Moderation, error)
+	FindByBiz(ctx context.Context, biz string, bizId int64) (domain.Moderation, error)
+	FindByStatus(ctx context.Context, status domain.ModerationStatus, offset, limit int) ([]domain.Moderation, error)
+	UpdateStatus(ctx context.Context, id int64, from, to domain.ModerationStatus, reviewer int64) (bool, error)
+}
+
+type DefaultModerationRepository struct {
+	dao dao.ModerationDAO
+}
+
+func NewDefaultModerationRepository(dao dao.ModerationDAO) ModerationRepository {
+	return &DefaultModerationRepository{
+		dao: dao,
+	}
+}
+
+func (repo *DefaultModerationRepository) Save(ctx context.Context, m domain.Moderation) error {
+	return repo.dao.Upsert(ctx, repo.toEntity(m))
+}
+
+func (repo *DefaultModerationRepository) FindById(ctx context.Context, id int64) (domain.Moderation, error) {
+	m, err := repo.dao.FindById(ctx, id)
+	if err != nil {
+		return domain.Moderation{}, err
+	}
+	return repo.toDomain(m), nil
+}
+
+func (repo *DefaultModerationRepository) FindByBiz(ctx context.Context, biz string, bizId int64) (domain.Moderation, error) {
+	m, err := repo.dao.FindByBiz(ctx, biz, bizId)
+	if err != nil {
+		return domain.Moderation{}, err
+	}
+	return repo.toDomain(m), nil
+}
+
+func (repo *DefaultModerationRepository) FindByStatus(ctx context.Context, status domain.ModerationStatus, offset, limit int) ([]domain.Moderation, error) {
+	ms, err := repo.dao.FindByStatus(ctx, status.ToUint8(), offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(ms, func(idx int, src dao.Moderation) domain.Moderation {
+		return repo.toDomain(src)
+	}), nil
+}
+
+func (repo *DefaultModerationRepository) UpdateStatus(ctx context.Context, id int64, from, to domain.ModerationStatus, reviewer int64) (bool, error) {
+	return repo.dao.UpdateStatus(ctx, id, from.ToUint8(), to.ToUint8(), reviewer)
+}
+
+func (repo *DefaultModerationRepository) toEntity(m domain.Moderation) dao.Moderation {
+	reasons, _ := json.Marshal(m.Reasons)
+	return dao.Moderation{
+		Id:       m.ID,
+		Biz:      m.Biz,
+		BizId:    m.BizId,
+		Uid:      m.Uid,
+		Content:  m.Content,
+		Verdict:  m.Verdict.ToUint8(),
+		Reasons:  string(reasons),
+		Source:   string(m.Source),
+		Status:   m.Status.ToUint8(),
+		Reviewer: m.Reviewer,
+	}
+}
+
+func (repo *DefaultModerationRepository) toDomain(m dao.Moderation) domain.Moderation {
+	var reasons []string
+	_ = json.Unmarshal([]byte(m.Reasons), &reasons)
+	return domain.Moderation{
+		ID:       m.Id,
+		Biz:      m.Biz,
+		BizId:    m.BizId,
+		Uid:      m.Uid,
+		Content:  m.Content,
+		Verdict:  domain.ModerationVerdict(m.Verdict),
+		Reasons:  reasons,
+		Source:   domain.ModerationSource(m.Source),
+		Status:   domain.ModerationStatus(m.Status),
+		Reviewer: m.Reviewer,
+		Ctime:    time.UnixMilli(m.Ctime),
+		Utime:    time.UnixMilli(m.Utime),
+	}
+}
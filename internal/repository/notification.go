@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"archi/internal/domain"
+	"archi/internal/repository/cache"
+	"archi/internal/repository/dao"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ecodeclub/ekit/slice"
+)
+
+var ErrNotificationNotFound = dao.ErrRecordNotFound
+
+type NotificationRepository interface {
+	// Merge 合并一次事件，同时增加未读计数
+	Merge(ctx context.Context, n domain.Notification, actor int64) (domain.Notification, error)
+	List(ctx context.Context, uid int64, offset, limit int) ([]domain.Notification, error)
+	MarkRead(ctx context.Context, uid, id int64) error
+	MarkAllRead(ctx context.Context, uid int64) error
+	// UnreadCounts 按类型返回未读数，优先读缓存
+	UnreadCounts(ctx context.Context, uid int64) (map[domain.NotificationType]int64, error)
+
+	MutedTypes(ctx context.Context, uid int64) ([]domain.NotificationType, error)
+	SetMuted(ctx context.Context, uid int64, typ domain.NotificationType, muted bool) error
+
+	Publish(ctx context.Context, n domain.Notification) error
+	Subscribe(ctx context.Context) (<-chan domain.Notification, error)
+}
+
+type CachedNotificationRepository struct {
+	dao   dao.NotificationDAO
+	cache cache.NotificationCache
+}
+
+func NewCachedNotificationRepository(dao dao.NotificationDAO, cache cache.NotificationCache) NotificationRepository {
+	return &CachedNotificationRepository{
+		dao:   dao,
+		cache: cache,
+	}
+}
+
+func (repo *CachedNotificationRepository) Merge(ctx context.Context, n domain.Notification, actor int64) (domain.Notification, error) {
+	res, err := repo.dao.Merge(ctx, repo.toEntity(n), actor)
+	if err != nil {
+		return domain.Notification{}, err
+	}
+	// 计数不准的时候，删掉缓存等下次重建
+	if er := repo.cache.IncrUnreadIfPresent(ctx, n.Uid, n.Type, 1); er != nil {
+		_ = repo.cache.DelUnread(ctx, n.Uid)
+	}
+	return repo.toDomain(res), nil
+}
+
+func (repo *CachedNotificationRepository) List(ctx context.Context, uid int64, offset, limit int) ([]domain.Notification, error) {
+	ns, err := repo.dao.List(ctx, uid, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(ns, func(idx int, src dao.Notification) domain.Notification {
+		return repo.toDomain(src)
+	}), nil
+}
+
+func (repo *CachedNotificationRepository) MarkRead(ctx context.Context, uid, id int64) error {
+	n, err := repo.dao.MarkRead(ctx, uid, id)
+	if err != nil {
+		return err
+	}
+	if n.UnreadCnt == 0 {
+		return nil
+	}
+	if er := repo.cache.IncrUnreadIfPresent(ctx, uid, domain.NotificationType(n.Type), -n.UnreadCnt); er != nil {
+		return repo.cache.DelUnread(ctx, uid)
+	}
+	return nil
+}
+
+func (repo *CachedNotificationRepository) MarkAllRead(ctx context.Context, uid int64) error {
+	if err := repo.dao.MarkAllRead(ctx, uid); err != nil {
+		return err
+	}
+	return repo.cache.SetUnread(ctx, uid, map[domain.NotificationType]int64{})
+}
+
+func (repo *CachedNotificationRepository) UnreadCounts(ctx context.Context, uid int64) (map[domain.NotificationType]int64, error) {
+	res, err := repo.cache.GetUnread(ctx, uid)
+	if err == nil {
+		return res, nil
+	}
+	if !errors.Is(err, cache.ErrKeyNotExist) {
+		return nil, err
+	}
+	cnts, err := repo.dao.CountUnread(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	res = make(map[domain.NotificationType]int64, len(cnts))
+	for typ, cnt := range cnts {
+		res[domain.NotificationType(typ)] = cnt
+	}
+	_ = repo.cache.SetUnread(ctx, uid, res)
+	return res, nil
+}
+
+func (repo *CachedNotificationRepository) MutedTypes(ctx context.Context, uid int64) ([]domain.NotificationType, error) {
+	types, err := repo.dao.GetMutedTypes(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(types, func(idx int, src string) domain.NotificationType {
+		return domain.NotificationType(src)
+	}), nil
+}
+
+func (repo *CachedNotificationRepository) SetMuted(ctx context.Context, uid int64, typ domain.NotificationType, muted bool) error {
+	return repo.dao.SetMuted(ctx, uid, string(typ), muted)
+}
+
+func (repo *CachedNotificationRepository) Publish(ctx context.Context, n domain.Notification) error {
+	return repo.cache.Publish(ctx, n)
+}
+
+func (repo *CachedNotificationRepository) Subscribe(ctx context.Context) (<-chan domain.Notification, error) {
+	return repo.cache.Subscribe(ctx)
+}
+
+func (repo *CachedNotificationRepository) toEntity(n domain.Notification) dao.Notification {
+	ext, _ := json.Marshal(n.Ext)
+	return dao.Notification{
+		Id:        n.ID,
+		Uid:       n.Uid,
+		GroupKey:  n.GroupKey,
+		Type:      string(n.Type),
+		Biz:       n.Biz,
+		BizId:     n.BizId,
+		ActorCnt:  n.ActorCnt,
+		UnreadCnt: n.UnreadCnt,
+		Ext:       string(ext),
+	}
+}
+
+func (repo *CachedNotificationRepository) toDomain(n dao.Notification) domain.Notification {
+	var (
+		actorIds []int64
+		ext      map[string]string
+	)
+	_ = json.Unmarshal([]byte(n.Actors), &actorIds)
+	_ = json.Unmarshal([]byte(n.Ext), &ext)
+	return domain.Notification{
+		ID:       n.Id,
+		Uid:      n.Uid,
+		Type:     domain.NotificationType(n.Type),
+		GroupKey: n.GroupKey,
+		Biz:      n.Biz,
+		BizId:    n.BizId,
+		Actors: slice.Map(actorIds, func(idx int, src int64) domain.Actor {
+			return domain.Actor{ID: src}
+		}),
+		ActorCnt:  n.ActorCnt,
+		UnreadCnt: n.UnreadCnt,
+		Ext:       ext,
+		Ctime:     time.UnixMilli(n.Ctime),
+		Utime:     time.UnixMilli(n.Utime),
+	}
+}
@@ -26,10 +26,11 @@ func NewDefaultArticleRepository(d search.ArticleDAO, td search.TagDAO) ArticleR
 
 func (a *DefaultArticleRepository) InputArticle(ctx context.Context, msg domain.ArticleES) error {
 	return a.dao.InputArticle(ctx, search.Article{
-		Id:      msg.Id,
-		Title:   msg.Title,
-		Status:  msg.Status,
-		Content: msg.Content,
+		Id:       msg.Id,
+		Title:    msg.Title,
+		Status:   msg.Status,
+		Content:  msg.Content,
+		AuthorId: msg.AuthorId,
 	})
 }
 
@@ -44,11 +45,12 @@ func (a *DefaultArticleRepository) SearchArticle(ctx context.Context, uid int64,
 	}
 	return slice.Map(arts, func(idx int, src search.Article) domain.ArticleES {
 		return domain.ArticleES{
-			Id:      src.Id,
-			Title:   src.Title,
-			Status:  src.Status,
-			Content: src.Content,
-			Tags:    src.Tags,
+			Id:       src.Id,
+			Title:    src.Title,
+			Status:   src.Status,
+			Content:  src.Content,
+			Tags:     src.Tags,
+			AuthorId: src.AuthorId,
 		}
 	}), nil
 }
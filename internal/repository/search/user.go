@@ -10,6 +10,7 @@ import (
 type UserRepository interface {
 	InputUser(ctx context.Context, msg domain.UserES) error
 	SearchUser(ctx context.Context, keywords []string) ([]domain.UserES, error)
+	SuggestUser(ctx context.Context, prefix string, limit int) ([]domain.UserES, error)
 }
 
 type DefaultUserRepository struct {
@@ -44,3 +45,16 @@ func (u *DefaultUserRepository) SearchUser(ctx context.Context, keywords []strin
 		}
 	}), nil
 }
+
+func (u *DefaultUserRepository) SuggestUser(ctx context.Context, prefix string, limit int) ([]domain.UserES, error) {
+	users, err := u.dao.Suggest(ctx, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(users, func(idx int, src search.User) domain.UserES {
+		return domain.UserES{
+			Id:       src.Id,
+			Nickname: src.Nickname,
+		}
+	}), nil
+}
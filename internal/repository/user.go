@@ -7,6 +7,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"github.com/ecodeclub/ekit/slice"
 	"time"
 )
 
@@ -25,6 +26,10 @@ type UserRepository interface {
 	FindByPhone(ctx context.Context, phone string) (domain.User, error)
 
 	FindById(ctx context.Context, uID int64) (domain.User, error)
+	// FindByIds 批量查询，不存在的用户直接跳过
+	FindByIds(ctx context.Context, uids []int64) ([]domain.User, error)
+	// FindByNicknames 批量按昵称查询，昵称不唯一，同一个昵称可能返回多个用户
+	FindByNicknames(ctx context.Context, nicknames []string) ([]domain.User, error)
 	FindByWechat(ctx context.Context, openID string) (domain.User, error)
 }
 
@@ -113,6 +118,30 @@ func (c *CachedUserRepository) FindById(ctx context.Context, uid int64) (domain.
 		return domain.User{}, err
 	}
 }
+func (c *CachedUserRepository) FindByIds(ctx context.Context, uids []int64) ([]domain.User, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	us, err := c.dao.FindByIds(ctx, uids)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(us, func(idx int, src dao.User) domain.User {
+		return c.toDomain(src)
+	}), nil
+}
+func (c *CachedUserRepository) FindByNicknames(ctx context.Context, nicknames []string) ([]domain.User, error) {
+	if len(nicknames) == 0 {
+		return nil, nil
+	}
+	us, err := c.dao.FindByNicknames(ctx, nicknames)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(us, func(idx int, src dao.User) domain.User {
+		return c.toDomain(src)
+	}), nil
+}
 func (c *CachedUserRepository) FindByWechat(ctx context.Context, openID string) (domain.User, error) {
 	ue, err := c.dao.FindByWechat(ctx, openID)
 	if err != nil {
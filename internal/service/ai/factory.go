@@ -4,8 +4,8 @@ import (
 	"archi/internal/domain"
 	"archi/internal/repository"
 	"archi/internal/service"
+	"archi/pkg/logger"
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 
@@ -15,20 +15,31 @@ import (
 	"github.com/cloudwego/eino/schema"
 )
 
+// maxOutputRepair 结构化输出校验失败后最多让模型修复的次数
+const maxOutputRepair = 2
+
 // AiFactory 负责根据场景构建所有的 Eino 编排实例
 type AiFactory struct {
 	chatModel model.ToolCallingChatModel
 	artRepo   repository.ArticleRepository
 	rankSvc   service.RankingService
 	intrSvc   service.InteractiveService
+	tagSvc    service.TagService
+	// aiRepo 用于保存待确认的写操作以及工具调用审计
+	aiRepo repository.AiRepository
+	l      logger.Logger
 }
 
-func NewAiFactory(m model.ToolCallingChatModel, artRepo repository.ArticleRepository, rankSvc service.RankingService, intrSvc service.InteractiveService) *AiFactory {
+func NewAiFactory(m model.ToolCallingChatModel, artRepo repository.ArticleRepository, rankSvc service.RankingService,
+	intrSvc service.InteractiveService, tagSvc service.TagService, aiRepo repository.AiRepository, l logger.Logger) *AiFactory {
 	return &AiFactory{
 		chatModel: m,
 		artRepo:   artRepo,
 		rankSvc:   rankSvc,
 		intrSvc:   intrSvc,
+		tagSvc:    tagSvc,
+		aiRepo:    aiRepo,
+		l:         l,
 	}
 }
 
@@ -41,6 +52,8 @@ func (f *AiFactory) Create(scene domain.Scene) (compose.Runnable[any, any], erro
 		return f.buildArticleQAChain()
 	case domain.SceneAuthorHelper:
 		return f.buildAuthorHelperAgent()
+	case domain.SceneContentModeration:
+		return f.buildModerationChain()
 	default:
 		return nil, fmt.Errorf("unknown ai scene: %s", scene)
 	}
@@ -48,31 +61,24 @@ func (f *AiFactory) Create(scene domain.Scene) (compose.Runnable[any, any], erro
 
 // buildSummaryChain 构建读者侧“文章课代表总结”的线性链
 func (f *AiFactory) buildSummaryChain() (compose.Runnable[any, any], error) {
-	// 定义 System Prompt，这部分内容是固定的
-	const systemPrompt = `你是一位资深的社区内容运营“课代表”。请仔细阅读以下文章，然后完成两个任务：
-1. 生成一段 100 字以内、风格类似小红书的精炼种草总结。
-2. 提取 2-3 句最能引发读者共鸣或彰显作者观点的“金句”。
-
-请严格按照以下 JSON 格式输出，不要包含任何额外说明：
-{"content": "你的总结内容", "golden_sentences": ["金句1", "金句2"]}`
-
 	// 创建一个通用的编排链 (输入为 any，输出为 any)
 	chain := compose.NewChain[any, any]()
 	chain.
 		// 第一步：将输入转换为模型需要的 []*schema.Message
 		AppendLambda(compose.InvokableLambda(func(ctx context.Context, input any) ([]*schema.Message, error) {
-			var art domain.Article
+			var sumInput ArticleSummaryInput
 			switch v := input.(type) {
-			case domain.Article:
-				art = v
-			case *domain.Article:
+			case ArticleSummaryInput:
+				sumInput = v
+			case *ArticleSummaryInput:
 				if v == nil {
-					return nil, fmt.Errorf("input article pointer is nil")
+					return nil, fmt.Errorf("input summary input pointer is nil")
 				}
-				art = *v
+				sumInput = *v
 			default:
 				return nil, fmt.Errorf("invalid input type for summary chain: %T", input)
 			}
+			art := sumInput.Article
 
 			// 手动格式化 Prompt，绕过有问题的 PromptTemplate 组件
 			userPrompt := fmt.Sprintf("文章标题: %s\n正文内容: %s", art.Title, art.Content)
@@ -80,17 +86,21 @@ func (f *AiFactory) buildSummaryChain() (compose.Runnable[any, any], error) {
 			log.Printf("[AI-FACTORY-DEBUG] Manually formatted prompt. Content length: %d", len(userPrompt))
 
 			return []*schema.Message{
-				schema.SystemMessage(systemPrompt),
+				// System Prompt 由 PromptRegistry 按实验分流渲染后传入
+				schema.SystemMessage(sumInput.SystemPrompt),
 				schema.UserMessage(userPrompt),
 			}, nil
 		})).
 		// 第二步：直接调用模型
 		AppendChatModel(f.chatModel).
-		// 第三步：解析 JSON 结果并返回
-		AppendLambda(compose.InvokableLambda(func(ctx context.Context, msg *schema.Message) (any, error) {
-			var res domain.ArticleSummary
-			err := json.Unmarshal([]byte(msg.Content), &res)
-			return res, err
+		// 第三步：清洗、校验 JSON 结果，不合法时让模型修复
+		AppendLambda(NewStructuredOutputParser[articleSummaryOutput](f.chatModel, maxOutputRepair).Lambda()).
+		// 第四步：转换为领域对象返回
+		AppendLambda(compose.InvokableLambda(func(ctx context.Context, out articleSummaryOutput) (any, error) {
+			return domain.ArticleSummary{
+				Content:         out.Content,
+				GoldenSentences: out.GoldenSentences,
+			}, nil
 		}))
 
 	// 3. 编译并返回
@@ -118,56 +128,74 @@ func (f *AiFactory) buildArticleQAChain() (compose.Runnable[any, any], error) {
 				return nil, fmt.Errorf("invalid input type for QA chain: %T", input)
 			}
 
-			// 构造 System Prompt，直接注入文章全文作为上下文
-			systemPrompt := fmt.Sprintf(`你是一位博学且细心的文章助手。以下是用户正在阅读的文章全文：
----
-%s
----
-请严格基于以上内容回答用户的提问。
-规则：
-1. 如果文章中没有提到相关信息，请回答：“抱歉，在本文中没有找到相关信息。”
-2. 请使用简洁且有亲和力的语气。
-3. 必要时使用 Markdown 格式（如加粗或列表）使回答更易读。`, qaInput.Content)
-
 			return []*schema.Message{
-				schema.SystemMessage(systemPrompt),
+				// System Prompt 已由 PromptRegistry 渲染，文章全文作为上下文注入其中
+				schema.SystemMessage(qaInput.SystemPrompt),
 				schema.UserMessage(qaInput.Question),
 			}, nil
 		})).
 		// 第二步：调用模型 (支持流式输出)
 		AppendChatModel(f.chatModel).
-		// 第三步：后处理，将 *schema.Message 转换为文本内容 (如果是流式，这一步会被 Eino 自动处理或透传)
-		AppendLambda(compose.InvokableLambda(func(ctx context.Context, msg *schema.Message) (any, error) {
-			return msg.Content, nil
-		}))
+		// 第三步：后处理，将 *schema.Message 转换为文本内容
+		// 流式调用时逐个转换数据块，避免 Eino 把模型输出拼接完整后才下发
+		AppendLambda(qaOutputLambda)
 
 	// 2. 编译并返回
 	return chain.Compile(context.Background())
 }
 
-// buildAuthorHelperAgent 使用 Eino ADK 构建创作者助手 Agent
-func (f *AiFactory) buildAuthorHelperAgent() (compose.Runnable[any, any], error) {
-	const systemPrompt = `你是一位专业的“创作者 AI 助手”。
-你的目标是帮助创作者优化文章内容、提供创意建议或参考其历史写作风格。
-
-你可以使用的工具：
-1. get_article_content: 当你需要获取当前文章或某篇特定文章的全文时使用。
-2. search_author_articles: 当你需要参考作者的历史写作风格或查找其相关旧文时使用。
-3. get_hot_trends: 当创作者询问当前热门话题或需要灵感建议时使用。
-4. get_article_stats: 当创作者需要了解某篇文章的阅读、点赞等反馈数据时使用。
+var qaOutputLambda, _ = compose.AnyLambda[*schema.Message, any, any](
+	func(ctx context.Context, msg *schema.Message, opts ...any) (any, error) {
+		return msg.Content, nil
+	}, nil, nil,
+	func(ctx context.Context, input *schema.StreamReader[*schema.Message], opts ...any) (*schema.StreamReader[any], error) {
+		return schema.StreamReaderWithConvert(input, func(msg *schema.Message) (any, error) {
+			if msg.Content == "" {
+				return nil, schema.ErrNoValue
+			}
+			return msg.Content, nil
+		}), nil
+	})
 
-工作流程：
-- 如果用户指令涉及“润色”、“续写”或“改写”当前文章，但你没有看到内容，请先调用 get_article_content。
-- 如果用户要求“模仿我的风格”或“参考我之前的文章”，请先调用 search_author_articles 查找相关文章。
-- 如果用户询问“最近什么火”或需要“选题建议”，请调用 get_hot_trends。
-- 始终以专业、鼓励且具有建设性的语气与创作者交流。`
+// buildModerationChain 构建平台侧“内容审核”的线性链
+func (f *AiFactory) buildModerationChain() (compose.Runnable[any, any], error) {
+	chain := compose.NewChain[any, any]()
+	chain.
+		AppendLambda(compose.InvokableLambda(func(ctx context.Context, input any) ([]*schema.Message, error) {
+			var modInput ContentModerationInput
+			switch v := input.(type) {
+			case ContentModerationInput:
+				modInput = v
+			case *ContentModerationInput:
+				if v == nil {
+					return nil, fmt.Errorf("input moderation input pointer is nil")
+				}
+				modInput = *v
+			default:
+				return nil, fmt.Errorf("invalid input type for moderation chain: %T", input)
+			}
+			return []*schema.Message{
+				schema.SystemMessage(modInput.SystemPrompt),
+				schema.UserMessage(modInput.Content),
+			}, nil
+		})).
+		AppendChatModel(f.chatModel).
+		AppendLambda(NewStructuredOutputParser[contentModerationOutput](f.chatModel, maxOutputRepair).Lambda()).
+		AppendLambda(compose.InvokableLambda(func(ctx context.Context, out contentModerationOutput) (any, error) {
+			return out, nil
+		}))
+	return chain.Compile(context.Background())
+}
 
+// buildAuthorHelperAgent 使用 Eino ADK 构建创作者助手 Agent
+func (f *AiFactory) buildAuthorHelperAgent() (compose.Runnable[any, any], error) {
 	// 1. 创建 ChatModelAgent
 	authorAgent, err := adk.NewChatModelAgent(context.Background(), &adk.ChatModelAgentConfig{
 		Name:        "AuthorHelper",
-		Description: "创作者 AI 助手，支持内容润色、风格模仿和自取内容",
-		Instruction: systemPrompt,
-		Model:       f.chatModel,
+		Description: "创作者 AI 助手，支持内容润色、风格模仿、自取内容以及经用户确认后的标签绑定和草稿保存",
+		// Instruction 按请求从 Session 中读取，见 genAuthorHelperInput
+		GenModelInput: genAuthorHelperInput,
+		Model:         f.chatModel,
 		ToolsConfig: adk.ToolsConfig{
 			ToolsNodeConfig: compose.ToolsNodeConfig{
 				Tools: f.initAuthorTools(f.artRepo),
@@ -186,6 +214,21 @@ func (f *AiFactory) buildAuthorHelperAgent() (compose.Runnable[any, any], error)
 	}, nil
 }
 
+// genAuthorHelperInput 使用 Session 中按实验分流渲染好的 System Prompt 作为指令
+// 不做 f-string 格式化，避免 Prompt 中的花括号被误解析
+func genAuthorHelperInput(ctx context.Context, instruction string, input *adk.AgentInput) ([]adk.Message, error) {
+	if val, ok := adk.GetSessionValue(ctx, "system_prompt"); ok {
+		if sp, ok := val.(string); ok && sp != "" {
+			instruction = sp
+		}
+	}
+	msgs := make([]adk.Message, 0, len(input.Messages)+1)
+	if instruction != "" {
+		msgs = append(msgs, schema.SystemMessage(instruction))
+	}
+	return append(msgs, input.Messages...), nil
+}
+
 // authorHelperRunnable 封装 ADK Agent 为 Eino Runnable 接口
 type authorHelperRunnable struct {
 	agent adk.Agent
@@ -200,8 +243,9 @@ func (r *authorHelperRunnable) Invoke(ctx context.Context, input any, opts ...co
 	userMsg := r.formatUserMsg(qaInput)
 	runner := adk.NewRunner(ctx, adk.RunnerConfig{Agent: r.agent})
 	iter := runner.Run(ctx, []adk.Message{{Role: schema.User, Content: userMsg}}, adk.WithSessionValues(map[string]any{
-		"article_id": qaInput.ArticleID,
-		"author_id":  qaInput.AuthorID,
+		"article_id":    qaInput.ArticleID,
+		"author_id":     qaInput.AuthorID,
+		"system_prompt": qaInput.SystemPrompt,
 	}))
 
 	var finalContent string
@@ -227,10 +271,12 @@ func (r *authorHelperRunnable) Stream(ctx context.Context, input any, opts ...co
 	userMsg := r.formatUserMsg(qaInput)
 	runner := adk.NewRunner(ctx, adk.RunnerConfig{Agent: r.agent})
 	iter := runner.Run(ctx, []adk.Message{{Role: schema.User, Content: userMsg}}, adk.WithSessionValues(map[string]any{
-		"article_id": qaInput.ArticleID,
-		"author_id":  qaInput.AuthorID,
+		"article_id":    qaInput.ArticleID,
+		"author_id":     qaInput.AuthorID,
+		"system_prompt": qaInput.SystemPrompt,
 	}))
 
+	// 完整转发 Agent 的消息，包括工具调用与工具结果，由 Web 层决定如何展示
 	pipeReader, pipeWriter := schema.Pipe[any](10)
 	go func() {
 		defer pipeWriter.Close()
@@ -239,9 +285,21 @@ func (r *authorHelperRunnable) Stream(ctx context.Context, input any, opts ...co
 			if !ok {
 				break
 			}
+			if event.Err != nil {
+				pipeWriter.Send(nil, event.Err)
+				return
+			}
 			msg, _, err := adk.GetMessage(event)
-			if err == nil && msg.Content != "" {
-				_ = pipeWriter.Send(msg.Content, nil)
+			if err != nil {
+				pipeWriter.Send(nil, err)
+				return
+			}
+			if msg == nil {
+				continue
+			}
+			// 读取端已经关闭，说明客户端断开了
+			if closed := pipeWriter.Send(msg, nil); closed {
+				return
 			}
 		}
 	}()
@@ -258,8 +316,14 @@ func (r *authorHelperRunnable) Collect(ctx context.Context, reader *schema.Strea
 		if err != nil {
 			break
 		}
-		if s, ok := chunk.(string); ok {
-			finalContent += s
+		switch v := chunk.(type) {
+		case string:
+			finalContent += v
+		case *schema.Message:
+			// 只保留最终回答，忽略工具调用与工具结果
+			if v.Role == schema.Assistant && len(v.ToolCalls) == 0 {
+				finalContent += v.Content
+			}
 		}
 	}
 	return finalContent, nil
@@ -0,0 +1,258 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/eino-contrib/jsonschema"
+)
+
+// ErrInvalidOutput 模型输出在修复之后仍然不符合预期结构
+var ErrInvalidOutput = errors.New("ai output does not match expected structure")
+
+// OutputError 结构化输出解析失败的详细信息
+type OutputError struct {
+	// Raw 最后一次模型输出的原文
+	Raw string
+	// Attempts 总共尝试解析的次数，包括修复重试
+	Attempts int
+	Err      error
+}
+
+func (e *OutputError) Error() string {
+	return fmt.Sprintf("parse structured output failed after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *OutputError) Unwrap() error {
+	return e.Err
+}
+
+func (e *OutputError) Is(target error) bool {
+	return target == ErrInvalidOutput
+}
+
+// StructuredOutputParser 可复用的结构化输出解析阶段
+// 依次执行：去掉 markdown 代码块 -> 按 T 生成的 JSON Schema 校验 -> 反序列化。
+// 校验失败时把错误原因和 Schema 交给模型重新生成，最多修复 maxRepair 次。
+type StructuredOutputParser[T any] struct {
+	chatModel model.BaseChatModel
+	schema    *jsonschema.Schema
+	schemaStr string
+	maxRepair int
+}
+
+func NewStructuredOutputParser[T any](m model.BaseChatModel, maxRepair int) *StructuredOutputParser[T] {
+	r := &jsonschema.Reflector{
+		Anonymous:                 true,
+		DoNotReference:            true,
+		ExpandedStruct:            true,
+		AllowAdditionalProperties: true,
+	}
+	var zero T
+	s := r.Reflect(zero)
+	// Reflect 出来的 $schema 对模型没有意义，去掉减少 token
+	s.Version = ""
+	bs, _ := json.Marshal(s)
+	return &StructuredOutputParser[T]{
+		chatModel: m,
+		schema:    s,
+		schemaStr: string(bs),
+		maxRepair: maxRepair,
+	}
+}
+
+// Lambda 返回可以直接 Append 到 Chain 上的节点，输入为模型消息，输出为 T
+func (p *StructuredOutputParser[T]) Lambda() *compose.Lambda {
+	return compose.InvokableLambda(func(ctx context.Context, msg *schema.Message) (T, error) {
+		return p.ParseWithRepair(ctx, msg.Content)
+	})
+}
+
+// ParseWithRepair 解析失败时发起有限次数的修复重试
+func (p *StructuredOutputParser[T]) ParseWithRepair(ctx context.Context, content string) (T, error) {
+	raw := content
+	res, err := p.Parse(raw)
+	attempts := 1
+	for err != nil && attempts <= p.maxRepair {
+		raw, err = p.repair(ctx, raw, err)
+		attempts++
+		if err != nil {
+			// 修复请求本身失败，不再继续重试
+			break
+		}
+		res, err = p.Parse(raw)
+	}
+	if err != nil {
+		return res, &OutputError{Raw: raw, Attempts: attempts, Err: err}
+	}
+	return res, nil
+}
+
+// Parse 只做清洗、校验和反序列化，不会调用模型
+func (p *StructuredOutputParser[T]) Parse(content string) (T, error) {
+	var res T
+	cleaned := stripJSONFence(content)
+	var doc any
+	if err := json.Unmarshal([]byte(cleaned), &doc); err != nil {
+		return res, fmt.Errorf("invalid json: %w", err)
+	}
+	if err := validateJSONSchema(p.schema, doc, "$"); err != nil {
+		return res, err
+	}
+	if err := json.Unmarshal([]byte(cleaned), &res); err != nil {
+		return res, fmt.Errorf("unmarshal to %T failed: %w", res, err)
+	}
+	return res, nil
+}
+
+func (p *StructuredOutputParser[T]) repair(ctx context.Context, raw string, cause error) (string, error) {
+	msgs := []*schema.Message{
+		schema.SystemMessage("你是一个 JSON 修复助手。请把用户给出的内容修正为严格符合下面 JSON Schema 的 JSON，" +
+			"只输出 JSON 本身，不要使用 markdown 代码块，也不要包含任何额外说明。\nJSON Schema:\n" + p.schemaStr),
+		schema.UserMessage(fmt.Sprintf("待修复的内容:\n%s\n\n校验错误: %s", raw, cause.Error())),
+	}
+	msg, err := p.chatModel.Generate(ctx, msgs)
+	if err != nil {
+		return raw, fmt.Errorf("repair structured output failed: %w", err)
+	}
+	return msg.Content, nil
+}
+
+// stripJSONFence 去掉模型常见的 ```json ... ``` 包裹以及前后的说明文字
+func stripJSONFence(content string) string {
+	s := strings.TrimSpace(content)
+	if strings.HasPrefix(s, "```") {
+		// 去掉首行的 ``` 或 ```json
+		if idx := strings.IndexByte(s, '\n'); idx >= 0 {
+			s = s[idx+1:]
+		} else {
+			s = strings.TrimPrefix(s, "```")
+		}
+		s = strings.TrimSuffix(strings.TrimSpace(s), "```")
+		s = strings.TrimSpace(s)
+	}
+	if strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[") {
+		return s
+	}
+	// 兜底：截取第一个 { 到最后一个 } 之间的内容
+	start, end := strings.IndexByte(s, '{'), strings.LastIndexByte(s, '}')
+	if start >= 0 && end > start {
+		return s[start : end+1]
+	}
+	return s
+}
+
+// validateJSONSchema 按 JSON Schema 的常用子集校验 json.Unmarshal 得到的文档
+// 支持 type、required、properties、items、min/maxItems、min/maxLength、enum
+func validateJSONSchema(s *jsonschema.Schema, v any, path string) error {
+	if s == nil {
+		return nil
+	}
+	if s.Type != "" && !matchJSONType(s.Type, v) {
+		return fmt.Errorf("%s: expected %s, got %s", path, s.Type, jsonTypeOf(v))
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value %v is not one of %v", path, v, s.Enum)
+		}
+	}
+	switch val := v.(type) {
+	case map[string]any:
+		for _, key := range s.Required {
+			if _, ok := val[key]; !ok {
+				return fmt.Errorf("%s: missing required field %q", path, key)
+			}
+		}
+		if s.Properties != nil {
+			for pair := s.Properties.Oldest(); pair != nil; pair = pair.Next() {
+				child, ok := val[pair.Key]
+				if !ok {
+					continue
+				}
+				if err := validateJSONSchema(pair.Value, child, path+"."+pair.Key); err != nil {
+					return err
+				}
+			}
+		}
+	case []any:
+		if s.MinItems != nil && uint64(len(val)) < *s.MinItems {
+			return fmt.Errorf("%s: expected at least %d items, got %d", path, *s.MinItems, len(val))
+		}
+		if s.MaxItems != nil && uint64(len(val)) > *s.MaxItems {
+			return fmt.Errorf("%s: expected at most %d items, got %d", path, *s.MaxItems, len(val))
+		}
+		for i, item := range val {
+			if err := validateJSONSchema(s.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case string:
+		n := uint64(utf8.RuneCountInString(val))
+		if s.MinLength != nil && n < *s.MinLength {
+			return fmt.Errorf("%s: expected at least %d characters, got %d", path, *s.MinLength, n)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fmt.Errorf("%s: expected at most %d characters, got %d", path, *s.MaxLength, n)
+		}
+	}
+	return nil
+}
+
+func matchJSONType(typ string, v any) bool {
+	switch typ {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == float64(int64(f))
+	case "null":
+		return v == nil
+	}
+	return true
+}
+
+func jsonTypeOf(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,310 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testOutputMeta struct {
+	Hot bool `json:"hot"`
+}
+
+type testOutput struct {
+	Verdict string         `json:"verdict" jsonschema:"enum=pass,enum=block"`
+	Title   string         `json:"title" jsonschema:"minLength=2,maxLength=5"`
+	Tags    []string       `json:"tags" jsonschema:"minItems=1,maxItems=2"`
+	Score   int            `json:"score"`
+	Meta    testOutputMeta `json:"meta"`
+	Note    string         `json:"note,omitempty"`
+}
+
+const validTestOutput = `{"verdict":"pass","title":"标题","tags":["go"],"score":3,"meta":{"hot":true}}`
+
+var wantTestOutput = testOutput{
+	Verdict: "pass",
+	Title:   "标题",
+	Tags:    []string{"go"},
+	Score:   3,
+	Meta:    testOutputMeta{Hot: true},
+}
+
+// fakeChatModel 按顺序返回 replies，用完之后返回 err
+type fakeChatModel struct {
+	replies []string
+	err     error
+	// inputs 每次 Generate 收到的消息
+	inputs [][]*schema.Message
+}
+
+func (m *fakeChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	m.inputs = append(m.inputs, input)
+	if len(m.replies) == 0 {
+		return nil, m.err
+	}
+	reply := m.replies[0]
+	m.replies = m.replies[1:]
+	return schema.AssistantMessage(reply, nil), nil
+}
+
+func (m *fakeChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestStripJSONFence(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "纯 JSON",
+			content: ` {"a":1} `,
+			want:    `{"a":1}`,
+		},
+		{
+			name:    "json 代码块",
+			content: "```json\n{\"a\":1}\n```",
+			want:    `{"a":1}`,
+		},
+		{
+			name:    "不带语言的代码块",
+			content: "```\n[1,2]\n```\n",
+			want:    `[1,2]`,
+		},
+		{
+			name:    "单行代码块",
+			content: "```{\"a\":1}```",
+			want:    `{"a":1}`,
+		},
+		{
+			name:    "前后有说明文字",
+			content: "好的，结果如下：\n{\"a\":{\"b\":1}}\n希望对你有帮助",
+			want:    `{"a":{"b":1}}`,
+		},
+		{
+			name:    "代码块外有说明文字",
+			content: "结果：\n```json\n{\"a\":1}\n```",
+			want:    `{"a":1}`,
+		},
+		{
+			name:    "没有 JSON",
+			content: "抱歉，我无法回答",
+			want:    "抱歉，我无法回答",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, stripJSONFence(tc.content))
+		})
+	}
+}
+
+func TestStructuredOutputParser_Parse(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		// wantErr 错误信息需要包含的内容，为空表示解析成功
+		wantErr string
+	}{
+		{
+			name:    "合法输出",
+			content: validTestOutput,
+		},
+		{
+			name:    "代码块包裹",
+			content: "```json\n" + validTestOutput + "\n```",
+		},
+		{
+			name:    "可选字段",
+			content: `{"verdict":"pass","title":"标题","tags":["go"],"score":3,"meta":{"hot":true},"note":"备注","extra":1}`,
+		},
+		{
+			name:    "不是 JSON",
+			content: `{"verdict":`,
+			wantErr: "invalid json",
+		},
+		{
+			name:    "根节点类型不对",
+			content: `["pass"]`,
+			wantErr: "$: expected object, got array",
+		},
+		{
+			name:    "缺少必填字段",
+			content: `{"verdict":"pass","title":"标题","tags":["go"],"score":3}`,
+			wantErr: `$: missing required field "meta"`,
+		},
+		{
+			name:    "枚举值不合法",
+			content: `{"verdict":"maybe","title":"标题","tags":["go"],"score":3,"meta":{"hot":true}}`,
+			wantErr: "$.verdict: value maybe is not one of",
+		},
+		{
+			name:    "字符串太短",
+			content: `{"verdict":"pass","title":"标","tags":["go"],"score":3,"meta":{"hot":true}}`,
+			wantErr: "$.title: expected at least 2 characters, got 1",
+		},
+		{
+			name:    "字符串按字符而不是字节计算长度",
+			content: `{"verdict":"pass","title":"五个汉字啊","tags":["go"],"score":3,"meta":{"hot":true}}`,
+		},
+		{
+			name:    "字符串太长",
+			content: `{"verdict":"pass","title":"六个汉字标题","tags":["go"],"score":3,"meta":{"hot":true}}`,
+			wantErr: "$.title: expected at most 5 characters, got 6",
+		},
+		{
+			name:    "数组太短",
+			content: `{"verdict":"pass","title":"标题","tags":[],"score":3,"meta":{"hot":true}}`,
+			wantErr: "$.tags: expected at least 1 items, got 0",
+		},
+		{
+			name:    "数组太长",
+			content: `{"verdict":"pass","title":"标题","tags":["a","b","c"],"score":3,"meta":{"hot":true}}`,
+			wantErr: "$.tags: expected at most 2 items, got 3",
+		},
+		{
+			name:    "数组元素类型不对",
+			content: `{"verdict":"pass","title":"标题","tags":["go",1],"score":3,"meta":{"hot":true}}`,
+			wantErr: "$.tags[1]: expected string, got number",
+		},
+		{
+			name:    "整数字段是小数",
+			content: `{"verdict":"pass","title":"标题","tags":["go"],"score":3.5,"meta":{"hot":true}}`,
+			wantErr: "$.score: expected integer, got number",
+		},
+		{
+			name:    "嵌套对象字段类型不对",
+			content: `{"verdict":"pass","title":"标题","tags":["go"],"score":3,"meta":{"hot":"yes"}}`,
+			wantErr: "$.meta.hot: expected boolean, got string",
+		},
+		{
+			name:    "null",
+			content: `{"verdict":"pass","title":"标题","tags":null,"score":3,"meta":{"hot":true}}`,
+			wantErr: "$.tags: expected array, got null",
+		},
+	}
+	p := NewStructuredOutputParser[testOutput](&fakeChatModel{}, 2)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := p.Parse(tc.content)
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "pass", res.Verdict)
+		})
+	}
+}
+
+func TestStructuredOutputParser_ParseWithRepair(t *testing.T) {
+	errModel := errors.New("模型调用失败")
+	const invalid = `{"verdict":"maybe"}`
+	testCases := []struct {
+		name      string
+		maxRepair int
+		content   string
+		replies   []string
+		modelErr  error
+
+		want         testOutput
+		wantCalls    int
+		wantErr      error
+		wantAttempts int
+		wantRaw      string
+	}{
+		{
+			name:      "第一次就合法",
+			maxRepair: 2,
+			content:   validTestOutput,
+			want:      wantTestOutput,
+		},
+		{
+			name:      "修复一次",
+			maxRepair: 2,
+			content:   invalid,
+			replies:   []string{"```json\n" + validTestOutput + "\n```"},
+			want:      wantTestOutput,
+			wantCalls: 1,
+		},
+		{
+			name:      "最后一次修复成功",
+			maxRepair: 2,
+			content:   invalid,
+			replies:   []string{invalid, validTestOutput},
+			want:      wantTestOutput,
+			wantCalls: 2,
+		},
+		{
+			name:         "修复次数用完",
+			maxRepair:    2,
+			content:      invalid,
+			replies:      []string{invalid, `not json`, validTestOutput},
+			wantCalls:    2,
+			wantErr:      ErrInvalidOutput,
+			wantAttempts: 3,
+			wantRaw:      `not json`,
+		},
+		{
+			name:         "不修复",
+			maxRepair:    0,
+			content:      invalid,
+			replies:      []string{validTestOutput},
+			wantErr:      ErrInvalidOutput,
+			wantAttempts: 1,
+			wantRaw:      invalid,
+		},
+		{
+			name:         "修复请求失败",
+			maxRepair:    2,
+			content:      invalid,
+			modelErr:     errModel,
+			wantCalls:    1,
+			wantErr:      errModel,
+			wantAttempts: 2,
+			wantRaw:      invalid,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &fakeChatModel{replies: tc.replies, err: tc.modelErr}
+			p := NewStructuredOutputParser[testOutput](m, tc.maxRepair)
+			res, err := p.ParseWithRepair(context.Background(), tc.content)
+			assert.Len(t, m.inputs, tc.wantCalls)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				assert.ErrorIs(t, err, ErrInvalidOutput)
+				var oe *OutputError
+				require.ErrorAs(t, err, &oe)
+				assert.Equal(t, tc.wantAttempts, oe.Attempts)
+				assert.Equal(t, tc.wantRaw, oe.Raw)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res)
+		})
+	}
+}
+
+func TestStructuredOutputParser_RepairPrompt(t *testing.T) {
+	m := &fakeChatModel{replies: []string{validTestOutput}}
+	p := NewStructuredOutputParser[testOutput](m, 1)
+	_, err := p.ParseWithRepair(context.Background(), `{"verdict":"maybe"}`)
+	require.NoError(t, err)
+	require.Len(t, m.inputs, 1)
+	msgs := m.inputs[0]
+	require.Len(t, msgs, 2)
+	// 修复请求带上 Schema、原始输出和校验错误
+	assert.Equal(t, schema.System, msgs[0].Role)
+	assert.Contains(t, msgs[0].Content, p.schemaStr)
+	assert.Equal(t, schema.User, msgs[1].Role)
+	assert.Contains(t, msgs[1].Content, `{"verdict":"maybe"}`)
+	assert.Contains(t, msgs[1].Content, `missing required field "title"`)
+}
@@ -0,0 +1,216 @@
+package ai
+
+import (
+	"archi/internal/domain"
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"text/template"
+)
+
+// SummaryPromptVars 文章总结场景的模板变量
+type SummaryPromptVars struct {
+	Title string
+}
+
+// QAPromptVars 文章问答场景的模板变量
+type QAPromptVars struct {
+	Content string
+}
+
+// AuthorHelperPromptVars 创作者助手场景的模板变量
+type AuthorHelperPromptVars struct {
+	AuthorID int64
+}
+
+// ModerationPromptVars 内容审核场景的模板变量
+type ModerationPromptVars struct {
+	// Biz 审核对象的中文名称，例如 文章、评论
+	Biz string
+}
+
+type compiledPrompt struct {
+	tpl domain.PromptTemplate
+	t   *template.Template
+}
+
+// PromptRegistry 管理各场景下版本化的 Prompt 模板，并按 uid 进行稳定的加权分流
+type PromptRegistry struct {
+	mu      sync.RWMutex
+	prompts map[domain.Scene][]compiledPrompt
+}
+
+func NewPromptRegistry() *PromptRegistry {
+	return &PromptRegistry{
+		prompts: make(map[domain.Scene][]compiledPrompt),
+	}
+}
+
+// Load 全量替换模板，用于配置热更新
+func (r *PromptRegistry) Load(tpls []domain.PromptTemplate) error {
+	prompts := make(map[domain.Scene][]compiledPrompt, len(tpls))
+	for _, tpl := range tpls {
+		cp, err := r.compile(tpl)
+		if err != nil {
+			return err
+		}
+		prompts[tpl.Scene] = r.upsert(prompts[tpl.Scene], cp)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prompts = prompts
+	return nil
+}
+
+// Register 注册单个模板，同场景同版本会被覆盖
+func (r *PromptRegistry) Register(tpl domain.PromptTemplate) error {
+	cp, err := r.compile(tpl)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prompts[tpl.Scene] = r.upsert(r.prompts[tpl.Scene], cp)
+	return nil
+}
+
+// Render 为 uid 选出实验版本并渲染
+// 同一个 uid 在权重配置不变的情况下总是命中同一个版本
+func (r *PromptRegistry) Render(scene domain.Scene, uid int64, vars any) (domain.RenderedPrompt, error) {
+	cp, err := r.pick(scene, uid)
+	if err != nil {
+		return domain.RenderedPrompt{}, err
+	}
+	var buf bytes.Buffer
+	if err = cp.t.Execute(&buf, vars); err != nil {
+		return domain.RenderedPrompt{}, fmt.Errorf("render prompt %s@%s failed: %w", scene, cp.tpl.Version, err)
+	}
+	return domain.RenderedPrompt{
+		Scene:   scene,
+		Version: cp.tpl.Version,
+		Content: buf.String(),
+	}, nil
+}
+
+func (r *PromptRegistry) pick(scene domain.Scene, uid int64) (compiledPrompt, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	// 权重为 0 或者负数的版本不参与分流，也不能抵消其它版本的权重
+	candidates := make([]compiledPrompt, 0, len(r.prompts[scene]))
+	total := 0
+	for _, cp := range r.prompts[scene] {
+		if cp.tpl.Weight > 0 {
+			candidates = append(candidates, cp)
+			total += cp.tpl.Weight
+		}
+	}
+	if total <= 0 {
+		return compiledPrompt{}, fmt.Errorf("no prompt template available for scene %s", scene)
+	}
+	// 按 scene + uid 哈希，保证不同场景的实验互相独立
+	h := fnv.New32a()
+	_, _ = fmt.Fprintf(h, "%s:%d", scene, uid)
+	bucket := int(h.Sum32() % uint32(total))
+	for _, cp := range candidates {
+		if bucket < cp.tpl.Weight {
+			return cp, nil
+		}
+		bucket -= cp.tpl.Weight
+	}
+	return candidates[len(candidates)-1], nil
+}
+
+func (r *PromptRegistry) compile(tpl domain.PromptTemplate) (compiledPrompt, error) {
+	if tpl.Scene == "" || tpl.Version == "" {
+		return compiledPrompt{}, fmt.Errorf("prompt template must have scene and version")
+	}
+	t, err := template.New(string(tpl.Scene) + "@" + tpl.Version).
+		Option("missingkey=error").Parse(tpl.Content)
+	if err != nil {
+		return compiledPrompt{}, fmt.Errorf("parse prompt %s@%s failed: %w", tpl.Scene, tpl.Version, err)
+	}
+	return compiledPrompt{tpl: tpl, t: t}, nil
+}
+
+func (r *PromptRegistry) upsert(list []compiledPrompt, cp compiledPrompt) []compiledPrompt {
+	for i := range list {
+		if list[i].tpl.Version == cp.tpl.Version {
+			list[i] = cp
+			return list
+		}
+	}
+	return append(list, cp)
+}
+
+// DefaultPromptTemplates 内置的默认版本 Prompt，配置中没有覆盖时使用
+func DefaultPromptTemplates() []domain.PromptTemplate {
+	return []domain.PromptTemplate{
+		{
+			Scene:   domain.SceneArticleSummary,
+			Version: "v1",
+			Weight:  100,
+			Content: `你是一位资深的社区内容运营“课代表”。请仔细阅读以下文章，然后完成两个任务：
+1. 生成一段 100 字以内、风格类似小红书的精炼种草总结。
+2. 提取 2-3 句最能引发读者共鸣或彰显作者观点的“金句”。
+
+请严格按照以下 JSON 格式输出，不要包含任何额外说明：
+{"content": "你的总结内容", "golden_sentences": ["金句1", "金句2"]}`,
+		},
+		{
+			Scene:   domain.SceneArticleQA,
+			Version: "v1",
+			Weight:  100,
+			Content: `你是一位博学且细心的文章助手。以下是用户正在阅读的文章全文：
+---
+{{.Content}}
+---
+请严格基于以上内容回答用户的提问。
+规则：
+1. 如果文章中没有提到相关信息，请回答：“抱歉，在本文中没有找到相关信息。”
+2. 请使用简洁且有亲和力的语气。
+3. 必要时使用 Markdown 格式（如加粗或列表）使回答更易读。`,
+		},
+		{
+			Scene:   domain.SceneAuthorHelper,
+			Version: "v2",
+			Weight:  100,
+			Content: `你是一位专业的“创作者 AI 助手”。
+你的目标是帮助创作者优化文章内容、提供创意建议或参考其历史写作风格。
+
+你可以使用的工具：
+1. get_article_content: 当你需要获取当前文章或某篇特定文章的全文时使用。
+2. search_author_articles: 当你需要参考作者的历史写作风格或查找其相关旧文时使用。
+3. get_hot_trends: 当创作者询问当前热门话题或需要灵感建议时使用。
+4. get_article_stats: 当创作者需要了解某篇文章的阅读、点赞等反馈数据时使用。
+5. get_author_tags: 当你需要为文章推荐标签时，先获取作者已有的标签。
+6. propose_attach_tags: 提议给文章绑定标签。
+7. propose_save_draft: 提议保存新的标题或修改后的正文。
+
+工作流程：
+- 如果用户指令涉及“润色”、“续写”或“改写”当前文章，但你没有看到内容，请先调用 get_article_content。
+- 如果用户要求“模仿我的风格”或“参考我之前的文章”，请先调用 search_author_articles 查找相关文章。
+- 如果用户询问“最近什么火”或需要“选题建议”，请调用 get_hot_trends。
+- 如果用户需要“推荐标签”，请先调用 get_author_tags，再调用 propose_attach_tags。
+- 如果用户需要“起标题”或“保存修改”，先给出你的方案，再调用 propose_save_draft。
+- propose_ 开头的工具只会生成待确认的操作，不会直接修改文章。调用后必须告诉用户操作尚未生效，需要用户确认，绝不能声称已经完成修改。
+- 始终以专业、鼓励且具有建设性的语气与创作者交流。`,
+		},
+		{
+			Scene:   domain.SceneContentModeration,
+			Version: "v1",
+			Weight:  100,
+			Content: `你是一位严谨的社区内容审核员，需要判断用户发布的{{.Biz}}是否违反社区规范。
+重点关注：色情低俗、暴力血腥、违法犯罪、人身攻击、垃圾广告与引流、虚假信息。
+
+判定标准：
+- pass：内容正常，没有违规风险。
+- review：存在疑似违规或无法确定的内容，需要人工复审。
+- block：明确违规。
+
+请严格按照以下 JSON 格式输出，不要包含任何额外说明：
+{"verdict": "pass", "reasons": []}
+verdict 取值只能是 pass、review、block 之一，reasons 简要列出判定原因。`,
+		},
+	}
+}
@@ -0,0 +1,250 @@
+package ai
+
+import (
+	"archi/internal/domain"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testScene domain.Scene = "test_scene"
+
+func testPrompt(version string, weight int) domain.PromptTemplate {
+	return domain.PromptTemplate{
+		Scene:   testScene,
+		Version: version,
+		Weight:  weight,
+		Content: version + ":{{.Title}}",
+	}
+}
+
+func TestPromptRegistry_Pick(t *testing.T) {
+	testCases := []struct {
+		name string
+		tpls []domain.PromptTemplate
+		// wantVersions uid 1 到 1000 命中的版本，只允许出现这些
+		wantVersions []string
+		wantErr      bool
+	}{
+		{
+			name:         "单个版本",
+			tpls:         []domain.PromptTemplate{testPrompt("v1", 100)},
+			wantVersions: []string{"v1"},
+		},
+		{
+			name:         "权重为 0 不参与分流",
+			tpls:         []domain.PromptTemplate{testPrompt("v1", 0), testPrompt("v2", 100)},
+			wantVersions: []string{"v2"},
+		},
+		{
+			name:         "负数权重不参与分流",
+			tpls:         []domain.PromptTemplate{testPrompt("v1", 100), testPrompt("v2", -50), testPrompt("v3", 100)},
+			wantVersions: []string{"v1", "v3"},
+		},
+		{
+			name:    "全部权重为 0",
+			tpls:    []domain.PromptTemplate{testPrompt("v1", 0), testPrompt("v2", -1)},
+			wantErr: true,
+		},
+		{
+			name:    "场景不存在",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewPromptRegistry()
+			require.NoError(t, r.Load(tc.tpls))
+			hits := make(map[string]int)
+			for uid := int64(1); uid <= 1000; uid++ {
+				cp, err := r.pick(testScene, uid)
+				if tc.wantErr {
+					require.Error(t, err)
+					return
+				}
+				require.NoError(t, err)
+				hits[cp.tpl.Version]++
+			}
+			for _, v := range tc.wantVersions {
+				assert.Positive(t, hits[v], v)
+				delete(hits, v)
+			}
+			assert.Empty(t, hits)
+		})
+	}
+}
+
+func TestPromptRegistry_PickStable(t *testing.T) {
+	r := NewPromptRegistry()
+	require.NoError(t, r.Load([]domain.PromptTemplate{testPrompt("v1", 50), testPrompt("v2", 50)}))
+	other := NewPromptRegistry()
+	require.NoError(t, other.Load([]domain.PromptTemplate{testPrompt("v1", 50), testPrompt("v2", 50)}))
+	for uid := int64(1); uid <= 100; uid++ {
+		first, err := r.pick(testScene, uid)
+		require.NoError(t, err)
+		// 同一个 scene:uid 多次调用、换一个实例都命中同一个版本
+		for i := 0; i < 3; i++ {
+			cp, err := r.pick(testScene, uid)
+			require.NoError(t, err)
+			assert.Equal(t, first.tpl.Version, cp.tpl.Version)
+		}
+		cp, err := other.pick(testScene, uid)
+		require.NoError(t, err)
+		assert.Equal(t, first.tpl.Version, cp.tpl.Version)
+	}
+}
+
+func TestPromptRegistry_PickDistribution(t *testing.T) {
+	testCases := []struct {
+		name    string
+		weights map[string]int
+	}{
+		{
+			name:    "七三分流",
+			weights: map[string]int{"v1": 70, "v2": 30},
+		},
+		{
+			name:    "三个版本",
+			weights: map[string]int{"v1": 50, "v2": 25, "v3": 25},
+		},
+		{
+			name:    "小流量实验",
+			weights: map[string]int{"v1": 95, "v2": 5},
+		},
+		{
+			name:    "负数权重不影响其它版本",
+			weights: map[string]int{"v1": 50, "v2": -20, "v3": 50},
+		},
+	}
+	const users = 20000
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewPromptRegistry()
+			total := 0
+			for v, w := range tc.weights {
+				require.NoError(t, r.Register(testPrompt(v, w)))
+				total += max(w, 0)
+			}
+			hits := make(map[string]int)
+			for uid := int64(1); uid <= users; uid++ {
+				cp, err := r.pick(testScene, uid)
+				require.NoError(t, err)
+				hits[cp.tpl.Version]++
+			}
+			for v, w := range tc.weights {
+				want := float64(max(w, 0)) / float64(total)
+				got := float64(hits[v]) / users
+				assert.InDelta(t, want, got, 0.02, v)
+			}
+		})
+	}
+}
+
+func TestPromptRegistry_Register(t *testing.T) {
+	r := NewPromptRegistry()
+	require.NoError(t, r.Register(testPrompt("v1", 100)))
+	// 同场景同版本覆盖
+	tpl := testPrompt("v1", 100)
+	tpl.Content = "new:{{.Title}}"
+	require.NoError(t, r.Register(tpl))
+	res, err := r.Render(testScene, 1, SummaryPromptVars{Title: "标题"})
+	require.NoError(t, err)
+	assert.Equal(t, "new:标题", res.Content)
+
+	// 模板不合法的时候不影响已经注册的版本
+	assert.Error(t, r.Register(domain.PromptTemplate{Scene: testScene, Version: "v1", Weight: 100, Content: "{{"}))
+	assert.Error(t, r.Register(domain.PromptTemplate{Scene: testScene, Weight: 100, Content: "x"}))
+	res, err = r.Render(testScene, 1, SummaryPromptVars{Title: "标题"})
+	require.NoError(t, err)
+	assert.Equal(t, "new:标题", res.Content)
+}
+
+func TestPromptRegistry_Load(t *testing.T) {
+	testCases := []struct {
+		name    string
+		reload  []domain.PromptTemplate
+		wantErr bool
+		// wantContent 重新加载之后 uid 1 渲染的结果，为空表示场景已经不存在
+		wantContent string
+	}{
+		{
+			name:        "全量替换",
+			reload:      []domain.PromptTemplate{testPrompt("v2", 100)},
+			wantContent: "v2:标题",
+		},
+		{
+			name:   "全量替换之后旧场景不存在",
+			reload: []domain.PromptTemplate{{Scene: domain.SceneArticleQA, Version: "v1", Weight: 100, Content: "qa"}},
+		},
+		{
+			name:        "模板语法错误，保留旧的模板",
+			reload:      []domain.PromptTemplate{testPrompt("v2", 100), {Scene: testScene, Version: "v3", Weight: 100, Content: "{{.Title"}},
+			wantErr:     true,
+			wantContent: "v1:标题",
+		},
+		{
+			name:        "缺少版本号，保留旧的模板",
+			reload:      []domain.PromptTemplate{{Scene: testScene, Weight: 100, Content: "x"}},
+			wantErr:     true,
+			wantContent: "v1:标题",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewPromptRegistry()
+			require.NoError(t, r.Load([]domain.PromptTemplate{testPrompt("v1", 100)}))
+			err := r.Load(tc.reload)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			res, err := r.Render(testScene, 1, SummaryPromptVars{Title: "标题"})
+			if tc.wantContent == "" {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantContent, res.Content)
+		})
+	}
+}
+
+func TestPromptRegistry_Render(t *testing.T) {
+	testCases := []struct {
+		name        string
+		vars        any
+		wantErr     bool
+		wantContent string
+	}{
+		{
+			name:        "渲染成功",
+			vars:        SummaryPromptVars{Title: "标题"},
+			wantContent: "v1:标题",
+		},
+		{
+			name:    "缺少变量",
+			vars:    map[string]any{},
+			wantErr: true,
+		},
+		{
+			name:    "变量类型不匹配",
+			vars:    QAPromptVars{Content: "正文"},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewPromptRegistry()
+			require.NoError(t, r.Register(testPrompt("v1", 100)))
+			res, err := r.Render(testScene, 1, tc.vars)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, domain.RenderedPrompt{Scene: testScene, Version: "v1", Content: tc.wantContent}, res)
+		})
+	}
+}
@@ -3,35 +3,58 @@ package ai
 import (
 	"archi/internal/domain"
 	"archi/internal/repository"
+	"archi/internal/service"
+	"archi/pkg/logger"
 	"context"
+	"errors"
 	"fmt"
-
-	"github.com/cloudwego/eino/schema"
+	"time"
 )
 
 // AiService 负责 AI 业务逻辑的调度与缓存编排
 type AiService interface {
-	GetArticleSummary(ctx context.Context, art domain.Article) (domain.ArticleSummary, error)
+	// GetArticleSummary uid 用于 Prompt 实验分流，未登录传 0
+	GetArticleSummary(ctx context.Context, uid int64, art domain.Article) (domain.ArticleSummary, error)
 	// AnswerQuestionStream 支持流式返回，提供“打字机”效果
-	AnswerQuestionStream(ctx context.Context, artId int64, content string, question string) (*schema.StreamReader[any], error)
+	AnswerQuestionStream(ctx context.Context, uid int64, artId int64, content string, question string) (StreamResponse, error)
 	// AuthorHelperStream 创作者助手 Agent 流式入口
-	AuthorHelperStream(ctx context.Context, input AuthorHelperInput) (*schema.StreamReader[any], error)
+	AuthorHelperStream(ctx context.Context, input AuthorHelperInput) (StreamResponse, error)
+	// ConfirmAction 用户确认或拒绝创作者助手提议的写操作，只有 approve 为 true 才会真正写入
+	ConfirmAction(ctx context.Context, uid int64, actionId string, approve bool) (domain.AiPendingAction, error)
+	// ModerateContent 使用大模型审核内容，返回审核结论与原因
+	ModerateContent(ctx context.Context, uid int64, biz string, bizId int64, content string) (domain.ModerationVerdict, []string, error)
 }
 
+var (
+	// ErrActionNotFound 待确认操作不存在、已过期或已被处理
+	ErrActionNotFound = errors.New("ai pending action not found")
+	// ErrActionConflict 提议之后文章又被修改过，确认会覆盖新的内容
+	ErrActionConflict = errors.New("article changed since ai action was proposed")
+)
+
 type aiService struct {
 	provider *AiProvider
+	prompts  *PromptRegistry
 	repo     repository.AiRepository
+	artSvc   service.ArticleService
+	tagSvc   service.TagService
+	l        logger.Logger
 }
 
-func NewAiService(p *AiProvider, r repository.AiRepository) AiService {
+func NewAiService(p *AiProvider, prompts *PromptRegistry, r repository.AiRepository,
+	artSvc service.ArticleService, tagSvc service.TagService, l logger.Logger) AiService {
 	return &aiService{
 		provider: p,
+		prompts:  prompts,
 		repo:     r,
+		artSvc:   artSvc,
+		tagSvc:   tagSvc,
+		l:        l,
 	}
 }
 
 // GetArticleSummary 获取文章课代表总结
-func (s *aiService) GetArticleSummary(ctx context.Context, art domain.Article) (domain.ArticleSummary, error) {
+func (s *aiService) GetArticleSummary(ctx context.Context, uid int64, art domain.Article) (domain.ArticleSummary, error) {
 	// 1. 优先查缓存 (Cache-Aside)
 	//summary, err := s.repo.GetArticleSummary(ctx, art.ID)
 	//if err == nil {
@@ -44,8 +67,19 @@ func (s *aiService) GetArticleSummary(ctx context.Context, art domain.Article) (
 		return domain.ArticleSummary{}, fmt.Errorf("ai scene %s is not registered", domain.SceneArticleSummary)
 	}
 
-	// 3. 执行编排逻辑
-	res, err := runnable.Invoke(ctx, art)
+	// 3. 按实验分流渲染 Prompt
+	prompt, err := s.prompts.Render(domain.SceneArticleSummary, uid, SummaryPromptVars{Title: art.Title})
+	if err != nil {
+		return domain.ArticleSummary{}, err
+	}
+
+	// 4. 执行编排逻辑
+	start := time.Now()
+	res, err := runnable.Invoke(ctx, ArticleSummaryInput{
+		Article:      art,
+		SystemPrompt: prompt.Content,
+	})
+	s.recordResponse(prompt, uid, art.ID, start, err == nil)
 	if err != nil {
 		return domain.ArticleSummary{}, fmt.Errorf("ai summary generation failed: %w", err)
 	}
@@ -55,8 +89,9 @@ func (s *aiService) GetArticleSummary(ctx context.Context, art domain.Article) (
 	if !ok {
 		return domain.ArticleSummary{}, fmt.Errorf("invalid output type from ai summary")
 	}
+	summaryRes.PromptVersion = prompt.Version
 
-	// 4. 异步回写缓存，不阻塞主流程
+	// 5. 异步回写缓存，不阻塞主流程
 	go func() {
 		// 使用 Background Context，避免请求结束后协程被取消
 		_ = s.repo.SetArticleSummary(context.Background(), art.ID, summaryRes)
@@ -66,33 +101,207 @@ func (s *aiService) GetArticleSummary(ctx context.Context, art domain.Article) (
 }
 
 // AnswerQuestionStream 实现针对单篇文章的“笔记问答”
-func (s *aiService) AnswerQuestionStream(ctx context.Context, artId int64, content string, question string) (*schema.StreamReader[any], error) {
+func (s *aiService) AnswerQuestionStream(ctx context.Context, uid int64, artId int64, content string, question string) (StreamResponse, error) {
 	// 1. 获取执行器
 	runnable := s.provider.Get(domain.SceneArticleQA)
 	if runnable == nil {
-		return nil, fmt.Errorf("ai scene %s is not registered", domain.SceneArticleQA)
+		return StreamResponse{}, fmt.Errorf("ai scene %s is not registered", domain.SceneArticleQA)
+	}
+
+	// 2. 渲染 Prompt，文章全文作为模板变量注入
+	prompt, err := s.prompts.Render(domain.SceneArticleQA, uid, QAPromptVars{Content: content})
+	if err != nil {
+		return StreamResponse{}, err
 	}
 
-	// 2. 构造输入 DTO
+	// 3. 构造输入 DTO
 	input := ArticleQAInput{
-		ArticleID: artId,
-		Content:   content,
-		Question:  question,
+		ArticleID:    artId,
+		Content:      content,
+		Question:     question,
+		SystemPrompt: prompt.Content,
 	}
 
-	// 3. 调用流式执行接口
-	return runnable.Stream(ctx, input)
+	// 4. 调用流式执行接口
+	start := time.Now()
+	reader, err := runnable.Stream(ctx, input)
+	s.recordResponse(prompt, uid, artId, start, err == nil)
+	if err != nil {
+		return StreamResponse{}, err
+	}
+	return StreamResponse{Reader: reader, PromptVersion: prompt.Version}, nil
 }
 
 // AuthorHelperStream 创作者助手 Agent 入口
-func (s *aiService) AuthorHelperStream(ctx context.Context, input AuthorHelperInput) (*schema.StreamReader[any], error) {
+func (s *aiService) AuthorHelperStream(ctx context.Context, input AuthorHelperInput) (StreamResponse, error) {
 	// 1. 获取 Agent 执行器
 	runnable := s.provider.Get(domain.SceneAuthorHelper)
 	if runnable == nil {
-		return nil, fmt.Errorf("ai scene %s is not registered", domain.SceneAuthorHelper)
+		return StreamResponse{}, fmt.Errorf("ai scene %s is not registered", domain.SceneAuthorHelper)
+	}
+
+	prompt, err := s.prompts.Render(domain.SceneAuthorHelper, input.AuthorID, AuthorHelperPromptVars{AuthorID: input.AuthorID})
+	if err != nil {
+		return StreamResponse{}, err
 	}
+	input.SystemPrompt = prompt.Content
 
 	// 2. 调用流式执行接口
 	// ADK Agent 的流会包含 Thought 和 ToolCall 消息，建议在 Web 层进行过滤或全量下发
-	return runnable.Stream(ctx, input)
+	start := time.Now()
+	reader, err := runnable.Stream(ctx, input)
+	s.recordResponse(prompt, input.AuthorID, input.ArticleID, start, err == nil)
+	if err != nil {
+		return StreamResponse{}, err
+	}
+	return StreamResponse{Reader: reader, PromptVersion: prompt.Version}, nil
+}
+
+func (s *aiService) ConfirmAction(ctx context.Context, uid int64, actionId string, approve bool) (domain.AiPendingAction, error) {
+	action, err := s.repo.GetPendingAction(ctx, actionId)
+	if err != nil {
+		return domain.AiPendingAction{}, ErrActionNotFound
+	}
+	// 不属于当前用户的操作，当作不存在处理
+	if action.Uid != uid {
+		return domain.AiPendingAction{}, ErrActionNotFound
+	}
+	// 先删除再执行，保证同一个操作只会被确认一次
+	ok, err := s.repo.ConsumePendingAction(ctx, actionId)
+	if err != nil {
+		return domain.AiPendingAction{}, err
+	}
+	if !ok {
+		return domain.AiPendingAction{}, ErrActionNotFound
+	}
+
+	audit := domain.AiToolAudit{
+		Uid:       uid,
+		ArticleID: action.ArticleID,
+		Args:      action.ID,
+		Success:   true,
+	}
+	if !approve {
+		audit.Tool = "reject_" + string(action.Kind)
+		s.recordToolAudit(audit)
+		return action, nil
+	}
+
+	audit.Tool = "confirm_" + string(action.Kind)
+	switch action.Kind {
+	case domain.AiActionAttachTags:
+		err = s.tagSvc.AttachTags(ctx, uid, "article", action.ArticleID, action.TagIDs)
+	case domain.AiActionSaveDraft:
+		if err = s.checkArticleUnchanged(ctx, action); err != nil {
+			break
+		}
+		_, err = s.artSvc.Save(ctx, domain.Article{
+			ID:      action.ArticleID,
+			Title:   action.Title,
+			Content: action.Content,
+			Author: domain.Author{
+				ID: uid,
+			},
+		})
+	default:
+		err = fmt.Errorf("unknown ai action kind: %s", action.Kind)
+	}
+	if err != nil {
+		audit.Success = false
+		audit.Result = err.Error()
+	}
+	s.recordToolAudit(audit)
+	return action, err
+}
+
+// checkArticleUnchanged 提议之后用户自己又保存过文章，按提议时的全文保存会覆盖这些修改
+func (s *aiService) checkArticleUnchanged(ctx context.Context, action domain.AiPendingAction) error {
+	art, err := s.artSvc.GetById(ctx, action.ArticleID)
+	if err != nil {
+		return err
+	}
+	if !art.Utime.Equal(action.ArticleUtime) {
+		return ErrActionConflict
+	}
+	return nil
+}
+
+// moderationBizNames 审核对象在 Prompt 中的展示名称
+var moderationBizNames = map[string]string{
+	"article": "文章",
+	"comment": "评论",
+}
+
+func (s *aiService) ModerateContent(ctx context.Context, uid int64, biz string, bizId int64, content string) (domain.ModerationVerdict, []string, error) {
+	runnable := s.provider.Get(domain.SceneContentModeration)
+	if runnable == nil {
+		return 0, nil, fmt.Errorf("ai scene %s is not registered", domain.SceneContentModeration)
+	}
+
+	bizName, ok := moderationBizNames[biz]
+	if !ok {
+		bizName = "内容"
+	}
+	prompt, err := s.prompts.Render(domain.SceneContentModeration, uid, ModerationPromptVars{Biz: bizName})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	start := time.Now()
+	res, err := runnable.Invoke(ctx, ContentModerationInput{
+		Biz:          biz,
+		Content:      content,
+		SystemPrompt: prompt.Content,
+	})
+	s.recordResponse(prompt, uid, bizId, start, err == nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("ai moderation failed: %w", err)
+	}
+	out, ok := res.(contentModerationOutput)
+	if !ok {
+		return 0, nil, fmt.Errorf("invalid output type from ai moderation")
+	}
+	switch out.Verdict {
+	case "block":
+		return domain.ModerationVerdictBlock, out.Reasons, nil
+	case "review":
+		return domain.ModerationVerdictReview, out.Reasons, nil
+	default:
+		return domain.ModerationVerdictPass, out.Reasons, nil
+	}
+}
+
+func (s *aiService) recordToolAudit(audit domain.AiToolAudit) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := s.repo.RecordToolAudit(ctx, audit); err != nil {
+			s.l.Error("记录 AI 操作审计失败",
+				logger.String("tool", audit.Tool),
+				logger.Int64("uid", audit.Uid),
+				logger.Error(err))
+		}
+	}()
+}
+
+// recordResponse 异步记录本次响应使用的 Prompt 版本，失败只记日志
+func (s *aiService) recordResponse(prompt domain.RenderedPrompt, uid, bizId int64, start time.Time, success bool) {
+	r := domain.AiResponse{
+		Scene:         prompt.Scene,
+		PromptVersion: prompt.Version,
+		Uid:           uid,
+		BizId:         bizId,
+		Duration:      time.Since(start),
+		Success:       success,
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := s.repo.RecordResponse(ctx, r); err != nil {
+			s.l.Error("记录 AI 响应失败",
+				logger.String("scene", string(r.Scene)),
+				logger.String("prompt_version", r.PromptVersion),
+				logger.Error(err))
+		}
+	}()
 }
@@ -0,0 +1,124 @@
+package ai
+
+import (
+	"archi/internal/domain"
+	"archi/internal/repository"
+	"archi/internal/service"
+	"archi/pkg/logger"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAiRepo 只保存一个待确认操作，审计记录直接丢弃
+type fakeAiRepo struct {
+	repository.AiRepository
+	action   domain.AiPendingAction
+	consumed bool
+}
+
+func (r *fakeAiRepo) GetPendingAction(ctx context.Context, id string) (domain.AiPendingAction, error) {
+	if r.consumed || id != r.action.ID {
+		return domain.AiPendingAction{}, errors.New("not found")
+	}
+	return r.action, nil
+}
+
+func (r *fakeAiRepo) ConsumePendingAction(ctx context.Context, id string) (bool, error) {
+	if r.consumed {
+		return false, nil
+	}
+	r.consumed = true
+	return true, nil
+}
+
+func (r *fakeAiRepo) RecordToolAudit(ctx context.Context, audit domain.AiToolAudit) error {
+	return nil
+}
+
+type fakeArticleService struct {
+	service.ArticleService
+	art   domain.Article
+	saved []domain.Article
+}
+
+func (s *fakeArticleService) GetById(ctx context.Context, id int64) (domain.Article, error) {
+	return s.art, nil
+}
+
+func (s *fakeArticleService) Save(ctx context.Context, art domain.Article) (int64, error) {
+	s.saved = append(s.saved, art)
+	return art.ID, nil
+}
+
+func TestAiService_ConfirmSaveDraft(t *testing.T) {
+	const uid = int64(1)
+	proposedAt := time.UnixMilli(1_700_000_000_000)
+	action := domain.AiPendingAction{
+		ID:           "action",
+		Kind:         domain.AiActionSaveDraft,
+		Uid:          uid,
+		ArticleID:    10,
+		Title:        "新标题",
+		Content:      "正文",
+		ArticleUtime: proposedAt,
+	}
+	testCases := []struct {
+		name string
+		uid  int64
+		// utime 确认时文章的更新时间
+		utime   time.Time
+		approve bool
+
+		wantErr   error
+		wantSaved []domain.Article
+	}{
+		{
+			name:    "文章没有修改过",
+			uid:     uid,
+			utime:   proposedAt,
+			approve: true,
+			wantSaved: []domain.Article{
+				{ID: 10, Title: "新标题", Content: "正文", Author: domain.Author{ID: uid}},
+			},
+		},
+		{
+			name:    "提议之后文章被修改过",
+			uid:     uid,
+			utime:   proposedAt.Add(time.Second),
+			approve: true,
+			wantErr: ErrActionConflict,
+		},
+		{
+			name:  "拒绝不检查文章",
+			uid:   uid,
+			utime: proposedAt.Add(time.Second),
+		},
+		{
+			name:    "不是自己的操作",
+			uid:     2,
+			utime:   proposedAt,
+			approve: true,
+			wantErr: ErrActionNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeAiRepo{action: action}
+			artSvc := &fakeArticleService{art: domain.Article{ID: 10, Utime: tc.utime}}
+			svc := NewAiService(nil, nil, repo, artSvc, nil, logger.NewNopLogger())
+			_, err := svc.ConfirmAction(context.Background(), tc.uid, action.ID, tc.approve)
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantSaved, artSvc.saved)
+			if tc.wantErr == ErrActionConflict {
+				// 过期的操作已经消费掉，不能再次确认
+				_, err = svc.ConfirmAction(context.Background(), tc.uid, action.ID, true)
+				require.ErrorIs(t, err, ErrActionNotFound)
+			}
+		})
+	}
+}
@@ -1,13 +1,18 @@
 package ai
 
 import (
+	"archi/internal/domain"
 	"archi/internal/repository"
+	"archi/pkg/logger"
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/cloudwego/eino/adk"
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/components/tool/utils"
+	"github.com/google/uuid"
 )
 
 // initAuthorTools 初始化创作者助手的工具集
@@ -125,5 +130,174 @@ func (f *AiFactory) initAuthorTools(repo repository.ArticleRepository) []tool.Ba
 				targetID, intr.ReadCnt, intr.LikeCnt, intr.CollectCnt), nil
 		})
 
-	return []tool.BaseTool{tool1, tool2, tool3, tool4}
+	// 工具 5: 获取作者已有的标签，用于推荐标签
+	tool5, _ := utils.InferTool("get_author_tags", "获取当前作者已创建的全部标签，返回标签ID和名称，推荐标签时只能从中选择",
+		func(ctx context.Context, input struct{}) (string, error) {
+			uid, ok := adk.GetSessionValue(ctx, "author_id")
+			if !ok {
+				return "", fmt.Errorf("author_id not found in session")
+			}
+			tags, err := f.tagSvc.GetTags(ctx, uid.(int64))
+			if err != nil {
+				return "", fmt.Errorf("failed to get author tags: %w", err)
+			}
+			if len(tags) == 0 {
+				return "该作者还没有创建任何标签", nil
+			}
+			var res string
+			for _, t := range tags {
+				res += fmt.Sprintf("- ID: %d, 名称: %s\n", t.Id, t.Name)
+			}
+			return "作者标签列表：\n" + res, nil
+		})
+
+	// 工具 6: 提议给文章绑定标签 (只生成待确认操作，不会直接写入)
+	tool6, _ := utils.InferTool("propose_attach_tags", "提议给文章绑定一组标签。该工具只会生成待用户确认的操作，不会直接生效",
+		func(ctx context.Context, input struct {
+			ArticleID int64   `json:"article_id" label:"文章ID" jsonschema_description:"需要绑定标签的文章ID，当前正在编辑的文章可传0"`
+			TagIDs    []int64 `json:"tag_ids" label:"标签ID列表" jsonschema_description:"需要绑定的标签ID，必须来自 get_author_tags 的结果"`
+		}) (string, error) {
+			art, uid, err := f.ownedArticle(ctx, input.ArticleID)
+			if err != nil {
+				return "", err
+			}
+			tags, err := f.tagSvc.GetTags(ctx, uid)
+			if err != nil {
+				return "", fmt.Errorf("failed to get author tags: %w", err)
+			}
+			owned := make(map[int64]string, len(tags))
+			for _, t := range tags {
+				owned[t.Id] = t.Name
+			}
+			names := make([]string, 0, len(input.TagIDs))
+			for _, id := range input.TagIDs {
+				name, ok := owned[id]
+				if !ok {
+					return "", fmt.Errorf("tag %d does not belong to current author", id)
+				}
+				names = append(names, name)
+			}
+			return f.propose(ctx, domain.AiPendingAction{
+				Kind:      domain.AiActionAttachTags,
+				Uid:       uid,
+				ArticleID: art.ID,
+				TagIDs:    input.TagIDs,
+			}, fmt.Sprintf("给文章《%s》绑定标签: %s", art.Title, strings.Join(names, "、")))
+		})
+
+	// 工具 7: 提议保存修改后的草稿 (标题或正文，只生成待确认操作)
+	tool7, _ := utils.InferTool("propose_save_draft", "提议把新的标题和/或正文保存为文章草稿。该工具只会生成待用户确认的操作，不会直接生效",
+		func(ctx context.Context, input struct {
+			ArticleID int64  `json:"article_id" label:"文章ID" jsonschema_description:"需要保存的文章ID，当前正在编辑的文章可传0"`
+			Title     string `json:"title" label:"标题" jsonschema_description:"新的标题，不修改标题时留空"`
+			Content   string `json:"content" label:"正文" jsonschema_description:"新的完整正文，不修改正文时留空"`
+		}) (string, error) {
+			if input.Title == "" && input.Content == "" {
+				return "", fmt.Errorf("title and content can not both be empty")
+			}
+			art, uid, err := f.ownedArticle(ctx, input.ArticleID)
+			if err != nil {
+				return "", err
+			}
+			// 未修改的字段保留原值，保证确认后的 Save 不会清空内容
+			action := domain.AiPendingAction{
+				Kind:         domain.AiActionSaveDraft,
+				Uid:          uid,
+				ArticleID:    art.ID,
+				Title:        art.Title,
+				Content:      art.Content,
+				ArticleUtime: art.Utime,
+			}
+			desc := fmt.Sprintf("保存文章《%s》的草稿", art.Title)
+			if input.Title != "" {
+				action.Title = input.Title
+				desc += fmt.Sprintf("，标题改为《%s》", input.Title)
+			}
+			if input.Content != "" {
+				action.Content = input.Content
+				desc += fmt.Sprintf("，正文更新为 %d 字", len([]rune(input.Content)))
+			}
+			return f.propose(ctx, action, desc)
+		})
+
+	tools := []tool.InvokableTool{tool1, tool2, tool3, tool4, tool5, tool6, tool7}
+	res := make([]tool.BaseTool, 0, len(tools))
+	for _, t := range tools {
+		res = append(res, &auditedTool{InvokableTool: t, repo: f.aiRepo, l: f.l})
+	}
+	return res
+}
+
+// ownedArticle 获取文章并校验当前会话的作者身份，articleID 为 0 时使用会话中的当前文章
+func (f *AiFactory) ownedArticle(ctx context.Context, articleID int64) (domain.Article, int64, error) {
+	if articleID <= 0 {
+		val, ok := adk.GetSessionValue(ctx, "article_id")
+		if !ok {
+			return domain.Article{}, 0, fmt.Errorf("article_id not provided and not found in session")
+		}
+		articleID = val.(int64)
+	}
+	uid, ok := adk.GetSessionValue(ctx, "author_id")
+	if !ok {
+		return domain.Article{}, 0, fmt.Errorf("author_id not found in session")
+	}
+	art, err := f.artRepo.GetById(ctx, articleID)
+	if err != nil {
+		return domain.Article{}, 0, fmt.Errorf("failed to get article %d: %w", articleID, err)
+	}
+	if art.Author.ID != uid.(int64) {
+		return domain.Article{}, 0, fmt.Errorf("permission denied: you are not the author of article %d", articleID)
+	}
+	return art, uid.(int64), nil
+}
+
+// propose 保存待确认操作，并提示模型把操作交给用户确认
+func (f *AiFactory) propose(ctx context.Context, action domain.AiPendingAction, desc string) (string, error) {
+	action.ID = uuid.New().String()
+	action.Ctime = time.Now()
+	if err := f.aiRepo.SavePendingAction(ctx, action); err != nil {
+		return "", fmt.Errorf("failed to save pending action: %w", err)
+	}
+	return fmt.Sprintf("已生成待确认操作 (action_id: %s): %s。\n"+
+		"该操作尚未执行，请向用户说明操作内容，并提示用户点击确认后才会生效。", action.ID, desc), nil
+}
+
+// auditedTool 为工具调用记录审计日志，审计失败不影响工具本身的结果
+type auditedTool struct {
+	tool.InvokableTool
+	repo repository.AiRepository
+	l    logger.Logger
+}
+
+func (t *auditedTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	res, err := t.InvokableTool.InvokableRun(ctx, argumentsInJSON, opts...)
+
+	audit := domain.AiToolAudit{
+		Args:    argumentsInJSON,
+		Result:  res,
+		Success: err == nil,
+	}
+	if info, er := t.Info(ctx); er == nil {
+		audit.Tool = info.Name
+	}
+	if err != nil {
+		audit.Result = err.Error()
+	}
+	if uid, ok := adk.GetSessionValue(ctx, "author_id"); ok {
+		audit.Uid, _ = uid.(int64)
+	}
+	if aid, ok := adk.GetSessionValue(ctx, "article_id"); ok {
+		audit.ArticleID, _ = aid.(int64)
+	}
+	go func() {
+		actx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if er := t.repo.RecordToolAudit(actx, audit); er != nil {
+			t.l.Error("记录 AI 工具审计失败",
+				logger.String("tool", audit.Tool),
+				logger.Int64("uid", audit.Uid),
+				logger.Error(er))
+		}
+	}()
+	return res, err
 }
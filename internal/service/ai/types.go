@@ -1,16 +1,55 @@
 package ai
 
+import (
+	"archi/internal/domain"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// ArticleSummaryInput 针对文章总结场景的输入 DTO
+type ArticleSummaryInput struct {
+	Article      domain.Article
+	SystemPrompt string // 已渲染好的 System Prompt
+}
+
 // ArticleQAInput 针对文章问答场景的输入 DTO
 type ArticleQAInput struct {
-	ArticleID int64  `json:"article_id"`
-	Content   string `json:"content"`  // 文章全文
-	Question  string `json:"question"` // 用户提问
+	ArticleID    int64  `json:"article_id"`
+	Content      string `json:"content"`  // 文章全文
+	Question     string `json:"question"` // 用户提问
+	SystemPrompt string `json:"-"`        // 已渲染好的 System Prompt
 }
 
 // AuthorHelperInput 针对创作者助手的输入 DTO
 type AuthorHelperInput struct {
-	ArticleID   int64  `json:"article_id"`
-	AuthorID    int64  `json:"author_id"`   // 用于工具校验
-	Content     string `json:"content"`     // 当前编辑器的实时内容 (可选)
-	Instruction string `json:"instruction"` // 用户指令 (如: "参考我之前的风格润色")
+	ArticleID    int64  `json:"article_id"`
+	AuthorID     int64  `json:"author_id"`   // 用于工具校验
+	Content      string `json:"content"`     // 当前编辑器的实时内容 (可选)
+	Instruction  string `json:"instruction"` // 用户指令 (如: "参考我之前的风格润色")
+	SystemPrompt string `json:"-"`           // 已渲染好的 System Prompt
+}
+
+// StreamResponse 流式响应，携带本次使用的 Prompt 版本
+type StreamResponse struct {
+	Reader        *schema.StreamReader[any]
+	PromptVersion string
+}
+
+// ContentModerationInput 针对内容审核场景的输入 DTO
+type ContentModerationInput struct {
+	Biz          string
+	Content      string
+	SystemPrompt string // 已渲染好的 System Prompt
+}
+
+// contentModerationOutput 内容审核场景期望模型输出的结构
+type contentModerationOutput struct {
+	Verdict string   `json:"verdict" jsonschema:"enum=pass,enum=review,enum=block,description=审核结论"`
+	Reasons []string `json:"reasons" jsonschema:"description=命中的违规原因，通过时为空"`
+}
+
+// articleSummaryOutput 文章总结场景期望模型输出的结构，同时用于生成 JSON Schema
+type articleSummaryOutput struct {
+	Content         string   `json:"content" jsonschema:"minLength=1,description=100 字以内的总结"`
+	GoldenSentences []string `json:"golden_sentences" jsonschema:"minItems=1,maxItems=3,description=文章金句"`
 }
@@ -26,16 +26,24 @@ type DefaultArticleService struct {
 
 	userRepo repository.UserRepository
 
+	modSvc ModerationService
+
+	mentionSvc MentionService
+
 	// V1 写法专用
 	//readerRepo repository.ArticleReaderRepository
 	//authorRepo repository.ArticleAuthorRepository
 	l logger.Logger
 }
 
-func NewDefaultArticleService(repo repository.ArticleRepository, producer article.Producer) ArticleService {
+func NewDefaultArticleService(repo repository.ArticleRepository, producer article.Producer, modSvc ModerationService,
+	mentionSvc MentionService, l logger.Logger) ArticleService {
 	return &DefaultArticleService{
-		repo:     repo,
-		producer: producer,
+		repo:       repo,
+		producer:   producer,
+		modSvc:     modSvc,
+		mentionSvc: mentionSvc,
+		l:          l,
 	}
 }
 
@@ -49,11 +57,61 @@ func (a *DefaultArticleService) Save(ctx context.Context, art domain.Article) (i
 }
 
 func (a *DefaultArticleService) Publish(ctx context.Context, art domain.Article) (int64, error) {
+	// 本地快速过滤，命中拦截规则直接拒绝，命中复审规则先进入待审核状态
+	verdict, reasons := a.modSvc.PreCheck(ctx, art.Title+"\n"+art.Content)
+	if verdict == domain.ModerationVerdictBlock {
+		return 0, ErrContentBlocked
+	}
 	art.Status = domain.ArticleStatusPublished
+	if verdict == domain.ModerationVerdictReview {
+		art.Status = domain.ArticleStatusPendingReview
+	}
+	if art.ID > 0 {
+		// 人工复审的结论优先，重新发表不能绕过待复审和驳回
+		status, err := a.modSvc.Status(ctx, "article", art.ID)
+		if err != nil {
+			return 0, err
+		}
+		switch status {
+		case domain.ModerationStatusPending:
+			art.Status = domain.ArticleStatusPendingReview
+		case domain.ModerationStatusRejected:
+			art.Status = domain.ArticleStatusRejected
+		}
+	}
+
+	// 解析失败不影响发表，只是不会 @ 到任何人
+	mentions, err := a.mentionSvc.Resolve(ctx, art.Content)
+	if err != nil {
+		a.l.Error("解析文章提及失败", logger.Int64("aid", art.ID), logger.Error(err))
+	}
 
 	id, err := a.repo.Sync(ctx, art)
+	if err != nil {
+		return id, err
+	}
 
-	if err == nil {
+	// 待复审的文章读者看不到，先不通知被 @ 的人，复审通过之后补发
+	err = a.mentionSvc.Save(ctx, "article", id, art.Author.ID, mentions,
+		art.Status == domain.ArticleStatusPublished)
+	if err != nil {
+		a.l.Error("保存文章提及失败", logger.Int64("aid", id), logger.Error(err))
+	}
+
+	err = a.modSvc.Submit(ctx, domain.Moderation{
+		Biz:     "article",
+		BizId:   id,
+		Uid:     art.Author.ID,
+		Content: art.Title + "\n" + art.Content,
+		Verdict: verdict,
+		Reasons: reasons,
+	})
+	if err != nil {
+		// 审核记录写入失败不影响发布，大模型复核也会兜底
+		a.l.Error("保存文章审核记录失败", logger.Int64("aid", id), logger.Error(err))
+	}
+
+	if art.Status == domain.ArticleStatusPublished {
 		go func() {
 			art.ID = id
 			bgCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
@@ -66,7 +124,7 @@ func (a *DefaultArticleService) Publish(ctx context.Context, art domain.Article)
 			}
 		}()
 	}
-	return id, err
+	return id, nil
 }
 func (a *DefaultArticleService) Withdraw(ctx context.Context, uid int64, id int64) error {
 	return a.repo.SyncStatus(ctx, uid, id, domain.ArticleStatusPrivate)
@@ -94,8 +152,16 @@ func (a *DefaultArticleService) GetPubById(ctx context.Context, id, uid int64) (
 			}
 		}
 	}()
-
-	return res, err
+	if err != nil {
+		return res, err
+	}
+	mentions, er := a.mentionSvc.FindByBizIds(ctx, "article", []int64{id})
+	if er != nil {
+		// 提及只影响展示
+		a.l.Error("查询文章提及失败", logger.Int64("aid", id), logger.Error(er))
+	}
+	res.Mentions = mentions[id]
+	return res, nil
 }
 func (a *DefaultArticleService) ListPub(ctx context.Context, start time.Time, offset, limit int) ([]domain.Article, error) {
 	return a.repo.ListPub(ctx, start, offset, limit)
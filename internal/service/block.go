@@ -0,0 +1,78 @@
+package service
+
+import (
+	"archi/internal/domain"
+	"archi/internal/repository"
+	"context"
+	"errors"
+)
+
+// ErrBlockSelf 不能拉黑或者静音自己
+var ErrBlockSelf = errors.New("不能拉黑或静音自己")
+
+type BlockService interface {
+	// Block 拉黑对方，同时解除双方之间的关注关系
+	Block(ctx context.Context, uid, target int64) error
+	Unblock(ctx context.Context, uid, target int64) error
+	// Mute 静音只是自己看不到对方的内容，不会通知对方，也不影响关注关系
+	Mute(ctx context.Context, uid, target int64) error
+	Unmute(ctx context.Context, uid, target int64) error
+	// List 分页查询拉黑或者静音的用户，cursor 为上一页最后一条关系的 ID，第一页传 0
+	List(ctx context.Context, uid int64, typ domain.BlockType, cursor, limit int64) ([]domain.BlockRelation, error)
+}
+
+type DefaultBlockService struct {
+	repo      repository.BlockRepository
+	followSvc FollowRelationService
+}
+
+func NewDefaultBlockService(repo repository.BlockRepository, followSvc FollowRelationService) BlockService {
+	return &DefaultBlockService{
+		repo:      repo,
+		followSvc: followSvc,
+	}
+}
+
+func (s *DefaultBlockService) Block(ctx context.Context, uid, target int64) error {
+	if uid == target {
+		return ErrBlockSelf
+	}
+	err := s.repo.Add(ctx, domain.BlockRelation{Uid: uid, Target: target, Type: domain.BlockTypeBlock})
+	if err != nil {
+		return err
+	}
+	states, err := s.followSvc.GetFollowStates(ctx, uid, []int64{target})
+	if err != nil {
+		return err
+	}
+	// 取消关注会异步清理双方 feed 收件箱里面对方的事件
+	state := states[target]
+	if state.Following {
+		if err = s.followSvc.CancelFollow(ctx, uid, target); err != nil {
+			return err
+		}
+	}
+	if state.FollowedBy {
+		return s.followSvc.CancelFollow(ctx, target, uid)
+	}
+	return nil
+}
+
+func (s *DefaultBlockService) Unblock(ctx context.Context, uid, target int64) error {
+	return s.repo.Remove(ctx, domain.BlockRelation{Uid: uid, Target: target, Type: domain.BlockTypeBlock})
+}
+
+func (s *DefaultBlockService) Mute(ctx context.Context, uid, target int64) error {
+	if uid == target {
+		return ErrBlockSelf
+	}
+	return s.repo.Add(ctx, domain.BlockRelation{Uid: uid, Target: target, Type: domain.BlockTypeMute})
+}
+
+func (s *DefaultBlockService) Unmute(ctx context.Context, uid, target int64) error {
+	return s.repo.Remove(ctx, domain.BlockRelation{Uid: uid, Target: target, Type: domain.BlockTypeMute})
+}
+
+func (s *DefaultBlockService) List(ctx context.Context, uid int64, typ domain.BlockType, cursor, limit int64) ([]domain.BlockRelation, error) {
+	return s.repo.List(ctx, uid, typ, cursor, limit)
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"archi/internal/repository"
+	"archi/pkg/captcha"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrCaptchaInvalid 图形验证码错误或者已经过期
+var ErrCaptchaInvalid = errors.New("图形验证码错误")
+
+// 需要图形验证码的场景，失败次数按场景分别统计
+const (
+	CaptchaSceneLogin    = "login"
+	CaptchaSceneSignup   = "signup"
+	CaptchaSceneLoginSMS = "login_sms"
+)
+
+// CaptchaConfig 自适应图形验证码的配置
+type CaptchaConfig struct {
+	// Threshold 任意一个主体在 FailureWindow 内失败这么多次之后，需要图形验证码
+	Threshold     int64
+	FailureWindow time.Duration
+	// TokenTTL 通过图形验证码之后签发的凭证多久之内有效
+	TokenTTL time.Duration
+}
+
+// CaptchaService 自适应的图形验证码，同一个账号或者 IP 连续失败之后才要求图形验证码
+type CaptchaService interface {
+	Generate(ctx context.Context) (captcha.Response, error)
+	// Verify 校验图形验证码，通过之后签发一次性的凭证
+	Verify(ctx context.Context, id, value string) (string, error)
+	// Pass 使用凭证，每个凭证只能用一次
+	Pass(ctx context.Context, token string) (bool, error)
+	// Required subjects 是账号、IP 等主体，任意一个失败次数过多就需要图形验证码
+	Required(ctx context.Context, scene string, subjects ...string) (bool, error)
+	RecordFailure(ctx context.Context, scene string, subjects ...string) error
+	Reset(ctx context.Context, scene string, subjects ...string) error
+}
+
+type DefaultCaptchaService struct {
+	repo       repository.CaptchaRepository
+	captchaSvc captcha.Service
+	cfg        CaptchaConfig
+}
+
+func NewDefaultCaptchaService(repo repository.CaptchaRepository, captchaSvc captcha.Service, cfg CaptchaConfig) CaptchaService {
+	return &DefaultCaptchaService{
+		repo:       repo,
+		captchaSvc: captchaSvc,
+		cfg:        cfg,
+	}
+}
+
+func (svc *DefaultCaptchaService) Generate(ctx context.Context) (captcha.Response, error) {
+	return svc.captchaSvc.Generate(ctx)
+}
+
+func (svc *DefaultCaptchaService) Verify(ctx context.Context, id, value string) (string, error) {
+	if !svc.captchaSvc.Verify(ctx, id, value) {
+		return "", ErrCaptchaInvalid
+	}
+	token := uuid.NewString()
+	if err := svc.repo.SetToken(ctx, token, svc.cfg.TokenTTL); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (svc *DefaultCaptchaService) Pass(ctx context.Context, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+	return svc.repo.ConsumeToken(ctx, token)
+}
+
+func (svc *DefaultCaptchaService) Required(ctx context.Context, scene string, subjects ...string) (bool, error) {
+	failures, err := svc.repo.Failures(ctx, scene, subjects)
+	if err != nil {
+		return false, err
+	}
+	for _, cnt := range failures {
+		if cnt >= svc.cfg.Threshold {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (svc *DefaultCaptchaService) RecordFailure(ctx context.Context, scene string, subjects ...string) error {
+	return svc.repo.IncrFailure(ctx, scene, subjects, svc.cfg.FailureWindow)
+}
+
+func (svc *DefaultCaptchaService) Reset(ctx context.Context, scene string, subjects ...string) error {
+	return svc.repo.ResetFailures(ctx, scene, subjects)
+}
+
+// CaptchaSubjectIP 和 CaptchaSubjectAccount 生成失败计数的主体
+func CaptchaSubjectIP(ip string) string {
+	return "ip:" + ip
+}
+
+func CaptchaSubjectAccount(account string) string {
+	return "account:" + account
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"archi/internal/repository"
+	"archi/internal/repository/cache"
+	"archi/pkg/captcha"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCaptcha 答案固定是 answer
+type fakeCaptcha struct{}
+
+func (fakeCaptcha) Generate(ctx context.Context) (captcha.Response, error) {
+	return captcha.Response{ID: "id"}, nil
+}
+
+func (fakeCaptcha) Verify(ctx context.Context, id string, value string) bool {
+	return value == "answer"
+}
+
+func newTestCaptchaService(t *testing.T) (CaptchaService, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	repo := repository.NewCachedCaptchaRepository(cache.NewRedisCaptchaCache(client))
+	return NewDefaultCaptchaService(repo, fakeCaptcha{}, CaptchaConfig{
+		Threshold:     3,
+		FailureWindow: time.Minute * 15,
+		TokenTTL:      time.Minute * 5,
+	}), mr
+}
+
+func TestDefaultCaptchaService_Required(t *testing.T) {
+	account := CaptchaSubjectAccount("a@qq.com")
+	ip := CaptchaSubjectIP("1.1.1.1")
+	testCases := []struct {
+		name string
+		// failures 预先记录的失败，每一项是一次失败涉及的主体
+		failures [][]string
+		// forward 记录完失败之后过了多久
+		forward  time.Duration
+		subjects []string
+		want     bool
+	}{
+		{
+			name:     "没有失败",
+			subjects: []string{account, ip},
+		},
+		{
+			name:     "账号失败次数没有达到阈值",
+			failures: [][]string{{account, ip}, {account, ip}},
+			subjects: []string{account, ip},
+		},
+		{
+			name:     "账号失败次数达到阈值",
+			failures: [][]string{{account, ip}, {account, ip}, {account, ip}},
+			subjects: []string{account, ip},
+			want:     true,
+		},
+		{
+			name: "换账号之后 IP 达到阈值",
+			failures: [][]string{
+				{CaptchaSubjectAccount("b@qq.com"), ip},
+				{CaptchaSubjectAccount("c@qq.com"), ip},
+				{CaptchaSubjectAccount("d@qq.com"), ip},
+			},
+			subjects: []string{account, ip},
+			want:     true,
+		},
+		{
+			name:     "别的 IP 失败不影响",
+			failures: [][]string{{ip}, {ip}, {ip}},
+			subjects: []string{account, CaptchaSubjectIP("2.2.2.2")},
+		},
+		{
+			name:     "窗口过期之后重新计数",
+			failures: [][]string{{account}, {account}, {account}},
+			forward:  time.Minute * 16,
+			subjects: []string{account},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc, mr := newTestCaptchaService(t)
+			ctx := context.Background()
+			for _, subjects := range tc.failures {
+				require.NoError(t, svc.RecordFailure(ctx, CaptchaSceneLogin, subjects...))
+			}
+			mr.FastForward(tc.forward)
+			required, err := svc.Required(ctx, CaptchaSceneLogin, tc.subjects...)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, required)
+			// 场景之间互不影响
+			required, err = svc.Required(ctx, CaptchaSceneSignup, tc.subjects...)
+			require.NoError(t, err)
+			assert.False(t, required)
+		})
+	}
+}
+
+func TestDefaultCaptchaService_Reset(t *testing.T) {
+	svc, _ := newTestCaptchaService(t)
+	ctx := context.Background()
+	account := CaptchaSubjectAccount("a@qq.com")
+	for i := 0; i < 3; i++ {
+		require.NoError(t, svc.RecordFailure(ctx, CaptchaSceneLogin, account))
+	}
+	require.NoError(t, svc.Reset(ctx, CaptchaSceneLogin, account))
+	required, err := svc.Required(ctx, CaptchaSceneLogin, account)
+	require.NoError(t, err)
+	assert.False(t, required)
+}
+
+func TestDefaultCaptchaService_Token(t *testing.T) {
+	svc, mr := newTestCaptchaService(t)
+	ctx := context.Background()
+
+	_, err := svc.Verify(ctx, "id", "wrong")
+	assert.ErrorIs(t, err, ErrCaptchaInvalid)
+
+	token, err := svc.Verify(ctx, "id", "answer")
+	require.NoError(t, err)
+	// 凭证只能用一次
+	ok, err := svc.Pass(ctx, token)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = svc.Pass(ctx, token)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// 过期之后不能用
+	token, err = svc.Verify(ctx, "id", "answer")
+	require.NoError(t, err)
+	mr.FastForward(time.Minute * 6)
+	ok, err = svc.Pass(ctx, token)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = svc.Pass(ctx, "")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"archi/internal/repository"
 	"archi/internal/service/sms"
+	"archi/internal/service/sms/template"
 	"context"
 	"errors"
 	"fmt"
@@ -19,27 +20,37 @@ type CodeService interface {
 	Verify(ctx context.Context, biz, phone, inputCode string) (bool, error)
 }
 
+// codeTemplate 验证码的逻辑模板，各个业务可以在配置里面单独指定模板
+const codeTemplate = "code"
+
 type DefaultCodeService struct {
-	repo   repository.CodeRepository
-	smsSvc sms.Service
+	repo      repository.CodeRepository
+	smsSvc    sms.Service
+	templates *template.Registry
 }
 
-func NewDefaultCodeService(repo repository.CodeRepository, smsSvc sms.Service) CodeService {
+func NewDefaultCodeService(repo repository.CodeRepository, smsSvc sms.Service, templates *template.Registry) CodeService {
 	return &DefaultCodeService{
-		repo:   repo,
-		smsSvc: smsSvc,
+		repo:      repo,
+		smsSvc:    smsSvc,
+		templates: templates,
 	}
 }
 
 func (svc *DefaultCodeService) Send(ctx context.Context, biz, phone string) error {
 	code := svc.generate()
-	err := svc.repo.Set(ctx, biz, phone, code)
+	args := []string{code}
+	// 先找到模板，模板配置有问题的时候不要占用发送次数
+	tplId, err := svc.templates.Resolve(codeTemplate, biz, args)
+	if err != nil {
+		return err
+	}
+	err = svc.repo.Set(ctx, biz, phone, code)
 	// 你在这儿，是不是要开始发送验证码了？
 	if err != nil {
 		return err
 	}
-	const codeTplId = "1877556"
-	return svc.smsSvc.Send(ctx, codeTplId, []string{code}, phone)
+	return svc.smsSvc.Send(ctx, tplId, args, phone)
 }
 
 func (svc *DefaultCodeService) Verify(ctx context.Context, biz, phone, inputCode string) (bool, error) {
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"archi/pkg/limiter"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrCodeCaptchaRequired 发送次数接近上限，需要先通过图形验证码
+	ErrCodeCaptchaRequired = errors.New("需要图形验证码")
+	// ErrCodePhoneDailyLimit 这个手机号今天的验证码发送次数已经用完
+	ErrCodePhoneDailyLimit = errors.New("手机号发送次数超过上限")
+	// ErrCodeIPLimit 同一个 IP 发送太频繁
+	ErrCodeIPLimit = errors.New("IP 发送太频繁")
+	// ErrCodeDeviceLimit 同一个设备发送太频繁
+	ErrCodeDeviceLimit = errors.New("设备发送太频繁")
+	// ErrCodeBudgetExhausted 全局的短信预算用完，暂停发送验证码
+	ErrCodeBudgetExhausted = errors.New("短信预算用完")
+)
+
+// CodeSendClient 发送验证码的客户端信息，Device 可以为空
+type CodeSendClient struct {
+	IP     string
+	Device string
+	// CaptchaPassed 这一次请求带了有效的图形验证码凭证
+	CaptchaPassed bool
+}
+
+// CodeGuardRule 一个维度的滑动窗口，Interval 内最多 Rate 次
+type CodeGuardRule struct {
+	Interval time.Duration
+	Rate     int
+}
+
+// CodeGuardRules 各个维度的阈值
+// 带 Challenge 的阈值更低，触发之后要求图形验证码，而不是直接拒绝
+type CodeGuardRules struct {
+	PhoneDaily     CodeGuardRule
+	PhoneChallenge CodeGuardRule
+	IP             CodeGuardRule
+	IPChallenge    CodeGuardRule
+	Device         CodeGuardRule
+	// Budget 全部手机号共享，触发之后所有验证码都暂停发送，相当于熔断
+	Budget CodeGuardRule
+}
+
+// CodeGuardService 验证码发送的防刷，在 CodeService.Send 之前调用
+type CodeGuardService interface {
+	// Check 检查这一次能不能发送，不能发送时返回具体的原因
+	Check(ctx context.Context, biz, phone string, client CodeSendClient) error
+}
+
+// DefaultCodeGuardService 所有维度在一次调用里面检查，全部通过才计数
+// 这样被 IP 拒绝的请求不会消耗手机号的次数，被手机号拒绝的请求也不会消耗全局预算
+type DefaultCodeGuardService struct {
+	limiter limiter.MultiLimiter
+	rules   CodeGuardRules
+}
+
+func NewDefaultCodeGuardService(l limiter.MultiLimiter, rules CodeGuardRules) CodeGuardService {
+	return &DefaultCodeGuardService{
+		limiter: l,
+		rules:   rules,
+	}
+}
+
+func (svc *DefaultCodeGuardService) Check(ctx context.Context, biz, phone string, client CodeSendClient) error {
+	type check struct {
+		rule CodeGuardRule
+		key  string
+		err  error
+	}
+	// 直接拒绝的排在前面，已经发不了的就不用再让用户去做图形验证码了
+	// key 都带 {code_guard} 这个 hash tag，Redis Cluster 下脚本可以同时操作它们
+	checks := []check{
+		{rule: svc.rules.IP, key: fmt.Sprintf("{code_guard}:ip:%s", client.IP), err: ErrCodeIPLimit},
+		{rule: svc.rules.PhoneDaily, key: fmt.Sprintf("{code_guard}:phone:%s:%s", biz, phone), err: ErrCodePhoneDailyLimit},
+		{rule: svc.rules.Budget, key: "{code_guard}:budget", err: ErrCodeBudgetExhausted},
+	}
+	// 没有上报设备的客户端只能靠 IP 限制
+	if client.Device != "" {
+		checks = append(checks, check{rule: svc.rules.Device, key: fmt.Sprintf("{code_guard}:device:%s", client.Device), err: ErrCodeDeviceLimit})
+	}
+	// 通过了图形验证码就不再检查挑战阈值
+	if !client.CaptchaPassed {
+		checks = append(checks,
+			check{rule: svc.rules.PhoneChallenge, key: fmt.Sprintf("{code_guard}:challenge:phone:%s:%s", biz, phone), err: ErrCodeCaptchaRequired},
+			check{rule: svc.rules.IPChallenge, key: fmt.Sprintf("{code_guard}:challenge:ip:%s", client.IP), err: ErrCodeCaptchaRequired})
+	}
+	rules := make([]limiter.Rule, 0, len(checks))
+	for _, c := range checks {
+		rules = append(rules, limiter.Rule{Key: c.key, Interval: c.rule.Interval, Rate: c.rule.Rate})
+	}
+	idx, err := svc.limiter.Limit(ctx, rules...)
+	if err != nil {
+		return err
+	}
+	if idx >= 0 {
+		return checks[idx].err
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"archi/pkg/limiter"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCodeGuardRules() CodeGuardRules {
+	return CodeGuardRules{
+		PhoneDaily:     CodeGuardRule{Interval: time.Hour * 24, Rate: 3},
+		PhoneChallenge: CodeGuardRule{Interval: time.Hour * 24, Rate: 2},
+		IP:             CodeGuardRule{Interval: time.Minute * 10, Rate: 3},
+		IPChallenge:    CodeGuardRule{Interval: time.Minute * 10, Rate: 2},
+		Device:         CodeGuardRule{Interval: time.Minute * 10, Rate: 2},
+		Budget:         CodeGuardRule{Interval: time.Hour, Rate: 100},
+	}
+}
+
+func TestDefaultCodeGuardService_Check(t *testing.T) {
+	const phone = "15212345678"
+	type attempt struct {
+		phone   string
+		client  CodeSendClient
+		wantErr error
+	}
+	ip1 := CodeSendClient{IP: "1.1.1.1", CaptchaPassed: true}
+	testCases := []struct {
+		name     string
+		rules    func(r *CodeGuardRules)
+		attempts []attempt
+	}{
+		{
+			name: "接近上限之后要求图形验证码",
+			attempts: []attempt{
+				{phone: phone, client: CodeSendClient{IP: "1.1.1.1"}},
+				{phone: phone, client: CodeSendClient{IP: "2.2.2.2"}},
+				{phone: phone, client: CodeSendClient{IP: "3.3.3.3"}, wantErr: ErrCodeCaptchaRequired},
+				{phone: phone, client: CodeSendClient{IP: "3.3.3.3", CaptchaPassed: true}},
+				// 手机号的次数已经用完，直接拒绝，不再要求图形验证码
+				{phone: phone, client: CodeSendClient{IP: "4.4.4.4"}, wantErr: ErrCodePhoneDailyLimit},
+			},
+		},
+		{
+			name: "被 IP 拒绝的请求不消耗手机号的次数",
+			attempts: []attempt{
+				{phone: "13000000001", client: ip1},
+				{phone: "13000000002", client: ip1},
+				{phone: "13000000003", client: ip1},
+				{phone: phone, client: ip1, wantErr: ErrCodeIPLimit},
+				{phone: phone, client: ip1, wantErr: ErrCodeIPLimit},
+				{phone: phone, client: ip1, wantErr: ErrCodeIPLimit},
+				// 换一个 IP，这个手机号还有完整的次数
+				{phone: phone, client: CodeSendClient{IP: "2.2.2.2", CaptchaPassed: true}},
+				{phone: phone, client: CodeSendClient{IP: "3.3.3.3", CaptchaPassed: true}},
+				{phone: phone, client: CodeSendClient{IP: "4.4.4.4", CaptchaPassed: true}},
+				{phone: phone, client: CodeSendClient{IP: "5.5.5.5", CaptchaPassed: true}, wantErr: ErrCodePhoneDailyLimit},
+			},
+		},
+		{
+			name: "被手机号拒绝的请求不消耗全局预算",
+			rules: func(r *CodeGuardRules) {
+				r.PhoneDaily.Rate = 1
+				r.Budget.Rate = 2
+			},
+			attempts: []attempt{
+				{phone: phone, client: CodeSendClient{IP: "1.1.1.1", CaptchaPassed: true}},
+				{phone: phone, client: CodeSendClient{IP: "2.2.2.2", CaptchaPassed: true}, wantErr: ErrCodePhoneDailyLimit},
+				{phone: phone, client: CodeSendClient{IP: "3.3.3.3", CaptchaPassed: true}, wantErr: ErrCodePhoneDailyLimit},
+				{phone: "13000000001", client: CodeSendClient{IP: "4.4.4.4", CaptchaPassed: true}},
+				{phone: "13000000002", client: CodeSendClient{IP: "5.5.5.5", CaptchaPassed: true}, wantErr: ErrCodeBudgetExhausted},
+			},
+		},
+		{
+			name: "设备限流，没有上报设备的不检查",
+			attempts: []attempt{
+				{phone: "13000000001", client: CodeSendClient{IP: "1.1.1.1", Device: "d1", CaptchaPassed: true}},
+				{phone: "13000000002", client: CodeSendClient{IP: "2.2.2.2", Device: "d1", CaptchaPassed: true}},
+				{phone: "13000000003", client: CodeSendClient{IP: "3.3.3.3", Device: "d1", CaptchaPassed: true}, wantErr: ErrCodeDeviceLimit},
+				{phone: "13000000003", client: CodeSendClient{IP: "3.3.3.3", CaptchaPassed: true}},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			rules := testCodeGuardRules()
+			if tc.rules != nil {
+				tc.rules(&rules)
+			}
+			svc := NewDefaultCodeGuardService(limiter.NewRedisMultiSlideWindowLimiter(client), rules)
+			for i, a := range tc.attempts {
+				err := svc.Check(context.Background(), "login", a.phone, a.client)
+				assert.ErrorIs(t, err, a.wantErr, "attempt %d", i)
+				if a.wantErr == nil {
+					assert.NoError(t, err, "attempt %d", i)
+				}
+			}
+		})
+	}
+}
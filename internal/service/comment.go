@@ -2,47 +2,460 @@ package service
 
 import (
 	"archi/internal/domain"
+	"archi/internal/event/feedevent"
 	"archi/internal/repository"
+	"archi/pkg/logger"
 	"context"
+	"errors"
+	"strconv"
+	"time"
 )
 
+// commentBiz 评论点赞复用 interactive，biz 固定为 comment
+const commentBiz = "comment"
+
+var (
+	ErrCommentNotFound = repository.ErrCommentNotFound
+	// ErrCommentPinForbidden 只有内容的作者才能置顶评论
+	ErrCommentPinForbidden = errors.New("没有置顶评论的权限")
+	// ErrCommentPinReply 回复不能被置顶
+	ErrCommentPinReply = errors.New("只能置顶一级评论")
+	// ErrCommentForbidden 修改或者删除别人的评论
+	ErrCommentForbidden = errors.New("没有操作这条评论的权限")
+	// ErrCommentEditExpired 超过了可以编辑的时间
+	ErrCommentEditExpired = errors.New("评论已经超过可编辑时间")
+	// ErrCommentUserBlocked 和内容作者或者被回复的人之间存在拉黑关系
+	ErrCommentUserBlocked = errors.New("存在拉黑关系，不能评论")
+)
+
+// CommentConfig 评论相关的配置
+type CommentConfig struct {
+	// EditWindow 发表之后多长时间内可以编辑
+	EditWindow time.Duration
+	// Admins 可以物理删除评论的管理员
+	Admins []int64
+}
+
 type CommentService interface {
-	// GetCommentList Comment的id为0 获取一级评论
-	// 按照 ID 倒序排序
-	GetCommentList(ctx context.Context, biz string, bizId, minID, limit int64) ([]domain.Comment, error)
-	// DeleteComment 删除评论，删除本评论何其子评论
-	DeleteComment(ctx context.Context, id int64) error
-	// CreateComment 创建评论
+	// GetCommentList 获取一级评论，uid 是当前用户，用于标记是否点赞过
+	// 第一页会把置顶评论放在最前面，置顶评论不占用 limit
+	GetCommentList(ctx context.Context, uid int64, biz string, bizId int64, sort domain.CommentSort,
+		cursor domain.CommentCursor, limit int64) ([]domain.Comment, error)
+	// Like 点赞或者取消点赞，重复操作是幂等的
+	Like(ctx context.Context, uid, cid int64, like bool) error
+	// Pin 内容作者置顶或者取消置顶一级评论，置顶会替换掉原有的置顶评论
+	Pin(ctx context.Context, uid, cid int64, pin bool) error
+	// DeleteComment 删除自己的评论，只保留墓碑，下面的回复不受影响
+	DeleteComment(ctx context.Context, uid, id int64) error
+	// EditComment 在可编辑时间内修改自己的评论，返回修改之后的评论
+	EditComment(ctx context.Context, uid, id int64, content string) (domain.Comment, error)
+	// GetEditHistory 评论的编辑历史，已经删除的评论不再展示，待复审的评论只有评论者自己能看到
+	GetEditHistory(ctx context.Context, uid, id int64) ([]domain.CommentEdit, error)
+	// HardDelete 管理员物理删除评论以及它下面的全部回复，会留下审计记录
+	HardDelete(ctx context.Context, operator, id int64, reason string) (int, error)
+	// CreateComment 创建评论，回复的根评论和评论对象以父评论为准
 	CreateComment(ctx context.Context, comment domain.Comment) (domain.Comment, error)
-	GetMoreReplies(ctx context.Context, rid int64, maxID int64, limit int64) ([]domain.Comment, error)
+	GetMoreReplies(ctx context.Context, uid, rid int64, maxID int64, limit int64) ([]domain.Comment, error)
 }
 
 type DefaultCommentService struct {
-	repo repository.CommentRepository
+	repo         repository.CommentRepository
+	artRepo      repository.ArticleRepository
+	intrSvc      InteractiveService
+	modSvc       ModerationService
+	mentionSvc   MentionService
+	blockRepo    repository.BlockRepository
+	feedProducer feedevent.Producer
+	editWindow   time.Duration
+	admins       map[int64]struct{}
+	l            logger.Logger
 }
 
-func NewDefaultCommentService(repo repository.CommentRepository) CommentService {
+func NewDefaultCommentService(repo repository.CommentRepository, artRepo repository.ArticleRepository,
+	intrSvc InteractiveService, modSvc ModerationService, mentionSvc MentionService,
+	blockRepo repository.BlockRepository, feedProducer feedevent.Producer, cfg CommentConfig, l logger.Logger) CommentService {
+	admins := make(map[int64]struct{}, len(cfg.Admins))
+	for _, uid := range cfg.Admins {
+		admins[uid] = struct{}{}
+	}
 	return &DefaultCommentService{
-		repo: repo,
+		repo:         repo,
+		artRepo:      artRepo,
+		intrSvc:      intrSvc,
+		modSvc:       modSvc,
+		mentionSvc:   mentionSvc,
+		blockRepo:    blockRepo,
+		feedProducer: feedProducer,
+		editWindow:   cfg.EditWindow,
+		admins:       admins,
+		l:            l,
 	}
 }
-func (c *DefaultCommentService) GetCommentList(ctx context.Context, biz string, bizId, minID, limit int64) ([]domain.Comment, error) {
-	list, err := c.repo.FindByBiz(ctx, biz, bizId, minID, limit)
+func (c *DefaultCommentService) GetCommentList(ctx context.Context, uid int64, biz string, bizId int64,
+	sort domain.CommentSort, cursor domain.CommentCursor, limit int64) ([]domain.Comment, error) {
+	list, err := c.repo.FindByBiz(ctx, biz, bizId, sort, cursor, limit)
 	if err != nil {
 		return nil, err
 	}
-	return list, err
+	c.fillLiked(ctx, uid, list)
+	c.fillMentions(ctx, list)
+	hidePending(uid, list)
+	return list, nil
+}
+
+// hidePending 待复审的评论只有评论者自己能看到内容
+func hidePending(uid int64, list []domain.Comment) {
+	for i := range list {
+		if list[i].PendingReview() && list[i].Commentator.ID != uid {
+			list[i].Content = domain.CommentPendingPlaceholder
+			list[i].Mentions = nil
+		}
+		hidePending(uid, list[i].Children)
+	}
+}
+
+// fillMentions 补全评论和带出来的回复中的 @，查询失败只影响展示
+func (c *DefaultCommentService) fillMentions(ctx context.Context, list []domain.Comment) {
+	ids := make([]int64, 0, len(list))
+	for _, cm := range list {
+		ids = append(ids, cm.Id)
+		for _, child := range cm.Children {
+			ids = append(ids, child.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	mentions, err := c.mentionSvc.FindByBizIds(ctx, commentBiz, ids)
+	if err != nil {
+		c.l.Error("查询评论提及失败", logger.Error(err))
+		return
+	}
+	for i := range list {
+		list[i].Mentions = mentions[list[i].Id]
+		for j := range list[i].Children {
+			list[i].Children[j].Mentions = mentions[list[i].Children[j].Id]
+		}
+	}
+}
+
+// resolveMentions 解析失败不影响发表，只是不会 @ 到任何人
+func (c *DefaultCommentService) resolveMentions(ctx context.Context, content string) []domain.Mention {
+	mentions, err := c.mentionSvc.Resolve(ctx, content)
+	if err != nil {
+		c.l.Error("解析评论提及失败", logger.Error(err))
+		return nil
+	}
+	return mentions
+}
+
+// saveMentions 待复审的评论其他人看不到，先不通知被 @ 的人
+func (c *DefaultCommentService) saveMentions(ctx context.Context, cid, uid int64, mentions []domain.Mention, notify bool) {
+	if err := c.mentionSvc.Save(ctx, commentBiz, cid, uid, mentions, notify); err != nil {
+		c.l.Error("保存评论提及失败", logger.Int64("cid", cid), logger.Error(err))
+	}
+}
+
+// fillLiked 标记当前用户点赞过的评论，包括带出来的回复，查询失败只影响展示
+func (c *DefaultCommentService) fillLiked(ctx context.Context, uid int64, list []domain.Comment) {
+	ids := make([]int64, 0, len(list))
+	for _, cm := range list {
+		ids = append(ids, cm.Id)
+		for _, child := range cm.Children {
+			ids = append(ids, child.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	liked, err := c.intrSvc.LikedIds(ctx, commentBiz, ids, uid)
+	if err != nil {
+		c.l.Error("查询评论点赞状态失败", logger.Int64("uid", uid), logger.Error(err))
+		return
+	}
+	for i := range list {
+		list[i].Liked = liked[list[i].Id]
+		for j := range list[i].Children {
+			list[i].Children[j].Liked = liked[list[i].Children[j].Id]
+		}
+	}
+}
+
+func (c *DefaultCommentService) Like(ctx context.Context, uid, cid int64, like bool) error {
+	cm, err := c.findById(ctx, cid)
+	if err != nil {
+		return err
+	}
+	if cm.Deleted() {
+		return ErrCommentNotFound
+	}
+	if like {
+		err = c.intrSvc.Like(ctx, commentBiz, cid, uid)
+	} else {
+		err = c.intrSvc.CancelLike(ctx, commentBiz, cid, uid)
+	}
+	if err != nil {
+		return err
+	}
+	// 点赞本身是幂等的，所以这里不做加减，而是直接以 interactive 中的计数为准
+	intrs, err := c.intrSvc.GetByIds(ctx, commentBiz, []int64{cid})
+	if err != nil {
+		return err
+	}
+	cm.LikeCnt = intrs[cid].LikeCnt
+	return c.repo.UpdateLikeCnt(ctx, cm)
+}
+
+func (c *DefaultCommentService) Pin(ctx context.Context, uid, cid int64, pin bool) error {
+	cm, err := c.findById(ctx, cid)
+	if err != nil {
+		return err
+	}
+	if cm.Deleted() {
+		return ErrCommentNotFound
+	}
+	if cm.ParentComment != nil {
+		return ErrCommentPinReply
+	}
+	owner, err := c.bizOwner(ctx, cm.Biz, cm.BizID)
+	if err != nil {
+		return err
+	}
+	if owner != uid {
+		return ErrCommentPinForbidden
+	}
+	if cm.Pinned == pin {
+		return nil
+	}
+	return c.repo.SetPinned(ctx, cm, pin)
+}
+
+// bizOwner 评论对象的作者，目前只有文章支持置顶
+func (c *DefaultCommentService) bizOwner(ctx context.Context, biz string, bizId int64) (int64, error) {
+	if biz != "article" {
+		return 0, ErrCommentPinForbidden
+	}
+	art, err := c.artRepo.GetPubById(ctx, bizId)
+	if err != nil {
+		return 0, err
+	}
+	return art.Author.ID, nil
+}
+
+func (c *DefaultCommentService) findById(ctx context.Context, cid int64) (domain.Comment, error) {
+	cs, err := c.repo.GetCommentByIds(ctx, []int64{cid})
+	if err != nil {
+		return domain.Comment{}, err
+	}
+	if len(cs) == 0 {
+		return domain.Comment{}, ErrCommentNotFound
+	}
+	return cs[0], nil
+}
+
+func (c *DefaultCommentService) DeleteComment(ctx context.Context, uid, id int64) error {
+	cm, err := c.findById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if cm.Commentator.ID != uid {
+		return ErrCommentForbidden
+	}
+	// 重复删除直接返回成功
+	if cm.Deleted() {
+		return nil
+	}
+	return c.repo.SoftDelete(ctx, id)
 }
 
-func (c *DefaultCommentService) DeleteComment(ctx context.Context, id int64) error {
-	return c.repo.DeleteComment(ctx, domain.Comment{
-		Id: id,
+func (c *DefaultCommentService) EditComment(ctx context.Context, uid, id int64, content string) (domain.Comment, error) {
+	cm, err := c.findById(ctx, id)
+	if err != nil {
+		return domain.Comment{}, err
+	}
+	if cm.Deleted() {
+		return domain.Comment{}, ErrCommentNotFound
+	}
+	if cm.Commentator.ID != uid {
+		return domain.Comment{}, ErrCommentForbidden
+	}
+	if time.Since(cm.CTime) > c.editWindow {
+		return domain.Comment{}, ErrCommentEditExpired
+	}
+	// 编辑之后的内容和发表时一样需要审核
+	verdict, reasons := c.modSvc.PreCheck(ctx, content)
+	if verdict == domain.ModerationVerdictBlock {
+		return domain.Comment{}, ErrContentBlocked
+	}
+	mentions := c.resolveMentions(ctx, content)
+	if verdict == domain.ModerationVerdictReview {
+		cm.Status = domain.CommentStatusPendingReview
+	}
+	err = c.repo.Edit(ctx, cm, content)
+	if errors.Is(err, ErrCommentNotFound) {
+		// 编辑的同时被删除了
+		return domain.Comment{}, ErrCommentNotFound
+	}
+	if err != nil {
+		return domain.Comment{}, err
+	}
+	err = c.modSvc.Submit(ctx, domain.Moderation{
+		Biz:     commentBiz,
+		BizId:   id,
+		Uid:     uid,
+		Content: content,
+		Verdict: verdict,
+		Reasons: reasons,
 	})
+	if err != nil {
+		c.l.Error("保存评论审核记录失败", logger.Int64("cid", id), logger.Error(err))
+	}
+	c.saveMentions(ctx, id, uid, mentions, !cm.PendingReview())
+	cm.Content = content
+	cm.Mentions = mentions
+	cm.EditCnt++
+	cm.UTime = time.Now()
+	return cm, nil
+}
+
+func (c *DefaultCommentService) GetEditHistory(ctx context.Context, uid, id int64) ([]domain.CommentEdit, error) {
+	cm, err := c.findById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cm.Deleted() || (cm.PendingReview() && cm.Commentator.ID != uid) {
+		return nil, ErrCommentNotFound
+	}
+	return c.repo.FindEdits(ctx, id)
+}
+
+func (c *DefaultCommentService) HardDelete(ctx context.Context, operator, id int64, reason string) (int, error) {
+	if _, ok := c.admins[operator]; !ok {
+		return 0, ErrCommentForbidden
+	}
+	cnt, err := c.repo.HardDelete(ctx, operator, id, reason)
+	if err != nil {
+		return 0, err
+	}
+	c.l.Info("管理员删除评论",
+		logger.Int64("operator", operator),
+		logger.Int64("cid", id),
+		logger.String("reason", reason),
+		logger.Int("cnt", cnt))
+	return cnt, nil
 }
 
 func (c *DefaultCommentService) CreateComment(ctx context.Context, comment domain.Comment) (domain.Comment, error) {
-	return c.repo.CreateComment(ctx, comment)
+	verdict, reasons := c.modSvc.PreCheck(ctx, comment.Content)
+	if verdict == domain.ModerationVerdictBlock {
+		return domain.Comment{}, ErrContentBlocked
+	}
+	var parent domain.Comment
+	if comment.ParentComment != nil && comment.ParentComment.Id > 0 {
+		var err error
+		parent, err = c.findById(ctx, comment.ParentComment.Id)
+		if err != nil {
+			return domain.Comment{}, err
+		}
+		if parent.Deleted() {
+			return domain.Comment{}, ErrCommentNotFound
+		}
+		// 回复的回复仍然挂在同一个根评论下面，回复数按根评论统计
+		root := parent.Id
+		if parent.RootComment != nil {
+			root = parent.RootComment.Id
+		}
+		comment.RootComment = &domain.Comment{Id: root}
+		comment.Biz, comment.BizID = parent.Biz, parent.BizID
+	} else {
+		comment.ParentComment, comment.RootComment = nil, nil
+	}
+	if err := c.checkBlocked(ctx, comment, parent); err != nil {
+		return domain.Comment{}, err
+	}
+	mentions := c.resolveMentions(ctx, comment.Content)
+	comment.Status = domain.CommentStatusNormal
+	if verdict == domain.ModerationVerdictReview {
+		comment.Status = domain.CommentStatusPendingReview
+	}
+	res, err := c.repo.CreateComment(ctx, comment)
+	if err != nil {
+		return res, err
+	}
+	c.saveMentions(ctx, res.Id, comment.Commentator.ID, mentions, !comment.PendingReview())
+	res.Mentions = mentions
+	err = c.modSvc.Submit(ctx, domain.Moderation{
+		Biz:     "comment",
+		BizId:   res.Id,
+		Uid:     comment.Commentator.ID,
+		Content: comment.Content,
+		Verdict: verdict,
+		Reasons: reasons,
+	})
+	if err != nil {
+		c.l.Error("保存评论审核记录失败", logger.Int64("cid", res.Id), logger.Error(err))
+	}
+	// 回复自己不需要通知，待复审的回复等复审通过之后由 ModerationService 补发
+	if comment.ParentComment != nil && parent.Commentator.ID != comment.Commentator.ID && !comment.PendingReview() {
+		go produceCommentReplyEvent(c.feedProducer, c.l, res.Id, comment, parent.Commentator.ID)
+	}
+	return res, nil
+}
+
+// checkBlocked 被内容作者或者被回复的人拉黑之后不能再评论，反过来也一样
+func (c *DefaultCommentService) checkBlocked(ctx context.Context, comment domain.Comment, parent domain.Comment) error {
+	uid := comment.Commentator.ID
+	others := make([]int64, 0, 2)
+	if parent.Id > 0 {
+		others = append(others, parent.Commentator.ID)
+	}
+	if comment.Biz == "article" {
+		art, err := c.artRepo.GetPubById(ctx, comment.BizID)
+		if err != nil {
+			return err
+		}
+		others = append(others, art.Author.ID)
+	}
+	for _, other := range others {
+		if other == uid {
+			continue
+		}
+		blocked, err := c.blockRepo.IsBlocked(ctx, uid, other)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return ErrCommentUserBlocked
+		}
+	}
+	return nil
+}
+
+// produceCommentReplyEvent 通知被回复的人，待复审的回复在复审通过之后由 ModerationService 补发
+func produceCommentReplyEvent(producer feedevent.Producer, l logger.Logger, cid int64, comment domain.Comment, replied int64) {
+	err := producer.ProduceFeedEvent(feedevent.Event{
+		Type: feedevent.TypeComment,
+		Ext: map[string]string{
+			"commentator": strconv.FormatInt(comment.Commentator.ID, 10),
+			"replied":     strconv.FormatInt(replied, 10),
+			"parent":      strconv.FormatInt(comment.ParentComment.Id, 10),
+			"cid":         strconv.FormatInt(cid, 10),
+			"biz":         comment.Biz,
+			"bizId":       strconv.FormatInt(comment.BizID, 10),
+		},
+	})
+	if err != nil {
+		l.Error("发送评论回复 feed 事件失败",
+			logger.Int64("cid", cid),
+			logger.Error(err))
+	}
 }
-func (c *DefaultCommentService) GetMoreReplies(ctx context.Context, rid int64, maxID int64, limit int64) ([]domain.Comment, error) {
-	return c.repo.GetMoreReplies(ctx, rid, maxID, limit)
+func (c *DefaultCommentService) GetMoreReplies(ctx context.Context, uid, rid int64, maxID int64, limit int64) ([]domain.Comment, error) {
+	list, err := c.repo.GetMoreReplies(ctx, rid, maxID, limit)
+	if err != nil {
+		return nil, err
+	}
+	c.fillMentions(ctx, list)
+	hidePending(uid, list)
+	return list, nil
 }
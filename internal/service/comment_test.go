@@ -0,0 +1,384 @@
+package service
+
+import (
+	"archi/internal/domain"
+	"archi/internal/repository"
+	"archi/pkg/logger"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCommentRepo 只实现了权限校验相关的方法，记录写操作
+type fakeCommentRepo struct {
+	repository.CommentRepository
+	comments map[int64]domain.Comment
+	deleted  []int64
+	edited   []string
+	pinned   []bool
+	// replyNotified 已经通知过被回复的人的回复
+	replyNotified map[int64]bool
+}
+
+func (r *fakeCommentRepo) GetCommentByIds(ctx context.Context, ids []int64) ([]domain.Comment, error) {
+	res := make([]domain.Comment, 0, len(ids))
+	for _, id := range ids {
+		if cm, ok := r.comments[id]; ok {
+			res = append(res, cm)
+		}
+	}
+	return res, nil
+}
+
+func (r *fakeCommentRepo) SoftDelete(ctx context.Context, id int64) error {
+	r.deleted = append(r.deleted, id)
+	return nil
+}
+
+func (r *fakeCommentRepo) Edit(ctx context.Context, comment domain.Comment, content string) error {
+	r.edited = append(r.edited, content)
+	return nil
+}
+
+func (r *fakeCommentRepo) SetPinned(ctx context.Context, comment domain.Comment, pinned bool) error {
+	r.pinned = append(r.pinned, pinned)
+	return nil
+}
+
+func (r *fakeCommentRepo) SetPendingReview(ctx context.Context, id int64, pending bool) error {
+	cm := r.comments[id]
+	cm.Status = domain.CommentStatusNormal
+	if pending {
+		cm.Status = domain.CommentStatusPendingReview
+	}
+	r.comments[id] = cm
+	return nil
+}
+
+func (r *fakeCommentRepo) MarkReplyNotified(ctx context.Context, id int64) (bool, error) {
+	if r.replyNotified[id] {
+		return false, nil
+	}
+	r.replyNotified[id] = true
+	return true, nil
+}
+
+func (r *fakeCommentRepo) FindEdits(ctx context.Context, cid int64) ([]domain.CommentEdit, error) {
+	return []domain.CommentEdit{{Cid: cid}}, nil
+}
+
+// fakeArticleRepo 只实现了 GetPubById，文章作者固定
+type fakeArticleRepo struct {
+	repository.ArticleRepository
+	author int64
+}
+
+func (r *fakeArticleRepo) GetPubById(ctx context.Context, id int64) (domain.Article, error) {
+	return domain.Article{ID: id, Author: domain.Author{ID: r.author}}, nil
+}
+
+// fakeModerationService 审核结论固定
+type fakeModerationService struct {
+	ModerationService
+	verdict domain.ModerationVerdict
+}
+
+func (s *fakeModerationService) PreCheck(ctx context.Context, content string) (domain.ModerationVerdict, []string) {
+	return s.verdict, nil
+}
+
+func (s *fakeModerationService) Submit(ctx context.Context, m domain.Moderation) error {
+	return nil
+}
+
+// fakeMentionService 内容里面没有 @
+type fakeMentionService struct {
+	MentionService
+}
+
+func (fakeMentionService) Resolve(ctx context.Context, content string) ([]domain.Mention, error) {
+	return nil, nil
+}
+
+func (fakeMentionService) Save(ctx context.Context, biz string, bizId, author int64, mentions []domain.Mention, notify bool) error {
+	return nil
+}
+
+const (
+	testCommentator  = int64(1)
+	testArticleOwner = int64(2)
+	testOther        = int64(3)
+)
+
+func newTestCommentService(repo *fakeCommentRepo, verdict domain.ModerationVerdict) CommentService {
+	return NewDefaultCommentService(repo, &fakeArticleRepo{author: testArticleOwner}, nil,
+		&fakeModerationService{verdict: verdict}, fakeMentionService{}, nil, nil,
+		CommentConfig{EditWindow: time.Minute * 10}, logger.NewNopLogger())
+}
+
+// testComment 文章下面 testCommentator 发表的一级评论
+func testComment(id int64, status domain.CommentStatus, ctime time.Time) domain.Comment {
+	return domain.Comment{
+		Id:          id,
+		Commentator: domain.CommentatorInfo{ID: testCommentator},
+		Biz:         "article",
+		BizID:       100,
+		Content:     "原来的内容",
+		Status:      status,
+		CTime:       ctime,
+	}
+}
+
+func TestDefaultCommentService_DeleteComment(t *testing.T) {
+	testCases := []struct {
+		name        string
+		comment     domain.Comment
+		uid         int64
+		wantErr     error
+		wantDeleted []int64
+	}{
+		{
+			name:        "删除自己的评论",
+			comment:     testComment(1, domain.CommentStatusNormal, time.Now()),
+			uid:         testCommentator,
+			wantDeleted: []int64{1},
+		},
+		{
+			name:    "删除别人的评论",
+			comment: testComment(1, domain.CommentStatusNormal, time.Now()),
+			uid:     testOther,
+			wantErr: ErrCommentForbidden,
+		},
+		{
+			name:    "内容作者也不能删除别人的评论",
+			comment: testComment(1, domain.CommentStatusNormal, time.Now()),
+			uid:     testArticleOwner,
+			wantErr: ErrCommentForbidden,
+		},
+		{
+			name:    "重复删除",
+			comment: testComment(1, domain.CommentStatusDeleted, time.Now()),
+			uid:     testCommentator,
+		},
+		{
+			name:    "评论不存在",
+			uid:     testCommentator,
+			wantErr: ErrCommentNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeCommentRepo{comments: map[int64]domain.Comment{}}
+			if tc.comment.Id > 0 {
+				repo.comments[tc.comment.Id] = tc.comment
+			}
+			svc := newTestCommentService(repo, domain.ModerationVerdictPass)
+			err := svc.DeleteComment(context.Background(), tc.uid, 1)
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantDeleted, repo.deleted)
+		})
+	}
+}
+
+func TestDefaultCommentService_EditComment(t *testing.T) {
+	testCases := []struct {
+		name       string
+		comment    domain.Comment
+		uid        int64
+		verdict    domain.ModerationVerdict
+		wantErr    error
+		wantStatus domain.CommentStatus
+		wantEdited []string
+	}{
+		{
+			name:       "编辑窗口内修改自己的评论",
+			comment:    testComment(1, domain.CommentStatusNormal, time.Now().Add(-time.Minute*9)),
+			uid:        testCommentator,
+			verdict:    domain.ModerationVerdictPass,
+			wantStatus: domain.CommentStatusNormal,
+			wantEdited: []string{"新的内容"},
+		},
+		{
+			name:    "超过编辑窗口",
+			comment: testComment(1, domain.CommentStatusNormal, time.Now().Add(-time.Minute*11)),
+			uid:     testCommentator,
+			verdict: domain.ModerationVerdictPass,
+			wantErr: ErrCommentEditExpired,
+		},
+		{
+			name:    "修改别人的评论",
+			comment: testComment(1, domain.CommentStatusNormal, time.Now()),
+			uid:     testOther,
+			verdict: domain.ModerationVerdictPass,
+			wantErr: ErrCommentForbidden,
+		},
+		{
+			name:    "已经删除的评论",
+			comment: testComment(1, domain.CommentStatusDeleted, time.Now()),
+			uid:     testCommentator,
+			verdict: domain.ModerationVerdictPass,
+			wantErr: ErrCommentNotFound,
+		},
+		{
+			name:    "新内容被拦截",
+			comment: testComment(1, domain.CommentStatusNormal, time.Now()),
+			uid:     testCommentator,
+			verdict: domain.ModerationVerdictBlock,
+			wantErr: ErrContentBlocked,
+		},
+		{
+			name:       "新内容需要复审",
+			comment:    testComment(1, domain.CommentStatusNormal, time.Now()),
+			uid:        testCommentator,
+			verdict:    domain.ModerationVerdictReview,
+			wantStatus: domain.CommentStatusPendingReview,
+			wantEdited: []string{"新的内容"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeCommentRepo{comments: map[int64]domain.Comment{1: tc.comment}}
+			svc := newTestCommentService(repo, tc.verdict)
+			cm, err := svc.EditComment(context.Background(), tc.uid, 1, "新的内容")
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantEdited, repo.edited)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, "新的内容", cm.Content)
+			assert.Equal(t, tc.wantStatus, cm.Status)
+			assert.Equal(t, int64(1), cm.EditCnt)
+		})
+	}
+}
+
+func TestDefaultCommentService_Pin(t *testing.T) {
+	reply := testComment(2, domain.CommentStatusNormal, time.Now())
+	reply.ParentComment = &domain.Comment{Id: 1}
+	pinned := testComment(1, domain.CommentStatusNormal, time.Now())
+	pinned.Pinned = true
+	otherBiz := testComment(1, domain.CommentStatusNormal, time.Now())
+	otherBiz.Biz = "video"
+
+	testCases := []struct {
+		name       string
+		comment    domain.Comment
+		uid        int64
+		pin        bool
+		wantErr    error
+		wantPinned []bool
+	}{
+		{
+			name:       "文章作者置顶",
+			comment:    testComment(1, domain.CommentStatusNormal, time.Now()),
+			uid:        testArticleOwner,
+			pin:        true,
+			wantPinned: []bool{true},
+		},
+		{
+			name:    "评论者不能置顶自己的评论",
+			comment: testComment(1, domain.CommentStatusNormal, time.Now()),
+			uid:     testCommentator,
+			pin:     true,
+			wantErr: ErrCommentPinForbidden,
+		},
+		{
+			name:    "回复不能置顶",
+			comment: reply,
+			uid:     testArticleOwner,
+			pin:     true,
+			wantErr: ErrCommentPinReply,
+		},
+		{
+			name:    "已经删除的评论",
+			comment: testComment(1, domain.CommentStatusDeleted, time.Now()),
+			uid:     testArticleOwner,
+			pin:     true,
+			wantErr: ErrCommentNotFound,
+		},
+		{
+			name:    "只有文章支持置顶",
+			comment: otherBiz,
+			uid:     testArticleOwner,
+			pin:     true,
+			wantErr: ErrCommentPinForbidden,
+		},
+		{
+			name:    "重复置顶",
+			comment: pinned,
+			uid:     testArticleOwner,
+			pin:     true,
+		},
+		{
+			name:       "取消置顶",
+			comment:    pinned,
+			uid:        testArticleOwner,
+			wantPinned: []bool{false},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeCommentRepo{comments: map[int64]domain.Comment{tc.comment.Id: tc.comment}}
+			svc := newTestCommentService(repo, domain.ModerationVerdictPass)
+			err := svc.Pin(context.Background(), tc.uid, tc.comment.Id, tc.pin)
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantPinned, repo.pinned)
+		})
+	}
+}
+
+func TestDefaultCommentService_GetEditHistory(t *testing.T) {
+	testCases := []struct {
+		name    string
+		status  domain.CommentStatus
+		uid     int64
+		wantErr error
+	}{
+		{
+			name:   "其他人查看",
+			status: domain.CommentStatusNormal,
+			uid:    testOther,
+		},
+		{
+			name:   "待复审的评论自己可以看",
+			status: domain.CommentStatusPendingReview,
+			uid:    testCommentator,
+		},
+		{
+			name:    "待复审的评论其他人看不到",
+			status:  domain.CommentStatusPendingReview,
+			uid:     testOther,
+			wantErr: ErrCommentNotFound,
+		},
+		{
+			name:    "已经删除的评论",
+			status:  domain.CommentStatusDeleted,
+			uid:     testCommentator,
+			wantErr: ErrCommentNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeCommentRepo{comments: map[int64]domain.Comment{1: testComment(1, tc.status, time.Now())}}
+			svc := newTestCommentService(repo, domain.ModerationVerdictPass)
+			edits, err := svc.GetEditHistory(context.Background(), tc.uid, 1)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err != nil {
+				return
+			}
+			require.Len(t, edits, 1)
+			assert.Equal(t, int64(1), edits[0].Cid)
+		})
+	}
+}
+
+func TestDefaultCommentService_HardDelete(t *testing.T) {
+	svc := NewDefaultCommentService(&fakeCommentRepo{}, nil, nil, nil, nil, nil, nil,
+		CommentConfig{Admins: []int64{99}}, logger.NewNopLogger())
+	// 评论者自己也不能物理删除
+	_, err := svc.HardDelete(context.Background(), testCommentator, 1, "spam")
+	assert.ErrorIs(t, err, ErrCommentForbidden)
+}
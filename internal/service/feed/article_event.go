@@ -2,41 +2,59 @@ package feed
 
 import (
 	"archi/internal/domain"
+	"archi/internal/event/fanout"
 	"archi/internal/repository"
 	"archi/internal/service"
 	"context"
 	"github.com/ecodeclub/ekit/slice"
 	"golang.org/x/sync/errgroup"
-	"sort"
 	"sync"
 	"time"
 )
 
 const (
 	ArticleEventName = "article_event"
-	threshold        = 4
-	//threshold        = 32
+
+	// followeeBatchSize 分页查询关注列表的每页大小
+	followeeBatchSize = 500
+	// pullBatchSize 查询发件箱时每条 SQL 最多带多少个 uid
+	pullBatchSize = 500
 )
 
 type ArticleEventHandler struct {
 	//followClient followv1.FollowServiceClient
 	repo      repository.FeedEventRepo
 	followSvc service.FollowRelationService
+	producer  fanout.Producer
+	cfg       FanoutConfig
 }
 
-func NewArticleEventHandler(repo repository.FeedEventRepo, followSvc service.FollowRelationService) Handler {
+func NewArticleEventHandler(repo repository.FeedEventRepo, followSvc service.FollowRelationService,
+	producer fanout.Producer, cfg FanoutConfig) Handler {
 	return &ArticleEventHandler{
 		repo:      repo,
 		followSvc: followSvc,
+		producer:  producer,
+		cfg:       cfg,
 	}
 }
 
+// CreateFeedEvent 推拉结合
+// 粉丝数不超过阈值时推给全部粉丝；超过阈值时写一份发件箱给所有粉丝拉取，
+// 同时只推给最近活跃的粉丝，读的时候推拉两份会去重
 func (a *ArticleEventHandler) CreateFeedEvent(ctx context.Context, ext domain.ExtendFields) error {
 	uid, err := ext.Get("uid").AsInt64()
 	if err != nil {
 		return err
 	}
-	// 根据粉丝数判断使用推模型还是拉模型
+	// 同一个事件推拉两份的 EventId 和 Ctime 必须一致，读的时候靠它们排序和去重
+	evt := domain.FeedEvent{
+		EventId: newEventId(),
+		Uid:     uid,
+		Type:    ArticleEventName,
+		Ctime:   time.Now(),
+		Ext:     ext,
+	}
 	resp, err := a.followSvc.GetFollowStatic(ctx, uid)
 	//	&followv1.GetFollowStaticRequest{
 	//	Followee: uid,
@@ -44,79 +62,192 @@ func (a *ArticleEventHandler) CreateFeedEvent(ctx context.Context, ext domain.Ex
 	if err != nil {
 		return err
 	}
-	// 粉丝数超出阈值使用拉模型
-	if resp.Followers > threshold {
-		return a.repo.CreatePullEvent(ctx, domain.FeedEvent{
-			Uid:   uid,
-			Type:  ArticleEventName,
-			Ctime: time.Now(),
-			Ext:   ext,
-		})
-	} else {
-		// 使用推模型
-		// 获取粉丝
-		fresp, err := a.followSvc.GetFollower(ctx, uid)
+	activeOnly := resp.Followers > a.cfg.PushAllThreshold
+	if activeOnly {
+		err = a.repo.CreatePullEvent(ctx, evt)
 		if err != nil {
 			return err
 		}
-		events := make([]domain.FeedEvent, 0, len(fresp))
-		for _, r := range fresp {
-			events = append(events, domain.FeedEvent{
-				Uid:   r.Follower,
-				Type:  ArticleEventName,
-				Ctime: time.Now(),
-				Ext:   ext,
-			})
+	}
+	return a.fanout(ctx, evt, activeOnly)
+}
+
+// fanout 分批扫描粉丝写收件箱
+// 需要推送的粉丝不超过一批时同步写入，否则按批投递到 Kafka 异步扩散
+func (a *ArticleEventHandler) fanout(ctx context.Context, evt domain.FeedEvent, activeOnly bool) error {
+	var (
+		pending []int64
+		async   bool
+	)
+	produce := func(followers []int64) error {
+		return a.producer.ProduceFanoutEvents([]fanout.Event{{
+			Type:      ArticleEventName,
+			Ext:       evt.Ext,
+			EventId:   evt.EventId,
+			Ctime:     evt.Ctime.UnixMilli(),
+			Followers: followers,
+		}})
+	}
+	for minId := int64(0); ; {
+		relations, err := a.followSvc.GetFollowerBatch(ctx, evt.Uid, minId, a.cfg.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(relations) == 0 {
+			break
+		}
+		minId = relations[len(relations)-1].ID
+		followers := slice.Map(relations, func(idx int, src domain.FollowRelation) int64 {
+			return src.Follower
+		})
+		if activeOnly {
+			followers, err = a.repo.FilterActive(ctx, followers, a.cfg.ActiveWindow)
+			if err != nil {
+				return err
+			}
+		}
+		pending = append(pending, followers...)
+		for int64(len(pending)) >= a.cfg.BatchSize {
+			async = true
+			if err = produce(pending[:a.cfg.BatchSize]); err != nil {
+				return err
+			}
+			pending = pending[a.cfg.BatchSize:]
 		}
-		return a.repo.CreatePushEvents(ctx, events)
+		if int64(len(relations)) < a.cfg.BatchSize {
+			break
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if async {
+		return produce(pending)
 	}
+	return a.repo.CreatePushEvents(ctx, buildPushEvents(evt, pending))
 }
-func (a *ArticleEventHandler) FindFeedEvents(ctx context.Context, uid, timestamp, limit int64) ([]domain.FeedEvent, error) {
-	// 获取推模型事件
+
+func (a *ArticleEventHandler) FindFeedEvents(ctx context.Context, uid int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error) {
+	followeeIds, err := a.getFollowees(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
 	var (
 		eg errgroup.Group
 		mu sync.Mutex
 	)
-	events := make([]domain.FeedEvent, 0, limit*2)
+	// 推模型一路，拉模型按关注列表分批，每批一路
+	lists := make([][]domain.FeedEvent, 0, len(followeeIds)/pullBatchSize+2)
 	// Push Event
 	eg.Go(func() error {
-		pushEvents, err := a.repo.FindPushEventsWithTyp(ctx, ArticleEventName, uid, timestamp, limit)
+		pushEvents, err := a.findPushEvents(ctx, uid, followeeIds, cursor, limit)
 		if err != nil {
 			return err
 		}
 		mu.Lock()
-		events = append(events, pushEvents...)
+		lists = append(lists, pushEvents)
 		mu.Unlock()
 		return nil
 	})
 
 	// Pull Event
-	eg.Go(func() error {
-		resp, rerr := a.followSvc.GetFollowee(ctx, uid, 0, 200)
-		if rerr != nil {
-			return rerr
-		}
-		followeeIds := slice.Map(resp, func(idx int, src domain.FollowRelation) int64 {
-			return src.Followee
+	for start := 0; start < len(followeeIds); start += pullBatchSize {
+		batch := followeeIds[start:min(start+pullBatchSize, len(followeeIds))]
+		eg.Go(func() error {
+			pullEvents, err := a.repo.FindPullEventsWithTyp(ctx, ArticleEventName, batch, cursor, limit)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			lists = append(lists, pullEvents)
+			mu.Unlock()
+			return nil
 		})
-		pullEvents, err := a.repo.FindPullEventsWithTyp(ctx, ArticleEventName, followeeIds, timestamp, limit)
+	}
+	if err = eg.Wait(); err != nil {
+		return nil, err
+	}
+	return mergeEvents(limit, lists...), nil
+}
+
+// findPushEvents 查询收件箱，过滤掉已经取消关注的人的事件
+// 取消关注之后收件箱是异步清理的，清理完成之前读的时候兜底过滤
+func (a *ArticleEventHandler) findPushEvents(ctx context.Context, uid int64, followeeIds []int64,
+	cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error) {
+	followees := make(map[int64]struct{}, len(followeeIds))
+	for _, id := range followeeIds {
+		followees[id] = struct{}{}
+	}
+	res := make([]domain.FeedEvent, 0, limit)
+	for {
+		events, err := a.repo.FindPushEventsWithTyp(ctx, ArticleEventName, uid, cursor, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, evt := range events {
+			author, er := evt.Ext.Get("uid").AsInt64()
+			if _, ok := followees[author]; er == nil && !ok {
+				continue
+			}
+			res = append(res, evt)
+			if int64(len(res)) == limit {
+				return res, nil
+			}
+		}
+		// 过滤掉了一部分，继续往后翻，否则返回不足一页会被当成没有更多了
+		if int64(len(events)) < limit {
+			return res, nil
+		}
+		cursor = events[len(events)-1].Cursor()
+	}
+}
+
+// CleanupUnfollow 删除 follower 收件箱中 followee 发表文章的事件
+func (a *ArticleEventHandler) CleanupUnfollow(ctx context.Context, follower, followee int64) error {
+	var (
+		ids    []int64
+		cursor domain.FeedCursor
+	)
+	for {
+		events, err := a.repo.FindPushEventsWithTyp(ctx, ArticleEventName, follower, cursor, followeeBatchSize)
 		if err != nil {
 			return err
 		}
-		mu.Lock()
-		events = append(events, pullEvents...)
-		mu.Unlock()
-		return nil
-	})
-	err := eg.Wait()
-	if err != nil {
-		return nil, err
+		for _, evt := range events {
+			if author, er := evt.Ext.Get("uid").AsInt64(); er == nil && author == followee {
+				ids = append(ids, evt.ID)
+			}
+		}
+		if len(events) < followeeBatchSize {
+			break
+		}
+		cursor = events[len(events)-1].Cursor()
 	}
-	// 获取拉模型事件
-	// 获取默认的关注列表
-	sort.Slice(events, func(i, j int) bool {
-		return events[i].Ctime.Unix() > events[j].Ctime.Unix()
-	})
+	return a.repo.DeletePushEvents(ctx, ArticleEventName, follower, ids)
+}
 
-	return events[:slice.Min[int]([]int{int(limit), len(events)})], nil
+// getFollowees 获取完整的关注列表，优先读缓存，未命中时分页查询全部关注的人
+func (a *ArticleEventHandler) getFollowees(ctx context.Context, uid int64) ([]int64, error) {
+	followeeIds, err := a.repo.GetFollowees(ctx, uid)
+	if err == nil {
+		return followeeIds, nil
+	}
+	followeeIds = make([]int64, 0, followeeBatchSize)
+	for cursor := int64(0); ; {
+		resp, err := a.followSvc.GetFollowee(ctx, uid, cursor, followeeBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		followeeIds = append(followeeIds, slice.Map(resp, func(idx int, src domain.FollowRelation) int64 {
+			return src.Followee
+		})...)
+		if len(resp) < followeeBatchSize {
+			break
+		}
+		cursor = resp[len(resp)-1].ID
+	}
+	// 回写缓存失败不影响本次查询
+	_ = a.repo.SetFollowees(ctx, uid, followeeIds)
+	return followeeIds, nil
 }
@@ -0,0 +1,46 @@
+package feed
+
+import (
+	"archi/internal/domain"
+	"archi/internal/event/feedevent"
+	"archi/internal/repository"
+	"context"
+	"time"
+)
+
+const (
+	CollectEventName = feedevent.TypeCollect
+)
+
+type CollectEventHandler struct {
+	repo repository.FeedEventRepo
+}
+
+func NewCollectEventHandler(repo repository.FeedEventRepo) Handler {
+	return &CollectEventHandler{
+		repo: repo,
+	}
+}
+
+// CreateFeedEvent 内容被收藏时通知作者
+// collector int64: 收藏的人
+// author int64: 被收藏内容的作者
+// biz string, bizId int64: 被收藏的东西
+// cid int64: 收藏夹
+func (c *CollectEventHandler) CreateFeedEvent(ctx context.Context, ext domain.ExtendFields) error {
+	author, err := ext.Get("author").AsInt64()
+	if err != nil {
+		return err
+	}
+	return c.repo.CreatePushEvents(ctx, []domain.FeedEvent{{
+		EventId: newEventId(),
+		Uid:     author,
+		Type:    CollectEventName,
+		Ctime:   time.Now(),
+		Ext:     ext,
+	}})
+}
+
+func (c *CollectEventHandler) FindFeedEvents(ctx context.Context, uid int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error) {
+	return c.repo.FindPushEventsWithTyp(ctx, CollectEventName, uid, cursor, limit)
+}
@@ -0,0 +1,47 @@
+package feed
+
+import (
+	"archi/internal/domain"
+	"archi/internal/event/feedevent"
+	"archi/internal/repository"
+	"context"
+	"time"
+)
+
+const (
+	CommentEventName = feedevent.TypeComment
+)
+
+type CommentEventHandler struct {
+	repo repository.FeedEventRepo
+}
+
+func NewCommentEventHandler(repo repository.FeedEventRepo) Handler {
+	return &CommentEventHandler{
+		repo: repo,
+	}
+}
+
+// CreateFeedEvent 评论被回复时通知父评论的作者
+// commentator int64: 回复的人
+// replied int64: 被回复的人
+// parent int64: 被回复的评论
+// cid int64: 回复本身
+// biz string, bizId int64: 评论所属的业务对象
+func (c *CommentEventHandler) CreateFeedEvent(ctx context.Context, ext domain.ExtendFields) error {
+	replied, err := ext.Get("replied").AsInt64()
+	if err != nil {
+		return err
+	}
+	return c.repo.CreatePushEvents(ctx, []domain.FeedEvent{{
+		EventId: newEventId(),
+		Uid:     replied,
+		Type:    CommentEventName,
+		Ctime:   time.Now(),
+		Ext:     ext,
+	}})
+}
+
+func (c *CommentEventHandler) FindFeedEvents(ctx context.Context, uid int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error) {
+	return c.repo.FindPushEventsWithTyp(ctx, CommentEventName, uid, cursor, limit)
+}
@@ -0,0 +1,81 @@
+package feed
+
+import (
+	"archi/internal/domain"
+	"context"
+	"golang.org/x/sync/errgroup"
+)
+
+// extRefs 事件 Ext 中引用了哪些用户和文章
+type extRefs struct {
+	// users 存放用户 id 的字段
+	users []string
+	// article 存放文章 id 的字段，为空时看 biz 是否为 article，是的话取 bizId
+	article string
+}
+
+var eventRefs = map[string]extRefs{
+	ArticleEventName: {users: []string{"uid"}, article: "aid"},
+	FollowEventName:  {users: []string{"follower", "followee"}},
+	LikeEventName:    {users: []string{"liker", "liked"}},
+	CommentEventName: {users: []string{"commentator", "replied"}},
+	RewardEventName:  {users: []string{"uid", "target"}},
+	CollectEventName: {users: []string{"collector", "author"}},
+}
+
+func (f *feedService) Enrich(ctx context.Context, events []domain.FeedEvent) (domain.FeedEnrichment, error) {
+	uidSet := make(map[int64]struct{})
+	aidSet := make(map[int64]struct{})
+	for _, evt := range events {
+		refs, ok := eventRefs[evt.Type]
+		if !ok {
+			continue
+		}
+		for _, key := range refs.users {
+			if uid, err := evt.Ext.Get(key).AsInt64(); err == nil {
+				uidSet[uid] = struct{}{}
+			}
+		}
+		key := refs.article
+		if key == "" {
+			if biz, _ := evt.Ext.Get("biz").String(); biz == "article" {
+				key = "bizId"
+			}
+		}
+		if key == "" {
+			continue
+		}
+		if aid, err := evt.Ext.Get(key).AsInt64(); err == nil {
+			aidSet[aid] = struct{}{}
+		}
+	}
+
+	res := domain.FeedEnrichment{
+		Users:    make(map[int64]domain.User, len(uidSet)),
+		Articles: make(map[int64]domain.Article, len(aidSet)),
+	}
+	var eg errgroup.Group
+	eg.Go(func() error {
+		users, err := f.userRepo.FindByIds(ctx, setToSlice(uidSet))
+		for _, u := range users {
+			res.Users[u.ID] = u
+		}
+		return err
+	})
+	eg.Go(func() error {
+		arts, err := f.artRepo.GetPubByIds(ctx, setToSlice(aidSet))
+		for _, art := range arts {
+			res.Articles[art.ID] = art
+		}
+		return err
+	})
+	return res, eg.Wait()
+}
+
+func setToSlice(set map[int64]struct{}) []int64 {
+	res := make([]int64, 0, len(set))
+	for id := range set {
+		res = append(res, id)
+	}
+	return res
+}
@@ -5,24 +5,113 @@ import (
 	"archi/internal/repository"
 	"context"
 	"fmt"
-	"github.com/ecodeclub/ekit/slice"
+	"github.com/google/uuid"
 	"golang.org/x/sync/errgroup"
-	"sort"
 	"sync"
+	"time"
 )
 
+// hiddenRefillRounds 过滤掉拉黑和静音用户的事件之后不足一页时，最多再往后取几轮
+const hiddenRefillRounds = 3
+
 type feedService struct {
 	repo       repository.FeedEventRepo
 	handlerMap map[string]Handler
+	userRepo   repository.UserRepository
+	artRepo    repository.ArticleRepository
+	blockRepo  repository.BlockRepository
+	cfg        FanoutConfig
+	retention  RetentionConfig
 	//followClient followv1.FollowServiceClient
 	//followSvc service.FollowRelationService
 }
 
-func NewFeedService(repo repository.FeedEventRepo, handlerMap map[string]Handler) Service {
+func NewFeedService(repo repository.FeedEventRepo, handlerMap map[string]Handler,
+	userRepo repository.UserRepository, artRepo repository.ArticleRepository,
+	blockRepo repository.BlockRepository, cfg FanoutConfig, retention RetentionConfig) Service {
 	return &feedService{
 		repo:       repo,
 		handlerMap: handlerMap,
+		userRepo:   userRepo,
+		artRepo:    artRepo,
+		blockRepo:  blockRepo,
+		cfg:        cfg,
+		retention:  retention,
+	}
+}
+
+func (f *feedService) MarkActive(ctx context.Context, uid int64) error {
+	return f.repo.MarkActive(ctx, uid, f.cfg.ActiveWindow)
+}
+
+func (f *feedService) FanoutPush(ctx context.Context, evt domain.FeedEvent, followers []int64) error {
+	if len(followers) == 0 {
+		return nil
+	}
+	return f.repo.CreatePushEvents(ctx, buildPushEvents(evt, followers))
+}
+
+func (f *feedService) Unfollow(ctx context.Context, follower, followee int64) error {
+	if err := f.repo.DelFollowees(ctx, follower); err != nil {
+		return err
+	}
+	for _, handler := range f.handlerMap {
+		h, ok := handler.(UnfollowHandler)
+		if !ok {
+			continue
+		}
+		if err := h.CleanupUnfollow(ctx, follower, followee); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *feedService) Archive(ctx context.Context) (int64, error) {
+	now := time.Now()
+	push, err := f.archive(ctx, now.Add(-f.retention.PushTTL), f.repo.ArchivePushEvents)
+	if err != nil {
+		return push, err
+	}
+	pull, err := f.archive(ctx, now.Add(-f.retention.PullTTL), f.repo.ArchivePullEvents)
+	return push + pull, err
+}
+
+// archive 分批归档直到没有过期的事件，或者 ctx 超时，剩下的留给下一次
+func (f *feedService) archive(ctx context.Context, before time.Time,
+	fn func(ctx context.Context, before time.Time, limit int) (int64, error)) (int64, error) {
+	var total int64
+	for ctx.Err() == nil {
+		cnt, err := fn(ctx, before, f.retention.BatchSize)
+		total += cnt
+		if err != nil {
+			return total, err
+		}
+		if cnt < int64(f.retention.BatchSize) {
+			break
+		}
+	}
+	return total, nil
+}
+
+// buildPushEvents 给每个粉丝生成一条推事件，同一个事件的 EventId 和 Ctime 保持一致
+func buildPushEvents(evt domain.FeedEvent, followers []int64) []domain.FeedEvent {
+	events := make([]domain.FeedEvent, 0, len(followers))
+	for _, follower := range followers {
+		events = append(events, domain.FeedEvent{
+			EventId: evt.EventId,
+			Uid:     follower,
+			Type:    evt.Type,
+			Ctime:   evt.Ctime,
+			Ext:     evt.Ext,
+		})
 	}
+	return events
+}
+
+// newEventId 生成事件的全局唯一 id
+func newEventId() string {
+	return uuid.NewString()
 }
 
 func (f *feedService) registerService(typ string, handler Handler) {
@@ -85,19 +174,59 @@ func (f *feedService) CreateFeedEvent(ctx context.Context, feed domain.FeedEvent
 //	return res[:slice.Min[int]([]int{int(limit), len(res)})], err
 //}
 
-func (f *feedService) GetFeedEventList(ctx context.Context, uid int64, timestamp, limit int64) ([]domain.FeedEvent, error) {
+func (f *feedService) GetFeedEventList(ctx context.Context, uid int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error) {
+	// 刷 feed 也算活跃，只在第一页记录
+	if cursor.IsZero() {
+		go func() {
+			actx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_ = f.MarkActive(actx, uid)
+		}()
+	}
+	hiddenUids, err := f.blockRepo.HiddenUids(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	hidden := make(map[int64]struct{}, len(hiddenUids))
+	for _, id := range hiddenUids {
+		hidden[id] = struct{}{}
+	}
+	res := make([]domain.FeedEvent, 0, limit)
+	for round := 0; round < hiddenRefillRounds; round++ {
+		events, err := f.findFeedEvents(ctx, uid, cursor, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, evt := range events {
+			if !hiddenEvent(evt, hidden) {
+				res = append(res, evt)
+			}
+		}
+		if len(hidden) == 0 || int64(len(events)) < limit || int64(len(res)) >= limit {
+			break
+		}
+		cursor = events[len(events)-1].Cursor()
+	}
+	// 多取出来的留给下一页，下一页的游标是这一页的最后一条
+	if int64(len(res)) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func (f *feedService) findFeedEvents(ctx context.Context, uid int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error) {
 	var eg errgroup.Group
-	res := make([]domain.FeedEvent, 0, limit*int64(len(f.handlerMap)))
-	var mu sync.RWMutex
+	lists := make([][]domain.FeedEvent, 0, len(f.handlerMap))
+	var mu sync.Mutex
 	for _, handler := range f.handlerMap {
 		h := handler
 		eg.Go(func() error {
-			events, err := h.FindFeedEvents(ctx, uid, timestamp, limit)
+			events, err := h.FindFeedEvents(ctx, uid, cursor, limit)
 			if err != nil {
 				return err
 			}
 			mu.Lock()
-			res = append(res, events...)
+			lists = append(lists, events)
 			mu.Unlock()
 			return nil
 		})
@@ -105,9 +234,23 @@ func (f *feedService) GetFeedEventList(ctx context.Context, uid int64, timestamp
 	if err := eg.Wait(); err != nil {
 		return nil, err
 	}
-	// 聚合排序，难免的
-	sort.Slice(res, func(i, j int) bool {
-		return res[i].Ctime.Unix() > res[j].Ctime.Unix()
-	})
-	return res[:slice.Min[int]([]int{int(limit), len(res)})], nil
+	// 每个 Handler 返回的都是有序的，多路归并即可
+	return mergeEvents(limit, lists...), nil
+}
+
+// hiddenEvent 事件引用到的任意一个用户不可见，整个事件就不展示
+func hiddenEvent(evt domain.FeedEvent, hidden map[int64]struct{}) bool {
+	if len(hidden) == 0 {
+		return false
+	}
+	for _, key := range eventRefs[evt.Type].users {
+		uid, err := evt.Ext.Get(key).AsInt64()
+		if err != nil {
+			continue
+		}
+		if _, ok := hidden[uid]; ok {
+			return true
+		}
+	}
+	return false
 }
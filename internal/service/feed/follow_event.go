@@ -30,14 +30,19 @@ func (f *FollowEventHandler) CreateFeedEvent(ctx context.Context, ext domain.Ext
 	if err != nil {
 		return err
 	}
+	// 关注列表变了，拉模型需要重新加载
+	if follower, er := ext.Get("follower").AsInt64(); er == nil {
+		_ = f.repo.DelFollowees(ctx, follower)
+	}
 	return f.repo.CreatePushEvents(ctx, []domain.FeedEvent{{
-		Uid:   followee,
-		Type:  FollowEventName,
-		Ctime: time.Now(),
-		Ext:   ext,
+		EventId: newEventId(),
+		Uid:     followee,
+		Type:    FollowEventName,
+		Ctime:   time.Now(),
+		Ext:     ext,
 	}})
 }
 
-func (f *FollowEventHandler) FindFeedEvents(ctx context.Context, uid, timestamp, limit int64) ([]domain.FeedEvent, error) {
-	return f.repo.FindPushEventsWithTyp(ctx, FollowEventName, uid, timestamp, limit)
+func (f *FollowEventHandler) FindFeedEvents(ctx context.Context, uid int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error) {
+	return f.repo.FindPushEventsWithTyp(ctx, FollowEventName, uid, cursor, limit)
 }
@@ -2,13 +2,14 @@ package feed
 
 import (
 	"archi/internal/domain"
+	"archi/internal/event/feedevent"
 	"archi/internal/repository"
 	"context"
 	"time"
 )
 
 const (
-	LikeEventName = "like_event"
+	LikeEventName = feedevent.TypeLike
 )
 
 type LikeEventHandler struct {
@@ -36,13 +37,14 @@ func (l *LikeEventHandler) CreateFeedEvent(ctx context.Context, ext domain.Exten
 	// 如果你希望冗余存储数据，但是业务方又不愿意存，
 	// 那么你在这里可以考虑回查业务获得一些数据
 	return l.repo.CreatePushEvents(ctx, []domain.FeedEvent{{
-		Uid:   liked,
-		Type:  LikeEventName,
-		Ctime: time.Now(),
-		Ext:   ext,
+		EventId: newEventId(),
+		Uid:     liked,
+		Type:    LikeEventName,
+		Ctime:   time.Now(),
+		Ext:     ext,
 	}})
 }
 
-func (l *LikeEventHandler) FindFeedEvents(ctx context.Context, uid, timestamp, limit int64) ([]domain.FeedEvent, error) {
-	return l.repo.FindPushEventsWithTyp(ctx, LikeEventName, uid, timestamp, limit)
+func (l *LikeEventHandler) FindFeedEvents(ctx context.Context, uid int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error) {
+	return l.repo.FindPushEventsWithTyp(ctx, LikeEventName, uid, cursor, limit)
 }
@@ -0,0 +1,66 @@
+package feed
+
+import (
+	"archi/internal/domain"
+	"container/heap"
+	"encoding/json"
+)
+
+// mergeEvents 多路归并，每一路都需要已经按 (Ctime, EventId) 倒序排好
+// 同一个事件可能同时出现在推模型和拉模型里面，按 EventId 去重
+func mergeEvents(limit int64, lists ...[]domain.FeedEvent) []domain.FeedEvent {
+	h := make(eventHeap, 0, len(lists))
+	for _, l := range lists {
+		if len(l) > 0 {
+			h = append(h, l)
+		}
+	}
+	heap.Init(&h)
+
+	res := make([]domain.FeedEvent, 0, limit)
+	seen := make(map[string]struct{}, limit)
+	for h.Len() > 0 && int64(len(res)) < limit {
+		evt := h[0][0]
+		if len(h[0]) == 1 {
+			heap.Pop(&h)
+		} else {
+			h[0] = h[0][1:]
+			heap.Fix(&h, 0)
+		}
+		key := dedupKey(evt)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		res = append(res, evt)
+	}
+	return res
+}
+
+func dedupKey(evt domain.FeedEvent) string {
+	if evt.EventId != "" && !evt.Legacy() {
+		return evt.EventId
+	}
+	// 历史数据推拉两份的 EventId 不一样，按类型和内容去重，map 序列化的时候 key 是有序的，内容相同结果就相同
+	ext, _ := json.Marshal(evt.Ext)
+	return evt.Type + ":" + string(ext)
+}
+
+// eventHeap 每个元素是一路事件，堆顶是当前最新的那一路
+type eventHeap [][]domain.FeedEvent
+
+func (h eventHeap) Len() int           { return len(h) }
+func (h eventHeap) Less(i, j int) bool { return h[i][0].Before(h[j][0]) }
+func (h eventHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *eventHeap) Push(x any) {
+	*h = append(*h, x.([]domain.FeedEvent))
+}
+
+func (h *eventHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
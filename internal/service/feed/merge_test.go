@@ -0,0 +1,141 @@
+package feed
+
+import (
+	"archi/internal/domain"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var baseTime = time.UnixMilli(1_700_000_000_000)
+
+// evt 构造一个事件，ms 是相对 baseTime 的毫秒偏移
+func evt(eventId string, ms int64, uid int64) domain.FeedEvent {
+	return domain.FeedEvent{
+		EventId: eventId,
+		Uid:     uid,
+		Type:    ArticleEventName,
+		Ctime:   baseTime.Add(time.Duration(ms) * time.Millisecond),
+		Ext:     domain.ExtendFields{"uid": "1", "aid": eventId},
+	}
+}
+
+func eventIds(events []domain.FeedEvent) []string {
+	res := make([]string, 0, len(events))
+	for _, e := range events {
+		res = append(res, e.EventId)
+	}
+	return res
+}
+
+func TestMergeEvents(t *testing.T) {
+	testCases := []struct {
+		name  string
+		limit int64
+		lists [][]domain.FeedEvent
+		want  []string
+	}{
+		{
+			name:  "多路按时间倒序归并",
+			limit: 10,
+			lists: [][]domain.FeedEvent{
+				{evt("e", 5, 1), evt("c", 3, 1), evt("a", 1, 1)},
+				{evt("d", 4, 2), evt("b", 2, 2)},
+			},
+			want: []string{"e", "d", "c", "b", "a"},
+		},
+		{
+			name:  "同一毫秒按 EventId 倒序",
+			limit: 10,
+			lists: [][]domain.FeedEvent{
+				{evt("b", 1, 1), evt("a", 1, 1)},
+				{evt("c", 1, 2)},
+			},
+			want: []string{"c", "b", "a"},
+		},
+		{
+			name:  "推拉两份按 EventId 去重",
+			limit: 10,
+			lists: [][]domain.FeedEvent{
+				// 推模型，Uid 是粉丝，行 id 和拉模型的不一样
+				{evt("c", 3, 100), evt("a", 1, 100)},
+				// 拉模型，Uid 是作者
+				{evt("c", 3, 1), evt("b", 2, 1), evt("a", 1, 1)},
+			},
+			want: []string{"c", "b", "a"},
+		},
+		{
+			name:  "去重之后再截断",
+			limit: 2,
+			lists: [][]domain.FeedEvent{
+				{evt("c", 3, 100), evt("b", 2, 100)},
+				{evt("c", 3, 1), evt("b", 2, 1), evt("a", 1, 1)},
+			},
+			want: []string{"c", "b"},
+		},
+		{
+			name:  "没有 EventId 的历史数据按内容去重",
+			limit: 10,
+			lists: [][]domain.FeedEvent{
+				{{Type: ArticleEventName, Ctime: baseTime, Ext: domain.ExtendFields{"aid": "1"}}},
+				{{Type: ArticleEventName, Ctime: baseTime, Ext: domain.ExtendFields{"aid": "1"}}},
+			},
+			want: []string{""},
+		},
+		{
+			name:  "回填了 EventId 的历史数据推拉两份按内容去重",
+			limit: 10,
+			lists: [][]domain.FeedEvent{
+				{{EventId: "legacy-push-7", Type: ArticleEventName, Ctime: baseTime, Ext: domain.ExtendFields{"aid": "1"}}},
+				{
+					{EventId: "legacy-pull-7", Type: ArticleEventName, Ctime: baseTime, Ext: domain.ExtendFields{"aid": "2"}},
+					{EventId: "legacy-pull-3", Type: ArticleEventName, Ctime: baseTime, Ext: domain.ExtendFields{"aid": "1"}},
+				},
+			},
+			// 行 id 相同的推拉两条是不同的事件，不能去重
+			want: []string{"legacy-push-7", "legacy-pull-7"},
+		},
+		{
+			name:  "空列表",
+			limit: 10,
+			lists: [][]domain.FeedEvent{nil, {}},
+			want:  []string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, eventIds(mergeEvents(tc.limit, tc.lists...)))
+		})
+	}
+}
+
+// TestMergeEvents_Paging 推拉两份翻页，同一毫秒的事件跨页也不会跳过或者重复
+func TestMergeEvents_Paging(t *testing.T) {
+	push := []domain.FeedEvent{evt("f", 2, 100), evt("d", 2, 100), evt("b", 1, 100), evt("a", 1, 100)}
+	pull := []domain.FeedEvent{evt("f", 2, 1), evt("e", 2, 1), evt("d", 2, 1), evt("c", 1, 1), evt("a", 1, 1)}
+	// page 模拟 dao 按游标过滤
+	page := func(list []domain.FeedEvent, cursor domain.FeedCursor) []domain.FeedEvent {
+		res := make([]domain.FeedEvent, 0, len(list))
+		for _, e := range list {
+			if cursor.Precedes(e) {
+				res = append(res, e)
+			}
+		}
+		return res
+	}
+
+	var (
+		cursor domain.FeedCursor
+		got    []string
+	)
+	for i := 0; i < 10; i++ {
+		events := mergeEvents(2, page(push, cursor), page(pull, cursor))
+		if len(events) == 0 {
+			break
+		}
+		got = append(got, eventIds(events)...)
+		cursor, _ = domain.ParseFeedCursor(events[len(events)-1].Cursor().String())
+	}
+	assert.Equal(t, []string{"f", "e", "d", "c", "b", "a"}, got)
+}
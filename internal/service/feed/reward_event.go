@@ -0,0 +1,46 @@
+package feed
+
+import (
+	"archi/internal/domain"
+	"archi/internal/event/feedevent"
+	"archi/internal/repository"
+	"context"
+	"time"
+)
+
+const (
+	RewardEventName = feedevent.TypeReward
+)
+
+type RewardEventHandler struct {
+	repo repository.FeedEventRepo
+}
+
+func NewRewardEventHandler(repo repository.FeedEventRepo) Handler {
+	return &RewardEventHandler{
+		repo: repo,
+	}
+}
+
+// CreateFeedEvent 打赏支付成功后通知被打赏的人
+// uid int64: 打赏的人
+// target int64: 被打赏的人
+// biz string, bizId int64: 因为什么而打赏
+// amt int64: 打赏金额，单位分
+func (r *RewardEventHandler) CreateFeedEvent(ctx context.Context, ext domain.ExtendFields) error {
+	target, err := ext.Get("target").AsInt64()
+	if err != nil {
+		return err
+	}
+	return r.repo.CreatePushEvents(ctx, []domain.FeedEvent{{
+		EventId: newEventId(),
+		Uid:     target,
+		Type:    RewardEventName,
+		Ctime:   time.Now(),
+		Ext:     ext,
+	}})
+}
+
+func (r *RewardEventHandler) FindFeedEvents(ctx context.Context, uid int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error) {
+	return r.repo.FindPushEventsWithTyp(ctx, RewardEventName, uid, cursor, limit)
+}
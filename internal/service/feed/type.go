@@ -3,15 +3,51 @@ package feed
 import (
 	"archi/internal/domain"
 	"context"
+	"time"
 )
 
 type Service interface {
 	CreateFeedEvent(ctx context.Context, feed domain.FeedEvent) error
-	GetFeedEventList(ctx context.Context, uid, timestamp, limit int64) ([]domain.FeedEvent, error)
+	// GetFeedEventList 按 (Ctime, ID) 倒序返回游标之后的事件，游标为零值时从最新的开始
+	GetFeedEventList(ctx context.Context, uid int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error)
+	// Enrich 批量加载一页事件中引用到的用户昵称头像和文章标题
+	Enrich(ctx context.Context, events []domain.FeedEvent) (domain.FeedEnrichment, error)
+	// MarkActive 记录用户活跃，登录和刷 feed 的时候调用，推模型只推给最近活跃的粉丝
+	MarkActive(ctx context.Context, uid int64) error
+	// FanoutPush 把事件写入一批粉丝的收件箱，异步扩散时由消费者调用
+	FanoutPush(ctx context.Context, evt domain.FeedEvent, followers []int64) error
+	// Unfollow 取消关注之后清理 follower 收件箱中 followee 的事件，由消费者异步调用
+	Unfollow(ctx context.Context, follower, followee int64) error
+	// Archive 把超过保留期的事件搬到归档表，由定时任务调用，返回搬走的条数
+	Archive(ctx context.Context) (int64, error)
+}
+
+// FanoutConfig 推拉结合的扩散策略
+type FanoutConfig struct {
+	// PushAllThreshold 粉丝数不超过该值时推给全部粉丝，超过时只推给活跃粉丝，其余粉丝走拉模型
+	PushAllThreshold int64
+	// ActiveWindow 在这段时间内登录过或者刷过 feed 的粉丝才算活跃
+	ActiveWindow time.Duration
+	// BatchSize 每批扩散的粉丝数，需要推送的粉丝超过一批时通过 Kafka 异步扩散
+	BatchSize int64
+}
+
+// RetentionConfig 线上表中事件的保留期，过期的事件会被归档
+type RetentionConfig struct {
+	PushTTL time.Duration
+	PullTTL time.Duration
+	// BatchSize 每个事务归档的条数
+	BatchSize int
 }
 
 // Handler 具体业务处理逻辑
 type Handler interface {
 	CreateFeedEvent(ctx context.Context, ext domain.ExtendFields) error
-	FindFeedEvents(ctx context.Context, uid, timestamp, limit int64) ([]domain.FeedEvent, error)
+	// FindFeedEvents 返回的事件需要按 (Ctime, ID) 倒序排好
+	FindFeedEvents(ctx context.Context, uid int64, cursor domain.FeedCursor, limit int64) ([]domain.FeedEvent, error)
+}
+
+// UnfollowHandler 依赖关注关系推送事件的 Handler 需要实现，取消关注之后清理收件箱
+type UnfollowHandler interface {
+	CleanupUnfollow(ctx context.Context, follower, followee int64) error
 }
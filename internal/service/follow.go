@@ -6,11 +6,23 @@ import (
 	"archi/internal/repository"
 	"archi/pkg/logger"
 	"context"
+	"errors"
 )
 
+// ErrFollowBlocked 双方之间有拉黑关系，不能关注
+var ErrFollowBlocked = errors.New("存在拉黑关系，不能关注")
+
 type FollowRelationService interface {
-	GetFollowee(ctx context.Context, follower, offset, limit int64) ([]domain.FollowRelation, error)
-	GetFollower(ctx context.Context, followee int64) ([]domain.FollowRelation, error)
+	// GetFollowee 获取关注列表，按关系 ID 倒序，cursor 为上一页最后一条关系的 ID，第一页传 0
+	GetFollowee(ctx context.Context, follower, cursor, limit int64) ([]domain.FollowRelation, error)
+	// GetFollower 获取粉丝列表，分页方式同 GetFollowee
+	GetFollower(ctx context.Context, followee, cursor, limit int64) ([]domain.FollowRelation, error)
+	// GetMutual 获取互相关注的列表，关系中的 Followee 是对方，分页方式同 GetFollowee
+	GetMutual(ctx context.Context, uid, cursor, limit int64) ([]domain.FollowRelation, error)
+	// GetFollowStates 批量查询 uid 和 targets 中每个人的关注状态，用于渲染用户列表
+	GetFollowStates(ctx context.Context, uid int64, targets []int64) (map[int64]domain.FollowState, error)
+	// GetFollowerBatch 分批获取粉丝，minId 传上一批最后一条关系的 ID，第一批传 0
+	GetFollowerBatch(ctx context.Context, followee, minId, limit int64) ([]domain.FollowRelation, error)
 	FollowInfo(ctx context.Context, follower, followee int64) (domain.FollowRelation, error)
 	Follow(ctx context.Context, follower, followee int64) error
 	CancelFollow(ctx context.Context, follower, followee int64) error
@@ -18,24 +30,39 @@ type FollowRelationService interface {
 }
 
 type DefaultFollowRelationService struct {
-	producer follow.Producer
-	repo     repository.FollowRepository
-	l        logger.Logger
+	producer  follow.Producer
+	repo      repository.FollowRepository
+	blockRepo repository.BlockRepository
+	l         logger.Logger
 }
 
-func NewDefaultFollowRelationService(producer follow.Producer, repo repository.FollowRepository, logger logger.Logger) FollowRelationService {
+func NewDefaultFollowRelationService(producer follow.Producer, repo repository.FollowRepository,
+	blockRepo repository.BlockRepository, logger logger.Logger) FollowRelationService {
 	return &DefaultFollowRelationService{
-		producer: producer,
-		repo:     repo,
-		l:        logger,
+		producer:  producer,
+		repo:      repo,
+		blockRepo: blockRepo,
+		l:         logger,
 	}
 }
-func (f *DefaultFollowRelationService) GetFollowee(ctx context.Context, follower, offset, limit int64) ([]domain.FollowRelation, error) {
-	return f.repo.GetFollowee(ctx, follower, offset, limit)
+func (f *DefaultFollowRelationService) GetFollowee(ctx context.Context, follower, cursor, limit int64) ([]domain.FollowRelation, error) {
+	return f.repo.GetFollowee(ctx, follower, cursor, limit)
+}
+
+func (f *DefaultFollowRelationService) GetFollower(ctx context.Context, followee, cursor, limit int64) ([]domain.FollowRelation, error) {
+	return f.repo.GetFollower(ctx, followee, cursor, limit)
+}
+
+func (f *DefaultFollowRelationService) GetMutual(ctx context.Context, uid, cursor, limit int64) ([]domain.FollowRelation, error) {
+	return f.repo.GetMutual(ctx, uid, cursor, limit)
+}
+
+func (f *DefaultFollowRelationService) GetFollowStates(ctx context.Context, uid int64, targets []int64) (map[int64]domain.FollowState, error) {
+	return f.repo.GetFollowStates(ctx, uid, targets)
 }
 
-func (f *DefaultFollowRelationService) GetFollower(ctx context.Context, followee int64) ([]domain.FollowRelation, error) {
-	return f.repo.GetFollower(ctx, followee)
+func (f *DefaultFollowRelationService) GetFollowerBatch(ctx context.Context, followee, minId, limit int64) ([]domain.FollowRelation, error) {
+	return f.repo.GetFollowerBatch(ctx, followee, minId, limit)
 }
 
 func (f *DefaultFollowRelationService) FollowInfo(ctx context.Context, follower, followee int64) (domain.FollowRelation, error) {
@@ -44,7 +71,14 @@ func (f *DefaultFollowRelationService) FollowInfo(ctx context.Context, follower,
 }
 
 func (f *DefaultFollowRelationService) Follow(ctx context.Context, follower, followee int64) error {
-	err := f.repo.AddFollowRelation(ctx, domain.FollowRelation{
+	blocked, err := f.blockRepo.IsBlocked(ctx, follower, followee)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrFollowBlocked
+	}
+	err = f.repo.AddFollowRelation(ctx, domain.FollowRelation{
 		Followee: followee,
 		Follower: follower,
 	})
@@ -68,7 +102,24 @@ func (f *DefaultFollowRelationService) Follow(ctx context.Context, follower, fol
 	return nil
 }
 func (f *DefaultFollowRelationService) CancelFollow(ctx context.Context, follower, followee int64) error {
-	return f.repo.InactiveFollowRelation(ctx, follower, followee)
+	err := f.repo.InactiveFollowRelation(ctx, follower, followee)
+	if err != nil {
+		return err
+	}
+	go func() {
+		// feed 收到之后异步清理收件箱里面这个人的事件
+		err := f.producer.ProduceUnfollowEvent(follow.Event{
+			Follower: follower,
+			Followee: followee,
+		})
+		if err != nil {
+			f.l.Error("发送取消关注事件失败",
+				logger.Int64("follower", follower),
+				logger.Int64("followee", followee),
+				logger.Error(err))
+		}
+	}()
+	return nil
 }
 
 func (f *DefaultFollowRelationService) GetFollowStatic(ctx context.Context, uid int64) (domain.FollowStatics, error) {
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"archi/internal/domain"
+	"archi/internal/repository"
+	"archi/pkg/logger"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// FollowRecommendConfig 关注推荐的计算参数
+type FollowRecommendConfig struct {
+	// CandidateLimit 每个来源最多取多少个候选人
+	CandidateLimit int
+	// Size 每个用户最多保存多少个推荐
+	Size int
+	// BatchSize 定时任务每批处理的用户数
+	BatchSize int
+	// Weights 每个来源命中一次的分数
+	Weights map[domain.FollowRecommendReason]float64
+}
+
+type FollowRecommendService interface {
+	// Refresh 给全部用户重新计算推荐，由定时任务调用，ctx 超时之后停止，返回处理的用户数
+	Refresh(ctx context.Context) (int64, error)
+	// Recommend 获取推荐，还没有计算过的用户当场计算一次
+	Recommend(ctx context.Context, uid int64, limit int) ([]domain.FollowRecommendation, error)
+	// Dismiss 不感兴趣，之后不再推荐这个人
+	Dismiss(ctx context.Context, uid, target int64) error
+}
+
+type DefaultFollowRecommendService struct {
+	repo       repository.FollowRecommendRepository
+	followRepo repository.FollowRepository
+	blockRepo  repository.BlockRepository
+	cfg        FollowRecommendConfig
+	l          logger.Logger
+}
+
+func NewDefaultFollowRecommendService(repo repository.FollowRecommendRepository, followRepo repository.FollowRepository,
+	blockRepo repository.BlockRepository, cfg FollowRecommendConfig, l logger.Logger) FollowRecommendService {
+	return &DefaultFollowRecommendService{
+		repo:       repo,
+		followRepo: followRepo,
+		blockRepo:  blockRepo,
+		cfg:        cfg,
+		l:          l,
+	}
+}
+
+// Refresh 从上一次的断点继续，每处理完一批记录一次断点，全部用户处理完之后清零，下一次从头开始
+func (s *DefaultFollowRecommendService) Refresh(ctx context.Context) (int64, error) {
+	minUid, err := s.repo.RefreshCursor(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var cnt int64
+	for ctx.Err() == nil {
+		uids, err := s.repo.FindUids(ctx, minUid, s.cfg.BatchSize)
+		if err != nil {
+			return cnt, err
+		}
+		for _, uid := range uids {
+			// 单个用户失败不影响其他用户
+			if _, err = s.compute(ctx, uid); err != nil {
+				s.l.Error("计算关注推荐失败", logger.Int64("uid", uid), logger.Error(err))
+				continue
+			}
+			cnt++
+		}
+		if ctx.Err() != nil {
+			// 这一批中途超时，不推进断点，下一次重新处理这一批
+			break
+		}
+		if len(uids) < s.cfg.BatchSize {
+			minUid = 0
+		} else {
+			minUid = uids[len(uids)-1]
+		}
+		if err = s.repo.SetRefreshCursor(ctx, minUid); err != nil {
+			return cnt, err
+		}
+		if minUid == 0 {
+			break
+		}
+	}
+	return cnt, nil
+}
+
+func (s *DefaultFollowRecommendService) Recommend(ctx context.Context, uid int64, limit int) ([]domain.FollowRecommendation, error) {
+	recs, err := s.repo.Find(ctx, uid)
+	if errors.Is(err, repository.ErrFollowRecommendNotFound) {
+		recs, err = s.compute(ctx, uid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 计算之后可能又关注、拉黑或者标记了不感兴趣，返回之前再过滤一次
+	recs, err = s.filter(ctx, uid, recs)
+	if err != nil {
+		return nil, err
+	}
+	if len(recs) > limit {
+		recs = recs[:limit]
+	}
+	return recs, nil
+}
+
+func (s *DefaultFollowRecommendService) Dismiss(ctx context.Context, uid, target int64) error {
+	return s.repo.Dismiss(ctx, uid, target)
+}
+
+// compute 汇总各个来源的候选人，按加权分数排序之后保存
+func (s *DefaultFollowRecommendService) compute(ctx context.Context, uid int64) ([]domain.FollowRecommendation, error) {
+	var (
+		eg  errgroup.Group
+		mu  sync.Mutex
+		res = make(map[int64]*domain.FollowRecommendation)
+		// best 每个候选人分数贡献最大的来源作为推荐理由
+		best = make(map[int64]float64)
+	)
+	for reason, weight := range s.cfg.Weights {
+		eg.Go(func() error {
+			cs, err := s.repo.Candidates(ctx, uid, reason, s.cfg.CandidateLimit)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for cid, cnt := range cs {
+				score := weight * float64(cnt)
+				rec, ok := res[cid]
+				if !ok {
+					rec = &domain.FollowRecommendation{Uid: cid}
+					res[cid] = rec
+				}
+				rec.Score += score
+				if score > best[cid] {
+					best[cid] = score
+					rec.Reason = reason
+				}
+			}
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	recs := make([]domain.FollowRecommendation, 0, len(res))
+	for _, rec := range res {
+		recs = append(recs, *rec)
+	}
+	recs, err := s.filter(ctx, uid, recs)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		if recs[i].Score != recs[j].Score {
+			return recs[i].Score > recs[j].Score
+		}
+		return recs[i].Uid < recs[j].Uid
+	})
+	if len(recs) > s.cfg.Size {
+		recs = recs[:s.cfg.Size]
+	}
+	return recs, s.repo.Save(ctx, uid, recs)
+}
+
+// filter 去掉自己、已经关注的、拉黑静音的和不感兴趣的
+func (s *DefaultFollowRecommendService) filter(ctx context.Context, uid int64,
+	recs []domain.FollowRecommendation) ([]domain.FollowRecommendation, error) {
+	if len(recs) == 0 {
+		return recs, nil
+	}
+	excluded := map[int64]struct{}{uid: {}}
+	hidden, err := s.blockRepo.HiddenUids(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	dismissed, err := s.repo.Dismissed(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range append(hidden, dismissed...) {
+		excluded[id] = struct{}{}
+	}
+	targets := make([]int64, 0, len(recs))
+	for _, rec := range recs {
+		targets = append(targets, rec.Uid)
+	}
+	states, err := s.followRepo.GetFollowStates(ctx, uid, targets)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.FollowRecommendation, 0, len(recs))
+	for _, rec := range recs {
+		if _, ok := excluded[rec.Uid]; ok || states[rec.Uid].Following {
+			continue
+		}
+		res = append(res, rec)
+	}
+	return res, nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"archi/internal/domain"
+	"archi/internal/repository"
+	"archi/pkg/logger"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFollowRecommendRepo 用户 id 是 1 到 total，保存 cancelAfter 个用户之后取消 ctx，模拟定时任务超时
+type fakeFollowRecommendRepo struct {
+	repository.FollowRecommendRepository
+	total       int64
+	cursor      int64
+	saved       []int64
+	cancelAfter int
+	cancel      context.CancelFunc
+}
+
+func (r *fakeFollowRecommendRepo) FindUids(ctx context.Context, minUid int64, limit int) ([]int64, error) {
+	var res []int64
+	for uid := minUid + 1; uid <= r.total && len(res) < limit; uid++ {
+		res = append(res, uid)
+	}
+	return res, nil
+}
+
+func (r *fakeFollowRecommendRepo) RefreshCursor(ctx context.Context) (int64, error) {
+	return r.cursor, nil
+}
+
+func (r *fakeFollowRecommendRepo) SetRefreshCursor(ctx context.Context, uid int64) error {
+	r.cursor = uid
+	return nil
+}
+
+func (r *fakeFollowRecommendRepo) Save(ctx context.Context, uid int64, recs []domain.FollowRecommendation) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.saved = append(r.saved, uid)
+	if len(r.saved) == r.cancelAfter {
+		r.cancel()
+	}
+	return nil
+}
+
+func TestDefaultFollowRecommendService_Refresh(t *testing.T) {
+	testCases := []struct {
+		name        string
+		cursor      int64
+		cancelAfter int
+		wantSaved   []int64
+		wantCursor  int64
+	}{
+		{
+			name:       "处理完全部用户，断点清零",
+			wantSaved:  []int64{1, 2, 3, 4, 5},
+			wantCursor: 0,
+		},
+		{
+			name:       "从断点继续",
+			cursor:     2,
+			wantSaved:  []int64{3, 4, 5},
+			wantCursor: 0,
+		},
+		{
+			name:        "超时之前处理完的批次记录断点",
+			cancelAfter: 3,
+			wantSaved:   []int64{1, 2, 3},
+			wantCursor:  2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			repo := &fakeFollowRecommendRepo{total: 5, cursor: tc.cursor, cancelAfter: tc.cancelAfter, cancel: cancel}
+			svc := NewDefaultFollowRecommendService(repo, nil, nil,
+				FollowRecommendConfig{Size: 10, BatchSize: 2}, logger.NewNopLogger())
+			cnt, err := svc.Refresh(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(tc.wantSaved)), cnt)
+			assert.Equal(t, tc.wantSaved, repo.saved)
+			assert.Equal(t, tc.wantCursor, repo.cursor)
+		})
+	}
+}
@@ -2,9 +2,13 @@ package service
 
 import (
 	"archi/internal/domain"
+	"archi/internal/event/feedevent"
 	"archi/internal/repository"
+	"archi/pkg/logger"
 	"context"
 	"golang.org/x/sync/errgroup"
+	"strconv"
+	"time"
 )
 
 var ErrNotFoundInter = repository.ErrNotFoundInter
@@ -18,14 +22,23 @@ type InteractiveService interface {
 	CancelCollect(ctx context.Context, biz string, bizId, cid, uid int64) error
 	Get(ctx context.Context, biz string, id int64, uid int64) (domain.Interactive, error)
 	GetByIds(ctx context.Context, biz string, ids []int64) (map[int64]domain.Interactive, error)
+	// LikedIds 批量查询用户是否点赞过，只返回点赞过的 id
+	LikedIds(ctx context.Context, biz string, ids []int64, uid int64) (map[int64]bool, error)
 }
 type DefaultInteractiveService struct {
-	repo repository.InteractiveRepository
+	repo         repository.InteractiveRepository
+	artRepo      repository.ArticleRepository
+	feedProducer feedevent.Producer
+	l            logger.Logger
 }
 
-func NewDefaultInteractiveService(repo repository.InteractiveRepository) InteractiveService {
+func NewDefaultInteractiveService(repo repository.InteractiveRepository, artRepo repository.ArticleRepository,
+	feedProducer feedevent.Producer, l logger.Logger) InteractiveService {
 	return &DefaultInteractiveService{
-		repo: repo,
+		repo:         repo,
+		artRepo:      artRepo,
+		feedProducer: feedProducer,
+		l:            l,
 	}
 }
 
@@ -33,14 +46,75 @@ func (i *DefaultInteractiveService) IncrReadCnt(ctx context.Context, biz string,
 	return i.repo.IncrReadCnt(ctx, biz, bizId)
 }
 func (i *DefaultInteractiveService) Like(c context.Context, biz string, id int64, uid int64) error {
-	return i.repo.IncrLike(c, biz, id, uid)
+	changed, err := i.repo.IncrLike(c, biz, id, uid)
+	if err != nil {
+		return err
+	}
+	// 重复点赞不再通知作者
+	if !changed {
+		return nil
+	}
+	go i.produceEvent(feedevent.TypeLike, biz, id, "liker", uid, "liked", map[string]string{})
+	return nil
 }
 
 func (i *DefaultInteractiveService) CancelLike(c context.Context, biz string, id int64, uid int64) error {
-	return i.repo.DecrLike(c, biz, id, uid)
+	_, err := i.repo.DecrLike(c, biz, id, uid)
+	return err
 }
 func (i *DefaultInteractiveService) Collect(ctx context.Context, biz string, bizId, cid, uid int64) error {
-	return i.repo.AddCollectionItem(ctx, biz, bizId, cid, uid)
+	err := i.repo.AddCollectionItem(ctx, biz, bizId, cid, uid)
+	if err != nil {
+		return err
+	}
+	go i.produceEvent(feedevent.TypeCollect, biz, bizId, "collector", uid, "author", map[string]string{
+		"cid": strconv.FormatInt(cid, 10),
+	})
+	return nil
+}
+
+// produceEvent 回查内容的作者，通知作者有人点赞或者收藏了
+// actorKey 和 ownerKey 分别是 ext 中操作人和作者的字段名
+func (i *DefaultInteractiveService) produceEvent(typ, biz string, bizId int64,
+	actorKey string, actor int64, ownerKey string, ext map[string]string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	owner, err := i.bizOwner(ctx, biz, bizId)
+	if err != nil {
+		i.l.Error("查询内容作者失败",
+			logger.String("biz", biz),
+			logger.Int64("biz_id", bizId),
+			logger.Error(err))
+		return
+	}
+	// 自己的内容不需要通知
+	if owner == 0 || owner == actor {
+		return
+	}
+	ext[actorKey] = strconv.FormatInt(actor, 10)
+	ext[ownerKey] = strconv.FormatInt(owner, 10)
+	ext["biz"] = biz
+	ext["bizId"] = strconv.FormatInt(bizId, 10)
+	err = i.feedProducer.ProduceFeedEvent(feedevent.Event{Type: typ, Ext: ext})
+	if err != nil {
+		i.l.Error("发送 feed 事件失败",
+			logger.String("type", typ),
+			logger.String("biz", biz),
+			logger.Int64("biz_id", bizId),
+			logger.Error(err))
+	}
+}
+
+// bizOwner 内容的作者，目前只支持文章，其它业务返回 0
+func (i *DefaultInteractiveService) bizOwner(ctx context.Context, biz string, bizId int64) (int64, error) {
+	if biz != "article" {
+		return 0, nil
+	}
+	art, err := i.artRepo.GetPubById(ctx, bizId)
+	if err != nil {
+		return 0, err
+	}
+	return art.Author.ID, nil
 }
 func (i *DefaultInteractiveService) CancelCollect(ctx context.Context, biz string, bizId, cid, uid int64) error {
 	return i.repo.RemoveCollectionItem(ctx, biz, bizId, cid, uid)
@@ -76,3 +150,15 @@ func (i *DefaultInteractiveService) GetByIds(ctx context.Context, biz string, id
 	}
 	return res, nil
 }
+
+func (i *DefaultInteractiveService) LikedIds(ctx context.Context, biz string, ids []int64, uid int64) (map[int64]bool, error) {
+	liked, err := i.repo.LikedIds(ctx, biz, ids, uid)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]bool, len(liked))
+	for _, id := range liked {
+		res[id] = true
+	}
+	return res, nil
+}
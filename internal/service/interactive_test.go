@@ -0,0 +1,83 @@
+package service
+
+import (
+	"archi/internal/repository"
+	"archi/pkg/logger"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeInteractiveRepo 记录点赞状态，和 dao 一样重复操作返回没有变化
+type fakeInteractiveRepo struct {
+	repository.InteractiveRepository
+	liked map[int64]bool
+}
+
+func (r *fakeInteractiveRepo) IncrLike(ctx context.Context, biz string, id int64, uid int64) (bool, error) {
+	if r.liked[uid] {
+		return false, nil
+	}
+	r.liked[uid] = true
+	return true, nil
+}
+
+func (r *fakeInteractiveRepo) DecrLike(ctx context.Context, biz string, id int64, uid int64) (bool, error) {
+	if !r.liked[uid] {
+		return false, nil
+	}
+	r.liked[uid] = false
+	return true, nil
+}
+
+func TestDefaultInteractiveService_Like(t *testing.T) {
+	testCases := []struct {
+		name string
+		// likes true 表示点赞，false 表示取消点赞
+		likes     []bool
+		wantLikes int
+	}{
+		{
+			name:      "点赞",
+			likes:     []bool{true},
+			wantLikes: 1,
+		},
+		{
+			name:      "重复点赞只通知一次",
+			likes:     []bool{true, true, true},
+			wantLikes: 1,
+		},
+		{
+			name:      "取消之后重新点赞",
+			likes:     []bool{true, false, true},
+			wantLikes: 2,
+		},
+		{
+			name:  "没有点赞直接取消",
+			likes: []bool{false},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			producer := &fakeFeedProducer{}
+			svc := NewDefaultInteractiveService(&fakeInteractiveRepo{liked: map[int64]bool{}},
+				&fakeArticleRepo{author: testArticleOwner}, producer, logger.NewNopLogger())
+			ctx := context.Background()
+			for _, like := range tc.likes {
+				var err error
+				if like {
+					err = svc.Like(ctx, "article", 100, testOther)
+				} else {
+					err = svc.CancelLike(ctx, "article", 100, testOther)
+				}
+				require.NoError(t, err)
+			}
+			// 事件是异步发送的
+			time.Sleep(time.Millisecond * 20)
+			assert.Len(t, producer.sent(), tc.wantLikes)
+		})
+	}
+}
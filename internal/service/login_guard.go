@@ -0,0 +1,212 @@
+package service
+
+import (
+	"archi/internal/event/security"
+	"archi/internal/repository"
+	"archi/pkg/logger"
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+const bizUnlock = "unlock"
+
+var (
+	// ErrAccountLocked 失败次数过多，账号被临时锁定
+	ErrAccountLocked = errors.New("账号已被锁定")
+	// ErrLoginTooFrequent 失败之后还没到下一次可以尝试的时间
+	ErrLoginTooFrequent = errors.New("登录尝试太频繁")
+	// ErrUnlockCodeInvalid 解锁验证码错误，账号不存在的时候也返回这个错误
+	ErrUnlockCodeInvalid = errors.New("解锁验证码错误")
+)
+
+// LoginGuardConfig 密码登录的防暴力破解配置
+type LoginGuardConfig struct {
+	// FailureWindow 失败次数的统计窗口，从第一次失败开始算
+	FailureWindow time.Duration
+	// FreeAttempts 账号失败这么多次之内不需要等待，之后每次失败等待 BaseDelay 翻倍，最多 MaxDelay
+	FreeAttempts int64
+	// IPFreeAttempts IP 允许的失败次数，一个 IP 后面可能有很多用户，要比账号的宽松
+	IPFreeAttempts int64
+	BaseDelay      time.Duration
+	MaxDelay       time.Duration
+	// LockThreshold 账号失败这么多次之后锁定 LockDuration，可以通过短信验证码提前解锁
+	LockThreshold int64
+	LockDuration  time.Duration
+}
+
+// LoginGuardService 密码登录的失败计数、递增等待与临时锁定
+// 不管账号存不存在都按同样的规则计数，避免通过登录结果判断账号是否注册过
+type LoginGuardService interface {
+	// Check 登录之前检查账号是否被锁定，账号和 IP 是否还在等待中
+	Check(ctx context.Context, email, ip string) error
+	// Failed 记录一次失败，uid 为 0 说明账号不存在
+	Failed(ctx context.Context, email, ip string, uid int64)
+	// Succeeded 登录成功之后清空账号的失败记录
+	Succeeded(ctx context.Context, email string)
+	// SendUnlockCode 给账号绑定的手机发送解锁验证码，账号不存在或者没有绑定手机时也返回成功
+	SendUnlockCode(ctx context.Context, email string, client CodeSendClient) error
+	// Unlock 使用短信验证码解锁账号
+	Unlock(ctx context.Context, email, code, ip string) error
+}
+
+type DefaultLoginGuardService struct {
+	repo     repository.LoginGuardRepository
+	userRepo repository.UserRepository
+	codeSvc  CodeService
+	guardSvc CodeGuardService
+	producer security.Producer
+	cfg      LoginGuardConfig
+	l        logger.Logger
+}
+
+func NewDefaultLoginGuardService(repo repository.LoginGuardRepository, userRepo repository.UserRepository,
+	codeSvc CodeService, guardSvc CodeGuardService, producer security.Producer,
+	cfg LoginGuardConfig, l logger.Logger) LoginGuardService {
+	return &DefaultLoginGuardService{
+		repo:     repo,
+		userRepo: userRepo,
+		codeSvc:  codeSvc,
+		guardSvc: guardSvc,
+		producer: producer,
+		cfg:      cfg,
+		l:        l,
+	}
+}
+
+func (svc *DefaultLoginGuardService) Check(ctx context.Context, email, ip string) error {
+	status, err := svc.repo.Status(ctx, svc.account(email), ip)
+	if err != nil {
+		return err
+	}
+	if status.Locked > 0 {
+		return ErrAccountLocked
+	}
+	if status.AccountWait > 0 || status.IPWait > 0 {
+		return ErrLoginTooFrequent
+	}
+	return nil
+}
+
+func (svc *DefaultLoginGuardService) Failed(ctx context.Context, email, ip string, uid int64) {
+	account := svc.account(email)
+	svc.audit(security.EventLoginFailed, account, uid, ip)
+	accountCnt, ipCnt, err := svc.repo.RecordFailure(ctx, account, ip, svc.cfg.FailureWindow)
+	if err != nil {
+		svc.l.Error("记录登录失败次数失败", logger.String("ip", ip), logger.Error(err))
+		return
+	}
+	if accountCnt >= svc.cfg.LockThreshold {
+		if err = svc.repo.Lock(ctx, account, svc.cfg.LockDuration); err != nil {
+			svc.l.Error("锁定账号失败", logger.String("ip", ip), logger.Error(err))
+			return
+		}
+		// 只在刚好达到阈值的那一次记录锁定，后面的失败都被 Check 拦住了
+		if accountCnt == svc.cfg.LockThreshold {
+			svc.audit(security.EventAccountLocked, account, uid, ip)
+		}
+		return
+	}
+	err = svc.repo.Delay(ctx, account, ip,
+		svc.delay(accountCnt, svc.cfg.FreeAttempts), svc.delay(ipCnt, svc.cfg.IPFreeAttempts))
+	if err != nil {
+		svc.l.Error("设置登录等待时间失败", logger.String("ip", ip), logger.Error(err))
+	}
+}
+
+func (svc *DefaultLoginGuardService) Succeeded(ctx context.Context, email string) {
+	if err := svc.repo.Reset(ctx, svc.account(email)); err != nil {
+		svc.l.Error("清空登录失败次数失败", logger.Error(err))
+	}
+}
+
+func (svc *DefaultLoginGuardService) SendUnlockCode(ctx context.Context, email string, client CodeSendClient) error {
+	account := svc.account(email)
+	// 按账号而不是手机号限制，这样账号存不存在的表现是一样的
+	if err := svc.guardSvc.Check(ctx, bizUnlock, account, client); err != nil {
+		return err
+	}
+	u, err := svc.userRepo.FindByEmail(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// 目前只支持短信解锁，没有绑定手机的账号只能等锁定自然过期
+	if u.Phone == "" {
+		return nil
+	}
+	err = svc.codeSvc.Send(ctx, bizUnlock, u.Phone)
+	if errors.Is(err, ErrCodeSendTooMany) {
+		// 上一条验证码还有效，不需要告诉调用方
+		return nil
+	}
+	return err
+}
+
+func (svc *DefaultLoginGuardService) Unlock(ctx context.Context, email, code, ip string) error {
+	u, err := svc.userRepo.FindByEmail(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return ErrUnlockCodeInvalid
+	}
+	if err != nil {
+		return err
+	}
+	if u.Phone == "" {
+		return ErrUnlockCodeInvalid
+	}
+	ok, err := svc.codeSvc.Verify(ctx, bizUnlock, u.Phone, code)
+	if errors.Is(err, ErrCodeVerifyTooMany) || errors.Is(err, ErrCodeExpired) {
+		return ErrUnlockCodeInvalid
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrUnlockCodeInvalid
+	}
+	account := svc.account(email)
+	if err = svc.repo.Reset(ctx, account); err != nil {
+		return err
+	}
+	svc.audit(security.EventAccountUnlocked, account, u.ID, ip)
+	return nil
+}
+
+// delay 第 cnt 次失败之后需要等待的时间
+func (svc *DefaultLoginGuardService) delay(cnt, free int64) time.Duration {
+	if cnt <= free {
+		return 0
+	}
+	d := svc.cfg.BaseDelay
+	for i := free + 1; i < cnt && d < svc.cfg.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, svc.cfg.MaxDelay)
+}
+
+// account 邮箱不区分大小写，统一成小写之后计数
+func (svc *DefaultLoginGuardService) account(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// audit 异步发送审计事件，发送失败不影响登录
+func (svc *DefaultLoginGuardService) audit(typ, account string, uid int64, ip string) {
+	evt := security.AuditEvent{
+		Type:    typ,
+		Account: account,
+		Uid:     uid,
+		IP:      ip,
+		Ctime:   time.Now().UnixMilli(),
+	}
+	go func() {
+		if err := svc.producer.ProduceAuditEvent(evt); err != nil {
+			svc.l.Error("发送安全审计事件失败",
+				logger.String("type", evt.Type),
+				logger.Int64("uid", evt.Uid),
+				logger.Error(err))
+		}
+	}()
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"archi/internal/domain"
+	"archi/internal/event/security"
+	"archi/internal/repository"
+	"archi/internal/repository/cache"
+	"archi/pkg/limiter"
+	"archi/pkg/logger"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAuditProducer 审计事件是异步发送的，按类型计数
+type fakeAuditProducer struct {
+	mu     sync.Mutex
+	events map[string]int
+}
+
+func (p *fakeAuditProducer) ProduceAuditEvent(evt security.AuditEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events[evt.Type]++
+	return nil
+}
+
+func (p *fakeAuditProducer) count(typ string) func() bool {
+	return func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.events[typ] > 0
+	}
+}
+
+// fakeUserRepo 只实现了 FindByEmail
+type fakeUserRepo struct {
+	repository.UserRepository
+	users map[string]domain.User
+}
+
+func (r *fakeUserRepo) FindByEmail(ctx context.Context, email string) (domain.User, error) {
+	u, ok := r.users[email]
+	if !ok {
+		return domain.User{}, repository.ErrUserNotFound
+	}
+	return u, nil
+}
+
+// fakeCodeService 验证码固定是 123456
+type fakeCodeService struct {
+	sent []string
+}
+
+func (s *fakeCodeService) Send(ctx context.Context, biz, phone string) error {
+	s.sent = append(s.sent, phone)
+	return nil
+}
+
+func (s *fakeCodeService) Verify(ctx context.Context, biz, phone, inputCode string) (bool, error) {
+	return inputCode == "123456", nil
+}
+
+func testLoginGuardConfig() LoginGuardConfig {
+	return LoginGuardConfig{
+		FailureWindow:  time.Minute * 30,
+		FreeAttempts:   2,
+		IPFreeAttempts: 4,
+		BaseDelay:      time.Second,
+		MaxDelay:       time.Second * 8,
+		LockThreshold:  6,
+		LockDuration:   time.Minute * 30,
+	}
+}
+
+func newTestLoginGuard(t *testing.T) (*DefaultLoginGuardService, *miniredis.Miniredis, *fakeAuditProducer, *fakeCodeService) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	producer := &fakeAuditProducer{events: map[string]int{}}
+	codeSvc := &fakeCodeService{}
+	userRepo := &fakeUserRepo{users: map[string]domain.User{
+		"a@qq.com":       {ID: 1, Email: "a@qq.com", Phone: "15212345678"},
+		"nophone@qq.com": {ID: 2, Email: "nophone@qq.com"},
+	}}
+	guardSvc := NewDefaultCodeGuardService(limiter.NewRedisMultiSlideWindowLimiter(client), testCodeGuardRules())
+	svc := NewDefaultLoginGuardService(
+		repository.NewCachedLoginGuardRepository(cache.NewRedisLoginGuardCache(client)),
+		userRepo, codeSvc, guardSvc, producer, testLoginGuardConfig(), logger.NewNopLogger())
+	return svc.(*DefaultLoginGuardService), mr, producer, codeSvc
+}
+
+func TestDefaultLoginGuardService_Delay(t *testing.T) {
+	svc := &DefaultLoginGuardService{cfg: testLoginGuardConfig()}
+	testCases := []struct {
+		cnt  int64
+		want time.Duration
+	}{
+		{cnt: 1, want: 0},
+		{cnt: 2, want: 0},
+		{cnt: 3, want: time.Second},
+		{cnt: 4, want: time.Second * 2},
+		{cnt: 5, want: time.Second * 4},
+		{cnt: 6, want: time.Second * 8},
+		{cnt: 20, want: time.Second * 8},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, svc.delay(tc.cnt, 2), "cnt %d", tc.cnt)
+	}
+}
+
+func TestDefaultLoginGuardService_Failed(t *testing.T) {
+	testCases := []struct {
+		name string
+		// failures 失败的次数，每次失败之后等待足够的时间
+		failures int
+		email    string
+		// checkEmail 最后用来检查的账号，为空时和 email 一样
+		checkEmail string
+		wantErr    error
+	}{
+		{
+			name:     "免费次数之内不需要等待",
+			failures: 2,
+			email:    "a@qq.com",
+		},
+		{
+			name:     "超过免费次数之后需要等待",
+			failures: 3,
+			email:    "a@qq.com",
+			wantErr:  ErrLoginTooFrequent,
+		},
+		{
+			name:     "达到阈值之后锁定",
+			failures: 6,
+			email:    "a@qq.com",
+			wantErr:  ErrAccountLocked,
+		},
+		{
+			name:     "账号不存在也一样锁定",
+			failures: 6,
+			email:    "nobody@qq.com",
+			wantErr:  ErrAccountLocked,
+		},
+		{
+			name:       "邮箱不区分大小写",
+			failures:   6,
+			email:      " A@QQ.com",
+			checkEmail: "a@qq.com",
+			wantErr:    ErrAccountLocked,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc, mr, producer, _ := newTestLoginGuard(t)
+			ctx := context.Background()
+			for i := 0; i < tc.failures; i++ {
+				require.NoError(t, svc.Check(ctx, tc.email, "1.1.1.1"), "failure %d", i)
+				svc.Failed(ctx, tc.email, "1.1.1.1", 0)
+				if i < tc.failures-1 {
+					mr.FastForward(time.Second * 8)
+				}
+			}
+			checkEmail := tc.checkEmail
+			if checkEmail == "" {
+				checkEmail = tc.email
+			}
+			assert.ErrorIs(t, svc.Check(ctx, checkEmail, "2.2.2.2"), tc.wantErr)
+			if tc.wantErr == ErrAccountLocked {
+				assert.Eventually(t, producer.count(security.EventAccountLocked), time.Second, time.Millisecond*10)
+			}
+		})
+	}
+}
+
+func TestDefaultLoginGuardService_IPDelay(t *testing.T) {
+	svc, mr, _, _ := newTestLoginGuard(t)
+	ctx := context.Background()
+	// 同一个 IP 换着账号试，账号都没有超过免费次数，IP 超过了
+	for i := 0; i < 5; i++ {
+		email := string(rune('a'+i)) + "@qq.com"
+		require.NoError(t, svc.Check(ctx, email, "1.1.1.1"))
+		svc.Failed(ctx, email, "1.1.1.1", 0)
+	}
+	assert.ErrorIs(t, svc.Check(ctx, "z@qq.com", "1.1.1.1"), ErrLoginTooFrequent)
+	assert.NoError(t, svc.Check(ctx, "z@qq.com", "2.2.2.2"))
+	mr.FastForward(time.Second)
+	assert.NoError(t, svc.Check(ctx, "z@qq.com", "1.1.1.1"))
+}
+
+func TestDefaultLoginGuardService_Succeeded(t *testing.T) {
+	svc, _, _, _ := newTestLoginGuard(t)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		svc.Failed(ctx, "a@qq.com", "1.1.1.1", 1)
+	}
+	require.ErrorIs(t, svc.Check(ctx, "a@qq.com", "2.2.2.2"), ErrLoginTooFrequent)
+	svc.Succeeded(ctx, "A@qq.com")
+	assert.NoError(t, svc.Check(ctx, "a@qq.com", "2.2.2.2"))
+}
+
+func TestDefaultLoginGuardService_Unlock(t *testing.T) {
+	testCases := []struct {
+		name     string
+		email    string
+		code     string
+		wantSent []string
+		wantErr  error
+	}{
+		{
+			name:     "验证码正确解锁",
+			email:    "a@qq.com",
+			code:     "123456",
+			wantSent: []string{"15212345678"},
+		},
+		{
+			name:     "验证码错误",
+			email:    "a@qq.com",
+			code:     "000000",
+			wantSent: []string{"15212345678"},
+			wantErr:  ErrUnlockCodeInvalid,
+		},
+		{
+			name:    "没有绑定手机",
+			email:   "nophone@qq.com",
+			code:    "123456",
+			wantErr: ErrUnlockCodeInvalid,
+		},
+		{
+			name:    "账号不存在",
+			email:   "nobody@qq.com",
+			code:    "123456",
+			wantErr: ErrUnlockCodeInvalid,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc, _, producer, codeSvc := newTestLoginGuard(t)
+			ctx := context.Background()
+			for i := 0; i < 6; i++ {
+				svc.Failed(ctx, tc.email, "1.1.1.1", 0)
+			}
+			require.ErrorIs(t, svc.Check(ctx, tc.email, "1.1.1.1"), ErrAccountLocked)
+
+			// 不管账号存不存在，发送解锁验证码的结果都一样
+			err := svc.SendUnlockCode(ctx, tc.email, CodeSendClient{IP: "1.1.1.1", CaptchaPassed: true})
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantSent, codeSvc.sent)
+
+			err = svc.Unlock(ctx, tc.email, tc.code, "1.1.1.1")
+			assert.ErrorIs(t, err, tc.wantErr)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, svc.Check(ctx, tc.email, "1.1.1.1"), ErrAccountLocked)
+				return
+			}
+			// 解锁之后账号可以登录，IP 的等待不受影响
+			assert.NoError(t, svc.Check(ctx, tc.email, "2.2.2.2"))
+			assert.Eventually(t, producer.count(security.EventAccountUnlocked), time.Second, time.Millisecond*10)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"archi/internal/domain"
+	"archi/internal/event/mention"
+	"archi/internal/repository"
+	"archi/pkg/logger"
+	"context"
+)
+
+type MentionService interface {
+	// Resolve 解析内容中的 @昵称 并换成用户 id，昵称不存在或者有重名的 @ 会被忽略
+	Resolve(ctx context.Context, content string) ([]domain.Mention, error)
+	// Save 保存内容的提及，notify 为 true 时通知之前没有通知过的用户
+	// 待复审的内容传 false，等复审通过之后调用 NotifyPending 补发
+	Save(ctx context.Context, biz string, bizId, author int64, mentions []domain.Mention, notify bool) error
+	// NotifyPending 通知内容中还没有通知过的用户
+	NotifyPending(ctx context.Context, biz string, bizId, author int64) error
+	// FindByBizIds 批量查询内容的提及，key 是内容 id
+	FindByBizIds(ctx context.Context, biz string, bizIds []int64) (map[int64][]domain.Mention, error)
+}
+
+type DefaultMentionService struct {
+	repo     repository.MentionRepository
+	userRepo repository.UserRepository
+	producer mention.Producer
+	l        logger.Logger
+}
+
+func NewDefaultMentionService(repo repository.MentionRepository, userRepo repository.UserRepository,
+	producer mention.Producer, l logger.Logger) MentionService {
+	return &DefaultMentionService{
+		repo:     repo,
+		userRepo: userRepo,
+		producer: producer,
+		l:        l,
+	}
+}
+
+func (s *DefaultMentionService) Resolve(ctx context.Context, content string) ([]domain.Mention, error) {
+	mentions := domain.ParseMentions(content)
+	if len(mentions) == 0 {
+		return nil, nil
+	}
+	nicknames := make([]string, 0, len(mentions))
+	for _, m := range mentions {
+		nicknames = append(nicknames, m.Nickname)
+	}
+	users, err := s.userRepo.FindByNicknames(ctx, nicknames)
+	if err != nil {
+		return nil, err
+	}
+	// 重名的昵称没办法确定是谁，宁可不 @ 也不要通知错人
+	uids := make(map[string]int64, len(users))
+	for _, u := range users {
+		if _, ok := uids[u.Nickname]; ok {
+			uids[u.Nickname] = 0
+			continue
+		}
+		uids[u.Nickname] = u.ID
+	}
+	res := make([]domain.Mention, 0, len(mentions))
+	for _, m := range mentions {
+		if uid := uids[m.Nickname]; uid > 0 {
+			m.Uid = uid
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+func (s *DefaultMentionService) Save(ctx context.Context, biz string, bizId, author int64,
+	mentions []domain.Mention, notify bool) error {
+	// 编辑或者重新发表的时候，之前已经 @ 过的人不再重复通知
+	targets, err := s.repo.Replace(ctx, biz, bizId, mentions, notify)
+	if err != nil {
+		return err
+	}
+	s.notify(biz, bizId, author, targets)
+	return nil
+}
+
+func (s *DefaultMentionService) NotifyPending(ctx context.Context, biz string, bizId, author int64) error {
+	targets, err := s.repo.MarkNotified(ctx, biz, bizId)
+	if err != nil {
+		return err
+	}
+	s.notify(biz, bizId, author, targets)
+	return nil
+}
+
+// notify 同一个人被 @ 多次只通知一次，自己 @ 自己不需要通知
+func (s *DefaultMentionService) notify(biz string, bizId, author int64, mentions []domain.Mention) {
+	notified := map[int64]struct{}{author: {}}
+	var targets []int64
+	for _, m := range mentions {
+		if _, ok := notified[m.Uid]; ok {
+			continue
+		}
+		notified[m.Uid] = struct{}{}
+		targets = append(targets, m.Uid)
+	}
+	if len(targets) > 0 {
+		go s.produce(biz, bizId, author, targets)
+	}
+}
+
+func (s *DefaultMentionService) produce(biz string, bizId, author int64, targets []int64) {
+	for _, uid := range targets {
+		err := s.producer.ProduceMentionEvent(mention.Event{
+			Biz:       biz,
+			BizId:     bizId,
+			Mentioner: author,
+			Mentioned: uid,
+		})
+		if err != nil {
+			s.l.Error("发送提及事件失败",
+				logger.String("biz", biz),
+				logger.Int64("biz_id", bizId),
+				logger.Int64("uid", uid),
+				logger.Error(err))
+		}
+	}
+}
+
+func (s *DefaultMentionService) FindByBizIds(ctx context.Context, biz string, bizIds []int64) (map[int64][]domain.Mention, error) {
+	return s.repo.FindByBizIds(ctx, biz, bizIds)
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"archi/internal/domain"
+	"archi/internal/event/mention"
+	"archi/internal/repository"
+	"archi/pkg/logger"
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMentionRepo 和 dao 一样，按 uid 保留通知标记
+type fakeMentionRepo struct {
+	repository.MentionRepository
+	mentions []domain.Mention
+	notified map[int64]bool
+}
+
+func (r *fakeMentionRepo) Replace(ctx context.Context, biz string, bizId int64,
+	mentions []domain.Mention, notify bool) ([]domain.Mention, error) {
+	var res []domain.Mention
+	notified := make(map[int64]bool, len(mentions))
+	for _, m := range mentions {
+		notified[m.Uid] = notify || r.notified[m.Uid]
+		if notify && !r.notified[m.Uid] {
+			res = append(res, m)
+		}
+	}
+	r.mentions, r.notified = mentions, notified
+	return res, nil
+}
+
+func (r *fakeMentionRepo) MarkNotified(ctx context.Context, biz string, bizId int64) ([]domain.Mention, error) {
+	var res []domain.Mention
+	for _, m := range r.mentions {
+		if !r.notified[m.Uid] {
+			res = append(res, m)
+		}
+	}
+	for _, m := range res {
+		r.notified[m.Uid] = true
+	}
+	return res, nil
+}
+
+// fakeMentionProducer 事件是异步发送的，记录被 @ 的人
+type fakeMentionProducer struct {
+	mu        sync.Mutex
+	mentioned []int64
+}
+
+func (p *fakeMentionProducer) ProduceMentionEvent(evt mention.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mentioned = append(p.mentioned, evt.Mentioned)
+	return nil
+}
+
+// take 等异步发送结束之后取出已经发送的事件
+func (p *fakeMentionProducer) take() []int64 {
+	time.Sleep(time.Millisecond * 20)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := p.mentioned
+	p.mentioned = nil
+	slices.Sort(res)
+	return res
+}
+
+func TestDefaultMentionService_SaveAndNotifyPending(t *testing.T) {
+	const author = int64(1)
+	mentions := func(uids ...int64) []domain.Mention {
+		res := make([]domain.Mention, 0, len(uids))
+		for _, uid := range uids {
+			res = append(res, domain.Mention{Uid: uid})
+		}
+		return res
+	}
+	repo := &fakeMentionRepo{}
+	producer := &fakeMentionProducer{}
+	svc := NewDefaultMentionService(repo, nil, producer, logger.NewNopLogger())
+	ctx := context.Background()
+
+	steps := []struct {
+		name string
+		// save 为 nil 表示复审通过，调用 NotifyPending
+		save          []domain.Mention
+		notify        bool
+		wantMentioned []int64
+	}{
+		{
+			name: "待复审的时候不通知",
+			// 同一个人 @ 了两次，也 @ 了自己
+			save: mentions(2, 3, 3, author),
+		},
+		{
+			name:          "复审通过之后补发，不通知自己",
+			wantMentioned: []int64{2, 3},
+		},
+		{
+			name:          "重新编辑，只通知新 @ 的人",
+			save:          mentions(2, 4),
+			notify:        true,
+			wantMentioned: []int64{4},
+		},
+		{
+			name: "再次进入复审，之前通知过的人保留标记",
+			save: mentions(2, 4, 5),
+		},
+		{
+			name:          "再次复审通过，只补发新 @ 的人",
+			wantMentioned: []int64{5},
+		},
+		{
+			name: "重复补发没有影响",
+		},
+	}
+	for _, step := range steps {
+		var err error
+		if step.save != nil {
+			err = svc.Save(ctx, "comment", 10, author, step.save, step.notify)
+		} else {
+			err = svc.NotifyPending(ctx, "comment", 10, author)
+		}
+		require.NoError(t, err, step.name)
+		assert.Equal(t, step.wantMentioned, producer.take(), step.name)
+	}
+}
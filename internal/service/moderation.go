@@ -0,0 +1,382 @@
+package service
+
+import (
+	"archi/internal/domain"
+	"archi/internal/event/article"
+	"archi/internal/event/feedevent"
+	"archi/internal/event/moderation"
+	"archi/internal/repository"
+	"archi/pkg/logger"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	regexp "github.com/dlclark/regexp2"
+)
+
+var (
+	// ErrContentBlocked 内容命中拦截规则，不允许发布
+	ErrContentBlocked = errors.New("内容包含违规信息")
+	// ErrModerationForbidden 非复审人员操作复审队列
+	ErrModerationForbidden = errors.New("没有复审权限")
+	// ErrModerationNotPending 审核记录不在待复审状态，可能已经被处理
+	ErrModerationNotPending = errors.New("审核记录不在待复审状态")
+)
+
+// ModerationRule 本地过滤规则，命中任意关键词或正则即给出 Verdict
+type ModerationRule struct {
+	Verdict  domain.ModerationVerdict
+	Reason   string
+	Keywords []string
+	Patterns []string
+}
+
+// ModerationFilter 本地关键词与正则过滤器，同步执行，只做快速的第一道筛选
+type ModerationFilter struct {
+	rules []compiledModerationRule
+}
+
+type compiledModerationRule struct {
+	ModerationRule
+	patterns []*regexp.Regexp
+}
+
+func NewModerationFilter(rules []ModerationRule) (*ModerationFilter, error) {
+	compiled := make([]compiledModerationRule, 0, len(rules))
+	for _, rule := range rules {
+		cr := compiledModerationRule{ModerationRule: rule}
+		cr.Keywords = make([]string, 0, len(rule.Keywords))
+		for _, kw := range rule.Keywords {
+			cr.Keywords = append(cr.Keywords, strings.ToLower(kw))
+		}
+		for _, p := range rule.Patterns {
+			re, err := regexp.Compile(p, regexp.IgnoreCase)
+			if err != nil {
+				return nil, fmt.Errorf("invalid moderation pattern %q: %w", p, err)
+			}
+			// 防止恶意构造的内容拖垮正则
+			re.MatchTimeout = time.Millisecond * 50
+			cr.patterns = append(cr.patterns, re)
+		}
+		compiled = append(compiled, cr)
+	}
+	return &ModerationFilter{rules: compiled}, nil
+}
+
+// Check 返回命中规则中最严重的结论以及全部命中原因
+func (f *ModerationFilter) Check(content string) (domain.ModerationVerdict, []string) {
+	verdict := domain.ModerationVerdictPass
+	var reasons []string
+	lower := strings.ToLower(content)
+	for _, rule := range f.rules {
+		hit := ""
+		for _, kw := range rule.Keywords {
+			if kw != "" && strings.Contains(lower, kw) {
+				hit = kw
+				break
+			}
+		}
+		if hit == "" {
+			for _, re := range rule.patterns {
+				// 超时的情况按未命中处理，交给大模型兜底
+				if ok, _ := re.MatchString(content); ok {
+					hit = re.String()
+					break
+				}
+			}
+		}
+		if hit == "" {
+			continue
+		}
+		reasons = append(reasons, fmt.Sprintf("%s: %s", rule.Reason, hit))
+		if rule.Verdict > verdict {
+			verdict = rule.Verdict
+		}
+	}
+	return verdict, reasons
+}
+
+// ModerationReviewers 拥有复审权限的用户
+type ModerationReviewers []int64
+
+type ModerationService interface {
+	// PreCheck 同步执行本地关键词与正则过滤
+	PreCheck(ctx context.Context, content string) (domain.ModerationVerdict, []string)
+	// Submit 保存本地审核结果，并异步投递给大模型复核
+	// 已经在复审队列里面或者被人工驳回的，保留原来的状态，不会被新的机审结果覆盖
+	Submit(ctx context.Context, m domain.Moderation) error
+	// Status 业务对象当前的审核状态，没有审核记录时返回 ModerationStatusUnknown
+	Status(ctx context.Context, biz string, bizId int64) (domain.ModerationStatus, error)
+	// ApplyVerdict 回写大模型的审核结论，命中时进入人工复审队列
+	ApplyVerdict(ctx context.Context, biz string, bizId int64, verdict domain.ModerationVerdict, reasons []string) error
+	// ListPending 复审队列，按进入队列的时间先后排序
+	ListPending(ctx context.Context, reviewer int64, offset, limit int) ([]domain.Moderation, error)
+	// Review 人工复审，通过或驳回
+	Review(ctx context.Context, reviewer int64, id int64, approve bool) error
+}
+
+type DefaultModerationService struct {
+	repo        repository.ModerationRepository
+	artRepo     repository.ArticleRepository
+	commentRepo repository.CommentRepository
+	mentionSvc  MentionService
+	artProducer article.Producer
+	// feedProducer 补发待复审回复的通知
+	feedProducer feedevent.Producer
+	producer     moderation.Producer
+	filter       *ModerationFilter
+	reviewers    map[int64]struct{}
+	l            logger.Logger
+}
+
+func NewDefaultModerationService(repo repository.ModerationRepository, artRepo repository.ArticleRepository,
+	commentRepo repository.CommentRepository, mentionSvc MentionService, artProducer article.Producer,
+	feedProducer feedevent.Producer, producer moderation.Producer,
+	filter *ModerationFilter, reviewers ModerationReviewers, l logger.Logger) ModerationService {
+	rs := make(map[int64]struct{}, len(reviewers))
+	for _, uid := range reviewers {
+		rs[uid] = struct{}{}
+	}
+	return &DefaultModerationService{
+		repo:         repo,
+		artRepo:      artRepo,
+		commentRepo:  commentRepo,
+		mentionSvc:   mentionSvc,
+		artProducer:  artProducer,
+		feedProducer: feedProducer,
+		producer:     producer,
+		filter:       filter,
+		reviewers:    rs,
+		l:            l,
+	}
+}
+
+func (svc *DefaultModerationService) PreCheck(ctx context.Context, content string) (domain.ModerationVerdict, []string) {
+	return svc.filter.Check(content)
+}
+
+func (svc *DefaultModerationService) Submit(ctx context.Context, m domain.Moderation) error {
+	m.Source = domain.ModerationSourceLocal
+	m.Status = domain.ModerationStatusPassed
+	if m.Verdict == domain.ModerationVerdictReview {
+		m.Status = domain.ModerationStatusPending
+	}
+	old, err := svc.repo.FindByBiz(ctx, m.Biz, m.BizId)
+	switch {
+	case err == nil:
+		if old.Status == domain.ModerationStatusPending || old.Status == domain.ModerationStatusRejected {
+			// 重新发表不能绕过人工复审，只更新内容快照
+			m.Status = old.Status
+			m.Source = old.Source
+			m.Reviewer = old.Reviewer
+			m.Verdict = max(m.Verdict, old.Verdict)
+			m.Reasons = mergeReasons(old.Reasons, m.Reasons)
+		}
+	case !errors.Is(err, repository.ErrModerationNotFound):
+		return err
+	}
+	if err = svc.repo.Save(ctx, m); err != nil {
+		return err
+	}
+	// 异步交给大模型复核，发送失败不影响发布
+	go func() {
+		er := svc.producer.ProduceModerationEvent(moderation.Event{
+			Biz:     m.Biz,
+			BizId:   m.BizId,
+			Uid:     m.Uid,
+			Content: m.Content,
+		})
+		if er != nil {
+			svc.l.Error("发送内容审核事件失败",
+				logger.String("biz", m.Biz),
+				logger.Int64("biz_id", m.BizId),
+				logger.Error(er))
+		}
+	}()
+	return nil
+}
+
+// mergeReasons 合并命中原因，去掉重复的
+func mergeReasons(old, reasons []string) []string {
+	res := make([]string, 0, len(old)+len(reasons))
+	seen := make(map[string]struct{}, len(old)+len(reasons))
+	for _, r := range append(old, reasons...) {
+		if _, ok := seen[r]; ok {
+			continue
+		}
+		seen[r] = struct{}{}
+		res = append(res, r)
+	}
+	return res
+}
+
+func (svc *DefaultModerationService) Status(ctx context.Context, biz string, bizId int64) (domain.ModerationStatus, error) {
+	m, err := svc.repo.FindByBiz(ctx, biz, bizId)
+	if errors.Is(err, repository.ErrModerationNotFound) {
+		return domain.ModerationStatusUnknown, nil
+	}
+	if err != nil {
+		return domain.ModerationStatusUnknown, err
+	}
+	return m.Status, nil
+}
+
+func (svc *DefaultModerationService) ApplyVerdict(ctx context.Context, biz string, bizId int64,
+	verdict domain.ModerationVerdict, reasons []string) error {
+	m, err := svc.repo.FindByBiz(ctx, biz, bizId)
+	if err != nil {
+		return err
+	}
+	// 已经人工处理过的，以人工结论为准
+	if m.Status == domain.ModerationStatusApproved || m.Status == domain.ModerationStatusRejected {
+		return nil
+	}
+	// 大模型只会升级结论，不会把本地命中的内容放行
+	if verdict <= domain.ModerationVerdictPass {
+		return nil
+	}
+	if verdict > m.Verdict {
+		m.Verdict = verdict
+	}
+	m.Reasons = append(m.Reasons, reasons...)
+	m.Source = domain.ModerationSourceLLM
+	m.Status = domain.ModerationStatusPending
+	if err = svc.repo.Save(ctx, m); err != nil {
+		return err
+	}
+	if biz == "comment" {
+		// 评论先隐藏，复审通过之后再展示
+		return svc.commentRepo.SetPendingReview(ctx, bizId, true)
+	}
+	if biz != "article" {
+		return nil
+	}
+	// 已发表的文章先下线，等待人工复审
+	art, err := svc.artRepo.GetById(ctx, bizId)
+	if err != nil {
+		return err
+	}
+	if art.Status != domain.ArticleStatusPublished {
+		return nil
+	}
+	return svc.syncArticleStatus(ctx, art, domain.ArticleStatusPendingReview)
+}
+
+func (svc *DefaultModerationService) ListPending(ctx context.Context, reviewer int64, offset, limit int) ([]domain.Moderation, error) {
+	if !svc.isReviewer(reviewer) {
+		return nil, ErrModerationForbidden
+	}
+	return svc.repo.FindByStatus(ctx, domain.ModerationStatusPending, offset, limit)
+}
+
+func (svc *DefaultModerationService) Review(ctx context.Context, reviewer int64, id int64, approve bool) error {
+	if !svc.isReviewer(reviewer) {
+		return ErrModerationForbidden
+	}
+	m, err := svc.repo.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	to := domain.ModerationStatusRejected
+	if approve {
+		to = domain.ModerationStatusApproved
+	}
+	ok, err := svc.repo.UpdateStatus(ctx, id, domain.ModerationStatusPending, to, reviewer)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrModerationNotPending
+	}
+	switch m.Biz {
+	case "article":
+		art, err := svc.artRepo.GetById(ctx, m.BizId)
+		if err != nil {
+			return err
+		}
+		if !approve {
+			return svc.syncArticleStatus(ctx, art, domain.ArticleStatusRejected)
+		}
+		if err = svc.syncArticleStatus(ctx, art, domain.ArticleStatusPublished); err != nil {
+			return err
+		}
+		svc.notifyPendingMentions(ctx, m.Biz, m.BizId, art.Author.ID)
+		return nil
+	case "comment":
+		if !approve {
+			// 驳回的评论只保留墓碑，不影响下面的回复
+			return svc.commentRepo.SoftDelete(ctx, m.BizId)
+		}
+		if err = svc.commentRepo.SetPendingReview(ctx, m.BizId, false); err != nil {
+			return err
+		}
+		svc.notifyApprovedComment(ctx, m.BizId)
+		return nil
+	}
+	return nil
+}
+
+// notifyPendingMentions 复审通过之后补发待复审期间没有发出的 @ 通知，失败只记录日志
+func (svc *DefaultModerationService) notifyPendingMentions(ctx context.Context, biz string, bizId, author int64) {
+	if err := svc.mentionSvc.NotifyPending(ctx, biz, bizId, author); err != nil {
+		svc.l.Error("补发提及通知失败",
+			logger.String("biz", biz),
+			logger.Int64("biz_id", bizId),
+			logger.Error(err))
+	}
+}
+
+// notifyApprovedComment 复审通过的评论补发 @ 通知，如果是回复，并且发表的时候就在待复审状态，补发回复通知
+func (svc *DefaultModerationService) notifyApprovedComment(ctx context.Context, cid int64) {
+	cs, err := svc.commentRepo.GetCommentByIds(ctx, []int64{cid})
+	if err != nil || len(cs) == 0 {
+		svc.l.Error("查询复审通过的评论失败", logger.Int64("cid", cid), logger.Error(err))
+		return
+	}
+	cm := cs[0]
+	svc.notifyPendingMentions(ctx, "comment", cid, cm.Commentator.ID)
+	if cm.ParentComment == nil {
+		return
+	}
+	// 发表之后才被大模型送去复审的回复，发表的时候已经通知过了
+	ok, err := svc.commentRepo.MarkReplyNotified(ctx, cid)
+	if err != nil || !ok {
+		if err != nil {
+			svc.l.Error("标记回复通知失败", logger.Int64("cid", cid), logger.Error(err))
+		}
+		return
+	}
+	parents, err := svc.commentRepo.GetCommentByIds(ctx, []int64{cm.ParentComment.Id})
+	if err != nil || len(parents) == 0 {
+		svc.l.Error("查询被回复的评论失败", logger.Int64("cid", cid), logger.Error(err))
+		return
+	}
+	if replied := parents[0].Commentator.ID; replied != cm.Commentator.ID {
+		go produceCommentReplyEvent(svc.feedProducer, svc.l, cid, cm, replied)
+	}
+}
+
+// syncArticleStatus 修改文章状态，并同步到搜索
+func (svc *DefaultModerationService) syncArticleStatus(ctx context.Context, art domain.Article, status domain.ArticleStatus) error {
+	if err := svc.artRepo.SyncStatus(ctx, art.Author.ID, art.ID, status); err != nil {
+		return err
+	}
+	art.Status = status
+	go func() {
+		pctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		if er := svc.artProducer.ProduceSyncEvent(pctx, art); er != nil {
+			svc.l.Error("发送文章同步事件失败",
+				logger.Int64("aid", art.ID),
+				logger.Error(er))
+		}
+	}()
+	return nil
+}
+
+func (svc *DefaultModerationService) isReviewer(uid int64) bool {
+	_, ok := svc.reviewers[uid]
+	return ok
+}
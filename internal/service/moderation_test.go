@@ -0,0 +1,159 @@
+package service
+
+import (
+	"archi/internal/domain"
+	"archi/internal/event/feedevent"
+	"archi/internal/repository"
+	"archi/pkg/logger"
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeModerationRepo 只有一条待复审的记录
+type fakeModerationRepo struct {
+	repository.ModerationRepository
+	m domain.Moderation
+}
+
+func (r *fakeModerationRepo) FindById(ctx context.Context, id int64) (domain.Moderation, error) {
+	return r.m, nil
+}
+
+func (r *fakeModerationRepo) UpdateStatus(ctx context.Context, id int64, from, to domain.ModerationStatus, reviewer int64) (bool, error) {
+	if r.m.Status != from {
+		return false, nil
+	}
+	r.m.Status = to
+	return true, nil
+}
+
+// recordMentionService 记录补发 @ 通知的内容
+type recordMentionService struct {
+	MentionService
+	pending []int64
+}
+
+func (s *recordMentionService) NotifyPending(ctx context.Context, biz string, bizId, author int64) error {
+	s.pending = append(s.pending, bizId)
+	return nil
+}
+
+// fakeFeedProducer 事件是异步发送的，每个事件按 cid->replied 记录，只关心条数的时候看长度就行
+type fakeFeedProducer struct {
+	mu      sync.Mutex
+	replies []string
+}
+
+func (p *fakeFeedProducer) ProduceFeedEvent(evt feedevent.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.replies = append(p.replies, evt.Ext["cid"]+"->"+evt.Ext["replied"])
+	return nil
+}
+
+func (p *fakeFeedProducer) sent() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.replies)
+}
+
+func TestDefaultModerationService_ReviewComment(t *testing.T) {
+	const reviewer = int64(99)
+	parent := testComment(1, domain.CommentStatusNormal, time.Now())
+	parent.Commentator.ID = testOther
+	reply := func(id int64, commentator int64) domain.Comment {
+		cm := testComment(id, domain.CommentStatusPendingReview, time.Now())
+		cm.Commentator.ID = commentator
+		cm.ParentComment = &domain.Comment{Id: parent.Id}
+		cm.RootComment = &domain.Comment{Id: parent.Id}
+		return cm
+	}
+	testCases := []struct {
+		name    string
+		comment domain.Comment
+		// notified 发表的时候是否已经通知过被回复的人
+		notified    bool
+		approve     bool
+		wantStatus  domain.CommentStatus
+		wantPending []int64
+		wantReplies []string
+	}{
+		{
+			name:        "发表时待复审的回复，通过之后补发回复和 @ 通知",
+			comment:     reply(2, testCommentator),
+			approve:     true,
+			wantStatus:  domain.CommentStatusNormal,
+			wantPending: []int64{2},
+			wantReplies: []string{"2->3"},
+		},
+		{
+			name:        "发表之后才进入复审的回复，不重复通知被回复的人",
+			comment:     reply(2, testCommentator),
+			notified:    true,
+			approve:     true,
+			wantStatus:  domain.CommentStatusNormal,
+			wantPending: []int64{2},
+		},
+		{
+			name:        "回复自己不通知",
+			comment:     reply(2, testOther),
+			approve:     true,
+			wantStatus:  domain.CommentStatusNormal,
+			wantPending: []int64{2},
+		},
+		{
+			name:        "一级评论只补发 @ 通知",
+			comment:     testComment(2, domain.CommentStatusPendingReview, time.Now()),
+			approve:     true,
+			wantStatus:  domain.CommentStatusNormal,
+			wantPending: []int64{2},
+		},
+		{
+			name:    "驳回不通知",
+			comment: reply(2, testCommentator),
+			// 驳回之后 fakeCommentRepo 只记录删除，状态不变
+			wantStatus: domain.CommentStatusPendingReview,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			commentRepo := &fakeCommentRepo{
+				comments:      map[int64]domain.Comment{parent.Id: parent, tc.comment.Id: tc.comment},
+				replyNotified: map[int64]bool{tc.comment.Id: tc.notified},
+			}
+			mentionSvc := &recordMentionService{}
+			producer := &fakeFeedProducer{}
+			modRepo := &fakeModerationRepo{m: domain.Moderation{
+				ID:     1,
+				Biz:    "comment",
+				BizId:  tc.comment.Id,
+				Status: domain.ModerationStatusPending,
+			}}
+			svc := NewDefaultModerationService(modRepo, nil, commentRepo, mentionSvc, nil, producer, nil,
+				nil, ModerationReviewers{reviewer}, logger.NewNopLogger())
+
+			require.NoError(t, svc.Review(context.Background(), reviewer, 1, tc.approve))
+			assert.Equal(t, tc.wantStatus, commentRepo.comments[tc.comment.Id].Status)
+			assert.Equal(t, tc.wantPending, mentionSvc.pending)
+			if len(tc.wantReplies) > 0 {
+				assert.Eventually(t, func() bool {
+					return len(producer.sent()) == len(tc.wantReplies)
+				}, time.Second, time.Millisecond*10)
+			} else {
+				time.Sleep(time.Millisecond * 20)
+			}
+			assert.Equal(t, tc.wantReplies, producer.sent())
+
+			// 重复复审会被拒绝，不会再通知一次
+			err := svc.Review(context.Background(), reviewer, 1, tc.approve)
+			assert.ErrorIs(t, err, ErrModerationNotPending)
+			assert.Equal(t, tc.wantPending, mentionSvc.pending)
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"archi/internal/domain"
+	"archi/internal/repository"
+	"archi/pkg/logger"
+	"context"
+	"slices"
+	"sync"
+)
+
+var ErrNotificationNotFound = repository.ErrNotificationNotFound
+
+type NotificationService interface {
+	// Notify 合并一次事件并推给在线的客户端，接收人对该类型开启了免打扰时直接丢弃
+	Notify(ctx context.Context, n domain.Notification, actor int64) error
+	// List 按最近更新时间倒序，会补全触发人的昵称和头像
+	List(ctx context.Context, uid int64, offset, limit int) ([]domain.Notification, error)
+	UnreadCounts(ctx context.Context, uid int64) (map[domain.NotificationType]int64, error)
+	MarkRead(ctx context.Context, uid, id int64) error
+	MarkAllRead(ctx context.Context, uid int64) error
+	MutedTypes(ctx context.Context, uid int64) ([]domain.NotificationType, error)
+	SetMuted(ctx context.Context, uid int64, typ domain.NotificationType, muted bool) error
+	// Subscribe 订阅 uid 的新通知，ctx 取消之后 channel 会被关闭
+	Subscribe(ctx context.Context, uid int64) (<-chan domain.Notification, error)
+}
+
+type DefaultNotificationService struct {
+	repo     repository.NotificationRepository
+	userRepo repository.UserRepository
+	hub      *notificationHub
+	l        logger.Logger
+}
+
+func NewDefaultNotificationService(repo repository.NotificationRepository,
+	userRepo repository.UserRepository, l logger.Logger) NotificationService {
+	return &DefaultNotificationService{
+		repo:     repo,
+		userRepo: userRepo,
+		hub:      newNotificationHub(repo, l),
+		l:        l,
+	}
+}
+
+func (svc *DefaultNotificationService) Notify(ctx context.Context, n domain.Notification, actor int64) error {
+	// 自己触发的不通知
+	if n.Uid == 0 || n.Uid == actor {
+		return nil
+	}
+	muted, err := svc.repo.MutedTypes(ctx, n.Uid)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(muted, n.Type) {
+		return nil
+	}
+	res, err := svc.repo.Merge(ctx, n, actor)
+	if err != nil {
+		return err
+	}
+	svc.fillActors(ctx, []domain.Notification{res})
+	// 推送失败不影响通知落库，客户端下次拉取的时候就能看到
+	if er := svc.repo.Publish(ctx, res); er != nil {
+		svc.l.Error("推送通知失败", logger.Int64("uid", n.Uid), logger.Error(er))
+	}
+	return nil
+}
+
+func (svc *DefaultNotificationService) List(ctx context.Context, uid int64, offset, limit int) ([]domain.Notification, error) {
+	ns, err := svc.repo.List(ctx, uid, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	svc.fillActors(ctx, ns)
+	return ns, nil
+}
+
+// fillActors 批量补全触发人的昵称和头像，查询失败的时候只返回 id
+func (svc *DefaultNotificationService) fillActors(ctx context.Context, ns []domain.Notification) {
+	var uids []int64
+	for _, n := range ns {
+		for _, a := range n.Actors {
+			uids = append(uids, a.ID)
+		}
+	}
+	users, err := svc.userRepo.FindByIds(ctx, uids)
+	if err != nil {
+		svc.l.Error("查询通知触发人失败", logger.Error(err))
+		return
+	}
+	userMap := make(map[int64]domain.User, len(users))
+	for _, u := range users {
+		userMap[u.ID] = u
+	}
+	for i := range ns {
+		for j, a := range ns[i].Actors {
+			u := userMap[a.ID]
+			ns[i].Actors[j].Nickname = u.Nickname
+			ns[i].Actors[j].Avatar = u.Avatar
+		}
+	}
+}
+
+func (svc *DefaultNotificationService) UnreadCounts(ctx context.Context, uid int64) (map[domain.NotificationType]int64, error) {
+	return svc.repo.UnreadCounts(ctx, uid)
+}
+
+func (svc *DefaultNotificationService) MarkRead(ctx context.Context, uid, id int64) error {
+	return svc.repo.MarkRead(ctx, uid, id)
+}
+
+func (svc *DefaultNotificationService) MarkAllRead(ctx context.Context, uid int64) error {
+	return svc.repo.MarkAllRead(ctx, uid)
+}
+
+func (svc *DefaultNotificationService) MutedTypes(ctx context.Context, uid int64) ([]domain.NotificationType, error) {
+	return svc.repo.MutedTypes(ctx, uid)
+}
+
+func (svc *DefaultNotificationService) SetMuted(ctx context.Context, uid int64, typ domain.NotificationType, muted bool) error {
+	return svc.repo.SetMuted(ctx, uid, typ, muted)
+}
+
+func (svc *DefaultNotificationService) Subscribe(ctx context.Context, uid int64) (<-chan domain.Notification, error) {
+	return svc.hub.subscribe(ctx, uid)
+}
+
+// notificationHub 每个实例只订阅一次 Redis，再按 uid 分发给本实例上的长连接
+type notificationHub struct {
+	repo repository.NotificationRepository
+	l    logger.Logger
+
+	mu      sync.Mutex
+	started bool
+	subs    map[int64]map[chan domain.Notification]struct{}
+}
+
+func newNotificationHub(repo repository.NotificationRepository, l logger.Logger) *notificationHub {
+	return &notificationHub{
+		repo: repo,
+		l:    l,
+		subs: make(map[int64]map[chan domain.Notification]struct{}),
+	}
+}
+
+func (h *notificationHub) subscribe(ctx context.Context, uid int64) (<-chan domain.Notification, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// 第一个客户端连上来的时候才开始订阅
+	if !h.started {
+		ch, err := h.repo.Subscribe(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		h.started = true
+		go h.dispatch(ch)
+	}
+	ch := make(chan domain.Notification, 16)
+	if h.subs[uid] == nil {
+		h.subs[uid] = make(map[chan domain.Notification]struct{})
+	}
+	h.subs[uid][ch] = struct{}{}
+	go func() {
+		<-ctx.Done()
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs[uid], ch)
+		if len(h.subs[uid]) == 0 {
+			delete(h.subs, uid)
+		}
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (h *notificationHub) dispatch(ch <-chan domain.Notification) {
+	for n := range ch {
+		h.mu.Lock()
+		for sub := range h.subs[n.Uid] {
+			select {
+			case sub <- n:
+			default:
+				// 客户端消费太慢直接丢掉，重新拉取未读数就能补上
+			}
+		}
+		h.mu.Unlock()
+	}
+	// 订阅断开，下一个客户端连上来的时候重新订阅
+	h.mu.Lock()
+	h.started = false
+	h.mu.Unlock()
+	h.l.Warn("通知订阅已断开")
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"archi/internal/domain"
+	"archi/internal/repository"
+	"archi/pkg/logger"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNotificationRepo 只实现了 Subscribe，通过 ch 模拟 Redis 推过来的通知
+type fakeNotificationRepo struct {
+	repository.NotificationRepository
+	ch chan domain.Notification
+}
+
+func (r *fakeNotificationRepo) Subscribe(ctx context.Context) (<-chan domain.Notification, error) {
+	return r.ch, nil
+}
+
+func (h *notificationHub) subCnt(uid int64) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs[uid])
+}
+
+func TestNotificationHub_Subscribe(t *testing.T) {
+	repo := &fakeNotificationRepo{ch: make(chan domain.Notification)}
+	hub := newNotificationHub(repo, logger.NewNopLogger())
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	ch1, err := hub.subscribe(ctx1, 123)
+	require.NoError(t, err)
+	ch2, err := hub.subscribe(ctx2, 123)
+	require.NoError(t, err)
+	assert.Equal(t, 2, hub.subCnt(123))
+
+	repo.ch <- domain.Notification{Uid: 123}
+	repo.ch <- domain.Notification{Uid: 456}
+	assert.Equal(t, int64(123), (<-ch1).Uid)
+	assert.Equal(t, int64(123), (<-ch2).Uid)
+
+	// 一个连接断开，只移除它自己的订阅
+	cancel1()
+	_, ok := <-ch1
+	assert.False(t, ok)
+	assert.Equal(t, 1, hub.subCnt(123))
+
+	cancel2()
+	_, ok = <-ch2
+	assert.False(t, ok)
+	assert.Eventually(t, func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		_, ok := hub.subs[123]
+		return !ok
+	}, time.Second, time.Millisecond*10)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"archi/internal/domain"
+	"archi/internal/event/feedevent"
 	"archi/internal/repository"
 	"archi/internal/service/payment/wechat"
 	"archi/pkg/logger"
@@ -22,10 +23,22 @@ type RewardService interface {
 	UpdateReward(ctx context.Context, bizTradeNO string, status domain.RewardStatus) error
 }
 type WechatNativeRewardService struct {
-	rewardRepo repository.RewardRepository
-	l          logger.Logger
-	paymentSvc wechat.PaymentService
-	accountSvc AccountService
+	rewardRepo   repository.RewardRepository
+	l            logger.Logger
+	paymentSvc   wechat.PaymentService
+	accountSvc   AccountService
+	feedProducer feedevent.Producer
+}
+
+func NewWechatNativeRewardService(rewardRepo repository.RewardRepository, paymentSvc wechat.PaymentService,
+	accountSvc AccountService, feedProducer feedevent.Producer, l logger.Logger) RewardService {
+	return &WechatNativeRewardService{
+		rewardRepo:   rewardRepo,
+		l:            l,
+		paymentSvc:   paymentSvc,
+		accountSvc:   accountSvc,
+		feedProducer: feedProducer,
+	}
 }
 
 func (s *WechatNativeRewardService) PreReward(ctx context.Context, r domain.Reward) (domain.CodeURL, error) {
@@ -148,9 +161,30 @@ func (s *WechatNativeRewardService) UpdateReward(ctx context.Context, bizTradeNO
 			// 做好监控和告警，这里
 			return err
 		}
+		go s.produceRewardEvent(r)
 	}
 	return nil
 }
+
+// produceRewardEvent 入账成功之后通知被打赏的人
+func (s *WechatNativeRewardService) produceRewardEvent(r domain.Reward) {
+	err := s.feedProducer.ProduceFeedEvent(feedevent.Event{
+		Type: feedevent.TypeReward,
+		Ext: map[string]string{
+			"rid":    strconv.FormatInt(r.ID, 10),
+			"uid":    strconv.FormatInt(r.Uid, 10),
+			"target": strconv.FormatInt(r.Target.Uid, 10),
+			"biz":    r.Target.Biz,
+			"bizId":  strconv.FormatInt(r.Target.BizID, 10),
+			"amt":    strconv.FormatInt(r.Amt, 10),
+		},
+	})
+	if err != nil {
+		s.l.Error("发送打赏 feed 事件失败",
+			logger.Int64("rid", r.ID),
+			logger.Error(err))
+	}
+}
 func (s *WechatNativeRewardService) toRid(tradeNO string) int64 {
 	ridStr := strings.Split(tradeNO, "-")
 	val, _ := strconv.ParseInt(ridStr[1], 10, 64)
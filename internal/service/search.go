@@ -2,23 +2,29 @@ package service
 
 import (
 	"archi/internal/domain"
+	"archi/internal/repository"
 	"archi/internal/repository/search"
 	"context"
+	"github.com/ecodeclub/ekit/slice"
 	"golang.org/x/sync/errgroup"
 	"strings"
 )
 
 type SearchService interface {
 	Search(ctx context.Context, uid int64, expression string) (domain.SearchResult, error)
+	// SuggestUsers 按昵称前缀补全用户，用于 @ 提示，uid 拉黑和静音的用户不会出现
+	SuggestUsers(ctx context.Context, uid int64, prefix string, limit int) ([]domain.UserES, error)
 }
 
 type DefaultSearchService struct {
 	userRepo    search.UserRepository
 	articleRepo search.ArticleRepository
+	blockRepo   repository.BlockRepository
 }
 
-func NewDefaultSearchService(userRepo search.UserRepository, articleRepo search.ArticleRepository) SearchService {
-	return &DefaultSearchService{userRepo: userRepo, articleRepo: articleRepo}
+func NewDefaultSearchService(userRepo search.UserRepository, articleRepo search.ArticleRepository,
+	blockRepo repository.BlockRepository) SearchService {
+	return &DefaultSearchService{userRepo: userRepo, articleRepo: articleRepo, blockRepo: blockRepo}
 }
 
 func (s *DefaultSearchService) Search(ctx context.Context, uid int64, expression string) (domain.SearchResult, error) {
@@ -40,5 +46,54 @@ func (s *DefaultSearchService) Search(ctx context.Context, uid int64, expression
 		res.Articles = arts
 		return err
 	})
-	return res, eg.Wait()
+	var hidden map[int64]struct{}
+	eg.Go(func() error {
+		var err error
+		hidden, err = s.hiddenSet(ctx, uid)
+		return err
+	})
+	if err := eg.Wait(); err != nil {
+		return res, err
+	}
+	// 拉黑和静音的用户以及他们的文章都不出现在搜索结果里面
+	res.Users = slice.FilterMap(res.Users, func(idx int, src domain.UserES) (domain.UserES, bool) {
+		_, ok := hidden[src.Id]
+		return src, !ok
+	})
+	res.Articles = slice.FilterMap(res.Articles, func(idx int, src domain.ArticleES) (domain.ArticleES, bool) {
+		_, ok := hidden[src.AuthorId]
+		return src, !ok
+	})
+	return res, nil
+}
+
+func (s *DefaultSearchService) hiddenSet(ctx context.Context, uid int64) (map[int64]struct{}, error) {
+	uids, err := s.blockRepo.HiddenUids(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]struct{}, len(uids))
+	for _, id := range uids {
+		res[id] = struct{}{}
+	}
+	return res, nil
+}
+
+func (s *DefaultSearchService) SuggestUsers(ctx context.Context, uid int64, prefix string, limit int) ([]domain.UserES, error) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		return []domain.UserES{}, nil
+	}
+	users, err := s.userRepo.SuggestUser(ctx, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	hidden, err := s.hiddenSet(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return slice.FilterMap(users, func(idx int, src domain.UserES) (domain.UserES, bool) {
+		_, ok := hidden[src.Id]
+		return src, !ok
+	}), nil
 }
@@ -28,7 +28,8 @@ func (s *Service) Send(ctx context.Context, tplId string, args []string, numbers
 	req := dysmsapi.CreateSendSmsRequest()
 	req.Scheme = "https"                          // 使用 HTTPS 协议
 	req.PhoneNumbers = strings.Join(numbers, ",") // 阿里云多个手机号为字符串逗号间隔
-	req.SignName = s.signName                     //设置短信签名
+	//设置短信签名，模板指定了签名的时候使用模板的
+	req.SignName = sms.SignatureFromContext(ctx, s.signName)
 	// 传的是 JSON
 	argsMap := make(map[string]string, len(args))
 	for idx, arg := range args {
@@ -0,0 +1,44 @@
+package async
+
+import (
+	"archi/internal/service/sms"
+	"time"
+)
+
+// AsyncDecider 根据服务商最近一段时间的表现，判断要不要转异步发送
+// 任意一个 AsyncDecider 认为需要，就会转异步
+type AsyncDecider interface {
+	NeedAsync(stats sms.WindowStats) bool
+	// Recovered 异步期间的探测请求是否说明服务商已经恢复，请求数是否足够由调用方判断
+	Recovered(stats sms.WindowStats) bool
+}
+
+// ResponseTimeDecider 窗口内的平均响应时间超过阈值就转异步
+type ResponseTimeDecider struct {
+	Threshold time.Duration
+	// MinRequests 请求太少的时候不做判断，避免一两个慢请求就触发
+	MinRequests int64
+}
+
+func (d ResponseTimeDecider) NeedAsync(stats sms.WindowStats) bool {
+	return stats.Total >= d.MinRequests && stats.AvgLatency() > d.Threshold
+}
+
+func (d ResponseTimeDecider) Recovered(stats sms.WindowStats) bool {
+	return stats.AvgLatency() <= d.Threshold
+}
+
+// ErrorRateDecider 窗口内的错误率超过阈值就转异步
+type ErrorRateDecider struct {
+	// Threshold 0 到 1 之间
+	Threshold   float64
+	MinRequests int64
+}
+
+func (d ErrorRateDecider) NeedAsync(stats sms.WindowStats) bool {
+	return stats.Total >= d.MinRequests && stats.ErrorRate() > d.Threshold
+}
+
+func (d ErrorRateDecider) Recovered(stats sms.WindowStats) bool {
+	return stats.ErrorRate() <= d.Threshold
+}
@@ -6,108 +6,332 @@ import (
 	"archi/internal/service/sms"
 	"archi/pkg/logger"
 	"context"
-	"errors"
+	"math/rand/v2"
+	"sync"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+// Config 同步转异步的策略
+type Config struct {
+	// Deciders 任意一个认为服务商不健康就转异步
+	Deciders []AsyncDecider
+	// Window 统计最近多长时间内的同步发送，分成 Buckets 个桶滑动
+	Window  time.Duration
+	Buckets int
+	// AsyncDuration 转异步之后至少保持多久，到期时服务商还不健康就再延长一段
+	AsyncDuration time.Duration
+	// ProbePercent 异步期间保留多少比例的请求继续同步发送，用来探测服务商是否恢复，0 到 100
+	ProbePercent float64
+	// RecoverMinRequests 退出异步之前，这一轮异步期间至少要有这么多探测请求
+	// 到期的时候探测请求不够，之后的请求都作为探测请求同步发送，直到够了为止，流量很小的时候也能退出异步
+	RecoverMinRequests int64
+	// Clock 为 nil 时使用系统时间
+	Clock sms.Clock
+	// Rand 返回 [0, 1) 的随机数，决定是否作为探测请求，为 nil 时使用 rand.Float64
+	Rand func() float64
+	// Gauge 导出当前的模式，1 为异步，0 为同步，为 nil 时不导出
+	Gauge prometheus.Gauge
+
+	Worker WorkerConfig
+}
+
+// WorkerConfig 异步发送的 worker 配置
+type WorkerConfig struct {
+	// Concurrency 同时发送的 worker 数量
+	Concurrency int
+	// BatchSize 每次从数据库抢占多少条
+	BatchSize int
+	// PollInterval 没有可以发送的短信时，隔多久再去抢占
+	PollInterval time.Duration
+	// Lease 抢占之后多久之内不会被别的实例重复抢占，要比 SendTimeout 长
+	Lease time.Duration
+	// SendTimeout 单条短信的发送超时
+	SendTimeout time.Duration
+	// MarkTimeout 发送之后更新数据库状态的超时，和发送的超时分开计算
+	MarkTimeout time.Duration
+	// RetryMax 转异步的短信最多发送几次，超过之后进入死信
+	RetryMax int
+	// BackoffBase 第一次失败之后等待的时间，之后每失败一次翻倍，最多等待 BackoffMax
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+}
+
 type Service struct {
 	smsSvc sms.Service
 	// 转异步，存储发短信请求的 repository
 	repo repository.AsyncSMSRepository
 	l    logger.Logger
+
+	deciders []AsyncDecider
+	// window 只统计同步发送和探测请求，worker 的发送不计入，否则会影响什么时候退出异步
+	window             *sms.SlidingWindow
+	asyncDuration      time.Duration
+	probeRatio         float64
+	recoverMinRequests int64
+	clock              sms.Clock
+	rand               func() float64
+	gauge              prometheus.Gauge
+	worker             WorkerConfig
+
+	mu sync.Mutex
+	// asyncUntil 异步模式持续到什么时候，零值表示同步模式
+	asyncUntil time.Time
+	// probes 这一轮异步期间全部探测请求的统计，不受滑动窗口长度的限制，进入或者延长异步的时候清零
+	probes sms.WindowStats
 }
 
-func NewService(smsSvc sms.Service, repo repository.AsyncSMSRepository, l logger.Logger) *Service {
+func NewService(smsSvc sms.Service, repo repository.AsyncSMSRepository, l logger.Logger, cfg Config) *Service {
 	res := &Service{
-		smsSvc: smsSvc,
-		repo:   repo,
-		l:      l,
+		smsSvc:             smsSvc,
+		repo:               repo,
+		l:                  l,
+		deciders:           cfg.Deciders,
+		window:             sms.NewSlidingWindow(cfg.Window, cfg.Buckets),
+		asyncDuration:      cfg.AsyncDuration,
+		probeRatio:         cfg.ProbePercent / 100,
+		recoverMinRequests: cfg.RecoverMinRequests,
+		clock:              cfg.Clock,
+		rand:               cfg.Rand,
+		gauge:              cfg.Gauge,
+		worker:             cfg.Worker,
+	}
+	if res.clock == nil {
+		res.clock = sms.SystemClock{}
+	}
+	if res.rand == nil {
+		res.rand = rand.Float64
+	}
+	// 没有 worker 的话 dispatch 会一直阻塞
+	res.worker.Concurrency = max(res.worker.Concurrency, 1)
+	if res.worker.MarkTimeout <= 0 {
+		res.worker.MarkTimeout = time.Second
+	}
+	if res.gauge != nil {
+		res.gauge.Set(0)
 	}
-	go func() {
-		res.StartAsyncCycle()
-	}()
 	return res
 }
 
-// StartAsyncCycle 异步发送消息
-// 这里我们没有设计退出机制，是因为没啥必要
-// 因为程序停止的时候，它自然就停止了
-// 原理：这是最简单的抢占式调度
-func (s *Service) StartAsyncCycle() {
-	// 这个是我为了测试而引入的，防止你在运行测试的时候，会出现偶发性的失败
-	time.Sleep(time.Second * 3)
-	for {
-		s.AsyncSend()
-	}
-}
-
-func (s *Service) AsyncSend() {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-	// 抢占一个异步发送的消息，确保在非常多个实例
-	// 比如 k8s 部署了三个 pod，一个请求，只有一个实例能拿到
-	as, err := s.repo.PreemptWaitingSMS(ctx)
-	switch {
-	case err == nil:
-		// 执行发送
-		// 这个也可以做成配置的
-		ctx, cancel = context.WithTimeout(context.Background(), time.Second)
-		defer cancel()
-		err = s.smsSvc.Send(ctx, as.TplId, as.Args, as.Numbers...)
+// Run 启动 Concurrency 个 worker 发送转异步的短信，阻塞到 ctx 被取消
+// ctx 取消之后不再抢占新的短信，等正在发送的短信处理完再返回
+// 已经抢占但还没来得及发送的短信，租约到期之后会被重新抢占
+func (s *Service) Run(ctx context.Context) {
+	tasks := make(chan domain.AsyncSMS)
+	var wg sync.WaitGroup
+	for i := 0; i < s.worker.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for as := range tasks {
+				s.handle(as)
+			}
+		}()
+	}
+	s.dispatch(ctx, tasks)
+	close(tasks)
+	wg.Wait()
+}
+
+// dispatch 批量抢占到期的短信，分发给 worker
+// 原理：这是最简单的抢占式调度，多个实例通过数据库的行锁和租约保证一条短信同一时刻只会被一个实例发送
+func (s *Service) dispatch(ctx context.Context, tasks chan<- domain.AsyncSMS) {
+	for ctx.Err() == nil {
+		pctx, cancel := context.WithTimeout(ctx, time.Second)
+		batch, err := s.repo.PreemptBatch(pctx, s.worker.BatchSize, s.worker.Lease)
+		cancel()
 		if err != nil {
-			// 啥也不需要干
-			s.l.Error("执行异步发送短信失败",
-				logger.Error(err),
-				logger.Int64("id", as.ID))
+			// 正常来说应该是数据库那边出了问题，稍微睡眠可以规避掉短时间的网络抖动
+			s.l.Error("抢占异步发送短信任务失败", logger.Error(err))
+			sleep(ctx, s.worker.PollInterval)
+			continue
 		}
-		res := err == nil
-		// 通知 repository 我这一次的执行结果
-		err = s.repo.ReportScheduleResult(ctx, as.ID, res)
-		if err != nil {
+		if len(batch) == 0 {
+			sleep(ctx, s.worker.PollInterval)
+			continue
+		}
+		for _, as := range batch {
+			select {
+			case tasks <- as:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// handle 发送一条短信，并记录结果
+// 这里不使用 Run 的 ctx，避免退出的时候把正在发送的短信打断
+func (s *Service) handle(as domain.AsyncSMS) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.worker.SendTimeout)
+	err := s.smsSvc.Send(ctx, as.TplId, as.Args, as.Numbers...)
+	cancel()
+	// 发送超时的时候 ctx 已经过期了，标记状态要用新的 ctx，否则永远标记不成功
+	mctx, mcancel := context.WithTimeout(context.Background(), s.worker.MarkTimeout)
+	defer mcancel()
+	if err == nil {
+		if er := s.repo.MarkSuccess(mctx, as.ID); er != nil {
 			s.l.Error("执行异步发送短信成功，但是标记数据库失败",
-				logger.Error(err),
-				logger.Bool("res", res),
+				logger.Error(er),
 				logger.Int64("id", as.ID))
 		}
-	case errors.Is(err, repository.ErrWaitingSMSNotFound):
-		// 睡一秒。这个你可以自己决定
-		time.Sleep(time.Second)
-	default:
-		// 正常来说应该是数据库那边出了问题，
-		// 但是为了尽量运行，还是要继续的
-		// 你可以稍微睡眠，也可以不睡眠
-		// 睡眠的话可以帮你规避掉短时间的网络抖动问题
-		s.l.Error("抢占异步发送短信任务失败", logger.Error(err))
-		time.Sleep(time.Second)
+		return
+	}
+	if as.RetryCnt >= as.RetryMax {
+		s.l.Error("异步发送短信失败，重试次数用完，进入死信",
+			logger.Error(err),
+			logger.Int64("id", as.ID),
+			logger.Int("retry_cnt", as.RetryCnt))
+		if er := s.repo.MarkDead(mctx, as.ID, err.Error()); er != nil {
+			s.l.Error("标记短信死信失败", logger.Error(er), logger.Int64("id", as.ID))
+		}
+		return
+	}
+	next := s.clock.Now().Add(s.backoff(as.RetryCnt))
+	s.l.Warn("执行异步发送短信失败，等待重试",
+		logger.Error(err),
+		logger.Int64("id", as.ID),
+		logger.Int("retry_cnt", as.RetryCnt),
+		logger.String("next_retry_at", next.Format(time.DateTime)))
+	if er := s.repo.MarkRetry(mctx, as.ID, next, err.Error()); er != nil {
+		// 标记失败也没关系，租约到期之后还是会重试
+		s.l.Error("标记短信重试失败", logger.Error(er), logger.Int64("id", as.ID))
+	}
+}
+
+// backoff 第 retryCnt 次失败之后等待的时间，指数增长，最多 BackoffMax
+func (s *Service) backoff(retryCnt int) time.Duration {
+	d := s.worker.BackoffBase
+	for i := 1; i < retryCnt && d < s.worker.BackoffMax; i++ {
+		d *= 2
+	}
+	return min(d, s.worker.BackoffMax)
+}
+
+// sleep 睡眠 d，ctx 取消时提前返回
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
 	}
 }
 
 func (s *Service) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
-	if s.needAsync() {
+	async, probe := s.decide()
+	if async {
 		// 需要异步发送，直接转储到数据库
 		err := s.repo.Add(ctx, domain.AsyncSMS{
-			TplId:   tplId,
-			Args:    args,
-			Numbers: numbers,
-			// 设置可以重试三次
-			RetryMax: 3,
+			TplId:    tplId,
+			Args:     args,
+			Numbers:  numbers,
+			RetryMax: s.worker.RetryMax,
 		})
 		return err
 	}
-	return s.smsSvc.Send(ctx, tplId, args, numbers...)
+	return s.send(ctx, probe, tplId, args, numbers...)
+}
+
+// send 同步调用服务商，并记录到滑动窗口里面，探测请求还会记录到这一轮异步的统计里面
+func (s *Service) send(ctx context.Context, probe bool, tplId string, args []string, numbers ...string) error {
+	start := s.clock.Now()
+	err := s.smsSvc.Send(ctx, tplId, args, numbers...)
+	now := s.clock.Now()
+	s.window.Record(now, now.Sub(start), err)
+	if probe {
+		s.mu.Lock()
+		s.probes.Total++
+		s.probes.Latency += now.Sub(start)
+		if err != nil {
+			s.probes.Failed++
+		}
+		s.mu.Unlock()
+	}
+	return err
 }
 
-// 提前引导你们，开始思考系统容错问题
-// 你们面试装逼，赢得竞争优势就靠这一类的东西
+// needAsync 这一次是不是转储到数据库
 func (s *Service) needAsync() bool {
-	// 这边就是你要设计的，各种判定要不要触发异步的方案
-	// 1. 基于响应时间的，平均响应时间
-	// 1.1 使用绝对阈值，比如说直接发送的时候，（连续一段时间，或者连续N个请求）响应时间超过了 500ms，然后后续请求转异步
-	// 1.2 变化趋势，比如说当前一秒钟内的所有请求的响应时间比上一秒钟增长了 X%，就转异步
-	// 2. 基于错误率：一段时间内，收到 err 的请求比率大于 X%，转异步
-
-	// 什么时候退出异步
-	// 1. 进入异步 N 分钟后
-	// 2. 保留 1% 的流量（或者更少），继续同步发送，判定响应时间/错误率
+	async, _ := s.decide()
+	return async
+}
+
+// decide 判断这一次要不要转异步，probe 表示异步期间同步发送的探测请求
+// 进入异步：任意一个 AsyncDecider 根据滑动窗口的统计认为服务商不健康
+// 退出异步：异步持续 AsyncDuration 之后，这一轮的探测请求足够多并且全部 AsyncDecider 都认为服务商已经恢复
+func (s *Service) decide() (async bool, probe bool) {
+	now := s.clock.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.asyncUntil.IsZero() {
+		if !s.unhealthy(now) {
+			return false, false
+		}
+		s.extendAsync(now)
+		s.setAsyncMode(true)
+		s.l.Warn("短信服务商不健康，转异步发送", logger.Any("stats", s.window.Stats(now)))
+		return true, false
+	}
+	if now.Before(s.asyncUntil) {
+		probe = s.probe()
+		return !probe, probe
+	}
+	if s.probes.Total < s.recoverMinRequests {
+		// 流量太小，按比例探测凑不够请求数，到期之后每个请求都作为探测请求
+		return false, true
+	}
+	if !s.recovered() {
+		s.extendAsync(now)
+		s.l.Warn("短信服务商仍未恢复，继续异步发送", logger.Any("probes", s.probes))
+		probe = s.probe()
+		return !probe, probe
+	}
+	s.asyncUntil = time.Time{}
+	s.setAsyncMode(false)
+	s.l.Info("短信服务商已恢复，转回同步发送", logger.Any("probes", s.probes))
+	return false, false
+}
+
+// extendAsync 开始新的一轮异步，重新统计探测请求
+func (s *Service) extendAsync(now time.Time) {
+	s.asyncUntil = now.Add(s.asyncDuration)
+	s.probes = sms.WindowStats{}
+}
+
+// recovered 这一轮的探测请求是否说明服务商已经恢复
+func (s *Service) recovered() bool {
+	for _, d := range s.deciders {
+		if !d.Recovered(s.probes) {
+			return false
+		}
+	}
 	return true
 }
+
+func (s *Service) unhealthy(now time.Time) bool {
+	stats := s.window.Stats(now)
+	for _, d := range s.deciders {
+		if d.NeedAsync(stats) {
+			return true
+		}
+	}
+	return false
+}
+
+// probe 异步期间按比例放一部分请求同步发送，它们的结果决定什么时候退出异步
+func (s *Service) probe() bool {
+	return s.rand() < s.probeRatio
+}
+
+func (s *Service) setAsyncMode(async bool) {
+	if s.gauge == nil {
+		return
+	}
+	if async {
+		s.gauge.Set(1)
+	} else {
+		s.gauge.Set(0)
+	}
+}
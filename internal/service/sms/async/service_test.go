@@ -0,0 +1,389 @@
+package async
+
+import (
+	"archi/internal/domain"
+	"archi/internal/repository"
+	repomocks "archi/internal/repository/mocks"
+	"archi/pkg/logger"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+var errProvider = errors.New("服务商错误")
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// fakeProvider 每次发送推进 latency，返回 err，block 为 true 时一直等到 ctx 过期
+type fakeProvider struct {
+	clock   *fakeClock
+	latency time.Duration
+	err     error
+	block   bool
+	calls   int
+}
+
+func (p *fakeProvider) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
+	p.calls++
+	if p.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	p.clock.Add(p.latency)
+	return p.err
+}
+
+// fakeRand 决定是不是探测请求，小于 ProbePercent 的时候是探测请求
+type fakeRand struct {
+	val float64
+}
+
+func (r *fakeRand) Float64() float64 {
+	return r.val
+}
+
+const (
+	randProbe   = 0.05
+	randNoProbe = 0.99
+)
+
+func newTestService(repo repository.AsyncSMSRepository, provider *fakeProvider, clock *fakeClock, rnd *fakeRand) *Service {
+	return NewService(provider, repo, logger.NewNopLogger(), Config{
+		Deciders: []AsyncDecider{
+			ResponseTimeDecider{Threshold: time.Millisecond * 500, MinRequests: 4},
+			ErrorRateDecider{Threshold: 0.5, MinRequests: 4},
+		},
+		Window:             time.Minute,
+		Buckets:            6,
+		AsyncDuration:      time.Minute * 5,
+		ProbePercent:       10,
+		RecoverMinRequests: 4,
+		Clock:              clock,
+		Rand:               rnd.Float64,
+		Worker: WorkerConfig{
+			SendTimeout: time.Millisecond * 50,
+			MarkTimeout: time.Second,
+			RetryMax:    3,
+			BackoffBase: time.Second * 10,
+			BackoffMax:  time.Minute,
+		},
+	})
+}
+
+func send(svc *Service) error {
+	return svc.Send(context.Background(), "tpl", []string{"123456"}, "15212345678")
+}
+
+func TestService_EnterAsync(t *testing.T) {
+	testCases := []struct {
+		name    string
+		latency time.Duration
+		err     error
+		// warmup 转异步之前的同步发送次数
+		warmup    int
+		wantAsync bool
+	}{
+		{
+			name:      "响应时间过长",
+			latency:   time.Millisecond * 600,
+			warmup:    4,
+			wantAsync: true,
+		},
+		{
+			name:      "错误率过高",
+			latency:   time.Millisecond * 10,
+			err:       errProvider,
+			warmup:    4,
+			wantAsync: true,
+		},
+		{
+			name:    "请求数不够",
+			latency: time.Millisecond * 600,
+			err:     errProvider,
+			warmup:  3,
+		},
+		{
+			name:    "服务商健康",
+			latency: time.Millisecond * 100,
+			warmup:  10,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := repomocks.NewMockAsyncSMSRepository(ctrl)
+			clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+			provider := &fakeProvider{clock: clock, latency: tc.latency, err: tc.err}
+			svc := newTestService(repo, provider, clock, &fakeRand{val: randNoProbe})
+			for i := 0; i < tc.warmup; i++ {
+				_ = send(svc)
+			}
+
+			wantCalls := tc.warmup + 1
+			if tc.wantAsync {
+				wantCalls = tc.warmup
+				repo.EXPECT().Add(gomock.Any(), domain.AsyncSMS{
+					TplId:    "tpl",
+					Args:     []string{"123456"},
+					Numbers:  []string{"15212345678"},
+					RetryMax: 3,
+				}).Return(nil)
+			}
+			_ = send(svc)
+			assert.Equal(t, wantCalls, provider.calls)
+		})
+	}
+}
+
+// enterAsync 连续失败，让 svc 进入异步模式
+func enterAsync(t *testing.T, svc *Service, provider *fakeProvider) {
+	provider.err = errProvider
+	for i := 0; i < 4; i++ {
+		_ = send(svc)
+	}
+	provider.err = nil
+	assert.True(t, svc.needAsync())
+}
+
+func TestService_Probe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := repomocks.NewMockAsyncSMSRepository(ctrl)
+	clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+	provider := &fakeProvider{clock: clock, latency: time.Millisecond * 10}
+	rnd := &fakeRand{val: randNoProbe}
+	svc := newTestService(repo, provider, clock, rnd)
+	enterAsync(t, svc, provider)
+
+	// 探测请求继续同步发送
+	rnd.val = randProbe
+	calls := provider.calls
+	assert.NoError(t, send(svc))
+	assert.Equal(t, calls+1, provider.calls)
+
+	// 其它请求转储到数据库
+	rnd.val = randNoProbe
+	repo.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil)
+	assert.NoError(t, send(svc))
+	assert.Equal(t, calls+1, provider.calls)
+}
+
+func TestService_Recover(t *testing.T) {
+	testCases := []struct {
+		name string
+		// probes 异步快结束的时候发送的探测请求数量
+		probes   int
+		probeErr error
+		// wantAsync, wantProbe AsyncDuration 到期之后的第一个请求
+		wantAsync bool
+		wantProbe bool
+	}{
+		{
+			name:   "探测请求健康",
+			probes: 4,
+		},
+		{
+			name:      "探测请求不够",
+			probes:    2,
+			wantProbe: true,
+		},
+		{
+			name:      "探测请求仍然失败",
+			probes:    4,
+			probeErr:  errProvider,
+			wantAsync: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := repomocks.NewMockAsyncSMSRepository(ctrl)
+			repo.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+			clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+			provider := &fakeProvider{clock: clock, latency: time.Millisecond * 10}
+			rnd := &fakeRand{val: randNoProbe}
+			svc := newTestService(repo, provider, clock, rnd)
+			enterAsync(t, svc, provider)
+			asyncAt := clock.Now()
+
+			clock.now = asyncAt.Add(time.Minute*5 - time.Second*30)
+			provider.err = tc.probeErr
+			rnd.val = randProbe
+			for i := 0; i < tc.probes; i++ {
+				_ = send(svc)
+			}
+
+			// 到期之前一直是异步
+			rnd.val = randNoProbe
+			clock.now = asyncAt.Add(time.Minute*5 - time.Millisecond)
+			assert.True(t, svc.needAsync())
+
+			clock.now = asyncAt.Add(time.Minute * 5)
+			async, probe := svc.decide()
+			assert.Equal(t, tc.wantAsync, async)
+			assert.Equal(t, tc.wantProbe, probe)
+			if tc.wantAsync {
+				// 延长一个 AsyncDuration
+				clock.now = asyncAt.Add(time.Minute*10 - time.Second)
+				assert.True(t, svc.needAsync())
+			}
+		})
+	}
+}
+
+// TestService_RecoverLowTraffic 每分钟只有一条短信，滑动窗口里面永远凑不够请求数，依靠到期之后的探测请求退出异步
+func TestService_RecoverLowTraffic(t *testing.T) {
+	testCases := []struct {
+		name     string
+		probeErr error
+		// wantAsync 探测请求发完之后是不是继续异步
+		wantAsync bool
+	}{
+		{
+			name: "服务商已经恢复",
+		},
+		{
+			name:      "服务商仍未恢复",
+			probeErr:  errProvider,
+			wantAsync: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := repomocks.NewMockAsyncSMSRepository(ctrl)
+			clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+			provider := &fakeProvider{clock: clock, latency: time.Millisecond * 10}
+			svc := newTestService(repo, provider, clock, &fakeRand{val: randNoProbe})
+			enterAsync(t, svc, provider)
+			asyncAt := clock.Now()
+
+			// 异步期间没有命中按比例的探测，全部转储到数据库
+			repo.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil).Times(4)
+			for i := 1; i < 5; i++ {
+				clock.now = asyncAt.Add(time.Minute * time.Duration(i))
+				assert.NoError(t, send(svc))
+			}
+
+			// 到期之后的请求都作为探测请求同步发送，直到凑够 RecoverMinRequests
+			provider.err = tc.probeErr
+			calls := provider.calls
+			for i := 5; i < 9; i++ {
+				clock.now = asyncAt.Add(time.Minute * time.Duration(i))
+				assert.Equal(t, tc.probeErr, send(svc))
+			}
+			assert.Equal(t, calls+4, provider.calls)
+
+			clock.now = asyncAt.Add(time.Minute * 9)
+			assert.Equal(t, tc.wantAsync, svc.needAsync())
+			if tc.wantAsync {
+				// 重新开始一轮异步，到期之前不再强制探测
+				clock.now = asyncAt.Add(time.Minute*14 - time.Second)
+				assert.True(t, svc.needAsync())
+			}
+		})
+	}
+}
+
+func TestService_WorkerNotRecorded(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := repomocks.NewMockAsyncSMSRepository(ctrl)
+	clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+	provider := &fakeProvider{clock: clock, latency: time.Millisecond * 10, err: errProvider}
+	svc := newTestService(repo, provider, clock, &fakeRand{val: randNoProbe})
+
+	repo.EXPECT().MarkRetry(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(4)
+	for i := int64(1); i <= 4; i++ {
+		svc.handle(domain.AsyncSMS{ID: i, TplId: "tpl", RetryCnt: 1, RetryMax: 3})
+	}
+	// worker 的失败不会让同步发送转异步
+	assert.False(t, svc.needAsync())
+}
+
+func TestService_Handle(t *testing.T) {
+	testCases := []struct {
+		name   string
+		block  bool
+		err    error
+		as     domain.AsyncSMS
+		expect func(repo *repomocks.MockAsyncSMSRepository)
+	}{
+		{
+			name: "发送成功",
+			as:   domain.AsyncSMS{ID: 1, RetryCnt: 1, RetryMax: 3},
+			expect: func(repo *repomocks.MockAsyncSMSRepository) {
+				repo.EXPECT().MarkSuccess(liveCtx{}, int64(1)).Return(nil)
+			},
+		},
+		{
+			name:  "发送超时之后等待重试",
+			block: true,
+			as:    domain.AsyncSMS{ID: 2, RetryCnt: 2, RetryMax: 3},
+			expect: func(repo *repomocks.MockAsyncSMSRepository) {
+				next := time.UnixMilli(1_700_000_000_000).Add(time.Second * 20)
+				repo.EXPECT().MarkRetry(liveCtx{}, int64(2), next, context.DeadlineExceeded.Error()).Return(nil)
+			},
+		},
+		{
+			name:  "发送超时之后进入死信",
+			block: true,
+			as:    domain.AsyncSMS{ID: 3, RetryCnt: 3, RetryMax: 3},
+			expect: func(repo *repomocks.MockAsyncSMSRepository) {
+				repo.EXPECT().MarkDead(liveCtx{}, int64(3), context.DeadlineExceeded.Error()).Return(nil)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := repomocks.NewMockAsyncSMSRepository(ctrl)
+			tc.expect(repo)
+			clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+			provider := &fakeProvider{clock: clock, block: tc.block, err: tc.err}
+			svc := newTestService(repo, provider, clock, &fakeRand{val: randNoProbe})
+			svc.handle(tc.as)
+		})
+	}
+}
+
+// liveCtx 匹配还没有过期的 ctx，发送超时之后标记状态不能复用发送的 ctx
+type liveCtx struct{}
+
+func (liveCtx) Matches(x any) bool {
+	ctx, ok := x.(context.Context)
+	return ok && ctx.Err() == nil
+}
+
+func (liveCtx) String() string {
+	return "is a live context"
+}
+
+func TestService_Backoff(t *testing.T) {
+	testCases := []struct {
+		retryCnt int
+		want     time.Duration
+	}{
+		{retryCnt: 1, want: time.Second * 10},
+		{retryCnt: 2, want: time.Second * 20},
+		{retryCnt: 3, want: time.Second * 40},
+		{retryCnt: 4, want: time.Minute},
+		{retryCnt: 10, want: time.Minute},
+	}
+	svc := newTestService(nil, &fakeProvider{}, &fakeClock{}, &fakeRand{})
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, svc.backoff(tc.retryCnt), "retryCnt %d", tc.retryCnt)
+	}
+}
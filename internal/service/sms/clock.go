@@ -0,0 +1,15 @@
+package sms
+
+import "time"
+
+// Clock 获取当前时间，测试的时候可以换成假的时钟来推进时间
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock 使用系统时间
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,155 @@
+package failover
+
+import (
+	"archi/internal/service/sms"
+	"sync"
+	"time"
+)
+
+// BreakerState 熔断器的状态
+type BreakerState uint8
+
+const (
+	// BreakerClosed 正常放行，错误率过高时打开
+	BreakerClosed BreakerState = iota
+	// BreakerHalfOpen 打开一段时间之后，放行少量请求探测服务商是否恢复
+	BreakerHalfOpen
+	// BreakerOpen 不放行任何请求
+	BreakerOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+// BreakerConfig 熔断器以及健康分的配置
+type BreakerConfig struct {
+	// Window 统计最近多长时间内的请求，分成 Buckets 个桶滑动
+	Window  time.Duration
+	Buckets int
+	// MinRequests 窗口内请求数少于这个值时不打开熔断
+	MinRequests int64
+	// ErrorRate 错误率达到这个值时打开熔断
+	ErrorRate float64
+	// OpenDuration 打开之后多久进入半开
+	OpenDuration time.Duration
+	// HalfOpenProbes 半开时同时放行的探测请求数，连续成功这么多次之后关闭
+	HalfOpenProbes int
+	// LatencyWeight 和 ErrorWeight 是健康分里面响应时间与成功率的权重
+	LatencyWeight float64
+	ErrorWeight   float64
+	// LatencyBaseline 平均响应时间达到这个值时，响应时间部分的得分为 0
+	LatencyBaseline time.Duration
+}
+
+// breaker 单个服务商的熔断器
+type breaker struct {
+	cfg    BreakerConfig
+	mu     sync.Mutex
+	state  BreakerState
+	window *sms.SlidingWindow
+	// openUntil 打开状态持续到什么时候
+	openUntil time.Time
+	// probing 半开状态下正在进行的探测请求数
+	probing int
+	// probeSuccess 半开状态下连续成功的探测请求数
+	probeSuccess int
+}
+
+func newBreaker(cfg BreakerConfig) *breaker {
+	return &breaker{
+		cfg:    cfg,
+		window: sms.NewSlidingWindow(cfg.Window, cfg.Buckets),
+	}
+}
+
+// allow 判断这一次能不能使用这个服务商，返回 true 之后必须调用 record 或者 release
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		if now.Before(b.openUntil) {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = 0
+		b.probeSuccess = 0
+	}
+	if b.probing >= b.cfg.HalfOpenProbes {
+		return false
+	}
+	b.probing++
+	return true
+}
+
+// record 记录一次请求的结果，并推动状态变化
+func (b *breaker) record(now time.Time, latency time.Duration, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.window.Record(now, latency, err)
+	switch b.state {
+	case BreakerClosed:
+		stats := b.window.Stats(now)
+		if stats.Total >= b.cfg.MinRequests && stats.ErrorRate() >= b.cfg.ErrorRate {
+			b.open(now)
+		}
+	case BreakerHalfOpen:
+		b.probing--
+		if err != nil {
+			b.open(now)
+			return
+		}
+		b.probeSuccess++
+		if b.probeSuccess >= b.cfg.HalfOpenProbes {
+			// 关闭之后重新统计，避免打开之前的错误马上又把熔断打开
+			b.state = BreakerClosed
+			b.window = sms.NewSlidingWindow(b.cfg.Window, b.cfg.Buckets)
+		}
+	}
+}
+
+// release 放行之后没有真正发送，比如调用方取消了请求，不计入统计
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen {
+		b.probing--
+	}
+}
+
+func (b *breaker) open(now time.Time) {
+	b.state = BreakerOpen
+	b.openUntil = now.Add(b.cfg.OpenDuration)
+}
+
+// score 健康分，0 到 1，按权重综合成功率与响应时间，没有请求的时候为满分
+func (b *breaker) score(stats sms.WindowStats) float64 {
+	total := b.cfg.ErrorWeight + b.cfg.LatencyWeight
+	if stats.Total == 0 || total <= 0 {
+		return 1
+	}
+	latencyScore := 1.0
+	if b.cfg.LatencyBaseline > 0 {
+		latencyScore = max(0, 1-float64(stats.AvgLatency())/float64(b.cfg.LatencyBaseline))
+	}
+	return (b.cfg.ErrorWeight*(1-stats.ErrorRate()) + b.cfg.LatencyWeight*latencyScore) / total
+}
+
+// snapshot 当前的状态、窗口统计与健康分
+func (b *breaker) snapshot(now time.Time) (BreakerState, sms.WindowStats, float64, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := b.window.Stats(now)
+	return b.state, stats, b.score(stats), b.openUntil
+}
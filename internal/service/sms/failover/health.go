@@ -0,0 +1,142 @@
+package failover
+
+import (
+	"archi/internal/domain"
+	"archi/internal/service/sms"
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _ sms.Service = &HealthService{}
+
+// ErrNoAvailableProvider 全部服务商都处于熔断状态，或者都发送失败了
+var ErrNoAvailableProvider = errors.New("没有可用的短信服务商")
+
+// Provider 带名字的服务商，名字用于监控和管理接口
+type Provider struct {
+	Name string
+	Svc  sms.Service
+}
+
+// HealthService 每个服务商一个熔断器，每次发送按健康分从高到低挑选没有熔断的服务商
+// 和 TimeoutService 只看超时不同，这里任何错误都计入错误率，
+// 调用方自己取消的请求和 sms.ErrProviderConfig 这种配置错误除外
+type HealthService struct {
+	providers []Provider
+	breakers  []*breaker
+	clock     sms.Clock
+	// stateGauge 和 scoreGauge 以 provider 为标签导出状态与健康分，为 nil 时不导出
+	stateGauge *prometheus.GaugeVec
+	scoreGauge *prometheus.GaugeVec
+}
+
+// NewHealthService clock 为 nil 时使用系统时间
+func NewHealthService(providers []Provider, cfg BreakerConfig, clock sms.Clock,
+	stateGauge, scoreGauge *prometheus.GaugeVec) *HealthService {
+	if clock == nil {
+		clock = sms.SystemClock{}
+	}
+	res := &HealthService{
+		providers:  providers,
+		breakers:   make([]*breaker, 0, len(providers)),
+		clock:      clock,
+		stateGauge: stateGauge,
+		scoreGauge: scoreGauge,
+	}
+	now := clock.Now()
+	for i := range providers {
+		res.breakers = append(res.breakers, newBreaker(cfg))
+		res.report(i, now)
+	}
+	return res
+}
+
+func (h *HealthService) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
+	var lastErr error
+	for _, idx := range h.rank() {
+		b := h.breakers[idx]
+		start := h.clock.Now()
+		if !b.allow(start) {
+			continue
+		}
+		err := h.providers[idx].Svc.Send(ctx, tplId, args, numbers...)
+		now := h.clock.Now()
+		if err != nil && ctx.Err() != nil {
+			// 调用方取消或者超时，不是服务商的问题，也没有必要再换一个服务商
+			b.release()
+			return err
+		}
+		if errors.Is(err, sms.ErrProviderConfig) {
+			// 这个服务商没有配置好，换下一个，熔断器不记录
+			b.release()
+			lastErr = err
+			continue
+		}
+		b.record(now, now.Sub(start), err)
+		h.report(idx, now)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+	}
+	if lastErr != nil {
+		return errors.Join(ErrNoAvailableProvider, lastErr)
+	}
+	return ErrNoAvailableProvider
+}
+
+// States 全部服务商当前的状态，顺序和构造时传入的一致
+func (h *HealthService) States() []domain.SMSProviderState {
+	now := h.clock.Now()
+	res := make([]domain.SMSProviderState, 0, len(h.providers))
+	for i, p := range h.providers {
+		state, stats, score, openUntil := h.breakers[i].snapshot(now)
+		ps := domain.SMSProviderState{
+			Name:       p.Name,
+			State:      state.String(),
+			Score:      score,
+			Total:      stats.Total,
+			Failed:     stats.Failed,
+			ErrorRate:  stats.ErrorRate(),
+			AvgLatency: stats.AvgLatency(),
+		}
+		if state == BreakerOpen {
+			ps.OpenUntil = openUntil
+		}
+		res = append(res, ps)
+	}
+	return res
+}
+
+// rank 按健康分从高到低排列服务商下标，分数相同时保持原有顺序
+func (h *HealthService) rank() []int {
+	now := h.clock.Now()
+	scores := make([]float64, len(h.breakers))
+	idxs := make([]int, len(h.breakers))
+	for i, b := range h.breakers {
+		_, _, scores[i], _ = b.snapshot(now)
+		idxs[i] = i
+	}
+	sort.SliceStable(idxs, func(i, j int) bool {
+		return scores[idxs[i]] > scores[idxs[j]]
+	})
+	return idxs
+}
+
+func (h *HealthService) report(idx int, now time.Time) {
+	if h.stateGauge == nil && h.scoreGauge == nil {
+		return
+	}
+	state, _, score, _ := h.breakers[idx].snapshot(now)
+	name := h.providers[idx].Name
+	if h.stateGauge != nil {
+		h.stateGauge.WithLabelValues(name).Set(float64(state))
+	}
+	if h.scoreGauge != nil {
+		h.scoreGauge.WithLabelValues(name).Set(score)
+	}
+}
@@ -0,0 +1,311 @@
+package failover
+
+import (
+	"archi/internal/service/sms"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errProvider = errors.New("服务商错误")
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// scriptedProvider 按脚本依次返回错误，脚本用完之后一直成功，每次发送推进 latency
+type scriptedProvider struct {
+	clock   *fakeClock
+	latency time.Duration
+	errs    []error
+	calls   int
+}
+
+func (p *scriptedProvider) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
+	p.clock.Add(p.latency)
+	var err error
+	if p.calls < len(p.errs) {
+		err = p.errs[p.calls]
+	}
+	p.calls++
+	return err
+}
+
+func testBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		Window:          time.Minute,
+		Buckets:         6,
+		MinRequests:     4,
+		ErrorRate:       0.5,
+		OpenDuration:    time.Second * 10,
+		HalfOpenProbes:  2,
+		LatencyWeight:   0.3,
+		ErrorWeight:     0.7,
+		LatencyBaseline: time.Second,
+	}
+}
+
+func TestBreaker_Open(t *testing.T) {
+	testCases := []struct {
+		name      string
+		results   []error
+		wantState BreakerState
+	}{
+		{
+			name:      "请求数不够",
+			results:   []error{errProvider, errProvider, errProvider},
+			wantState: BreakerClosed,
+		},
+		{
+			name:      "错误率没有达到阈值",
+			results:   []error{nil, nil, nil, errProvider},
+			wantState: BreakerClosed,
+		},
+		{
+			name:      "错误率达到阈值",
+			results:   []error{nil, errProvider, nil, errProvider},
+			wantState: BreakerOpen,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.UnixMilli(1_700_000_000_000)
+			b := newBreaker(testBreakerConfig())
+			for _, err := range tc.results {
+				require.True(t, b.allow(now))
+				b.record(now, time.Millisecond*100, err)
+			}
+			state, _, _, _ := b.snapshot(now)
+			assert.Equal(t, tc.wantState, state)
+			assert.Equal(t, tc.wantState == BreakerClosed, b.allow(now))
+		})
+	}
+}
+
+func TestBreaker_HalfOpen(t *testing.T) {
+	testCases := []struct {
+		name string
+		// probes 半开之后探测请求的结果
+		probes    []error
+		wantState BreakerState
+	}{
+		{
+			name:      "探测全部成功",
+			probes:    []error{nil, nil},
+			wantState: BreakerClosed,
+		},
+		{
+			name:      "探测失败重新打开",
+			probes:    []error{nil, errProvider},
+			wantState: BreakerOpen,
+		},
+		{
+			name:      "第一个探测就失败",
+			probes:    []error{errProvider},
+			wantState: BreakerOpen,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testBreakerConfig()
+			now := time.UnixMilli(1_700_000_000_000)
+			b := newBreaker(cfg)
+			for i := 0; i < 4; i++ {
+				b.allow(now)
+				b.record(now, time.Millisecond, errProvider)
+			}
+
+			// 打开期间不放行
+			assert.False(t, b.allow(now.Add(cfg.OpenDuration-time.Millisecond)))
+			now = now.Add(cfg.OpenDuration)
+			// 半开之后最多同时放行 HalfOpenProbes 个请求
+			for i := 0; i < cfg.HalfOpenProbes; i++ {
+				require.True(t, b.allow(now))
+			}
+			assert.False(t, b.allow(now))
+			state, _, _, _ := b.snapshot(now)
+			assert.Equal(t, BreakerHalfOpen, state)
+
+			for _, err := range tc.probes {
+				b.record(now, time.Millisecond, err)
+			}
+			state, stats, _, _ := b.snapshot(now)
+			assert.Equal(t, tc.wantState, state)
+			if tc.wantState == BreakerClosed {
+				// 关闭之后重新统计
+				assert.Equal(t, int64(0), stats.Total)
+			}
+		})
+	}
+}
+
+func TestBreaker_Release(t *testing.T) {
+	cfg := testBreakerConfig()
+	now := time.UnixMilli(1_700_000_000_000)
+	b := newBreaker(cfg)
+	for i := 0; i < 4; i++ {
+		b.allow(now)
+		b.record(now, time.Millisecond, errProvider)
+	}
+	now = now.Add(cfg.OpenDuration)
+	for i := 0; i < cfg.HalfOpenProbes; i++ {
+		require.True(t, b.allow(now))
+	}
+	require.False(t, b.allow(now))
+	// 没有真正发送的探测请求要把名额还回去
+	b.release()
+	assert.True(t, b.allow(now))
+}
+
+func TestHealthService_Send(t *testing.T) {
+	testCases := []struct {
+		name string
+		// providers 每个服务商的脚本
+		providers []*scriptedProvider
+		// before 发送之前预置的历史请求，key 是服务商下标
+		before    map[int][]error
+		wantErr   error
+		wantCalls []int
+	}{
+		{
+			name: "分数相同按配置的顺序",
+			providers: []*scriptedProvider{
+				{latency: time.Millisecond * 100},
+				{latency: time.Millisecond * 100},
+			},
+			wantCalls: []int{1, 0},
+		},
+		{
+			name: "健康分高的优先",
+			providers: []*scriptedProvider{
+				{latency: time.Millisecond * 100},
+				{latency: time.Millisecond * 100},
+			},
+			before:    map[int][]error{0: {nil, nil, errProvider}},
+			wantCalls: []int{3, 1},
+		},
+		{
+			name: "响应时间影响健康分",
+			providers: []*scriptedProvider{
+				{latency: time.Millisecond * 900},
+				{latency: time.Millisecond * 100},
+			},
+			before:    map[int][]error{0: {nil}, 1: {nil}},
+			wantCalls: []int{1, 2},
+		},
+		{
+			name: "失败之后换下一个",
+			providers: []*scriptedProvider{
+				{latency: time.Millisecond * 100, errs: []error{errProvider}},
+				{latency: time.Millisecond * 100},
+			},
+			wantCalls: []int{1, 1},
+		},
+		{
+			name: "跳过熔断的服务商",
+			providers: []*scriptedProvider{
+				{latency: time.Millisecond * 100},
+				{latency: time.Millisecond * 100},
+			},
+			before:    map[int][]error{0: {errProvider, errProvider, errProvider, errProvider}},
+			wantCalls: []int{4, 1},
+		},
+		{
+			name: "全部失败",
+			providers: []*scriptedProvider{
+				{latency: time.Millisecond * 100, errs: []error{errProvider}},
+				{latency: time.Millisecond * 100, errs: []error{errProvider}},
+			},
+			wantErr:   ErrNoAvailableProvider,
+			wantCalls: []int{1, 1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+			providers := make([]Provider, 0, len(tc.providers))
+			for i, p := range tc.providers {
+				p.clock = clock
+				// 预置的历史请求也通过服务商发送，消耗脚本
+				p.errs = append(tc.before[i], p.errs...)
+				providers = append(providers, Provider{Name: string(rune('a' + i)), Svc: p})
+			}
+			svc := NewHealthService(providers, testBreakerConfig(), clock, nil, nil)
+			for i, errs := range tc.before {
+				for range errs {
+					b := svc.breakers[i]
+					b.allow(clock.Now())
+					start := clock.Now()
+					err := tc.providers[i].Send(context.Background(), "tpl", nil)
+					b.record(clock.Now(), clock.Now().Sub(start), err)
+				}
+			}
+
+			err := svc.Send(context.Background(), "tpl", []string{"123456"}, "15212345678")
+			assert.ErrorIs(t, err, tc.wantErr)
+			calls := make([]int, 0, len(tc.providers))
+			for _, p := range tc.providers {
+				calls = append(calls, p.calls)
+			}
+			assert.Equal(t, tc.wantCalls, calls)
+		})
+	}
+}
+
+func TestHealthService_SendCanceled(t *testing.T) {
+	clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+	p0 := &scriptedProvider{clock: clock, errs: []error{context.Canceled}}
+	p1 := &scriptedProvider{clock: clock}
+	svc := NewHealthService([]Provider{{Name: "a", Svc: p0}, {Name: "b", Svc: p1}},
+		testBreakerConfig(), clock, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := svc.Send(ctx, "tpl", nil, "15212345678")
+	assert.ErrorIs(t, err, context.Canceled)
+	// 调用方取消之后不再换服务商，也不计入错误率
+	assert.Equal(t, 0, p1.calls)
+	states := svc.States()
+	assert.Equal(t, int64(0), states[0].Total)
+}
+
+func TestHealthService_SendConfigError(t *testing.T) {
+	clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+	errConfig := fmt.Errorf("%w, 没有配置模板", sms.ErrProviderConfig)
+	p0 := &scriptedProvider{clock: clock, errs: []error{errConfig, errConfig, errConfig, errConfig, errConfig}}
+	p1 := &scriptedProvider{clock: clock}
+	svc := NewHealthService([]Provider{{Name: "a", Svc: p0}, {Name: "b", Svc: p1}},
+		testBreakerConfig(), clock, nil, nil)
+
+	for i := 0; i < 5; i++ {
+		err := svc.Send(context.Background(), "tpl", nil, "15212345678")
+		require.NoError(t, err)
+	}
+	// 配置错误每次都换下一个服务商，不计入错误率，也不会熔断
+	assert.Equal(t, 5, p0.calls)
+	assert.Equal(t, 5, p1.calls)
+	states := svc.States()
+	assert.Equal(t, BreakerClosed.String(), states[0].State)
+	assert.Equal(t, int64(0), states[0].Total)
+	assert.Equal(t, int64(5), states[1].Total)
+
+	// 全部服务商都没有配置好，返回配置错误
+	p1.errs = []error{nil, nil, nil, nil, nil, errConfig}
+	p0.errs = append(p0.errs, errConfig)
+	err := svc.Send(context.Background(), "tpl", nil, "15212345678")
+	assert.ErrorIs(t, err, ErrNoAvailableProvider)
+	assert.ErrorIs(t, err, sms.ErrProviderConfig)
+}
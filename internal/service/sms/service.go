@@ -1,6 +1,13 @@
 package sms
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// ErrProviderConfig 服务商的配置有问题，例如没有配置对应的模板，不是服务商本身的故障
+// failover 遇到它直接换下一个服务商，不计入熔断器
+var ErrProviderConfig = errors.New("短信服务商配置错误")
 
 //go:generate mockgen -source=./types.go -package=smsmocks -destination=./mocks/sms.mock.go Service
 type Service interface {
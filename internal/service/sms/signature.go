@@ -0,0 +1,18 @@
+package sms
+
+import "context"
+
+type signatureKey struct{}
+
+// WithSignature 指定这一次发送使用的短信签名，不同模板在不同服务商那里可能使用不同的签名
+func WithSignature(ctx context.Context, signature string) context.Context {
+	return context.WithValue(ctx, signatureKey{}, signature)
+}
+
+// SignatureFromContext 返回 WithSignature 指定的签名，没有指定时返回 def
+func SignatureFromContext(ctx context.Context, def string) string {
+	if s, ok := ctx.Value(signatureKey{}).(string); ok && s != "" {
+		return s
+	}
+	return def
+}
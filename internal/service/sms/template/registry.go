@@ -0,0 +1,95 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrTemplateNotFound 没有注册这个模板
+	ErrTemplateNotFound = errors.New("短信模板不存在")
+	// ErrProviderTemplateNotFound 模板没有在这个服务商那里配置
+	ErrProviderTemplateNotFound = errors.New("服务商没有配置这个短信模板")
+	// ErrInvalidArgs 参数和模板声明的参数对不上
+	ErrInvalidArgs = errors.New("短信模板参数不正确")
+)
+
+// ProviderTemplate 模板在某个服务商那里的 ID 和签名，签名为空时使用服务商的默认签名
+type ProviderTemplate struct {
+	Id        string
+	Signature string
+}
+
+// Template 逻辑模板，Biz 为空的是默认模板，不为空的只给这个业务使用
+type Template struct {
+	Name string
+	Biz  string
+	// Params 模板参数的名字，发送时按顺序传入同样数量的参数
+	Params []string
+	// Providers 服务商名字到服务商模板的映射
+	Providers map[string]ProviderTemplate
+}
+
+func (t Template) key() string {
+	if t.Biz == "" {
+		return t.Name
+	}
+	return t.Name + ":" + t.Biz
+}
+
+// Registry 逻辑模板到各个服务商模板的映射
+// 业务方只认识逻辑模板，真正发送的时候由 Service 换成实际发送的服务商的模板 ID
+type Registry struct {
+	templates map[string]Template
+}
+
+func NewRegistry(templates []Template) (*Registry, error) {
+	res := &Registry{templates: make(map[string]Template, len(templates))}
+	for _, t := range templates {
+		if t.Name == "" || strings.Contains(t.Name, ":") {
+			return nil, fmt.Errorf("短信模板名字 %q 不合法", t.Name)
+		}
+		key := t.key()
+		if _, ok := res.templates[key]; ok {
+			return nil, fmt.Errorf("短信模板 %s 重复注册", key)
+		}
+		res.templates[key] = t
+	}
+	return res, nil
+}
+
+// Resolve 找到业务使用的模板并校验参数，返回的 key 作为 sms.Service 的 tplId 传下去
+// 业务没有单独配置模板的时候使用默认模板
+func (r *Registry) Resolve(name, biz string, args []string) (string, error) {
+	t, ok := r.templates[Template{Name: name, Biz: biz}.key()]
+	if !ok {
+		t, ok = r.templates[name]
+	}
+	if !ok {
+		return "", fmt.Errorf("%w name: %s, biz: %s", ErrTemplateNotFound, name, biz)
+	}
+	if len(args) != len(t.Params) {
+		return "", fmt.Errorf("%w 模板 %s 需要 %d 个参数 %v，实际 %d 个",
+			ErrInvalidArgs, t.key(), len(t.Params), t.Params, len(args))
+	}
+	for i, arg := range args {
+		if arg == "" {
+			return "", fmt.Errorf("%w 模板 %s 的参数 %s 为空", ErrInvalidArgs, t.key(), t.Params[i])
+		}
+	}
+	return t.key(), nil
+}
+
+// Lookup 模板在服务商那里的 ID 和签名，key 是 Resolve 返回的值
+func (r *Registry) Lookup(key, provider string) (ProviderTemplate, error) {
+	t, ok := r.templates[key]
+	if !ok {
+		return ProviderTemplate{}, fmt.Errorf("%w key: %s", ErrTemplateNotFound, key)
+	}
+	pt, ok := t.Providers[provider]
+	if !ok {
+		return ProviderTemplate{}, fmt.Errorf("%w key: %s, provider: %s", ErrProviderTemplateNotFound, key, provider)
+	}
+	return pt, nil
+}
@@ -0,0 +1,37 @@
+package template
+
+import (
+	"archi/internal/service/sms"
+	"context"
+	"fmt"
+)
+
+var _ sms.Service = &Service{}
+
+// Service 装饰单个服务商，把逻辑模板换成这个服务商的模板 ID 和签名
+// 要放在 failover 里面每个服务商的外层，这样换了服务商之后使用的也是正确的模板
+type Service struct {
+	provider string
+	svc      sms.Service
+	registry *Registry
+}
+
+func NewService(provider string, svc sms.Service, registry *Registry) sms.Service {
+	return &Service{
+		provider: provider,
+		svc:      svc,
+		registry: registry,
+	}
+}
+
+func (s *Service) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
+	pt, err := s.registry.Lookup(tplId, s.provider)
+	if err != nil {
+		// 模板没配好是配置问题，不能算到服务商的错误率里面
+		return fmt.Errorf("%w, %w", sms.ErrProviderConfig, err)
+	}
+	if pt.Signature != "" {
+		ctx = sms.WithSignature(ctx, pt.Signature)
+	}
+	return s.svc.Send(ctx, pt.Id, args, numbers...)
+}
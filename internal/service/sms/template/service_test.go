@@ -0,0 +1,76 @@
+package template
+
+import (
+	"archi/internal/service/sms"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordProvider struct {
+	tplId     string
+	signature string
+}
+
+func (p *recordProvider) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
+	p.tplId = tplId
+	p.signature = sms.SignatureFromContext(ctx, "")
+	return nil
+}
+
+func TestService_Send(t *testing.T) {
+	registry, err := NewRegistry([]Template{
+		{
+			Name:   "login",
+			Params: []string{"code"},
+			Providers: map[string]ProviderTemplate{
+				"aliyun": {Id: "SMS_1", Signature: "archi"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	testCases := []struct {
+		name      string
+		provider  string
+		tplId     string
+		wantErr   error
+		wantTplId string
+		wantSign  string
+	}{
+		{
+			name:      "换成服务商的模板",
+			provider:  "aliyun",
+			tplId:     "login",
+			wantTplId: "SMS_1",
+			wantSign:  "archi",
+		},
+		{
+			name:     "服务商没有配置模板",
+			provider: "tencent",
+			tplId:    "login",
+			wantErr:  ErrProviderTemplateNotFound,
+		},
+		{
+			name:     "模板不存在",
+			provider: "aliyun",
+			tplId:    "register",
+			wantErr:  ErrTemplateNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &recordProvider{}
+			svc := NewService(tc.provider, p, registry)
+			err := svc.Send(context.Background(), tc.tplId, []string{"123456"}, "15212345678")
+			assert.ErrorIs(t, err, tc.wantErr)
+			if tc.wantErr != nil {
+				// 模板查找失败都是配置错误，failover 不会计入熔断
+				assert.ErrorIs(t, err, sms.ErrProviderConfig)
+			}
+			assert.Equal(t, tc.wantTplId, p.tplId)
+			assert.Equal(t, tc.wantSign, p.signature)
+		})
+	}
+}
@@ -29,7 +29,7 @@ func (s *Service) Send(ctx context.Context, tplId string, args []string, numbers
 	request := tencentsms.NewSendSmsRequest()
 	request.SetContext(ctx)
 	request.SmsSdkAppId = s.appID
-	request.SignName = s.signName
+	request.SignName = ekit.ToPtr[string](sms.SignatureFromContext(ctx, *s.signName))
 	request.TemplateId = ekit.ToPtr[string](tplId)
 	request.TemplateParamSet = s.toPtrSlice(args)
 	request.PhoneNumberSet = s.toPtrSlice(numbers)
@@ -0,0 +1,95 @@
+package sms
+
+import (
+	"sync"
+	"time"
+)
+
+// WindowStats 滑动窗口内的发送统计
+type WindowStats struct {
+	Total  int64
+	Failed int64
+	// Latency 全部请求的总耗时
+	Latency time.Duration
+}
+
+// ErrorRate 错误率，没有请求的时候为 0
+func (s WindowStats) ErrorRate() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Failed) / float64(s.Total)
+}
+
+// AvgLatency 平均响应时间，没有请求的时候为 0
+func (s WindowStats) AvgLatency() time.Duration {
+	if s.Total == 0 {
+		return 0
+	}
+	return s.Latency / time.Duration(s.Total)
+}
+
+func (s *WindowStats) add(o WindowStats) {
+	s.Total += o.Total
+	s.Failed += o.Failed
+	s.Latency += o.Latency
+}
+
+// SlidingWindow 按时间分桶的滑动窗口，过期的桶在下一次写入的时候复用
+type SlidingWindow struct {
+	mu      sync.Mutex
+	span    int64
+	buckets []windowBucket
+}
+
+type windowBucket struct {
+	// start 桶的起始时间，纳秒，和 span 对齐
+	start int64
+	stats WindowStats
+}
+
+// NewSlidingWindow window 是窗口总长度，分成 buckets 个桶
+func NewSlidingWindow(window time.Duration, buckets int) *SlidingWindow {
+	if buckets <= 0 {
+		buckets = 1
+	}
+	span := int64(window) / int64(buckets)
+	if span <= 0 {
+		span = 1
+	}
+	return &SlidingWindow{
+		span:    span,
+		buckets: make([]windowBucket, buckets),
+	}
+}
+
+func (w *SlidingWindow) Record(now time.Time, latency time.Duration, err error) {
+	start := now.UnixNano() / w.span * w.span
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	b := &w.buckets[(start/w.span)%int64(len(w.buckets))]
+	if b.start != start {
+		b.start = start
+		b.stats = WindowStats{}
+	}
+	b.stats.Total++
+	b.stats.Latency += latency
+	if err != nil {
+		b.stats.Failed++
+	}
+}
+
+// Stats 汇总 now 往前一个窗口内的统计
+func (w *SlidingWindow) Stats(now time.Time) WindowStats {
+	cur := now.UnixNano() / w.span * w.span
+	oldest := cur - w.span*int64(len(w.buckets)-1)
+	var res WindowStats
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, b := range w.buckets {
+		if b.start >= oldest && b.start <= cur {
+			res.add(b.stats)
+		}
+	}
+	return res
+}
@@ -0,0 +1,57 @@
+package sms
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// windowRecord 相对起始时间的偏移量以及是否失败
+type windowRecord struct {
+	offset time.Duration
+	failed bool
+}
+
+func TestSlidingWindow_Stats(t *testing.T) {
+	start := time.UnixMilli(1_700_000_000_000).Truncate(time.Second * 10)
+	testCases := []struct {
+		name    string
+		records []windowRecord
+		at      time.Duration
+		want    WindowStats
+	}{
+		{
+			name:    "窗口内的全部统计",
+			records: []windowRecord{{0, false}, {time.Second * 15, true}, {time.Second * 55, false}},
+			at:      time.Second * 59,
+			want:    WindowStats{Total: 3, Failed: 1, Latency: time.Millisecond * 300},
+		},
+		{
+			name:    "过期的桶不统计",
+			records: []windowRecord{{0, true}, {time.Second * 35, false}},
+			at:      time.Second * 65,
+			want:    WindowStats{Total: 1, Latency: time.Millisecond * 100},
+		},
+		{
+			name:    "过期的桶被复用",
+			records: []windowRecord{{0, true}, {time.Second * 60, false}},
+			at:      time.Second * 60,
+			want:    WindowStats{Total: 1, Latency: time.Millisecond * 100},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := NewSlidingWindow(time.Minute, 6)
+			for _, r := range tc.records {
+				var err error
+				if r.failed {
+					err = errors.New("mock error")
+				}
+				w.Record(start.Add(r.offset), time.Millisecond*100, err)
+			}
+			assert.Equal(t, tc.want, w.Stats(start.Add(tc.at)))
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"archi/internal/domain"
+	"archi/internal/repository"
+	"context"
+	"errors"
+)
+
+var (
+	// ErrSMSForbidden 非管理员操作短信死信
+	ErrSMSForbidden = errors.New("没有短信管理权限")
+	// ErrSMSNotDead 短信不在死信里面，可能已经被重新投递
+	ErrSMSNotDead = errors.New("短信不在死信中")
+)
+
+// SMSAdmins 可以查看和重新投递短信死信的用户
+type SMSAdmins []int64
+
+// SMSDeadLetterService 转异步之后重试次数用完的短信，由管理员检查之后重新投递
+type SMSDeadLetterService interface {
+	// ListDead 按 id 倒序分页，cursor 为 0 时从最新的开始
+	ListDead(ctx context.Context, operator int64, cursor int64, limit int) ([]domain.AsyncSMS, error)
+	// Requeue 重新投递，重试次数清零，马上可以被 worker 抢占
+	Requeue(ctx context.Context, operator int64, id int64) error
+}
+
+type DefaultSMSDeadLetterService struct {
+	repo   repository.AsyncSMSRepository
+	admins map[int64]struct{}
+}
+
+func NewDefaultSMSDeadLetterService(repo repository.AsyncSMSRepository, admins SMSAdmins) SMSDeadLetterService {
+	as := make(map[int64]struct{}, len(admins))
+	for _, uid := range admins {
+		as[uid] = struct{}{}
+	}
+	return &DefaultSMSDeadLetterService{
+		repo:   repo,
+		admins: as,
+	}
+}
+
+func (svc *DefaultSMSDeadLetterService) ListDead(ctx context.Context, operator int64, cursor int64, limit int) ([]domain.AsyncSMS, error) {
+	if !svc.isAdmin(operator) {
+		return nil, ErrSMSForbidden
+	}
+	return svc.repo.FindDead(ctx, cursor, limit)
+}
+
+func (svc *DefaultSMSDeadLetterService) Requeue(ctx context.Context, operator int64, id int64) error {
+	if !svc.isAdmin(operator) {
+		return ErrSMSForbidden
+	}
+	ok, err := svc.repo.Requeue(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrSMSNotDead
+	}
+	return nil
+}
+
+func (svc *DefaultSMSDeadLetterService) isAdmin(uid int64) bool {
+	_, ok := svc.admins[uid]
+	return ok
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"archi/internal/domain"
+	"context"
+)
+
+// SMSProviderReporter 提供短信服务商当前的熔断状态与健康分
+type SMSProviderReporter interface {
+	States() []domain.SMSProviderState
+}
+
+// SMSProviderService 管理员查看短信服务商的状态
+type SMSProviderService interface {
+	States(ctx context.Context, operator int64) ([]domain.SMSProviderState, error)
+}
+
+type DefaultSMSProviderService struct {
+	reporter SMSProviderReporter
+	admins   map[int64]struct{}
+}
+
+func NewDefaultSMSProviderService(reporter SMSProviderReporter, admins SMSAdmins) SMSProviderService {
+	as := make(map[int64]struct{}, len(admins))
+	for _, uid := range admins {
+		as[uid] = struct{}{}
+	}
+	return &DefaultSMSProviderService{
+		reporter: reporter,
+		admins:   as,
+	}
+}
+
+func (svc *DefaultSMSProviderService) States(ctx context.Context, operator int64) ([]domain.SMSProviderState, error) {
+	if _, ok := svc.admins[operator]; !ok {
+		return nil, ErrSMSForbidden
+	}
+	return svc.reporter.States(), nil
+}
@@ -10,6 +10,7 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
@@ -18,13 +19,22 @@ var (
 	ErrInvalidUserOrPassword = errors.New("用户不存在或者密码不对")
 )
 
+// dummyPasswordHash 账号不存在的时候也做一次 bcrypt 比较，避免通过响应时间判断账号是否存在
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
+
 //go:generate mockgen -source=./user.go -package=mocks -destination=./mocks/user.mock.go UserService
 type UserService interface {
 	Signup(ctx context.Context, user domain.User) error
-	Login(ctx context.Context, email string, password string) (domain.User, error)
+	// Login 密码登录，ip 用于按 IP 统计失败次数
+	Login(ctx context.Context, email string, password string, ip string) (domain.User, error)
 	UpdateAvatarPath(ctx context.Context, uid int64, newPath string) error
 	UpdateNonSensitiveInfo(ctx context.Context, user domain.User) error
 	FindById(ctx context.Context, uid int64) (domain.User, error)
+	// FindByIds 批量查询用户，用于渲染用户列表
+	FindByIds(ctx context.Context, uids []int64) ([]domain.User, error)
 	FindOrCreate(ctx context.Context, phone string) (domain.User, error)
 	FindOrCreateByWechat(ctx context.Context, wechatInfo domain.WechatInfo) (domain.User, error)
 }
@@ -33,13 +43,16 @@ type DefaultUserService struct {
 	l            logger.Logger
 	syncProducer user.Producer
 	repo         repository.UserRepository
+	guard        LoginGuardService
 }
 
-func NewUserService(log logger.Logger, repo repository.UserRepository, syncProducer user.Producer) UserService {
+func NewUserService(log logger.Logger, repo repository.UserRepository, syncProducer user.Producer,
+	guard LoginGuardService) UserService {
 	return &DefaultUserService{
 		l:            log,
 		syncProducer: syncProducer,
 		repo:         repo,
+		guard:        guard,
 	}
 }
 
@@ -65,9 +78,14 @@ func (svc *DefaultUserService) Signup(ctx context.Context, u domain.User) error
 	return er
 }
 
-func (svc *DefaultUserService) Login(ctx context.Context, email string, password string) (domain.User, error) {
+func (svc *DefaultUserService) Login(ctx context.Context, email string, password string, ip string) (domain.User, error) {
+	if err := svc.guard.Check(ctx, email, ip); err != nil {
+		return domain.User{}, err
+	}
 	u, err := svc.repo.FindByEmail(ctx, email)
 	if errors.Is(err, repository.ErrUserNotFound) {
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		svc.guard.Failed(ctx, email, ip, 0)
 		return domain.User{}, ErrInvalidUserOrPassword
 	}
 	if err != nil {
@@ -76,8 +94,10 @@ func (svc *DefaultUserService) Login(ctx context.Context, email string, password
 	// 检查密码对不对
 	err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	if err != nil {
+		svc.guard.Failed(ctx, email, ip, u.ID)
 		return domain.User{}, ErrInvalidUserOrPassword
 	}
+	svc.guard.Succeeded(ctx, email)
 	return u, nil
 }
 
@@ -125,6 +145,10 @@ func (svc *DefaultUserService) FindById(ctx context.Context, uid int64) (domain.
 	return svc.repo.FindById(ctx, uid)
 }
 
+func (svc *DefaultUserService) FindByIds(ctx context.Context, uids []int64) ([]domain.User, error) {
+	return svc.repo.FindByIds(ctx, uids)
+}
+
 func (svc *DefaultUserService) FindOrCreate(ctx context.Context, phone string) (domain.User, error) {
 	// 先找一下，我们认为，大部分用户是已经存在的用户
 	u, err := svc.repo.FindByPhone(ctx, phone)
@@ -8,6 +8,7 @@ import (
 	"archi/internal/web/middleware/jwt"
 	"archi/pkg/ginx"
 	"archi/pkg/logger"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -63,11 +64,13 @@ func (a *ArticleHandler) RegisterRoutes(e *gin.Engine) {
 	pub.POST("/collect", ginx.WrapBodyAndClaims(a.Collect))
 	//pub.POST("/reward", ginx.WrapBodyAndClaims(a.Reward))
 
-	pub.GET("/:id/ai-summary", ginx.Wrap(a.GetAiSummary))
-	pub.POST("/:id/ai-qa", a.AnswerQA)
+	pub.GET("/:id/ai-summary", ginx.WrapClaims(a.GetAiSummary))
+	pub.POST("/:id/ai-qa", ginx.WrapStreamBodyAndClaims(a.AnswerQA))
 
 	// 创作者专用 AI 助手 (Agent 模式)
-	g.POST("/author-helper", a.AuthorHelper)
+	g.POST("/author-helper", ginx.WrapStreamBodyAndClaims(a.AuthorHelper))
+	// 用户确认或拒绝 AI 助手提议的写操作
+	g.POST("/author-helper/confirm", ginx.WrapBodyAndClaims(a.ConfirmAiAction))
 
 	g.GET("/hot", ginx.Wrap(a.GetHot))
 }
@@ -78,6 +81,11 @@ type AuthorHelperReq struct {
 	Instruction string `json:"instruction"`
 }
 
+type AiActionConfirmReq struct {
+	ActionID string `json:"action_id" binding:"required"`
+	Approve  bool   `json:"approve"`
+}
+
 type ArticleQAReq struct {
 	Question string `json:"question"`
 }
@@ -134,6 +142,12 @@ func (a *ArticleHandler) Publish(ctx *gin.Context, req PublishReq, uc jwt.UserCl
 			ID: uc.Uid,
 		},
 	})
+	if errors.Is(err, service.ErrContentBlocked) {
+		return ginx.Result{
+			Code: errs.ArticleContentBlocked,
+			Msg:  "文章包含违规内容，请修改后再发表",
+		}, nil
+	}
 	if err != nil {
 		return ginx.Result{
 			Code: errs.ArticleInternalServerError,
@@ -179,9 +193,12 @@ type ArticleVo struct {
 	ReadCnt    int64 `json:"readCnt"`
 	LikeCnt    int64 `json:"likeCnt"`
 	CollectCnt int64 `json:"collectCnt"`
+	CommentCnt int64 `json:"commentCnt"`
 
 	Liked     bool `json:"liked"`
 	Collected bool `json:"collected"`
+
+	Mentions []MentionVo `json:"mentions,omitempty"`
 }
 
 func (a *ArticleHandler) Detail(ctx *gin.Context, uc jwt.UserClaims) (ginx.Result, error) {
@@ -249,7 +266,15 @@ func (a *ArticleHandler) List(ctx *gin.Context, page ArticleListPage, uc jwt.Use
 			Msg:  "系统错误",
 		}, err
 	}
+	// 计数查询失败不影响列表本身
+	intrs, err := a.interSvc.GetByIds(ctx, a.biz, slice.Map(arts, func(idx int, src domain.Article) int64 {
+		return src.ID
+	}))
+	if err != nil {
+		a.l.Error("查询文章计数失败", logger.Int64("uid", uc.Uid), logger.Error(err))
+	}
 	data := slice.Map[domain.Article, ArticleVo](arts, func(idx int, src domain.Article) ArticleVo {
+		intr := intrs[src.ID]
 		return ArticleVo{
 			ID:       src.ID,
 			Title:    src.Title,
@@ -261,6 +286,11 @@ func (a *ArticleHandler) List(ctx *gin.Context, page ArticleListPage, uc jwt.Use
 			Status: src.Status.ToUint8(),
 			Ctime:  src.Ctime.Format(time.DateTime),
 			Utime:  src.Utime.Format(time.DateTime),
+
+			ReadCnt:    intr.ReadCnt,
+			LikeCnt:    intr.LikeCnt,
+			CollectCnt: intr.CollectCnt,
+			CommentCnt: intr.CommentCnt,
 		}
 	})
 	return ginx.Result{
@@ -337,8 +367,10 @@ func (a *ArticleHandler) PubDetail(ctx *gin.Context, uc jwt.UserClaims) (ginx.Re
 		ReadCnt:    intr.ReadCnt,
 		CollectCnt: intr.CollectCnt,
 		LikeCnt:    intr.LikeCnt,
+		CommentCnt: intr.CommentCnt,
 		Liked:      intr.Liked,
 		Collected:  intr.Collected,
+		Mentions:   toMentionVos(art.Mentions),
 
 		Status: art.Status.ToUint8(),
 		Ctime:  art.Ctime.Format(time.DateTime),
@@ -352,7 +384,7 @@ func (a *ArticleHandler) PubDetail(ctx *gin.Context, uc jwt.UserClaims) (ginx.Re
 	}, nil
 }
 
-func (a *ArticleHandler) GetAiSummary(ctx *gin.Context) (ginx.Result, error) {
+func (a *ArticleHandler) GetAiSummary(ctx *gin.Context, uc jwt.UserClaims) (ginx.Result, error) {
 	idstr := ctx.Param("id")
 	id, err := strconv.ParseInt(idstr, 10, 64)
 	if err != nil {
@@ -372,8 +404,15 @@ func (a *ArticleHandler) GetAiSummary(ctx *gin.Context) (ginx.Result, error) {
 		}, err
 	}
 
-	// 2. 调用 AI 服务获取总结
-	summary, err := a.aiSvc.GetArticleSummary(ctx, art)
+	// 2. 调用 AI 服务获取总结，uid 用于 Prompt 实验分流
+	summary, err := a.aiSvc.GetArticleSummary(ctx, uc.Uid, art)
+	if errors.Is(err, ai.ErrInvalidOutput) {
+		a.l.Warn("AI 总结输出格式错误", logger.Int64("id", id), logger.Error(err))
+		return ginx.Result{
+			Code: errs.AiOutputInvalid,
+			Msg:  "AI 课代表这次没总结好，请稍后再试",
+		}, err
+	}
 	if err != nil {
 		a.l.Error("获取 AI 总结失败", logger.Int64("id", id), logger.Error(err))
 		return ginx.Result{
@@ -390,152 +429,92 @@ func (a *ArticleHandler) GetAiSummary(ctx *gin.Context) (ginx.Result, error) {
 }
 
 // AnswerQA 针对单篇文章的“沉浸式笔记问答” (SSE 实现)
-func (a *ArticleHandler) AnswerQA(ctx *gin.Context) {
+func (a *ArticleHandler) AnswerQA(ctx *gin.Context, req ArticleQAReq, uc jwt.UserClaims) (*schema.StreamReader[any], ginx.Result, error) {
 	// 1. 获取文章 ID
 	idstr := ctx.Param("id")
 	id, err := strconv.ParseInt(idstr, 10, 64)
 	if err != nil {
-		ctx.JSON(http.StatusOK, ginx.Result{
+		return nil, ginx.Result{
 			Code: errs.ArticleInvalidInput,
 			Msg:  "id 参数错误",
-		})
-		return
-	}
-
-	// 2. 解析请求体
-	var req ArticleQAReq
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusOK, ginx.Result{
-			Code: errs.ArticleInvalidInput,
-			Msg:  "请求格式错误",
-		})
-		return
+		}, err
 	}
 
-	// 3. 获取文章内容 (用于注入 Context)
+	// 2. 获取文章内容 (用于注入 Context)
 	// 这里可以加上权限校验，目前先假设公开文章
 	art, err := a.ArtSvc.GetPubById(ctx, id, 0)
 	if err != nil {
-		a.l.Error("AI 问答查询文章失败", logger.Int64("id", id), logger.Error(err))
-		ctx.JSON(http.StatusOK, ginx.Result{
+		return nil, ginx.Result{
 			Code: errs.ArticleInternalServerError,
 			Msg:  "系统错误",
-		})
-		return
+		}, fmt.Errorf("AI 问答查询文章失败 aid %d %w", id, err)
 	}
 
-	// 4. 调用 AI Service 获取流式响应
-	reader, err := a.aiSvc.AnswerQuestionStream(ctx, id, art.Content, req.Question)
+	// 3. 调用 AI Service 获取流式响应，客户端断开时 Request 的 context 会被取消
+	resp, err := a.aiSvc.AnswerQuestionStream(ctx.Request.Context(), uc.Uid, id, art.Content, req.Question)
 	if err != nil {
-		a.l.Error("启动 AI 问答失败", logger.Int64("id", id), logger.Error(err))
-		ctx.JSON(http.StatusOK, ginx.Result{
+		return nil, ginx.Result{
 			Code: errs.AiServiceError,
 			Msg:  "AI 助手暂不可用",
-		})
-		return
-	}
-	defer reader.Close()
-
-	// 5. 设置 SSE 响应头
-	ctx.Header("Content-Type", "text/event-stream")
-	ctx.Header("Cache-Control", "no-cache")
-	ctx.Header("Connection", "keep-alive")
-	ctx.Header("Transfer-Encoding", "chunked")
-
-	// 6. 循环读取流并发送
-	for {
-		chunk, err := reader.Recv()
-		if err != nil {
-			// 流结束
-			break
-		}
-
-		content, ok := chunk.(string)
-		if !ok {
-			continue
-		}
-
-		// 发送数据块给前端
-		ctx.SSEvent("message", content)
-		ctx.Writer.Flush()
+		}, fmt.Errorf("启动 AI 问答失败 aid %d %w", id, err)
 	}
 
-	// 结束标识
-	ctx.SSEvent("end", "done")
-	ctx.Writer.Flush()
+	// 4. 附带本次使用的 Prompt 版本，SSE 分帧由 ginx 统一处理
+	ctx.Header("X-Prompt-Version", resp.PromptVersion)
+	return resp.Reader, ginx.Result{}, nil
 }
 
 // AuthorHelper 创作者 AI 助手 (Agent 模式, SSE 流式返回)
-func (a *ArticleHandler) AuthorHelper(ctx *gin.Context) {
-	// 1. 获取用户 Claims
-	val, ok := ctx.Get("user")
-	if !ok {
-		ctx.AbortWithStatus(http.StatusUnauthorized)
-		return
-	}
-	uc, ok := val.(jwt.UserClaims)
-	if !ok {
-		ctx.AbortWithStatus(http.StatusUnauthorized)
-		return
-	}
-
-	// 2. 解析请求
-	var req AuthorHelperReq
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusOK, ginx.Result{
-			Code: errs.ArticleInvalidInput,
-			Msg:  "参数错误",
-		})
-		return
-	}
-
-	// 3. 调用 AI Service 获取 Agent 流
-	reader, err := a.aiSvc.AuthorHelperStream(ctx, ai.AuthorHelperInput{
+// 工具调用与工具结果会以 tool_call、tool_result 事件下发，前端可以据此展示 Agent 的执行过程
+func (a *ArticleHandler) AuthorHelper(ctx *gin.Context, req AuthorHelperReq, uc jwt.UserClaims) (*schema.StreamReader[any], ginx.Result, error) {
+	// 客户端断开时 Request 的 context 会被取消，模型调用随之终止
+	resp, err := a.aiSvc.AuthorHelperStream(ctx.Request.Context(), ai.AuthorHelperInput{
 		ArticleID:   req.ArticleID,
 		AuthorID:    uc.Uid,
 		Content:     req.Content,
 		Instruction: req.Instruction,
 	})
 	if err != nil {
-		a.l.Error("启动 AI 创作助手失败", logger.Error(err))
-		ctx.JSON(http.StatusOK, ginx.Result{
+		return nil, ginx.Result{
 			Code: errs.AiServiceError,
 			Msg:  "AI 助手暂不可用",
-		})
-		return
-	}
-	defer reader.Close()
-
-	// 4. 设置 SSE 响应头
-	ctx.Header("Content-Type", "text/event-stream")
-	ctx.Header("Cache-Control", "no-cache")
-	ctx.Header("Connection", "keep-alive")
-	ctx.Header("Transfer-Encoding", "chunked")
-
-	// 5. 循环读取并发送
-	for {
-		chunk, err := reader.Recv()
-		if err != nil {
-			break
-		}
-
-		// ReAct Agent 的输出 chunk 可能是 *schema.Message (最终回答)
-		// 或者是工具调用信息 (中间思考过程)
-		// 这里简单处理，提取文本内容发送
-		switch v := chunk.(type) {
-		case string:
-			ctx.SSEvent("message", v)
-		case *schema.Message:
-			ctx.SSEvent("message", v.Content)
-		default:
-			// 其他类型的 chunk (如中间思考) 也可以发送给前端显示
-			// ctx.SSEvent("thought", fmt.Sprintf("%v", v))
-		}
-		ctx.Writer.Flush()
+		}, fmt.Errorf("启动 AI 创作助手失败 %w", err)
 	}
 
-	ctx.SSEvent("end", "done")
-	ctx.Writer.Flush()
+	ctx.Header("X-Prompt-Version", resp.PromptVersion)
+	return resp.Reader, ginx.Result{}, nil
+}
+
+// ConfirmAiAction 创作者确认 AI 助手提议的操作，只有这里才会真正写入
+func (a *ArticleHandler) ConfirmAiAction(ctx *gin.Context, req AiActionConfirmReq, uc jwt.UserClaims) (ginx.Result, error) {
+	action, err := a.aiSvc.ConfirmAction(ctx, uc.Uid, req.ActionID, req.Approve)
+	if errors.Is(err, ai.ErrActionNotFound) {
+		return ginx.Result{
+			Code: errs.AiActionNotFound,
+			Msg:  "操作不存在或已过期",
+		}, err
+	}
+	if errors.Is(err, ai.ErrActionConflict) {
+		return ginx.Result{
+			Code: errs.AiActionConflict,
+			Msg:  "文章在提议之后已被修改，请重新生成",
+		}, err
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: errs.ArticleInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	msg := "已取消操作"
+	if req.Approve {
+		msg = "操作已生效"
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  msg,
+		Data: action.ArticleID,
+	}, nil
 }
 
 type ArticleLikeReq struct {
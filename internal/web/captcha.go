@@ -0,0 +1,86 @@
+package web
+
+import (
+	"archi/internal/service"
+	"archi/internal/web/errs"
+	"archi/pkg/ginx"
+	"archi/pkg/logger"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var _ Handler = (*CaptchaHandler)(nil)
+
+// CaptchaHandler 图形验证码，通过之后拿到的凭证放在 X-Captcha-Token 里面调用需要验证的接口
+type CaptchaHandler struct {
+	svc service.CaptchaService
+	l   logger.Logger
+}
+
+func NewCaptchaHandler(svc service.CaptchaService, l logger.Logger) *CaptchaHandler {
+	return &CaptchaHandler{
+		svc: svc,
+		l:   l,
+	}
+}
+
+func (h *CaptchaHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/captcha")
+	g.GET("", ginx.Wrap(h.Generate))
+	g.POST("/verify", ginx.WrapBody(h.Verify))
+}
+
+type CaptchaVo struct {
+	Id    string `json:"id"`
+	Image string `json:"image"`
+}
+
+func (h *CaptchaHandler) Generate(ctx *gin.Context) (ginx.Result, error) {
+	res, err := h.svc.Generate(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.UserInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "获取图形验证码成功",
+		Data: CaptchaVo{
+			Id:    res.ID,
+			Image: res.B64S,
+		},
+	}, nil
+}
+
+type CaptchaVerifyReq struct {
+	Id    string `json:"id" binding:"required"`
+	Value string `json:"value" binding:"required"`
+}
+
+type CaptchaTokenVo struct {
+	Token string `json:"token"`
+}
+
+func (h *CaptchaHandler) Verify(ctx *gin.Context, req CaptchaVerifyReq) (ginx.Result, error) {
+	token, err := h.svc.Verify(ctx, req.Id, req.Value)
+	if errors.Is(err, service.ErrCaptchaInvalid) {
+		return ginx.Result{
+			Code: errs.UserCaptchaInvalid,
+			Msg:  "图形验证码错误，请重新获取",
+		}, nil
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: errs.UserInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "图形验证码通过",
+		Data: CaptchaTokenVo{Token: token},
+	}, nil
+}
@@ -7,6 +7,7 @@ import (
 	"archi/internal/web/middleware/jwt"
 	"archi/pkg/ginx"
 	"archi/pkg/logger"
+	"errors"
 	"github.com/ecodeclub/ekit/slice"
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -29,8 +30,13 @@ func (h *CommentHandler) RegisterRoutes(server *gin.Engine) {
 	g := server.Group("/comments")
 	g.POST("/create", ginx.WrapBodyAndClaims(h.CreateComment))
 	g.POST("/delete", ginx.WrapBodyAndClaims(h.DeleteComment))
-	g.POST("/list", ginx.WrapBody(h.GetCommentList))
-	g.POST("/replies", ginx.WrapBody(h.GetMoreReplies))
+	g.POST("/list", ginx.WrapBodyAndClaims(h.GetCommentList))
+	g.POST("/replies", ginx.WrapBodyAndClaims(h.GetMoreReplies))
+	g.POST("/like", ginx.WrapBodyAndClaims(h.Like))
+	g.POST("/pin", ginx.WrapBodyAndClaims(h.Pin))
+	g.POST("/edit", ginx.WrapBodyAndClaims(h.EditComment))
+	g.POST("/edits", ginx.WrapBodyAndClaims(h.GetEditHistory))
+	g.POST("/admin/delete", ginx.WrapBodyAndClaims(h.HardDelete))
 }
 
 type CreateCommentReq struct {
@@ -52,14 +58,7 @@ func (h *CommentHandler) CreateComment(ctx *gin.Context, req CreateCommentReq, u
 	} else {
 		parentComment = nil
 	}
-	var rootComment *domain.Comment
-	if req.ParentID != 0 {
-		rootComment = &domain.Comment{
-			Id: req.ParentID,
-		}
-	} else {
-		rootComment = nil
-	}
+	// 根评论由 service 根据父评论确定，不信任前端传入的 root_id
 	comment, err := h.svc.CreateComment(ctx, domain.Comment{
 		Commentator: domain.CommentatorInfo{
 			ID: uc.Uid,
@@ -67,9 +66,26 @@ func (h *CommentHandler) CreateComment(ctx *gin.Context, req CreateCommentReq, u
 		Biz:           req.Biz,
 		BizID:         req.BizID,
 		Content:       req.Content,
-		RootComment:   rootComment,
 		ParentComment: parentComment,
 	})
+	if errors.Is(err, service.ErrContentBlocked) {
+		return ginx.Result{
+			Code: errs.CommentContentBlocked,
+			Msg:  "评论包含违规内容",
+		}, nil
+	}
+	if errors.Is(err, service.ErrCommentNotFound) {
+		return ginx.Result{
+			Code: errs.CommentNotFound,
+			Msg:  "回复的评论不存在",
+		}, nil
+	}
+	if errors.Is(err, service.ErrCommentUserBlocked) {
+		return ginx.Result{
+			Code: errs.CommentUserBlocked,
+			Msg:  "由于拉黑关系，无法评论",
+		}, nil
+	}
 	if err != nil {
 		return ginx.Result{
 			Code: errs.CommentInternalServerError,
@@ -89,8 +105,98 @@ type DeleteCommentReq struct {
 }
 
 func (h *CommentHandler) DeleteComment(ctx *gin.Context, req DeleteCommentReq, uc jwt.UserClaims) (ginx.Result, error) {
-	// 在service层没有校验评论是否是自己的，可以在这层补充
-	err := h.svc.DeleteComment(ctx, req.ID)
+	err := h.svc.DeleteComment(ctx, uc.Uid, req.ID)
+	switch {
+	case err == nil:
+		return ginx.Result{
+			Code: http.StatusOK,
+			Msg:  "删除成功",
+		}, nil
+	case errors.Is(err, service.ErrCommentNotFound):
+		return ginx.Result{
+			Code: errs.CommentNotFound,
+			Msg:  "评论不存在",
+		}, nil
+	case errors.Is(err, service.ErrCommentForbidden):
+		return ginx.Result{
+			Code: errs.CommentForbidden,
+			Msg:  "只能删除自己的评论",
+		}, nil
+	default:
+		return ginx.Result{
+			Code: errs.CommentInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+}
+
+type EditCommentReq struct {
+	ID      int64  `json:"id"`
+	Content string `json:"content"`
+}
+
+func (h *CommentHandler) EditComment(ctx *gin.Context, req EditCommentReq, uc jwt.UserClaims) (ginx.Result, error) {
+	if req.Content == "" {
+		return ginx.Result{
+			Code: errs.CommentInvalidInput,
+			Msg:  "评论内容不能为空",
+		}, nil
+	}
+	comment, err := h.svc.EditComment(ctx, uc.Uid, req.ID, req.Content)
+	switch {
+	case err == nil:
+		return ginx.Result{
+			Code: http.StatusOK,
+			Msg:  "修改成功",
+			Data: h.toVo(comment),
+		}, nil
+	case errors.Is(err, service.ErrCommentNotFound):
+		return ginx.Result{
+			Code: errs.CommentNotFound,
+			Msg:  "评论不存在",
+		}, nil
+	case errors.Is(err, service.ErrCommentForbidden):
+		return ginx.Result{
+			Code: errs.CommentForbidden,
+			Msg:  "只能修改自己的评论",
+		}, nil
+	case errors.Is(err, service.ErrCommentEditExpired):
+		return ginx.Result{
+			Code: errs.CommentEditExpired,
+			Msg:  "评论已经超过可编辑时间",
+		}, nil
+	case errors.Is(err, service.ErrContentBlocked):
+		return ginx.Result{
+			Code: errs.CommentContentBlocked,
+			Msg:  "评论包含违规内容",
+		}, nil
+	default:
+		return ginx.Result{
+			Code: errs.CommentInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+}
+
+type CommentEditVo struct {
+	// Content 编辑之前的内容
+	Content string `json:"content"`
+	// CTime 编辑的时间
+	CTime string `json:"ctime"`
+}
+
+type GetEditHistoryReq struct {
+	ID int64 `json:"id"`
+}
+
+func (h *CommentHandler) GetEditHistory(ctx *gin.Context, req GetEditHistoryReq, uc jwt.UserClaims) (ginx.Result, error) {
+	edits, err := h.svc.GetEditHistory(ctx, uc.Uid, req.ID)
+	if errors.Is(err, service.ErrCommentNotFound) {
+		return ginx.Result{
+			Code: errs.CommentNotFound,
+			Msg:  "评论不存在",
+		}, nil
+	}
 	if err != nil {
 		return ginx.Result{
 			Code: errs.CommentInternalServerError,
@@ -99,10 +205,56 @@ func (h *CommentHandler) DeleteComment(ctx *gin.Context, req DeleteCommentReq, u
 	}
 	return ginx.Result{
 		Code: http.StatusOK,
-		Msg:  "删除成功",
+		Msg:  "OK",
+		Data: slice.Map(edits, func(idx int, src domain.CommentEdit) CommentEditVo {
+			return CommentEditVo{
+				Content: src.Content,
+				CTime:   src.Ctime.Format(time.DateTime),
+			}
+		}),
 	}, nil
 }
 
+type HardDeleteCommentReq struct {
+	ID int64 `json:"id"`
+	// Reason 删除原因，记录在审计日志里面
+	Reason string `json:"reason"`
+}
+
+// HardDelete 管理员物理删除评论以及它下面的全部回复
+func (h *CommentHandler) HardDelete(ctx *gin.Context, req HardDeleteCommentReq, uc jwt.UserClaims) (ginx.Result, error) {
+	if req.Reason == "" {
+		return ginx.Result{
+			Code: errs.CommentInvalidInput,
+			Msg:  "删除原因不能为空",
+		}, nil
+	}
+	cnt, err := h.svc.HardDelete(ctx, uc.Uid, req.ID, req.Reason)
+	switch {
+	case err == nil:
+		return ginx.Result{
+			Code: http.StatusOK,
+			Msg:  "删除成功",
+			Data: cnt,
+		}, nil
+	case errors.Is(err, service.ErrCommentNotFound):
+		return ginx.Result{
+			Code: errs.CommentNotFound,
+			Msg:  "评论不存在",
+		}, nil
+	case errors.Is(err, service.ErrCommentForbidden):
+		return ginx.Result{
+			Code: errs.CommentForbidden,
+			Msg:  "没有权限",
+		}, nil
+	default:
+		return ginx.Result{
+			Code: errs.CommentInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+}
+
 type CommentVo struct {
 	Id int64 `json:"id"`
 	// 评论者
@@ -115,41 +267,175 @@ type CommentVo struct {
 	// 父评论
 	ParentComment *CommentVo  `json:"parent_comment"`
 	Children      []CommentVo `json:"children"`
-	CTime         string      `json:"ctime"`
+	ReplyCnt      int64       `json:"reply_cnt"`
+	Mentions      []MentionVo `json:"mentions"`
+	LikeCnt       int64       `json:"like_cnt"`
+	Liked         bool        `json:"liked"`
+	Pinned        bool        `json:"pinned"`
+	// Deleted 已删除的评论只是一个墓碑，内容和评论者都不再展示
+	Deleted bool `json:"deleted"`
+	// PendingReview 等待人工复审，评论者以外的人看不到内容
+	PendingReview bool   `json:"pending_review"`
+	Edited        bool   `json:"edited"`
+	CTime         string `json:"ctime"`
+}
+
+// MentionVo 内容中 @ 到的用户，start 和 end 是按字符计算的下标，左闭右开
+type MentionVo struct {
+	Uid      int64  `json:"uid"`
+	Nickname string `json:"nickname"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+func toMentionVos(mentions []domain.Mention) []MentionVo {
+	return slice.Map(mentions, func(idx int, src domain.Mention) MentionVo {
+		return MentionVo{
+			Uid:      src.Uid,
+			Nickname: src.Nickname,
+			Start:    src.Start,
+			End:      src.End,
+		}
+	})
+}
+
+type CommentListVo struct {
+	Comments []CommentVo `json:"comments"`
+	// NextCursor 下一页的游标，为空说明没有更多了
+	NextCursor string `json:"next_cursor"`
 }
 
 type GetCommentListReq struct {
 	Biz   string `json:"biz"`
 	BizID int64  `json:"biz_id"`
-	MinID int64  `json:"min_id"`
-	Limit int64  `json:"limit"`
+	// Sort new 按时间倒序，hot 按热度倒序，默认 new
+	Sort string `json:"sort"`
+	// Cursor 为上一页返回的 next_cursor，第一页不传
+	Cursor string `json:"cursor"`
+	Limit  int64  `json:"limit"`
 }
 
-func (h *CommentHandler) GetCommentList(ctx *gin.Context, req GetCommentListReq) (ginx.Result, error) {
-	list, err := h.svc.GetCommentList(ctx, req.Biz, req.BizID, req.MinID, req.Limit)
+func (h *CommentHandler) GetCommentList(ctx *gin.Context, req GetCommentListReq, uc jwt.UserClaims) (ginx.Result, error) {
+	sort := domain.CommentSort(req.Sort)
+	if sort == "" {
+		sort = domain.CommentSortNew
+	}
+	if !sort.Valid() {
+		return ginx.Result{
+			Code: errs.CommentInvalidInput,
+			Msg:  "sort 参数错误",
+		}, nil
+	}
+	cursor, err := domain.ParseCommentCursor(req.Cursor)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.CommentInvalidInput,
+			Msg:  "cursor 参数错误",
+		}, err
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 10 // 默认值
+	}
+	list, err := h.svc.GetCommentList(ctx, uc.Uid, req.Biz, req.BizID, sort, cursor, req.Limit)
 	if err != nil {
 		return ginx.Result{
 			Code: errs.CommentInternalServerError,
 			Msg:  "系统错误",
 		}, err
 	}
+	vo := CommentListVo{
+		Comments: slice.Map(list, func(idx int, src domain.Comment) CommentVo {
+			return h.toVo(src)
+		}),
+	}
+	// 置顶评论不占用 limit，也不参与翻页
+	var cnt int64
+	for _, cm := range list {
+		if !cm.Pinned {
+			cnt++
+		}
+	}
+	if cnt == req.Limit {
+		vo.NextCursor = list[len(list)-1].Cursor().String()
+	}
 	return ginx.Result{
 		Code: http.StatusOK,
 		Msg:  "加载评论成功",
-		Data: slice.Map(list, func(idx int, src domain.Comment) CommentVo {
-			return h.toVo(src)
-		}),
+		Data: vo,
 	}, nil
 }
 
+type LikeCommentReq struct {
+	ID int64 `json:"id"`
+	// Like true 点赞，false 取消点赞
+	Like bool `json:"like"`
+}
+
+func (h *CommentHandler) Like(ctx *gin.Context, req LikeCommentReq, uc jwt.UserClaims) (ginx.Result, error) {
+	err := h.svc.Like(ctx, uc.Uid, req.ID, req.Like)
+	if errors.Is(err, service.ErrCommentNotFound) {
+		return ginx.Result{
+			Code: errs.CommentNotFound,
+			Msg:  "评论不存在",
+		}, nil
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: errs.CommentInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "OK",
+	}, nil
+}
+
+type PinCommentReq struct {
+	ID int64 `json:"id"`
+	// Pin true 置顶，false 取消置顶
+	Pin bool `json:"pin"`
+}
+
+func (h *CommentHandler) Pin(ctx *gin.Context, req PinCommentReq, uc jwt.UserClaims) (ginx.Result, error) {
+	err := h.svc.Pin(ctx, uc.Uid, req.ID, req.Pin)
+	switch {
+	case err == nil:
+		return ginx.Result{
+			Code: http.StatusOK,
+			Msg:  "OK",
+		}, nil
+	case errors.Is(err, service.ErrCommentNotFound):
+		return ginx.Result{
+			Code: errs.CommentNotFound,
+			Msg:  "评论不存在",
+		}, nil
+	case errors.Is(err, service.ErrCommentPinReply):
+		return ginx.Result{
+			Code: errs.CommentInvalidInput,
+			Msg:  "只能置顶一级评论",
+		}, nil
+	case errors.Is(err, service.ErrCommentPinForbidden):
+		return ginx.Result{
+			Code: errs.CommentForbidden,
+			Msg:  "只有作者可以置顶评论",
+		}, nil
+	default:
+		return ginx.Result{
+			Code: errs.CommentInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+}
+
 type GetMoreRepliesReq struct {
 	RID   int64 `json:"rid"`
 	MaxID int64 `json:"max_id"`
 	Limit int64 `json:"limit"`
 }
 
-func (h *CommentHandler) GetMoreReplies(ctx *gin.Context, req GetMoreRepliesReq) (ginx.Result, error) {
-	list, err := h.svc.GetMoreReplies(ctx, req.RID, req.MaxID, req.Limit)
+func (h *CommentHandler) GetMoreReplies(ctx *gin.Context, req GetMoreRepliesReq, uc jwt.UserClaims) (ginx.Result, error) {
+	list, err := h.svc.GetMoreReplies(ctx, uc.Uid, req.RID, req.MaxID, req.Limit)
 	if err != nil {
 		return ginx.Result{
 			Code: errs.CommentInternalServerError,
@@ -173,13 +459,27 @@ func (h *CommentHandler) toVo(c domain.Comment) CommentVo {
 		})
 	}
 	res := CommentVo{
-		Id:          c.Id,
-		Commentator: c.Commentator,
-		Biz:         c.Biz,
-		BizID:       c.BizID,
-		Content:     c.Content,
-		Children:    children,
-		CTime:       c.CTime.Format(time.DateTime),
+		Id:            c.Id,
+		Commentator:   c.Commentator,
+		Biz:           c.Biz,
+		BizID:         c.BizID,
+		Content:       c.Content,
+		Children:      children,
+		ReplyCnt:      c.ReplyCnt,
+		Mentions:      toMentionVos(c.Mentions),
+		LikeCnt:       c.LikeCnt,
+		Liked:         c.Liked,
+		Pinned:        c.Pinned,
+		PendingReview: c.PendingReview(),
+		Edited:        c.EditCnt > 0,
+		CTime:         c.CTime.Format(time.DateTime),
+	}
+	if c.Deleted() {
+		res.Deleted = true
+		res.Content = domain.CommentTombstone
+		res.Commentator = domain.CommentatorInfo{}
+		res.Mentions = nil
+		res.Edited = false
 	}
 	if c.ParentComment != nil {
 		res.ParentComment = &CommentVo{
@@ -3,8 +3,16 @@ package errs
 const (
 	// ArticleInvalidInput 这是一个非常含糊的错误码，代表用户相关的API参数不对
 	ArticleInvalidInput = 403001
+	// AiActionNotFound AI 助手提议的操作不存在、已过期或已处理
+	AiActionNotFound = 403002
+	// ArticleContentBlocked 文章内容命中审核拦截规则
+	ArticleContentBlocked = 403003
+	// AiActionConflict AI 助手提议之后文章又被修改过
+	AiActionConflict = 403004
 	// ArticleInternalServerError 这是一个非常含糊的错误码。代表系统内部错误
 	ArticleInternalServerError = 503001
 	// AiServiceError AI 服务故障
 	AiServiceError = 503002
+	// AiOutputInvalid AI 输出格式不符合预期，修复后仍然失败
+	AiOutputInvalid = 503003
 )
@@ -3,6 +3,16 @@ package errs
 const (
 	// CommentInvalidInput 这是一个非常含糊的错误码，代表用户相关的API参数不对
 	CommentInvalidInput = 405001
+	// CommentContentBlocked 评论内容命中审核拦截规则
+	CommentContentBlocked = 405002
+	// CommentForbidden 没有权限操作这条评论，比如置顶别人文章下的评论
+	CommentForbidden = 405003
+	// CommentNotFound 评论不存在
+	CommentNotFound = 405004
+	// CommentEditExpired 超过了可以编辑的时间
+	CommentEditExpired = 405005
+	// CommentUserBlocked 和内容作者或者被回复的人之间存在拉黑关系
+	CommentUserBlocked = 405006
 	// CommentInternalServerError 这是一个非常含糊的错误码。代表系统内部错误
 	CommentInternalServerError = 505001
 )
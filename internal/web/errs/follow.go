@@ -3,6 +3,8 @@ package errs
 const (
 	// FollowInvalidInput 这是一个非常含糊的错误码，代表用户相关的API参数不对
 	FollowInvalidInput = 406001
+	// FollowBlocked 双方之间存在拉黑关系，不能关注
+	FollowBlocked = 406002
 	// FollowInternalServerError 这是一个非常含糊的错误码。代表系统内部错误
 	FollowInternalServerError = 506001
 )
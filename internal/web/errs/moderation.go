@@ -0,0 +1,12 @@
+package errs
+
+const (
+	// ModerationInvalidInput 这是一个非常含糊的错误码，代表用户相关的API参数不对
+	ModerationInvalidInput = 410001
+	// ModerationForbidden 没有复审权限
+	ModerationForbidden = 410002
+	// ModerationNotPending 审核记录已经被处理
+	ModerationNotPending = 410003
+	// ModerationInternalServerError 这是一个非常含糊的错误码。代表系统内部错误
+	ModerationInternalServerError = 510001
+)
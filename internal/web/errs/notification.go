@@ -0,0 +1,8 @@
+package errs
+
+const (
+	// NotificationInvalidInput 这是一个非常含糊的错误码，代表通知相关的API参数不对
+	NotificationInvalidInput = 411001
+	// NotificationInternalServerError 这是一个非常含糊的错误码。代表系统内部错误
+	NotificationInternalServerError = 511001
+)
@@ -0,0 +1,12 @@
+package errs
+
+const (
+	// SMSInvalidInput 这是一个非常含糊的错误码，代表用户相关的API参数不对
+	SMSInvalidInput = 411001
+	// SMSForbidden 没有短信管理权限
+	SMSForbidden = 411002
+	// SMSNotDead 短信不在死信中
+	SMSNotDead = 411003
+	// SMSInternalServerError 这是一个非常含糊的错误码。代表系统内部错误
+	SMSInternalServerError = 511001
+)
@@ -35,4 +35,24 @@ const (
 	UserSmsStateInvalid = 401009
 	// UserSmsCodeInvalid 登录短信授权码错误
 	UserSmsCodeInvalid = 401010
+	// UserCaptchaRequired 发送验证码需要先通过图形验证码
+	UserCaptchaRequired = 401011
+	// UserCaptchaInvalid 图形验证码错误
+	UserCaptchaInvalid = 401012
+	// UserCodePhoneDailyLimit 手机号当天的验证码发送次数用完
+	UserCodePhoneDailyLimit = 401013
+	// UserCodeIPLimit 同一个 IP 发送验证码太频繁
+	UserCodeIPLimit = 401014
+	// UserCodeDeviceLimit 同一个设备发送验证码太频繁
+	UserCodeDeviceLimit = 401015
+	// UserCodeBudgetExhausted 全局短信预算用完，暂停发送验证码
+	UserCodeBudgetExhausted = 401016
+	// UserAccountLocked 密码错误次数过多，账号被临时锁定
+	UserAccountLocked = 401017
+	// UserLoginTooFrequent 密码错误之后还需要等待一段时间才能再次尝试
+	UserLoginTooFrequent = 401018
+	// UserUnlockCodeInvalid 解锁验证码错误
+	UserUnlockCodeInvalid = 401019
+	// UserSessionNotFound 要退出的会话不存在或者已经过期
+	UserSessionNotFound = 401020
 )
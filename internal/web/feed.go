@@ -1,6 +1,7 @@
 package web
 
 import (
+	"archi/internal/domain"
 	"archi/internal/service/feed"
 	"archi/internal/web/errs"
 	"archi/internal/web/middleware/jwt"
@@ -9,7 +10,6 @@ import (
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"strconv"
-	"time"
 )
 
 type FeedHandler struct {
@@ -29,30 +29,71 @@ func (h *FeedHandler) RegisterRoutes(e *gin.Engine) {
 	g.GET("/events", ginx.WrapClaims(h.GetFeedEventList))
 }
 
-func (h *FeedHandler) GetFeedEventList(c *gin.Context, uc jwt.UserClaims) (ginx.Result, error) {
-	timestampStr := c.Query("timestamp")
-	limitStr := c.Query("limit")
+type FeedEventListVO struct {
+	Events []domain.FeedEvent `json:"events"`
+	// Users 和 Articles 是这一页事件的 Ext 中引用到的用户和文章，按 id 索引
+	Users    map[int64]FeedUserVO    `json:"users"`
+	Articles map[int64]FeedArticleVO `json:"articles"`
+	// NextCursor 下一页的游标，为空说明没有更多了
+	NextCursor string `json:"next_cursor"`
+}
+
+type FeedUserVO struct {
+	Id       int64  `json:"id"`
+	Nickname string `json:"nickname"`
+	Avatar   string `json:"avatar"`
+}
 
-	timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
-	if err != nil || timestamp == 0 {
-		timestamp = time.Now().Unix()
+type FeedArticleVO struct {
+	Id    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+// GetFeedEventList /feed/events?cursor=&limit=
+// cursor 为上一页返回的 next_cursor，第一页不传
+func (h *FeedHandler) GetFeedEventList(c *gin.Context, uc jwt.UserClaims) (ginx.Result, error) {
+	cursor, err := domain.ParseFeedCursor(c.Query("cursor"))
+	if err != nil {
+		return ginx.Result{
+			Code: errs.FeedInvalidInput,
+			Msg:  "cursor 参数错误",
+		}, err
 	}
 
-	limit, err := strconv.ParseInt(limitStr, 10, 64)
-	if err != nil || limit == 0 {
+	limit, err := strconv.ParseInt(c.Query("limit"), 10, 64)
+	if err != nil || limit <= 0 || limit > 100 {
 		limit = 10 // 默认值
 	}
 
-	events, err := h.svc.GetFeedEventList(c.Request.Context(), uc.Uid, timestamp, limit)
+	events, err := h.svc.GetFeedEventList(c.Request.Context(), uc.Uid, cursor, limit)
 	if err != nil {
 		return ginx.Result{
 			Code: errs.FeedInternalServerError,
 			Msg:  "系统错误",
 		}, err
 	}
+	vo := FeedEventListVO{
+		Events:   events,
+		Users:    map[int64]FeedUserVO{},
+		Articles: map[int64]FeedArticleVO{},
+	}
+	// 补全失败不影响返回事件本身，客户端按 id 自己兜底
+	enrichment, err := h.svc.Enrich(c.Request.Context(), events)
+	if err != nil {
+		h.l.Error("补全 feed 事件信息失败", logger.Int64("uid", uc.Uid), logger.Error(err))
+	}
+	for id, u := range enrichment.Users {
+		vo.Users[id] = FeedUserVO{Id: u.ID, Nickname: u.Nickname, Avatar: u.Avatar}
+	}
+	for id, art := range enrichment.Articles {
+		vo.Articles[id] = FeedArticleVO{Id: art.ID, Title: art.Title}
+	}
+	if int64(len(events)) == limit {
+		vo.NextCursor = events[len(events)-1].Cursor().String()
+	}
 	return ginx.Result{
 		Code: http.StatusOK,
 		Msg:  "feed流获取成功",
-		Data: events,
+		Data: vo,
 	}, nil
 }
@@ -1,28 +1,41 @@
 package web
 
 import (
+	"archi/internal/domain"
 	"archi/internal/service"
 	"archi/internal/web/errs"
 	jwtware "archi/internal/web/middleware/jwt"
 	"archi/pkg/ginx"
 	"archi/pkg/logger"
+	"context"
 	"errors"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 	"net/http"
 	"strconv"
 )
 
+const (
+	followListDefaultLimit = 20
+	followListMaxLimit     = 100
+)
+
 // FollowHandler 负责处理关注关系的路由
 type FollowHandler struct {
-	svc service.FollowRelationService
-	log logger.Logger
+	svc      service.FollowRelationService
+	userSvc  service.UserService
+	blockSvc service.BlockService
+	recSvc   service.FollowRecommendService
+	log      logger.Logger
 }
 
-func NewFollowHandler(svc service.FollowRelationService, l logger.Logger) *FollowHandler {
+func NewFollowHandler(svc service.FollowRelationService, userSvc service.UserService,
+	blockSvc service.BlockService, recSvc service.FollowRecommendService, l logger.Logger) *FollowHandler {
 	return &FollowHandler{
-		svc: svc,
-		log: l,
+		svc:      svc,
+		userSvc:  userSvc,
+		blockSvc: blockSvc,
+		recSvc:   recSvc,
+		log:      l,
 	}
 }
 
@@ -34,7 +47,17 @@ func (h *FollowHandler) RegisterRoutes(server *gin.Engine) {
 	// 定义具体的路由和处理函数
 	g.POST("/relation", ginx.WrapBodyAndClaims(h.ToggleFollow))
 	g.POST("/list/followees", ginx.WrapBodyAndClaims(h.FolloweeList))
+	g.POST("/list/followers", ginx.WrapBodyAndClaims(h.FollowerList))
+	g.POST("/list/mutual", ginx.WrapBodyAndClaims(h.MutualList))
+	g.POST("/relations", ginx.WrapBodyAndClaims(h.BatchFollowRelation))
 	g.GET("/relation/:followee_id", ginx.WrapClaims(h.GetFollowRelation))
+	// 拉黑和静音
+	g.POST("/block", ginx.WrapBodyAndClaims(h.ToggleBlock))
+	g.POST("/mute", ginx.WrapBodyAndClaims(h.ToggleMute))
+	g.POST("/list/blocked", ginx.WrapBodyAndClaims(h.BlockedList))
+	// 可能认识的人
+	g.POST("/recommendations", ginx.WrapBodyAndClaims(h.Recommendations))
+	g.POST("/recommendations/dismiss", ginx.WrapBodyAndClaims(h.DismissRecommendation))
 }
 
 type FollowRelationReq struct {
@@ -55,6 +78,12 @@ func (h *FollowHandler) ToggleFollow(ctx *gin.Context, req FollowRelationReq, uc
 	if req.Follow {
 		// 执行关注逻辑
 		err := h.svc.Follow(ctx, followerID, req.FolloweeID)
+		if errors.Is(err, service.ErrFollowBlocked) {
+			return ginx.Result{
+				Code: errs.FollowBlocked,
+				Msg:  "由于拉黑关系，无法关注",
+			}, nil
+		}
 		if err != nil {
 			h.log.Error("关注用户失败", logger.Error(err),
 				logger.Int64("follower", followerID),
@@ -81,30 +110,180 @@ func (h *FollowHandler) ToggleFollow(ctx *gin.Context, req FollowRelationReq, uc
 	}
 }
 
-type FolloweeListPage struct {
-	Limit  int `json:"limit"`
-	Offset int `json:"offset"`
+// FollowListReq 分页查询关注相关的列表
+type FollowListReq struct {
+	// Uid 要查看谁的列表，不传就是自己
+	Uid int64 `json:"uid"`
+	// Cursor 上一页返回的 nextCursor，第一页不传
+	Cursor int64 `json:"cursor"`
+	Limit  int64 `json:"limit"`
+}
+
+// FollowUserVo 列表中的一个用户，关注状态是相对当前登录用户的
+type FollowUserVo struct {
+	Uid        int64  `json:"uid"`
+	Nickname   string `json:"nickname"`
+	Avatar     string `json:"avatar"`
+	Following  bool   `json:"following"`
+	FollowedBy bool   `json:"followedBy"`
+	Mutual     bool   `json:"mutual"`
+}
+
+type FollowListVo struct {
+	Users []FollowUserVo `json:"users"`
+	// NextCursor 为 0 说明没有下一页了
+	NextCursor int64 `json:"nextCursor"`
 }
 
 // FolloweeList 获取某人关注的列表
-func (h *FollowHandler) FolloweeList(ctx *gin.Context, page FolloweeListPage, uc jwtware.UserClaims) (ginx.Result, error) {
-	list, err := h.svc.GetFollowee(ctx, uc.Uid, int64(page.Offset), int64(page.Limit))
+func (h *FollowHandler) FolloweeList(ctx *gin.Context, req FollowListReq, uc jwtware.UserClaims) (ginx.Result, error) {
+	return h.followList(ctx, req, uc, "获取关注列表", h.svc.GetFollowee,
+		func(r domain.FollowRelation) int64 { return r.Followee })
+}
+
+// FollowerList 获取某人的粉丝列表
+func (h *FollowHandler) FollowerList(ctx *gin.Context, req FollowListReq, uc jwtware.UserClaims) (ginx.Result, error) {
+	return h.followList(ctx, req, uc, "获取粉丝列表", h.svc.GetFollower,
+		func(r domain.FollowRelation) int64 { return r.Follower })
+}
+
+// MutualList 获取和某人互相关注的列表
+func (h *FollowHandler) MutualList(ctx *gin.Context, req FollowListReq, uc jwtware.UserClaims) (ginx.Result, error) {
+	return h.followList(ctx, req, uc, "获取互关列表", h.svc.GetMutual,
+		func(r domain.FollowRelation) int64 { return r.Followee })
+}
+
+func (h *FollowHandler) followList(ctx *gin.Context, req FollowListReq, uc jwtware.UserClaims, action string,
+	list func(ctx context.Context, uid, cursor, limit int64) ([]domain.FollowRelation, error),
+	target func(r domain.FollowRelation) int64) (ginx.Result, error) {
+	if req.Uid <= 0 {
+		req.Uid = uc.Uid
+	}
+	if req.Limit <= 0 {
+		req.Limit = followListDefaultLimit
+	}
+	if req.Limit > followListMaxLimit {
+		req.Limit = followListMaxLimit
+	}
+	if req.Cursor < 0 {
+		return ginx.Result{
+			Code: errs.FollowInvalidInput,
+			Msg:  "参数错误",
+		}, nil
+	}
+	relations, err := list(ctx, req.Uid, req.Cursor, req.Limit)
+	if err != nil {
+		h.log.Error(action+"失败", logger.Error(err), logger.Int64("uid", req.Uid))
+		return ginx.Result{
+			Code: errs.FollowInternalServerError,
+			Msg:  "系统异常，请重试",
+		}, err
+	}
+	uids := make([]int64, 0, len(relations))
+	for _, r := range relations {
+		uids = append(uids, target(r))
+	}
+	users, err := h.renderUsers(ctx, uc.Uid, uids)
+	if err != nil {
+		h.log.Error(action+"失败", logger.Error(err), logger.Int64("uid", req.Uid))
+		return ginx.Result{
+			Code: errs.FollowInternalServerError,
+			Msg:  "系统异常，请重试",
+		}, err
+	}
+	res := FollowListVo{Users: users}
+	if int64(len(relations)) == req.Limit {
+		res.NextCursor = relations[len(relations)-1].ID
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  action + "成功",
+		Data: res,
+	}, nil
+}
+
+// renderUsers 补全用户信息和当前用户与他们的关注状态，保持 uids 的顺序
+func (h *FollowHandler) renderUsers(ctx context.Context, viewer int64, uids []int64) ([]FollowUserVo, error) {
+	res := make([]FollowUserVo, 0, len(uids))
+	if len(uids) == 0 {
+		return res, nil
+	}
+	users, err := h.userSvc.FindByIds(ctx, uids)
+	if err != nil {
+		return nil, err
+	}
+	states, err := h.svc.GetFollowStates(ctx, viewer, uids)
+	if err != nil {
+		return nil, err
+	}
+	userMap := make(map[int64]domain.User, len(users))
+	for _, u := range users {
+		userMap[u.ID] = u
+	}
+	for _, uid := range uids {
+		u := userMap[uid]
+		state := states[uid]
+		res = append(res, FollowUserVo{
+			Uid:        uid,
+			Nickname:   u.Nickname,
+			Avatar:     u.Avatar,
+			Following:  state.Following,
+			FollowedBy: state.FollowedBy,
+			Mutual:     state.Mutual(),
+		})
+	}
+	return res, nil
+}
+
+type BatchFollowRelationReq struct {
+	Uids []int64 `json:"uids"`
+}
+
+type FollowStateVo struct {
+	Uid        int64 `json:"uid"`
+	Following  bool  `json:"following"`
+	FollowedBy bool  `json:"followedBy"`
+	Mutual     bool  `json:"mutual"`
+}
+
+// BatchFollowRelation 批量查询当前用户和一批用户的关注关系，用于渲染用户列表上的关注按钮
+func (h *FollowHandler) BatchFollowRelation(ctx *gin.Context, req BatchFollowRelationReq, uc jwtware.UserClaims) (ginx.Result, error) {
+	if len(req.Uids) == 0 || len(req.Uids) > followListMaxLimit {
+		return ginx.Result{
+			Code: errs.FollowInvalidInput,
+			Msg:  "参数错误",
+		}, nil
+	}
+	states, err := h.svc.GetFollowStates(ctx, uc.Uid, req.Uids)
 	if err != nil {
-		h.log.Error("获取关注列表失败", logger.Error(err), logger.Int64("uid", uc.Uid))
+		h.log.Error("批量查询关注关系失败", logger.Error(err), logger.Int64("uid", uc.Uid))
 		return ginx.Result{
 			Code: errs.FollowInternalServerError,
 			Msg:  "系统异常，请重试",
 		}, err
 	}
+	res := make([]FollowStateVo, 0, len(req.Uids))
+	for _, uid := range req.Uids {
+		state := states[uid]
+		res = append(res, FollowStateVo{
+			Uid:        uid,
+			Following:  state.Following,
+			FollowedBy: state.FollowedBy,
+			Mutual:     state.Mutual(),
+		})
+	}
 	return ginx.Result{
 		Code: http.StatusOK,
-		Msg:  "获取关注列表成功",
-		Data: list,
+		Msg:  "查询关注关系成功",
+		Data: res,
 	}, nil
 }
 
 type FollowRelationVo struct {
 	IsFollowed bool `json:"isFollowed"`
+	// FollowsYou 对方是否关注了我
+	FollowsYou bool `json:"followsYou"`
+	Mutual     bool `json:"mutual"`
 }
 
 // GetFollowRelation 获取当前用户与另一个用户的关注关系
@@ -121,21 +300,9 @@ func (h *FollowHandler) GetFollowRelation(ctx *gin.Context, uc jwtware.UserClaim
 	// 2. 从 JWT claims 中获取当前登录用户的 ID (follower)
 	followerID := uc.Uid
 
-	// 3. 调用 Service 层的方法
-	_, err = h.svc.FollowInfo(ctx, followerID, followeeID)
-
-	// 4. 根据 Service 返回的 error 来判断关系是否存在，并返回相应的结果
+	// 3. 两个方向的关系一起查，资料页要展示"关注了你"
+	states, err := h.svc.GetFollowStates(ctx, followerID, []int64{followeeID})
 	if err != nil {
-		// 如果错误是 gorm.ErrRecordNotFound，这在业务上是正常情况，
-		// 意味着“没有关注关系”，而不是系统出错了。
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return ginx.Result{
-				Code: http.StatusOK,
-				Msg:  "查询关注关系成功",
-				Data: FollowRelationVo{IsFollowed: false},
-			}, nil
-		}
-		// 如果是其他错误，则记录日志并返回系统异常
 		h.log.Error("查询关注关系失败", logger.Error(err),
 			logger.Int64("follower", followerID), logger.Int64("followee", followeeID))
 		return ginx.Result{
@@ -143,10 +310,192 @@ func (h *FollowHandler) GetFollowRelation(ctx *gin.Context, uc jwtware.UserClaim
 			Msg:  "系统异常，请重试",
 		}, err
 	}
-	// 5. 如果没有错误，说明关注关系存在
+	state := states[followeeID]
 	return ginx.Result{
 		Code: http.StatusOK,
 		Msg:  "查询关注关系成功",
-		Data: FollowRelationVo{IsFollowed: true},
+		Data: FollowRelationVo{
+			IsFollowed: state.Following,
+			FollowsYou: state.FollowedBy,
+			Mutual:     state.Mutual(),
+		},
+	}, nil
+}
+
+type ToggleBlockReq struct {
+	Uid int64 `json:"uid"`
+	// Block true 为拉黑，false 为取消拉黑
+	Block bool `json:"block"`
+}
+
+// ToggleBlock 拉黑或者取消拉黑，拉黑会同时解除双方的关注关系
+func (h *FollowHandler) ToggleBlock(ctx *gin.Context, req ToggleBlockReq, uc jwtware.UserClaims) (ginx.Result, error) {
+	if req.Block {
+		return h.toggleBlock(ctx, uc.Uid, req.Uid, "拉黑", h.blockSvc.Block)
+	}
+	return h.toggleBlock(ctx, uc.Uid, req.Uid, "取消拉黑", h.blockSvc.Unblock)
+}
+
+type ToggleMuteReq struct {
+	Uid int64 `json:"uid"`
+	// Mute true 为静音，false 为取消静音
+	Mute bool `json:"mute"`
+}
+
+// ToggleMute 静音或者取消静音，对方不会收到任何通知
+func (h *FollowHandler) ToggleMute(ctx *gin.Context, req ToggleMuteReq, uc jwtware.UserClaims) (ginx.Result, error) {
+	if req.Mute {
+		return h.toggleBlock(ctx, uc.Uid, req.Uid, "静音", h.blockSvc.Mute)
+	}
+	return h.toggleBlock(ctx, uc.Uid, req.Uid, "取消静音", h.blockSvc.Unmute)
+}
+
+func (h *FollowHandler) toggleBlock(ctx *gin.Context, uid, target int64, action string,
+	fn func(ctx context.Context, uid, target int64) error) (ginx.Result, error) {
+	if target <= 0 {
+		return ginx.Result{
+			Code: errs.FollowInvalidInput,
+			Msg:  "参数错误",
+		}, nil
+	}
+	err := fn(ctx, uid, target)
+	if errors.Is(err, service.ErrBlockSelf) {
+		return ginx.Result{
+			Code: errs.FollowInvalidInput,
+			Msg:  "不能" + action + "自己",
+		}, nil
+	}
+	if err != nil {
+		h.log.Error(action+"失败", logger.Error(err),
+			logger.Int64("uid", uid),
+			logger.Int64("target", target))
+		return ginx.Result{Code: errs.FollowInternalServerError, Msg: "系统异常，请重试"}, err
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  action + "成功",
+	}, nil
+}
+
+type BlockedListReq struct {
+	// Type block 或者 mute
+	Type   string `json:"type"`
+	Cursor int64  `json:"cursor"`
+	Limit  int64  `json:"limit"`
+}
+
+// BlockedList 自己拉黑或者静音的用户列表
+func (h *FollowHandler) BlockedList(ctx *gin.Context, req BlockedListReq, uc jwtware.UserClaims) (ginx.Result, error) {
+	var typ domain.BlockType
+	switch req.Type {
+	case "block":
+		typ = domain.BlockTypeBlock
+	case "mute":
+		typ = domain.BlockTypeMute
+	}
+	if !typ.Valid() || req.Cursor < 0 {
+		return ginx.Result{
+			Code: errs.FollowInvalidInput,
+			Msg:  "参数错误",
+		}, nil
+	}
+	if req.Limit <= 0 {
+		req.Limit = followListDefaultLimit
+	}
+	if req.Limit > followListMaxLimit {
+		req.Limit = followListMaxLimit
+	}
+	relations, err := h.blockSvc.List(ctx, uc.Uid, typ, req.Cursor, req.Limit)
+	if err != nil {
+		h.log.Error("获取屏蔽列表失败", logger.Error(err), logger.Int64("uid", uc.Uid))
+		return ginx.Result{Code: errs.FollowInternalServerError, Msg: "系统异常，请重试"}, err
+	}
+	uids := make([]int64, 0, len(relations))
+	for _, r := range relations {
+		uids = append(uids, r.Target)
+	}
+	users, err := h.renderUsers(ctx, uc.Uid, uids)
+	if err != nil {
+		h.log.Error("获取屏蔽列表失败", logger.Error(err), logger.Int64("uid", uc.Uid))
+		return ginx.Result{Code: errs.FollowInternalServerError, Msg: "系统异常，请重试"}, err
+	}
+	res := FollowListVo{Users: users}
+	if int64(len(relations)) == req.Limit {
+		res.NextCursor = relations[len(relations)-1].ID
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "获取屏蔽列表成功",
+		Data: res,
+	}, nil
+}
+
+type RecommendationsReq struct {
+	Limit int `json:"limit"`
+}
+
+type RecommendationVo struct {
+	FollowUserVo
+	// Reason 推荐理由：second_degree 关注的人也关注了他，tag 有相同的兴趣标签，liked 点赞过他的文章
+	Reason string `json:"reason"`
+}
+
+// Recommendations 可能认识的人，已经关注的、拉黑静音的和标记不感兴趣的都不会出现
+func (h *FollowHandler) Recommendations(ctx *gin.Context, req RecommendationsReq, uc jwtware.UserClaims) (ginx.Result, error) {
+	if req.Limit <= 0 {
+		req.Limit = followListDefaultLimit
+	}
+	if req.Limit > followListMaxLimit {
+		req.Limit = followListMaxLimit
+	}
+	recs, err := h.recSvc.Recommend(ctx, uc.Uid, req.Limit)
+	if err != nil {
+		h.log.Error("获取关注推荐失败", logger.Error(err), logger.Int64("uid", uc.Uid))
+		return ginx.Result{Code: errs.FollowInternalServerError, Msg: "系统异常，请重试"}, err
+	}
+	uids := make([]int64, 0, len(recs))
+	for _, rec := range recs {
+		uids = append(uids, rec.Uid)
+	}
+	users, err := h.renderUsers(ctx, uc.Uid, uids)
+	if err != nil {
+		h.log.Error("获取关注推荐失败", logger.Error(err), logger.Int64("uid", uc.Uid))
+		return ginx.Result{Code: errs.FollowInternalServerError, Msg: "系统异常，请重试"}, err
+	}
+	res := make([]RecommendationVo, 0, len(recs))
+	for i, rec := range recs {
+		res = append(res, RecommendationVo{
+			FollowUserVo: users[i],
+			Reason:       string(rec.Reason),
+		})
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "获取关注推荐成功",
+		Data: res,
+	}, nil
+}
+
+type DismissRecommendationReq struct {
+	Uid int64 `json:"uid"`
+}
+
+// DismissRecommendation 不感兴趣，之后不再推荐这个人
+func (h *FollowHandler) DismissRecommendation(ctx *gin.Context, req DismissRecommendationReq, uc jwtware.UserClaims) (ginx.Result, error) {
+	if req.Uid <= 0 {
+		return ginx.Result{
+			Code: errs.FollowInvalidInput,
+			Msg:  "参数错误",
+		}, nil
+	}
+	if err := h.recSvc.Dismiss(ctx, uc.Uid, req.Uid); err != nil {
+		h.log.Error("标记不感兴趣失败", logger.Error(err),
+			logger.Int64("uid", uc.Uid),
+			logger.Int64("target", req.Uid))
+		return ginx.Result{Code: errs.FollowInternalServerError, Msg: "系统异常，请重试"}, err
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "OK",
 	}, nil
 }
@@ -21,6 +21,10 @@ func NewJWTAuth(hdl jwtware.Handler) *JWTAuth {
 	s.Add("/users/login_sms")
 	s.Add("/users/refresh_token")
 	s.Add("/users/login")
+	s.Add("/users/login/unlock/code/send")
+	s.Add("/users/login/unlock")
+	s.Add("/captcha")
+	s.Add("/captcha/verify")
 	s.Add("/oauth2/wechat/authurl")
 	s.Add("/oauth2/wechat/callback")
 	s.Add("/test/random")
@@ -74,7 +78,7 @@ func (j *JWTAuth) Middleware() gin.HandlerFunc {
 		//	return
 		//}
 
-		err = j.hdl.CheckSession(ctx, uc.Ssid)
+		err = j.hdl.CheckSession(ctx, uc.Uid, uc.Ssid)
 		if err != nil {
 			// 系统错误或者用户已经主动退出登录了
 			// 这里也可以考虑说，如果在 Redis 已经崩溃的时候，
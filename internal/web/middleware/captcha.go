@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"archi/internal/service"
+	"archi/internal/web/errs"
+	"archi/pkg/ginx"
+	"archi/pkg/logger"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// CaptchaTokenHeader 通过图形验证码之后拿到的凭证
+	CaptchaTokenHeader = "X-Captcha-Token"
+	captchaPassedKey   = "captcha_passed"
+)
+
+// CaptchaSubject 从请求里面取出需要统计失败次数的账号，取不到时返回空字符串
+type CaptchaSubject func(ctx *gin.Context) string
+
+// BodyField 从 JSON 请求体里面取出字段，读完之后把请求体放回去，后面的 Bind 不受影响
+func BodyField(field string) CaptchaSubject {
+	return func(ctx *gin.Context) string {
+		if ctx.Request.Body == nil {
+			return ""
+		}
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			return ""
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+		var m map[string]any
+		if json.Unmarshal(body, &m) != nil {
+			return ""
+		}
+		val, _ := m[field].(string)
+		return val
+	}
+}
+
+// CaptchaBuilder 自适应的图形验证码，只有账号或者 IP 失败次数过多之后才要求带上凭证
+type CaptchaBuilder struct {
+	svc service.CaptchaService
+	l   logger.Logger
+}
+
+func NewCaptchaBuilder(svc service.CaptchaService, l logger.Logger) *CaptchaBuilder {
+	return &CaptchaBuilder{
+		svc: svc,
+		l:   l,
+	}
+}
+
+// Build account 为 nil 时只按 IP 统计
+func (b *CaptchaBuilder) Build(scene string, account CaptchaSubject) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		// 带了凭证就直接使用，不管有没有触发
+		if token := ctx.GetHeader(CaptchaTokenHeader); token != "" {
+			ok, err := b.svc.Pass(ctx, token)
+			if err != nil {
+				b.l.Error("校验图形验证码凭证失败", logger.Error(err))
+				ctx.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				ctx.AbortWithStatusJSON(http.StatusOK, ginx.Result{
+					Code: errs.UserCaptchaInvalid,
+					Msg:  "图形验证码已失效，请重新获取",
+				})
+				return
+			}
+			ctx.Set(captchaPassedKey, true)
+			return
+		}
+		required, err := b.svc.Required(ctx, scene, CaptchaSubjects(ctx, account)...)
+		if err != nil {
+			// Redis 出问题的时候放行，不能因为图形验证码影响登录
+			b.l.Error("查询图形验证码状态失败", logger.Error(err))
+			return
+		}
+		if required {
+			ctx.AbortWithStatusJSON(http.StatusOK, ginx.Result{
+				Code: errs.UserCaptchaRequired,
+				Msg:  "请先完成图形验证码",
+			})
+		}
+	}
+}
+
+// CaptchaSubjects 请求对应的失败计数主体，IP 以及 account 取出来的账号
+func CaptchaSubjects(ctx *gin.Context, account CaptchaSubject) []string {
+	subjects := []string{service.CaptchaSubjectIP(ctx.ClientIP())}
+	if account != nil {
+		if acc := account(ctx); acc != "" {
+			subjects = append(subjects, service.CaptchaSubjectAccount(acc))
+		}
+	}
+	return subjects
+}
+
+// CaptchaPassed 这一次请求是否带了有效的图形验证码凭证
+func CaptchaPassed(ctx *gin.Context) bool {
+	return ctx.GetBool(captchaPassedKey)
+}
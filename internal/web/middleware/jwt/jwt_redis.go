@@ -1,39 +1,72 @@
 package jwt
 
 import (
+	_ "embed"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
-
+	"strconv"
 	"strings"
 	"time"
 )
 
+var (
+	//go:embed lua/session_create.lua
+	luaSessionCreate string
+	//go:embed lua/refresh_rotate.lua
+	luaRefreshRotate string
+)
+
 var _ Handler = &RedisJWTHandler{}
 
+// ErrSessionConflict 创建会话的时候同一个用户并发登录太多，重试几次之后还是没有成功
+var ErrSessionConflict = errors.New("并发登录冲突")
+
+const (
+	// sessionCreateRetry 创建会话时会话列表被并发修改，最多重试几次
+	sessionCreateRetry = 3
+	// lastSeenInterval 最近访问时间的精度，避免每个请求都写一次 Redis
+	lastSeenInterval = time.Minute
+	// deviceHeader 客户端上报的设备标识
+	deviceHeader = "X-Device-Id"
+)
+
+// RedisJWTHandler 每次登录生成一个会话，会话信息存在 Redis 里面
+// users:session:{uid}:ssid 是会话详情，users:sessions:{uid} 是用户所有会话的 ssid，按登录时间排序
+// 同一个用户的 key 都带 {uid} 这个 hash tag，Redis Cluster 下 Lua 脚本可以同时操作它们
 type RedisJWTHandler struct {
 	client        redis.Cmdable
 	signingMethod jwt.SigningMethod
 	rcExpiration  time.Duration
+	// maxSessions 每个用户最多同时登录多少个会话，超过之后最早登录的被挤下线，0 表示不限制
+	maxSessions int
 }
 
-func NewRedisJWTHandler(client redis.Cmdable) Handler {
+func NewRedisJWTHandler(client redis.Cmdable, maxSessions int) Handler {
 	return &RedisJWTHandler{
 		client:        client,
 		signingMethod: jwt.SigningMethodHS512,
 		rcExpiration:  time.Hour * 24 * 7,
+		maxSessions:   maxSessions,
 	}
 }
 
-func (r *RedisJWTHandler) CheckSession(ctx *gin.Context, ssid string) error {
-	cnt, err := r.client.Exists(ctx, fmt.Sprintf("users:ssid:%s", ssid)).Result()
+func (r *RedisJWTHandler) CheckSession(ctx *gin.Context, uid int64, ssid string) error {
+	key := r.sessionKey(uid, ssid)
+	lastSeen, err := r.client.HGet(ctx, key, "last_seen").Int64()
+	if errors.Is(err, redis.Nil) {
+		return ErrSessionNotFound
+	}
 	if err != nil {
 		return err
 	}
-	if cnt > 0 {
-		return ErrSessionNotFound
+	now := time.Now()
+	if now.Sub(time.UnixMilli(lastSeen)) > lastSeenInterval {
+		// 更新失败不影响这一次请求
+		_ = r.client.HSet(ctx, key, "last_seen", now.UnixMilli(), "ip", ctx.ClientIP()).Err()
 	}
 	return nil
 }
@@ -53,19 +86,157 @@ func (r *RedisJWTHandler) ExtractTokenString(ctx *gin.Context) string {
 
 func (r *RedisJWTHandler) SetLoginToken(ctx *gin.Context, uid int64) error {
 	ssid := uuid.New().String()
-	err := r.setRefreshToken(ctx, uid, ssid)
+	rid := uuid.New().String()
+	if err := r.createSession(ctx, uid, ssid, rid); err != nil {
+		return err
+	}
+	err := r.setRefreshToken(ctx, uid, ssid, rid)
 	if err != nil {
 		return err
 	}
 	return r.SetJWTToken(ctx, uid, ssid)
 }
 
+// createSession 脚本只能操作 KEYS 里面的 key，所以先读出已有的会话，再把它们的 key 一起传进去
+// 读完之后会话列表又变了的话脚本返回 0，重新读一次
+func (r *RedisJWTHandler) createSession(ctx *gin.Context, uid int64, ssid, rid string) error {
+	userKey := r.userSessionsKey(uid)
+	for i := 0; i < sessionCreateRetry; i++ {
+		olds, err := r.client.ZRange(ctx, userKey, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(olds)+2)
+		keys = append(keys, r.sessionKey(uid, ssid), userKey)
+		now := time.Now().UnixMilli()
+		args := make([]any, 0, len(olds)+19)
+		args = append(args, ssid, now, r.rcExpiration.Milliseconds(), r.maxSessions, len(olds))
+		for _, old := range olds {
+			keys = append(keys, r.sessionKey(uid, old))
+			args = append(args, old)
+		}
+		args = append(args,
+			"uid", uid,
+			"device", ctx.GetHeader(deviceHeader),
+			"user_agent", ctx.GetHeader("User-Agent"),
+			"ip", ctx.ClientIP(),
+			"ctime", now,
+			"last_seen", now,
+			"refresh_id", rid,
+		)
+		res, err := r.client.Eval(ctx, luaSessionCreate, keys, args...).Int()
+		if err != nil {
+			return err
+		}
+		if res == 1 {
+			return nil
+		}
+	}
+	return ErrSessionConflict
+}
+
 func (r *RedisJWTHandler) ClearToken(ctx *gin.Context) error {
 	ctx.Header("x-jwt-token", "")
 	ctx.Header("x-refresh-token", "")
 	uc := ctx.MustGet("user").(UserClaims)
+	return r.deleteSessions(ctx, uc.Uid, uc.Ssid)
+}
 
-	return r.client.Set(ctx, fmt.Sprintf("users:ssid:%s", uc.Ssid), "", r.rcExpiration).Err()
+func (r *RedisJWTHandler) RefreshToken(ctx *gin.Context) error {
+	// 假定长 token 也放在这里
+	tokenStr := ctx.GetHeader("X-Refresh-Token")
+	var rc RefreshClaims
+	token, err := jwt.ParseWithClaims(tokenStr, &rc, func(token *jwt.Token) (interface{}, error) {
+		return RefreshTokenKey, nil
+	})
+	if err != nil || token == nil || !token.Valid {
+		return ErrInvalidRefreshToken
+	}
+	rid := uuid.New().String()
+	res, err := r.client.Eval(ctx, luaRefreshRotate,
+		[]string{r.sessionKey(rc.Uid, rc.Ssid), r.userSessionsKey(rc.Uid)},
+		rc.Ssid, rc.Rid, rid, time.Now().UnixMilli(), r.rcExpiration.Milliseconds(),
+	).Int()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case 0:
+		return ErrSessionNotFound
+	case -1:
+		return ErrRefreshTokenReused
+	}
+	if err = r.setRefreshToken(ctx, rc.Uid, rc.Ssid, rid); err != nil {
+		return err
+	}
+	return r.SetJWTToken(ctx, rc.Uid, rc.Ssid)
+}
+
+func (r *RedisJWTHandler) ListSessions(ctx *gin.Context, uid int64) ([]Session, error) {
+	ssids, err := r.client.ZRevRange(ctx, r.userSessionsKey(uid), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(ssids) == 0 {
+		return nil, nil
+	}
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, 0, len(ssids))
+	for _, ssid := range ssids {
+		cmds = append(cmds, pipe.HGetAll(ctx, r.sessionKey(uid, ssid)))
+	}
+	if _, err = pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	res := make([]Session, 0, len(ssids))
+	var expired []any
+	for i, cmd := range cmds {
+		vals := cmd.Val()
+		if len(vals) == 0 {
+			expired = append(expired, ssids[i])
+			continue
+		}
+		ctime, _ := strconv.ParseInt(vals["ctime"], 10, 64)
+		lastSeen, _ := strconv.ParseInt(vals["last_seen"], 10, 64)
+		res = append(res, Session{
+			Ssid:      ssids[i],
+			Device:    vals["device"],
+			UserAgent: vals["user_agent"],
+			IP:        vals["ip"],
+			Ctime:     time.UnixMilli(ctime),
+			LastSeen:  time.UnixMilli(lastSeen),
+		})
+	}
+	if len(expired) > 0 {
+		// 清理已经过期的会话，失败了下次再清理
+		_ = r.client.ZRem(ctx, r.userSessionsKey(uid), expired...).Err()
+	}
+	return res, nil
+}
+
+func (r *RedisJWTHandler) RevokeSession(ctx *gin.Context, uid int64, ssid string) error {
+	score := r.client.ZScore(ctx, r.userSessionsKey(uid), ssid)
+	if errors.Is(score.Err(), redis.Nil) {
+		return ErrSessionNotFound
+	}
+	if score.Err() != nil {
+		return score.Err()
+	}
+	return r.deleteSessions(ctx, uid, ssid)
+}
+
+func (r *RedisJWTHandler) RevokeAllSessions(ctx *gin.Context, uid int64, keep string) error {
+	ssids, err := r.client.ZRange(ctx, r.userSessionsKey(uid), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	revoked := make([]string, 0, len(ssids))
+	for _, ssid := range ssids {
+		if ssid != keep {
+			revoked = append(revoked, ssid)
+		}
+	}
+	return r.deleteSessions(ctx, uid, revoked...)
 }
 
 func (r *RedisJWTHandler) SetJWTToken(ctx *gin.Context, uid int64, ssid string) error {
@@ -87,10 +258,11 @@ func (r *RedisJWTHandler) SetJWTToken(ctx *gin.Context, uid int64, ssid string)
 	return nil
 }
 
-func (r *RedisJWTHandler) setRefreshToken(ctx *gin.Context, uid int64, ssid string) error {
+func (r *RedisJWTHandler) setRefreshToken(ctx *gin.Context, uid int64, ssid, rid string) error {
 	rc := RefreshClaims{
 		Uid:  uid,
 		Ssid: ssid,
+		Rid:  rid,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(r.rcExpiration)),
 		},
@@ -103,3 +275,29 @@ func (r *RedisJWTHandler) setRefreshToken(ctx *gin.Context, uid int64, ssid stri
 	ctx.Header("x-refresh-token", tokenStr)
 	return nil
 }
+
+// deleteSessions 删除会话详情，并从用户的会话列表里面移除
+func (r *RedisJWTHandler) deleteSessions(ctx *gin.Context, uid int64, ssids ...string) error {
+	if len(ssids) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(ssids))
+	members := make([]any, 0, len(ssids))
+	for _, ssid := range ssids {
+		keys = append(keys, r.sessionKey(uid, ssid))
+		members = append(members, ssid)
+	}
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, keys...)
+	pipe.ZRem(ctx, r.userSessionsKey(uid), members...)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisJWTHandler) sessionKey(uid int64, ssid string) string {
+	return fmt.Sprintf("users:session:{%d}:%s", uid, ssid)
+}
+
+func (r *RedisJWTHandler) userSessionsKey(uid int64) string {
+	return fmt.Sprintf("users:sessions:{%d}", uid)
+}
@@ -0,0 +1,165 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHandler(t *testing.T, maxSessions int) (*RedisJWTHandler, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	return NewRedisJWTHandler(client, maxSessions).(*RedisJWTHandler), mr
+}
+
+func newTestContext() (*gin.Context, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/users/login", nil)
+	return ctx, recorder
+}
+
+// login 登录一次，返回会话 id 和 refresh token
+func login(t *testing.T, hdl *RedisJWTHandler, uid int64) (string, string) {
+	ctx, recorder := newTestContext()
+	require.NoError(t, hdl.SetLoginToken(ctx, uid))
+	refresh := recorder.Header().Get("x-refresh-token")
+	var rc RefreshClaims
+	_, _, err := jwt.NewParser().ParseUnverified(refresh, &rc)
+	require.NoError(t, err)
+	return rc.Ssid, refresh
+}
+
+func refresh(hdl *RedisJWTHandler, token string) (string, error) {
+	ctx, recorder := newTestContext()
+	ctx.Request.Header.Set("X-Refresh-Token", token)
+	err := hdl.RefreshToken(ctx)
+	return recorder.Header().Get("x-refresh-token"), err
+}
+
+func TestRedisJWTHandler_SetLoginToken(t *testing.T) {
+	testCases := []struct {
+		name        string
+		maxSessions int
+		logins      int
+		// wantAlive 按登录顺序，哪些会话还有效
+		wantAlive []bool
+	}{
+		{
+			name:        "没有超过上限",
+			maxSessions: 3,
+			logins:      3,
+			wantAlive:   []bool{true, true, true},
+		},
+		{
+			name:        "超过上限挤掉最早的",
+			maxSessions: 2,
+			logins:      4,
+			wantAlive:   []bool{false, false, true, true},
+		},
+		{
+			name:      "不限制",
+			logins:    4,
+			wantAlive: []bool{true, true, true, true},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hdl, mr := newTestHandler(t, tc.maxSessions)
+			ssids := make([]string, 0, tc.logins)
+			for i := 0; i < tc.logins; i++ {
+				ssid, _ := login(t, hdl, 123)
+				ssids = append(ssids, ssid)
+				// 会话按登录的毫秒时间排序，保证先后顺序
+				time.Sleep(time.Millisecond * 2)
+			}
+			for i, ssid := range ssids {
+				ctx, _ := newTestContext()
+				err := hdl.CheckSession(ctx, 123, ssid)
+				if tc.wantAlive[i] {
+					assert.NoError(t, err, "session %d", i)
+					// 同一个用户的 key 带同一个 hash tag
+					assert.True(t, mr.Exists("users:session:{123}:"+ssid))
+				} else {
+					assert.ErrorIs(t, err, ErrSessionNotFound, "session %d", i)
+				}
+			}
+			members, err := mr.ZMembers("users:sessions:{123}")
+			require.NoError(t, err)
+			alive := 0
+			for _, ok := range tc.wantAlive {
+				if ok {
+					alive++
+				}
+			}
+			assert.Len(t, members, alive)
+		})
+	}
+}
+
+func TestRedisJWTHandler_SetLoginTokenCleanExpired(t *testing.T) {
+	hdl, mr := newTestHandler(t, 2)
+	expired, _ := login(t, hdl, 123)
+	// 会话详情已经过期，会话列表里面还有
+	mr.Del("users:session:{123}:" + expired)
+	first, _ := login(t, hdl, 123)
+	second, _ := login(t, hdl, 123)
+
+	members, err := mr.ZMembers("users:sessions:{123}")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{first, second}, members)
+}
+
+func TestRedisJWTHandler_SetLoginTokenConflict(t *testing.T) {
+	hdl, mr := newTestHandler(t, 2)
+	// 会话列表里面有一个脚本不知道的会话，模拟读完之后有并发登录
+	ctx, _ := newTestContext()
+	keys := []string{hdl.sessionKey(123, "new"), hdl.userSessionsKey(123)}
+	_, err := mr.ZAdd("users:sessions:{123}", 1, "other")
+	require.NoError(t, err)
+	res, err := hdl.client.Eval(ctx, luaSessionCreate, keys, "new", 2, 60000, 2, 0, "uid", 123).Int()
+	require.NoError(t, err)
+	assert.Equal(t, 0, res)
+	assert.False(t, mr.Exists("users:session:{123}:new"))
+
+	// 正常登录会重新读会话列表，然后成功
+	ssid, _ := login(t, hdl, 123)
+	assert.True(t, mr.Exists("users:session:{123}:"+ssid))
+}
+
+func TestRedisJWTHandler_RefreshToken(t *testing.T) {
+	hdl, mr := newTestHandler(t, 0)
+	ssid, token := login(t, hdl, 123)
+
+	// 第一次刷新正常轮换
+	newToken, err := refresh(hdl, token)
+	require.NoError(t, err)
+	assert.NotEmpty(t, newToken)
+	assert.NotEqual(t, token, newToken)
+
+	// 新的 refresh token 可以继续刷新
+	newToken, err = refresh(hdl, newToken)
+	require.NoError(t, err)
+
+	// 旧的 refresh token 再次使用，整个会话失效
+	_, err = refresh(hdl, token)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	assert.False(t, mr.Exists("users:session:{123}:"+ssid))
+	ctx, _ := newTestContext()
+	assert.ErrorIs(t, hdl.CheckSession(ctx, 123, ssid), ErrSessionNotFound)
+
+	// 会话失效之后最新的 refresh token 也不能用了
+	_, err = refresh(hdl, newToken)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+
+	_, err = refresh(hdl, "invalid")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
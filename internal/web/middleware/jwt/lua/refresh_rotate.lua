@@ -0,0 +1,24 @@
+-- 轮换 refresh token，只有当前的 refresh token 可以换新的
+local sessionKey = KEYS[1]
+local userKey = KEYS[2]
+local ssid = ARGV[1]
+local oldRid = ARGV[2]
+local newRid = ARGV[3]
+local now = ARGV[4]
+local ttl = tonumber(ARGV[5])
+
+local rid = redis.call('HGET', sessionKey, 'refresh_id')
+if not rid then
+    -- 会话不存在，已经退出或者过期了
+    return 0
+end
+if rid ~= oldRid then
+    -- 已经换过的 refresh token 又被使用，可能已经泄露，整个会话直接失效
+    redis.call('DEL', sessionKey)
+    redis.call('ZREM', userKey, ssid)
+    return -1
+end
+redis.call('HSET', sessionKey, 'refresh_id', newRid, 'last_seen', now)
+redis.call('PEXPIRE', sessionKey, ttl)
+redis.call('PEXPIRE', userKey, ttl)
+return 1
@@ -0,0 +1,48 @@
+-- 创建会话，并按最大会话数淘汰最早登录的会话
+-- 用到的 key 全部通过 KEYS 传进来，key 里面都带 {uid} 这个 hash tag，在 Redis Cluster 下位于同一个 slot
+-- KEYS[1] 新会话，KEYS[2] 用户的会话列表，KEYS[3] 开始是调用方读到的已有会话，和 ARGV 里面的 ssid 一一对应
+local sessionKey = KEYS[1]
+local userKey = KEYS[2]
+local ssid = ARGV[1]
+local now = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+local max = tonumber(ARGV[4])
+local n = tonumber(ARGV[5])
+
+local keys = {[ssid] = sessionKey}
+for i = 1, n do
+    keys[ARGV[5 + i]] = KEYS[2 + i]
+end
+-- 调用方读完会话列表之后又有新的登录，没有拿到这些会话的 key，让调用方重新读一次
+local members = redis.call('ZRANGE', userKey, 0, -1)
+for _, m in ipairs(members) do
+    if not keys[m] then
+        return 0
+    end
+end
+
+local fields = {}
+for i = 6 + n, #ARGV do
+    fields[#fields + 1] = ARGV[i]
+end
+redis.call('HSET', sessionKey, unpack(fields))
+redis.call('PEXPIRE', sessionKey, ttl)
+redis.call('ZADD', userKey, now, ssid)
+redis.call('PEXPIRE', userKey, ttl)
+
+-- 顺便清理已经过期的会话
+for _, m in ipairs(members) do
+    if redis.call('EXISTS', keys[m]) == 0 then
+        redis.call('ZREM', userKey, m)
+    end
+end
+
+local cnt = redis.call('ZCARD', userKey)
+if max > 0 and cnt > max then
+    local olds = redis.call('ZRANGE', userKey, 0, cnt - max - 1)
+    for _, m in ipairs(olds) do
+        redis.call('DEL', keys[m])
+        redis.call('ZREM', userKey, m)
+    end
+end
+return 1
@@ -4,17 +4,35 @@ import (
 	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"strconv"
+	"time"
 )
 
-var ErrSessionNotFound = errors.New("会话不存在或已过期")
+var (
+	ErrSessionNotFound = errors.New("会话不存在或已过期")
+	// ErrInvalidRefreshToken refresh token 格式不对、签名不对或者已经过期
+	ErrInvalidRefreshToken = errors.New("refresh token 无效")
+	// ErrRefreshTokenReused 已经轮换过的 refresh token 又被使用，对应的会话已经被强制退出
+	ErrRefreshTokenReused = errors.New("refresh token 被重复使用")
+)
 
 //go:generate mockgen -source=./types.go -package=jwtmocks -destination=./mocks/handler.mock.go Handler
 type Handler interface {
 	ClearToken(ctx *gin.Context) error
 	SetLoginToken(ctx *gin.Context, uid int64) error
 	SetJWTToken(ctx *gin.Context, uid int64, ssid string) error
-	CheckSession(ctx *gin.Context, ssid string) error
+	// CheckSession 会话还有效时返回 nil，否则返回 ErrSessionNotFound
+	CheckSession(ctx *gin.Context, uid int64, ssid string) error
 	ExtractTokenString(ctx *gin.Context) string
+	// RefreshToken 校验 X-Refresh-Token，轮换 refresh token 并签发新的 access token
+	RefreshToken(ctx *gin.Context) error
+
+	// ListSessions 用户所有有效的会话，最近登录的在前面
+	ListSessions(ctx *gin.Context, uid int64) ([]Session, error)
+	// RevokeSession 退出用户的某个会话，会话不属于这个用户时返回 ErrSessionNotFound
+	RevokeSession(ctx *gin.Context, uid int64, ssid string) error
+	// RevokeAllSessions 退出用户的所有会话，keep 不为空时保留这个会话
+	RevokeAllSessions(ctx *gin.Context, uid int64, keep string) error
 }
 
 var AccessTokenKey = []byte("k6CswdUm77WKcbM68UQUuxVsHSpTCwgK")
@@ -27,8 +45,25 @@ type UserClaims struct {
 	UserAgent string
 }
 
+// SSEOwner 流式接口断线补发的时候，只允许同一个用户补发
+func (c UserClaims) SSEOwner() string {
+	return strconv.FormatInt(c.Uid, 10)
+}
+
 type RefreshClaims struct {
 	jwt.RegisteredClaims
 	Uid  int64  //User ID
 	Ssid string //Session ID
+	Rid  string //Refresh ID，每次刷新都会换一个新的
+}
+
+// Session 一次登录对应一个会话
+type Session struct {
+	Ssid      string
+	Device    string
+	UserAgent string
+	// IP 最近一次访问的 IP
+	IP       string
+	Ctime    time.Time
+	LastSeen time.Time
 }
@@ -0,0 +1,118 @@
+package web
+
+import (
+	"archi/internal/domain"
+	"archi/internal/service"
+	"archi/internal/web/errs"
+	"archi/internal/web/middleware/jwt"
+	"archi/pkg/ginx"
+	"archi/pkg/logger"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+)
+
+// ModerationHandler 人工复审队列，只有配置中的复审人员可以访问
+type ModerationHandler struct {
+	svc service.ModerationService
+	l   logger.Logger
+}
+
+func NewModerationHandler(svc service.ModerationService, l logger.Logger) *ModerationHandler {
+	return &ModerationHandler{
+		svc: svc,
+		l:   l,
+	}
+}
+
+func (h *ModerationHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/moderation")
+	g.POST("/queue", ginx.WrapBodyAndClaims(h.Queue))
+	g.POST("/review", ginx.WrapBodyAndClaims(h.Review))
+}
+
+type ModerationQueueReq struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit" binding:"max=100"`
+}
+
+type ModerationVO struct {
+	Id      int64    `json:"id"`
+	Biz     string   `json:"biz"`
+	BizId   int64    `json:"biz_id"`
+	Uid     int64    `json:"uid"`
+	Content string   `json:"content"`
+	Verdict string   `json:"verdict"`
+	Reasons []string `json:"reasons"`
+	Source  string   `json:"source"`
+	Utime   string   `json:"utime"`
+}
+
+func (h *ModerationHandler) Queue(ctx *gin.Context, req ModerationQueueReq, uc jwt.UserClaims) (ginx.Result, error) {
+	if req.Limit <= 0 {
+		req.Limit = 20
+	}
+	ms, err := h.svc.ListPending(ctx, uc.Uid, req.Offset, req.Limit)
+	if errors.Is(err, service.ErrModerationForbidden) {
+		return ginx.Result{
+			Code: errs.ModerationForbidden,
+			Msg:  "没有复审权限",
+		}, nil
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: errs.ModerationInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "获取复审队列成功",
+		Data: slice.Map(ms, func(idx int, src domain.Moderation) ModerationVO {
+			return ModerationVO{
+				Id:      src.ID,
+				Biz:     src.Biz,
+				BizId:   src.BizId,
+				Uid:     src.Uid,
+				Content: src.Content,
+				Verdict: src.Verdict.String(),
+				Reasons: src.Reasons,
+				Source:  string(src.Source),
+				Utime:   src.Utime.Format(time.DateTime),
+			}
+		}),
+	}, nil
+}
+
+type ModerationReviewReq struct {
+	Id      int64 `json:"id" binding:"required"`
+	Approve bool  `json:"approve"`
+}
+
+func (h *ModerationHandler) Review(ctx *gin.Context, req ModerationReviewReq, uc jwt.UserClaims) (ginx.Result, error) {
+	err := h.svc.Review(ctx, uc.Uid, req.Id, req.Approve)
+	switch {
+	case errors.Is(err, service.ErrModerationForbidden):
+		return ginx.Result{
+			Code: errs.ModerationForbidden,
+			Msg:  "没有复审权限",
+		}, nil
+	case errors.Is(err, service.ErrModerationNotPending):
+		return ginx.Result{
+			Code: errs.ModerationNotPending,
+			Msg:  "该内容已被处理",
+		}, nil
+	case err != nil:
+		return ginx.Result{
+			Code: errs.ModerationInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "复审成功",
+	}, nil
+}
@@ -0,0 +1,276 @@
+package web
+
+import (
+	"archi/internal/domain"
+	"archi/internal/service"
+	"archi/internal/web/errs"
+	"archi/internal/web/middleware/jwt"
+	"archi/pkg/ginx"
+	"archi/pkg/logger"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+)
+
+// sseEventNotification 推送新通知的 SSE 事件类型
+const sseEventNotification = "notification"
+
+type NotificationHandler struct {
+	svc service.NotificationService
+	l   logger.Logger
+}
+
+func NewNotificationHandler(svc service.NotificationService, l logger.Logger) *NotificationHandler {
+	return &NotificationHandler{
+		svc: svc,
+		l:   l,
+	}
+}
+
+func (h *NotificationHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/notifications")
+	g.POST("/list", ginx.WrapBodyAndClaims(h.List))
+	g.GET("/unread", ginx.WrapClaims(h.Unread))
+	g.POST("/read", ginx.WrapBodyAndClaims(h.MarkRead))
+	g.POST("/read_all", ginx.WrapClaims(h.MarkAllRead))
+	g.GET("/settings", ginx.WrapClaims(h.Settings))
+	g.POST("/settings", ginx.WrapBodyAndClaims(h.SetMuted))
+	g.GET("/stream", ginx.WrapEventStreamClaims(h.Stream))
+}
+
+type NotificationListReq struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit" binding:"max=100"`
+}
+
+type NotificationActorVO struct {
+	Id       int64  `json:"id"`
+	Nickname string `json:"nickname"`
+	Avatar   string `json:"avatar"`
+}
+
+type NotificationVO struct {
+	Id     int64                 `json:"id"`
+	Type   string                `json:"type"`
+	Biz    string                `json:"biz"`
+	BizId  int64                 `json:"biz_id"`
+	Actors []NotificationActorVO `json:"actors"`
+	// ActorCnt 聚合的总人次
+	ActorCnt int64 `json:"actor_cnt"`
+	// Summary 例如 "张三 和其他 12 人赞了你的文章"
+	Summary string            `json:"summary"`
+	Unread  bool              `json:"unread"`
+	Ext     map[string]string `json:"ext"`
+	Utime   string            `json:"utime"`
+}
+
+func (h *NotificationHandler) List(ctx *gin.Context, req NotificationListReq, uc jwt.UserClaims) (ginx.Result, error) {
+	if req.Limit <= 0 {
+		req.Limit = 20
+	}
+	ns, err := h.svc.List(ctx, uc.Uid, req.Offset, req.Limit)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.NotificationInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "获取通知成功",
+		Data: slice.Map(ns, func(idx int, src domain.Notification) NotificationVO {
+			return h.toVO(src)
+		}),
+	}, nil
+}
+
+type NotificationUnreadVO struct {
+	Total int64            `json:"total"`
+	Types map[string]int64 `json:"types"`
+}
+
+func (h *NotificationHandler) Unread(ctx *gin.Context, uc jwt.UserClaims) (ginx.Result, error) {
+	cnts, err := h.svc.UnreadCounts(ctx, uc.Uid)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.NotificationInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	vo := NotificationUnreadVO{Types: make(map[string]int64, len(domain.NotificationTypes))}
+	for _, typ := range domain.NotificationTypes {
+		vo.Types[string(typ)] = cnts[typ]
+		vo.Total += cnts[typ]
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "获取未读数成功",
+		Data: vo,
+	}, nil
+}
+
+type NotificationReadReq struct {
+	Id int64 `json:"id" binding:"required"`
+}
+
+func (h *NotificationHandler) MarkRead(ctx *gin.Context, req NotificationReadReq, uc jwt.UserClaims) (ginx.Result, error) {
+	err := h.svc.MarkRead(ctx, uc.Uid, req.Id)
+	if errors.Is(err, service.ErrNotificationNotFound) {
+		return ginx.Result{
+			Code: errs.NotificationInvalidInput,
+			Msg:  "通知不存在",
+		}, nil
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: errs.NotificationInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "标记已读成功",
+	}, nil
+}
+
+func (h *NotificationHandler) MarkAllRead(ctx *gin.Context, uc jwt.UserClaims) (ginx.Result, error) {
+	if err := h.svc.MarkAllRead(ctx, uc.Uid); err != nil {
+		return ginx.Result{
+			Code: errs.NotificationInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "全部标记已读成功",
+	}, nil
+}
+
+// NotificationSettingsVO 每种通知是否开启了免打扰
+type NotificationSettingsVO struct {
+	Muted map[string]bool `json:"muted"`
+}
+
+func (h *NotificationHandler) Settings(ctx *gin.Context, uc jwt.UserClaims) (ginx.Result, error) {
+	muted, err := h.svc.MutedTypes(ctx, uc.Uid)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.NotificationInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	vo := NotificationSettingsVO{Muted: make(map[string]bool, len(domain.NotificationTypes))}
+	for _, typ := range domain.NotificationTypes {
+		vo.Muted[string(typ)] = false
+	}
+	for _, typ := range muted {
+		vo.Muted[string(typ)] = true
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "获取通知设置成功",
+		Data: vo,
+	}, nil
+}
+
+type NotificationMuteReq struct {
+	Type  string `json:"type" binding:"required"`
+	Muted bool   `json:"muted"`
+}
+
+func (h *NotificationHandler) SetMuted(ctx *gin.Context, req NotificationMuteReq, uc jwt.UserClaims) (ginx.Result, error) {
+	typ := domain.NotificationType(req.Type)
+	if !typ.Valid() {
+		return ginx.Result{
+			Code: errs.NotificationInvalidInput,
+			Msg:  "不支持的通知类型",
+		}, nil
+	}
+	if err := h.svc.SetMuted(ctx, uc.Uid, typ, req.Muted); err != nil {
+		return ginx.Result{
+			Code: errs.NotificationInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "设置成功",
+	}, nil
+}
+
+// Stream 通过 SSE 推送新通知，断线重连之后客户端需要重新拉一次未读数
+// 订阅跟着请求的 ctx 走，gin.Context 会被放回池子里复用，不能在 goroutine 里面持有
+func (h *NotificationHandler) Stream(ctx *gin.Context, uc jwt.UserClaims) (<-chan ginx.SSEEvent, ginx.Result, error) {
+	reqCtx := ctx.Request.Context()
+	ns, err := h.svc.Subscribe(reqCtx, uc.Uid)
+	if err != nil {
+		return nil, ginx.Result{
+			Code: errs.NotificationInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	events := make(chan ginx.SSEEvent)
+	go func() {
+		defer close(events)
+		for n := range ns {
+			select {
+			case events <- ginx.SSEEvent{Event: sseEventNotification, Data: h.toVO(n)}:
+			case <-reqCtx.Done():
+				return
+			}
+		}
+	}()
+	return events, ginx.Result{}, nil
+}
+
+func (h *NotificationHandler) toVO(n domain.Notification) NotificationVO {
+	return NotificationVO{
+		Id:    n.ID,
+		Type:  string(n.Type),
+		Biz:   n.Biz,
+		BizId: n.BizId,
+		Actors: slice.Map(n.Actors, func(idx int, src domain.Actor) NotificationActorVO {
+			return NotificationActorVO{Id: src.ID, Nickname: src.Nickname, Avatar: src.Avatar}
+		}),
+		ActorCnt: n.ActorCnt,
+		Summary:  h.summary(n),
+		Unread:   n.UnreadCnt > 0,
+		Ext:      n.Ext,
+		Utime:    n.Utime.Format(time.DateTime),
+	}
+}
+
+func (h *NotificationHandler) summary(n domain.Notification) string {
+	who := "有人"
+	if len(n.Actors) > 0 && n.Actors[0].Nickname != "" {
+		who = n.Actors[0].Nickname
+	}
+	if n.ActorCnt > 1 {
+		who = fmt.Sprintf("%s 和其他 %d 人", who, n.ActorCnt-1)
+	}
+	target := "内容"
+	switch n.Biz {
+	case "article":
+		target = "文章"
+	case "comment":
+		target = "评论"
+	}
+	switch n.Type {
+	case domain.NotificationTypeFollow:
+		return who + "关注了你"
+	case domain.NotificationTypeLike:
+		return who + "赞了你的" + target
+	case domain.NotificationTypeComment:
+		return who + "回复了你的评论"
+	case domain.NotificationTypeReward:
+		return who + "打赏了你的" + target
+	case domain.NotificationTypeMention:
+		return who + "在" + target + "中提到了你"
+	default:
+		return who
+	}
+}
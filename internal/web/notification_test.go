@@ -0,0 +1,56 @@
+package web
+
+import (
+	"archi/internal/domain"
+	"archi/internal/repository"
+	"archi/internal/service"
+	"archi/internal/web/middleware/jwt"
+	"archi/pkg/logger"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNotificationRepo 只实现了 Subscribe，通过 ch 模拟 Redis 推过来的通知
+type fakeNotificationRepo struct {
+	repository.NotificationRepository
+	ch chan domain.Notification
+}
+
+func (r *fakeNotificationRepo) Subscribe(ctx context.Context) (<-chan domain.Notification, error) {
+	return r.ch, nil
+}
+
+func TestNotificationHandler_StreamClosedWithRequest(t *testing.T) {
+	repo := &fakeNotificationRepo{ch: make(chan domain.Notification)}
+	hdl := NewNotificationHandler(service.NewDefaultNotificationService(repo, nil, logger.NewNopLogger()), logger.NewNopLogger())
+
+	reqCtx, cancel := context.WithCancel(context.Background())
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/notifications/stream", nil).WithContext(reqCtx)
+	events, _, err := hdl.Stream(ctx, jwt.UserClaims{Uid: 123})
+	require.NoError(t, err)
+
+	repo.ch <- domain.Notification{Uid: 123, Type: domain.NotificationTypeLike}
+	select {
+	case evt := <-events:
+		assert.Equal(t, sseEventNotification, evt.Event)
+	case <-time.After(time.Second):
+		t.Fatal("没有收到通知")
+	}
+
+	// 客户端断开之后订阅被移除，转发的 goroutine 退出并关闭 events
+	cancel()
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("客户端断开之后 events 没有关闭")
+	}
+}
@@ -1,12 +1,15 @@
 package web
 
 import (
+	"archi/internal/domain"
 	"archi/internal/service"
 	"archi/internal/web/errs"
 	"archi/internal/web/middleware/jwt"
 	"archi/pkg/ginx"
+	"github.com/ecodeclub/ekit/slice"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"unicode/utf8"
 )
 
 // SearchHandler 负责处理搜索相关的HTTP请求
@@ -26,6 +29,8 @@ func (h *SearchHandler) RegisterRoutes(e *gin.Engine) {
 	sg := e.Group("/search")
 	// 使用 POST /api/search/ 接口进行搜索，需要JWT认证
 	sg.POST("/", ginx.WrapBodyAndClaims(h.Search))
+	// @ 用户时的昵称补全
+	sg.POST("/users/suggest", ginx.WrapBodyAndClaims(h.SuggestUsers))
 }
 
 // SearchReq 定义了搜索请求的结构体
@@ -50,3 +55,40 @@ func (h *SearchHandler) Search(ctx *gin.Context, req SearchReq, uc jwt.UserClaim
 		Data: res,
 	}, nil
 }
+
+type SuggestUsersReq struct {
+	Prefix string `json:"prefix"`
+	Limit  int    `json:"limit"`
+}
+
+// UserSuggestionVo 补全只返回 @ 需要的字段，不暴露邮箱和手机号
+type UserSuggestionVo struct {
+	Id       int64  `json:"id"`
+	Nickname string `json:"nickname"`
+}
+
+func (h *SearchHandler) SuggestUsers(ctx *gin.Context, req SuggestUsersReq, uc jwt.UserClaims) (ginx.Result, error) {
+	if req.Limit <= 0 || req.Limit > 20 {
+		req.Limit = 10
+	}
+	if utf8.RuneCountInString(req.Prefix) > 32 {
+		return ginx.Result{
+			Code: errs.SearchInvalidInput,
+			Msg:  "输入过长",
+		}, nil
+	}
+	users, err := h.svc.SuggestUsers(ctx, uc.Uid, req.Prefix, req.Limit)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.SearchInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "OK",
+		Data: slice.Map(users, func(idx int, src domain.UserES) UserSuggestionVo {
+			return UserSuggestionVo{Id: src.Id, Nickname: src.Nickname}
+		}),
+	}, nil
+}
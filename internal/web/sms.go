@@ -0,0 +1,174 @@
+package web
+
+import (
+	"archi/internal/domain"
+	"archi/internal/service"
+	"archi/internal/web/errs"
+	"archi/internal/web/middleware/jwt"
+	"archi/pkg/ginx"
+	"archi/pkg/logger"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+)
+
+// SMSHandler 短信死信的查看与重新投递，以及服务商状态，只有配置中的管理员可以访问
+type SMSHandler struct {
+	svc         service.SMSDeadLetterService
+	providerSvc service.SMSProviderService
+	l           logger.Logger
+}
+
+func NewSMSHandler(svc service.SMSDeadLetterService, providerSvc service.SMSProviderService, l logger.Logger) *SMSHandler {
+	return &SMSHandler{
+		svc:         svc,
+		providerSvc: providerSvc,
+		l:           l,
+	}
+}
+
+func (h *SMSHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/sms")
+	g.POST("/dead/list", ginx.WrapBodyAndClaims(h.ListDead))
+	g.POST("/dead/requeue", ginx.WrapBodyAndClaims(h.Requeue))
+	g.GET("/providers", ginx.WrapClaims(h.Providers))
+}
+
+type SMSDeadListReq struct {
+	Cursor int64 `json:"cursor"`
+	Limit  int   `json:"limit" binding:"max=100"`
+}
+
+type AsyncSMSVo struct {
+	Id       int64    `json:"id"`
+	TplId    string   `json:"tpl_id"`
+	Args     []string `json:"args"`
+	Numbers  []string `json:"numbers"`
+	RetryCnt int      `json:"retry_cnt"`
+	LastErr  string   `json:"last_err"`
+	Ctime    string   `json:"ctime"`
+	Utime    string   `json:"utime"`
+}
+
+type SMSDeadListVo struct {
+	List       []AsyncSMSVo `json:"list"`
+	NextCursor int64        `json:"next_cursor"`
+}
+
+func (h *SMSHandler) ListDead(ctx *gin.Context, req SMSDeadListReq, uc jwt.UserClaims) (ginx.Result, error) {
+	if req.Limit <= 0 {
+		req.Limit = 20
+	}
+	list, err := h.svc.ListDead(ctx, uc.Uid, req.Cursor, req.Limit)
+	if errors.Is(err, service.ErrSMSForbidden) {
+		return ginx.Result{
+			Code: errs.SMSForbidden,
+			Msg:  "没有短信管理权限",
+		}, nil
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: errs.SMSInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	res := SMSDeadListVo{
+		List: slice.Map(list, func(idx int, src domain.AsyncSMS) AsyncSMSVo {
+			return AsyncSMSVo{
+				Id:       src.ID,
+				TplId:    src.TplId,
+				Args:     src.Args,
+				Numbers:  src.Numbers,
+				RetryCnt: src.RetryCnt,
+				LastErr:  src.LastErr,
+				Ctime:    src.Ctime.Format(time.DateTime),
+				Utime:    src.Utime.Format(time.DateTime),
+			}
+		}),
+	}
+	if len(list) == req.Limit {
+		res.NextCursor = list[len(list)-1].ID
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "获取短信死信成功",
+		Data: res,
+	}, nil
+}
+
+type SMSRequeueReq struct {
+	Id int64 `json:"id" binding:"required"`
+}
+
+func (h *SMSHandler) Requeue(ctx *gin.Context, req SMSRequeueReq, uc jwt.UserClaims) (ginx.Result, error) {
+	err := h.svc.Requeue(ctx, uc.Uid, req.Id)
+	switch {
+	case errors.Is(err, service.ErrSMSForbidden):
+		return ginx.Result{
+			Code: errs.SMSForbidden,
+			Msg:  "没有短信管理权限",
+		}, nil
+	case errors.Is(err, service.ErrSMSNotDead):
+		return ginx.Result{
+			Code: errs.SMSNotDead,
+			Msg:  "短信不在死信中",
+		}, nil
+	case err != nil:
+		return ginx.Result{
+			Code: errs.SMSInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "重新投递成功",
+	}, nil
+}
+
+type SMSProviderVo struct {
+	Name  string  `json:"name"`
+	State string  `json:"state"`
+	Score float64 `json:"score"`
+	Total int64   `json:"total"`
+	// ErrorRate 和 AvgLatency 是滑动窗口内的统计，AvgLatency 单位为毫秒
+	ErrorRate  float64 `json:"error_rate"`
+	AvgLatency int64   `json:"avg_latency"`
+	OpenUntil  string  `json:"open_until,omitempty"`
+}
+
+func (h *SMSHandler) Providers(ctx *gin.Context, uc jwt.UserClaims) (ginx.Result, error) {
+	states, err := h.providerSvc.States(ctx, uc.Uid)
+	if errors.Is(err, service.ErrSMSForbidden) {
+		return ginx.Result{
+			Code: errs.SMSForbidden,
+			Msg:  "没有短信管理权限",
+		}, nil
+	}
+	if err != nil {
+		return ginx.Result{
+			Code: errs.SMSInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "获取短信服务商状态成功",
+		Data: slice.Map(states, func(idx int, src domain.SMSProviderState) SMSProviderVo {
+			vo := SMSProviderVo{
+				Name:       src.Name,
+				State:      src.State,
+				Score:      src.Score,
+				Total:      src.Total,
+				ErrorRate:  src.ErrorRate,
+				AvgLatency: src.AvgLatency.Milliseconds(),
+			}
+			if !src.OpenUntil.IsZero() {
+				vo.OpenUntil = src.OpenUntil.Format(time.DateTime)
+			}
+			return vo
+		}),
+	}, nil
+}
@@ -3,10 +3,13 @@ package web
 import (
 	"archi/internal/domain"
 	"archi/internal/service"
+	"archi/internal/service/feed"
 	"archi/internal/web/errs"
+	"archi/internal/web/middleware"
 	jwtware "archi/internal/web/middleware/jwt"
 	"archi/pkg/ginx"
 	"archi/pkg/logger"
+	"context"
 	"errors"
 	"net/http"
 	"os"
@@ -15,7 +18,6 @@ import (
 
 	regexp "github.com/dlclark/regexp2"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
@@ -25,23 +27,37 @@ const (
 	emailRegexPattern    = "(?i)^[A-Z0-9_!#$%&'*+/=?`{|}~^.-]+@[A-Z0-9.-]+$"
 	passwordRegexPattern = `^(?=.*[a-z])(?=.*[A-Z])(?=.*[!@#$%^&*()_+\-=\[\]{};':"\\|,.<>\/?~]).{8,}$`
 	bizLogin             = "login"
+	// deviceIdHeader 客户端上报的设备标识，用于按设备限制验证码发送
+	deviceIdHeader = "X-Device-Id"
 )
 
 type UserHandler struct {
 	log              logger.Logger
 	userSvc          service.UserService
 	codeSvc          service.CodeService
+	guardSvc         service.CodeGuardService
+	loginGuardSvc    service.LoginGuardService
+	captchaSvc       service.CaptchaService
+	captchaMw        *middleware.CaptchaBuilder
 	jwtHdl           jwtware.Handler
+	feedSvc          feed.Service
 	emailRegexExp    *regexp.Regexp
 	passwordRegexExp *regexp.Regexp
 }
 
-func NewUserHandler(log logger.Logger, userSvc service.UserService, codeSvc service.CodeService, jwtHdl jwtware.Handler) *UserHandler {
+func NewUserHandler(log logger.Logger, userSvc service.UserService, codeSvc service.CodeService,
+	guardSvc service.CodeGuardService, loginGuardSvc service.LoginGuardService, captchaSvc service.CaptchaService, captchaMw *middleware.CaptchaBuilder,
+	jwtHdl jwtware.Handler, feedSvc feed.Service) *UserHandler {
 	return &UserHandler{
 		log:              log,
 		userSvc:          userSvc,
 		codeSvc:          codeSvc,
+		guardSvc:         guardSvc,
+		loginGuardSvc:    loginGuardSvc,
+		captchaSvc:       captchaSvc,
+		captchaMw:        captchaMw,
 		jwtHdl:           jwtHdl,
+		feedSvc:          feedSvc,
 		emailRegexExp:    regexp.MustCompile(emailRegexPattern, regexp.None),
 		passwordRegexExp: regexp.MustCompile(passwordRegexPattern, regexp.None),
 	}
@@ -50,8 +66,9 @@ func NewUserHandler(log logger.Logger, userSvc service.UserService, codeSvc serv
 func (u *UserHandler) RegisterRoutes(e *gin.Engine) {
 	g := e.Group("/users")
 
-	g.POST("/signup", ginx.WrapBody(u.SignUp))
-	g.POST("/login", ginx.WrapBody(u.LoginJWT))
+	// 同一个账号或者 IP 连续失败之后，这几个接口需要先通过图形验证码
+	g.POST("/signup", u.captchaMw.Build(service.CaptchaSceneSignup, nil), ginx.WrapBody(u.SignUp))
+	g.POST("/login", u.captchaMw.Build(service.CaptchaSceneLogin, middleware.BodyField("email")), ginx.WrapBody(u.LoginJWT))
 	g.POST("/logout", ginx.Wrap(u.LogoutJWT))
 	g.POST("/refresh_token", ginx.Wrap(u.RefreshToken))
 
@@ -59,7 +76,15 @@ func (u *UserHandler) RegisterRoutes(e *gin.Engine) {
 	g.POST("/edit", ginx.WrapBodyAndClaims(u.Edit))
 	g.GET("/profile", ginx.WrapClaims(u.Profile))
 
-	g.POST("/login_sms/code/send", ginx.WrapBody(u.SendSMSLoginCode))
+	g.GET("/sessions", ginx.WrapClaims(u.Sessions))
+	g.POST("/sessions/revoke", ginx.WrapBodyAndClaims(u.RevokeSession))
+	g.POST("/sessions/revoke_all", ginx.WrapBodyAndClaims(u.RevokeAllSessions))
+
+	g.POST("/login/unlock/code/send", u.captchaMw.Build(service.CaptchaSceneLogin, middleware.BodyField("email")),
+		ginx.WrapBody(u.SendUnlockCode))
+	g.POST("/login/unlock", ginx.WrapBody(u.Unlock))
+	g.POST("/login_sms/code/send", u.captchaMw.Build(service.CaptchaSceneLoginSMS, middleware.BodyField("phone")),
+		ginx.WrapBody(u.SendSMSLoginCode))
 	g.POST("/login_sms", ginx.WrapBody(u.LoginSMS))
 }
 
@@ -79,13 +104,14 @@ func (u *UserHandler) SignUp(ctx *gin.Context, req SignUpReq) (ginx.Result, erro
 		}, err
 	}
 	if !isEmail {
-
+		u.captchaFailure(ctx, service.CaptchaSceneSignup, "")
 		return ginx.Result{
 			Code: errs.UserInvalidInput,
 			Msg:  "邮箱格式错误",
 		}, nil
 	}
 	if req.Password != req.ConfirmPassword {
+		u.captchaFailure(ctx, service.CaptchaSceneSignup, "")
 		return ginx.Result{
 			Code: errs.UserInvalidInput,
 			Msg:  "两次输入密码不同",
@@ -99,6 +125,7 @@ func (u *UserHandler) SignUp(ctx *gin.Context, req SignUpReq) (ginx.Result, erro
 		}, err
 	}
 	if !isPassword {
+		u.captchaFailure(ctx, service.CaptchaSceneSignup, "")
 		return ginx.Result{
 			Code: errs.UserInvalidInput,
 			Msg:  "密码必须包含数字、特殊字符、大小字母，并且长度不能小于 8 位",
@@ -109,6 +136,8 @@ func (u *UserHandler) SignUp(ctx *gin.Context, req SignUpReq) (ginx.Result, erro
 	err = u.userSvc.Signup(ctx.Request.Context(), domain.User{Email: req.Email, Password: req.ConfirmPassword})
 	if errors.Is(err, service.ErrDuplicateEmail) {
 		u.log.Warn("用户邮箱冲突", logger.Error(err))
+		// 反复撞已经注册的邮箱，可能是在枚举账号
+		u.captchaFailure(ctx, service.CaptchaSceneSignup, "")
 		return ginx.Result{
 			Code: errs.UserDuplicateEmail,
 			Msg:  "邮箱冲突",
@@ -133,7 +162,7 @@ type LoginJWTReq struct {
 }
 
 func (u *UserHandler) LoginJWT(ctx *gin.Context, req LoginJWTReq) (ginx.Result, error) {
-	user, err := u.userSvc.Login(ctx, req.Email, req.Password)
+	user, err := u.userSvc.Login(ctx, req.Email, req.Password, ctx.ClientIP())
 	switch {
 	case err == nil:
 		err = u.jwtHdl.SetLoginToken(ctx, user.ID)
@@ -143,15 +172,28 @@ func (u *UserHandler) LoginJWT(ctx *gin.Context, req LoginJWTReq) (ginx.Result,
 				Msg:  "系统错误",
 			}, err
 		}
+		u.markActive(user.ID)
+		u.captchaReset(ctx, service.CaptchaSceneLogin, req.Email)
 		return ginx.Result{
 			Code: http.StatusOK,
 			Msg:  "登录成功",
 		}, nil
 	case errors.Is(err, service.ErrInvalidUserOrPassword):
+		u.captchaFailure(ctx, service.CaptchaSceneLogin, req.Email)
 		return ginx.Result{
 			Code: errs.UserInvalidOrPassword,
 			Msg:  "用户名或者密码错误",
 		}, err
+	case errors.Is(err, service.ErrAccountLocked):
+		return ginx.Result{
+			Code: errs.UserAccountLocked,
+			Msg:  "密码错误次数过多，账号已被临时锁定，可以通过短信验证码解锁",
+		}, nil
+	case errors.Is(err, service.ErrLoginTooFrequent):
+		return ginx.Result{
+			Code: errs.UserLoginTooFrequent,
+			Msg:  "尝试太频繁，请稍后再试",
+		}, nil
 	default:
 		return ginx.Result{
 			Code: errs.UserInternalServerError,
@@ -176,51 +218,121 @@ func (u *UserHandler) LogoutJWT(ctx *gin.Context) (ginx.Result, error) {
 }
 
 func (u *UserHandler) RefreshToken(ctx *gin.Context) (ginx.Result, error) {
-	// 假定长 token 也放在这里
-	tokenStr := ctx.GetHeader("X-Refresh-Token")
-
-	var rc jwtware.RefreshClaims
-	token, err := jwt.ParseWithClaims(tokenStr, &rc, func(token *jwt.Token) (interface{}, error) {
-		return jwtware.RefreshTokenKey, nil
-	})
-	// 这边要保持和登录校验一直的逻辑，即返回 401 响应
-	if err != nil || token == nil || !token.Valid {
+	err := u.jwtHdl.RefreshToken(ctx)
+	switch {
+	case err == nil:
+		return ginx.Result{
+			Code: http.StatusOK,
+			Msg:  "刷新成功",
+		}, nil
+	// 这边要保持和登录校验一致的逻辑，即返回 401 响应
+	case errors.Is(err, jwtware.ErrInvalidRefreshToken):
 		return ginx.Result{
 			Code: http.StatusUnauthorized,
 			Msg:  "登录已过期，请重新登录",
 		}, err
+	case errors.Is(err, jwtware.ErrSessionNotFound):
+		return ginx.Result{
+			Code: http.StatusUnauthorized,
+			Msg:  "会话已过期，请重新登录",
+		}, err
+	case errors.Is(err, jwtware.ErrRefreshTokenReused):
+		// refresh token 可能已经泄露，会话已经被强制退出
+		u.log.Warn("refresh token 被重复使用", logger.String("ip", ctx.ClientIP()))
+		return ginx.Result{
+			Code: http.StatusUnauthorized,
+			Msg:  "登录状态异常，请重新登录",
+		}, err
+	default:
+		return ginx.Result{
+			Code: errs.UserInternalServerError,
+			Msg:  "系统内部错误",
+		}, err
 	}
+}
+
+type SessionVO struct {
+	Ssid      string `json:"ssid"`
+	Device    string `json:"device"`
+	UserAgent string `json:"userAgent"`
+	IP        string `json:"ip"`
+	Ctime     string `json:"ctime"`
+	LastSeen  string `json:"lastSeen"`
+	// Current 是不是发起请求的这个会话
+	Current bool `json:"current"`
+}
 
-	// 校验 ssid
-	err = u.jwtHdl.CheckSession(ctx, rc.Ssid)
+func (u *UserHandler) Sessions(ctx *gin.Context, uc jwtware.UserClaims) (ginx.Result, error) {
+	sessions, err := u.jwtHdl.ListSessions(ctx, uc.Uid)
 	if err != nil {
-		// 如果是会话不存在的业务错误，返回 401
-		if errors.Is(err, jwtware.ErrSessionNotFound) {
-			return ginx.Result{
-				Code: http.StatusUnauthorized,
-				Msg:  "会话已过期，请重新登录",
-			}, err
-		}
-		// 系统错误或者用户已经主动退出登录了
-		// 这里也可以考虑说，如果在 Redis 已经崩溃的时候，
-		// 就不要去校验是不是已经主动退出登录了。
-		//ctx.AbortWithStatus(http.StatusUnauthorized)
 		return ginx.Result{
-			Code: http.StatusInternalServerError,
+			Code: errs.UserInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+	vos := make([]SessionVO, 0, len(sessions))
+	for _, s := range sessions {
+		vos = append(vos, SessionVO{
+			Ssid:      s.Ssid,
+			Device:    s.Device,
+			UserAgent: s.UserAgent,
+			IP:        s.IP,
+			Ctime:     s.Ctime.Format(time.DateTime),
+			LastSeen:  s.LastSeen.Format(time.DateTime),
+			Current:   s.Ssid == uc.Ssid,
+		})
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Data: vos,
+	}, nil
+}
+
+type RevokeSessionReq struct {
+	Ssid string `json:"ssid" binding:"required"`
+}
+
+func (u *UserHandler) RevokeSession(ctx *gin.Context, req RevokeSessionReq, uc jwtware.UserClaims) (ginx.Result, error) {
+	err := u.jwtHdl.RevokeSession(ctx, uc.Uid, req.Ssid)
+	switch {
+	case err == nil:
+		return ginx.Result{
+			Code: http.StatusOK,
+			Msg:  "已退出该设备",
+		}, nil
+	case errors.Is(err, jwtware.ErrSessionNotFound):
+		return ginx.Result{
+			Code: errs.UserSessionNotFound,
+			Msg:  "会话不存在或已过期",
+		}, nil
+	default:
+		return ginx.Result{
+			Code: errs.UserInternalServerError,
 			Msg:  "系统错误",
 		}, err
 	}
+}
 
-	err = u.jwtHdl.SetJWTToken(ctx, rc.Uid, rc.Ssid)
+type RevokeAllSessionsReq struct {
+	// KeepCurrent 为 true 时只退出其它设备
+	KeepCurrent bool `json:"keepCurrent"`
+}
+
+func (u *UserHandler) RevokeAllSessions(ctx *gin.Context, req RevokeAllSessionsReq, uc jwtware.UserClaims) (ginx.Result, error) {
+	keep := ""
+	if req.KeepCurrent {
+		keep = uc.Ssid
+	}
+	err := u.jwtHdl.RevokeAllSessions(ctx, uc.Uid, keep)
 	if err != nil {
 		return ginx.Result{
 			Code: errs.UserInternalServerError,
-			Msg:  "系统内部错误",
+			Msg:  "系统错误",
 		}, err
 	}
 	return ginx.Result{
 		Code: http.StatusOK,
-		Msg:  "刷新成功",
+		Msg:  "已退出所有设备",
 	}, nil
 }
 
@@ -368,7 +480,15 @@ func (u *UserHandler) SendSMSLoginCode(ctx *gin.Context, req SendSMSCodeReq) (gi
 			Msg:  "请输入手机号码",
 		}, nil
 	}
-	err := u.codeSvc.Send(ctx.Request.Context(), bizLogin, req.Phone)
+	err := u.guardSvc.Check(ctx, bizLogin, req.Phone, service.CodeSendClient{
+		IP:            ctx.ClientIP(),
+		Device:        ctx.GetHeader(deviceIdHeader),
+		CaptchaPassed: middleware.CaptchaPassed(ctx),
+	})
+	if err != nil {
+		return u.codeGuardResult(logger.SafePhoneZH(req.Phone), err)
+	}
+	err = u.codeSvc.Send(ctx.Request.Context(), bizLogin, req.Phone)
 	switch {
 	case err == nil:
 		return ginx.Result{
@@ -391,6 +511,90 @@ func (u *UserHandler) SendSMSLoginCode(ctx *gin.Context, req SendSMSCodeReq) (gi
 	}
 }
 
+// codeGuardResult 把防刷的拒绝原因转换成错误码
+// subject 是发送对象，只用于记录日志
+func (u *UserHandler) codeGuardResult(subject logger.Field, err error) (ginx.Result, error) {
+	switch {
+	case errors.Is(err, service.ErrCodeCaptchaRequired):
+		return ginx.Result{
+			Code: errs.UserCaptchaRequired,
+			Msg:  "请先完成图形验证码",
+		}, nil
+	case errors.Is(err, service.ErrCodePhoneDailyLimit):
+		return ginx.Result{
+			Code: errs.UserCodePhoneDailyLimit,
+			Msg:  "该手机号今天的验证码发送次数已用完",
+		}, nil
+	case errors.Is(err, service.ErrCodeIPLimit), errors.Is(err, service.ErrCodeDeviceLimit):
+		u.log.Warn("验证码发送被限流", subject, logger.Error(err))
+		code := errs.UserCodeIPLimit
+		if errors.Is(err, service.ErrCodeDeviceLimit) {
+			code = errs.UserCodeDeviceLimit
+		}
+		return ginx.Result{
+			Code: code,
+			Msg:  "短信发送太频繁，请稍后再试",
+		}, nil
+	case errors.Is(err, service.ErrCodeBudgetExhausted):
+		u.log.Error("短信预算用完，暂停发送验证码")
+		return ginx.Result{
+			Code: errs.UserCodeBudgetExhausted,
+			Msg:  "短信服务繁忙，请稍后再试",
+		}, nil
+	default:
+		return ginx.Result{
+			Code: errs.UserInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+}
+
+type SendUnlockCodeReq struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// SendUnlockCode 给被锁定账号绑定的手机发送解锁验证码，账号不存在时也返回发送成功
+func (u *UserHandler) SendUnlockCode(ctx *gin.Context, req SendUnlockCodeReq) (ginx.Result, error) {
+	err := u.loginGuardSvc.SendUnlockCode(ctx, req.Email, service.CodeSendClient{
+		IP:            ctx.ClientIP(),
+		Device:        ctx.GetHeader(deviceIdHeader),
+		CaptchaPassed: middleware.CaptchaPassed(ctx),
+	})
+	if err != nil {
+		return u.codeGuardResult(logger.SafeEmail(req.Email), err)
+	}
+	return ginx.Result{
+		Code: http.StatusOK,
+		Msg:  "如果账号绑定了手机，解锁验证码已经发送",
+	}, nil
+}
+
+type UnlockReq struct {
+	Email string `json:"email" binding:"required,email"`
+	Code  string `json:"code" binding:"required,len=6,numeric"`
+}
+
+func (u *UserHandler) Unlock(ctx *gin.Context, req UnlockReq) (ginx.Result, error) {
+	err := u.loginGuardSvc.Unlock(ctx, req.Email, req.Code, ctx.ClientIP())
+	switch {
+	case err == nil:
+		return ginx.Result{
+			Code: http.StatusOK,
+			Msg:  "解锁成功",
+		}, nil
+	case errors.Is(err, service.ErrUnlockCodeInvalid):
+		return ginx.Result{
+			Code: errs.UserUnlockCodeInvalid,
+			Msg:  "验证码不对，请重新输入",
+		}, nil
+	default:
+		return ginx.Result{
+			Code: errs.UserInternalServerError,
+			Msg:  "系统错误",
+		}, err
+	}
+}
+
 type LoginSMSReq struct {
 	Phone string `json:"phone" binding:"required,len=11,numeric"`
 	Code  string `json:"code" binding:"required,len=6,numeric"`
@@ -398,6 +602,10 @@ type LoginSMSReq struct {
 
 func (u *UserHandler) LoginSMS(ctx *gin.Context, req LoginSMSReq) (ginx.Result, error) {
 	ok, err := u.codeSvc.Verify(ctx, bizLogin, req.Phone, req.Code)
+	if err != nil || !ok {
+		// 验证码错误次数过多之后，这个手机号和 IP 再发送验证码需要图形验证码
+		u.captchaFailure(ctx, service.CaptchaSceneLoginSMS, req.Phone)
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err, service.ErrCodeVerifyTooMany):
@@ -437,8 +645,39 @@ func (u *UserHandler) LoginSMS(ctx *gin.Context, req LoginSMSReq) (ginx.Result,
 			Msg:  "系统错误",
 		}, err
 	}
+	u.markActive(user.ID)
+	u.captchaReset(ctx, service.CaptchaSceneLoginSMS, req.Phone)
 	return ginx.Result{
 		Code: http.StatusOK,
 		Msg:  "登录成功",
 	}, nil
 }
+
+// captchaFailure 记录一次失败，IP 或者账号失败次数过多之后需要图形验证码，account 为空时只记录 IP
+func (u *UserHandler) captchaFailure(ctx *gin.Context, scene, account string) {
+	subjects := []string{service.CaptchaSubjectIP(ctx.ClientIP())}
+	if account != "" {
+		subjects = append(subjects, service.CaptchaSubjectAccount(account))
+	}
+	if err := u.captchaSvc.RecordFailure(ctx, scene, subjects...); err != nil {
+		u.log.Error("记录图形验证码失败次数失败", logger.String("scene", scene), logger.Error(err))
+	}
+}
+
+// captchaReset 账号成功之后清空它的失败次数，IP 的失败次数保留
+func (u *UserHandler) captchaReset(ctx *gin.Context, scene, account string) {
+	if err := u.captchaSvc.Reset(ctx, scene, service.CaptchaSubjectAccount(account)); err != nil {
+		u.log.Error("清空图形验证码失败次数失败", logger.String("scene", scene), logger.Error(err))
+	}
+}
+
+// markActive 登录算一次活跃，feed 推模型只推给活跃用户，失败不影响登录
+func (u *UserHandler) markActive(uid int64) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := u.feedSvc.MarkActive(ctx, uid); err != nil {
+			u.log.Error("记录用户活跃失败", logger.Int64("uid", uid), logger.Error(err))
+		}
+	}()
+}
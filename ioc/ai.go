@@ -3,12 +3,15 @@ package ioc
 import (
 	"archi/internal/domain"
 	"archi/internal/service/ai"
+	"archi/pkg/logger"
 	"context"
 	"fmt"
 	"os"
 
 	"github.com/cloudwego/eino-ext/components/model/ark"
 	"github.com/cloudwego/eino/components/model"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
 )
 
 func InitAiProvider(factory *ai.AiFactory) *ai.AiProvider {
@@ -36,6 +39,13 @@ func InitAiProvider(factory *ai.AiFactory) *ai.AiProvider {
 	}
 	provider.Register(domain.SceneAuthorHelper, authorHelperRunnable)
 
+	// 场景：内容审核
+	moderationRunnable, err := factory.Create(domain.SceneContentModeration)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create ai scene %s: %v", domain.SceneContentModeration, err))
+	}
+	provider.Register(domain.SceneContentModeration, moderationRunnable)
+
 	return provider
 }
 
@@ -61,3 +71,53 @@ func InitVolcanoModel() model.ToolCallingChatModel {
 	}
 	return chatModel
 }
+
+// InitPromptRegistry 加载版本化的 Prompt 模板
+// 内置 v1 版本兜底，配置文件 ai.prompts 中同场景同版本的模板会覆盖内置版本，
+// 新增的版本按 weight 参与 A/B 实验；配置文件变更时自动热加载，监听由 setting.InitViper 启动
+func InitPromptRegistry(l logger.Logger) *ai.PromptRegistry {
+	registry := ai.NewPromptRegistry()
+	tpls, err := loadPromptTemplates()
+	if err != nil {
+		panic(err)
+	}
+	if err = registry.Load(tpls); err != nil {
+		panic(err)
+	}
+	viper.OnConfigChange(func(in fsnotify.Event) {
+		// 改坏了的配置不能让进程挂掉，保留当前的模板
+		tpls, err := loadPromptTemplates()
+		if err == nil {
+			err = registry.Load(tpls)
+		}
+		if err != nil {
+			l.Error("热加载 Prompt 模板失败，继续使用旧版本", logger.Error(err))
+			return
+		}
+		l.Info("Prompt 模板已重新加载")
+	})
+	return registry
+}
+
+func loadPromptTemplates() ([]domain.PromptTemplate, error) {
+	type promptConfig struct {
+		Scene   string `yaml:"scene"`
+		Version string `yaml:"version"`
+		Content string `yaml:"content"`
+		Weight  int    `yaml:"weight"`
+	}
+	var cfgs []promptConfig
+	if err := viper.UnmarshalKey("ai.prompts", &cfgs); err != nil {
+		return nil, fmt.Errorf("解析 ai.prompts 失败: %w", err)
+	}
+	tpls := ai.DefaultPromptTemplates()
+	for _, cfg := range cfgs {
+		tpls = append(tpls, domain.PromptTemplate{
+			Scene:   domain.Scene(cfg.Scene),
+			Version: cfg.Version,
+			Content: cfg.Content,
+			Weight:  cfg.Weight,
+		})
+	}
+	return tpls, nil
+}
@@ -0,0 +1,120 @@
+package ioc
+
+import (
+	"archi/internal/service"
+	"archi/pkg/captcha"
+	"archi/pkg/captcha/mojocn"
+	"archi/pkg/limiter"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+// InitCaptchaService 图形验证码的答案存在 Redis 里面，多实例部署的时候也能校验
+func InitCaptchaService(cmd redis.Cmdable) captcha.Service {
+	return mojocn.NewService(mojocn.NewRedisStore(cmd, time.Minute*5))
+}
+
+// InitCaptchaConfig 读取 captcha 配置
+func InitCaptchaConfig() service.CaptchaConfig {
+	type Config struct {
+		Threshold     int64         `yaml:"threshold"`
+		FailureWindow time.Duration `yaml:"failureWindow"`
+		TokenTTL      time.Duration `yaml:"tokenTTL"`
+	}
+	cfg := Config{
+		Threshold:     3,
+		FailureWindow: time.Minute * 15,
+		TokenTTL:      time.Minute * 5,
+	}
+	if err := viper.UnmarshalKey("captcha", &cfg); err != nil {
+		panic(err)
+	}
+	return service.CaptchaConfig{
+		Threshold:     cfg.Threshold,
+		FailureWindow: cfg.FailureWindow,
+		TokenTTL:      cfg.TokenTTL,
+	}
+}
+
+// InitCodeGuardLimiter 验证码防刷的各个维度在一个脚本里面检查和计数
+func InitCodeGuardLimiter(cmd redis.Cmdable) limiter.MultiLimiter {
+	return limiter.NewRedisMultiSlideWindowLimiter(cmd)
+}
+
+// InitCodeGuardRules 读取 code.guard 配置
+func InitCodeGuardRules() service.CodeGuardRules {
+	type Config struct {
+		// PhoneDaily 每个手机号 24 小时内最多发送几次，达到 PhoneChallenge 次之后要求图形验证码
+		PhoneDaily     int `yaml:"phoneDaily"`
+		PhoneChallenge int `yaml:"phoneChallenge"`
+		// IPRate 每个 IP 在 IPWindow 内最多发送几次，达到 IPChallenge 次之后要求图形验证码
+		IPWindow    time.Duration `yaml:"ipWindow"`
+		IPRate      int           `yaml:"ipRate"`
+		IPChallenge int           `yaml:"ipChallenge"`
+		// DeviceRate 每个设备在 DeviceWindow 内最多发送几次
+		DeviceWindow time.Duration `yaml:"deviceWindow"`
+		DeviceRate   int           `yaml:"deviceRate"`
+		// Budget 全部手机号在 BudgetWindow 内最多发送几次
+		BudgetWindow time.Duration `yaml:"budgetWindow"`
+		Budget       int           `yaml:"budget"`
+	}
+	cfg := Config{
+		PhoneDaily:     10,
+		PhoneChallenge: 3,
+		IPWindow:       time.Minute * 10,
+		IPRate:         20,
+		IPChallenge:    5,
+		DeviceWindow:   time.Minute * 10,
+		DeviceRate:     5,
+		BudgetWindow:   time.Hour,
+		Budget:         10000,
+	}
+	if err := viper.UnmarshalKey("code.guard", &cfg); err != nil {
+		panic(err)
+	}
+	const day = time.Hour * 24
+	return service.CodeGuardRules{
+		PhoneDaily:     service.CodeGuardRule{Interval: day, Rate: cfg.PhoneDaily},
+		PhoneChallenge: service.CodeGuardRule{Interval: day, Rate: cfg.PhoneChallenge},
+		IP:             service.CodeGuardRule{Interval: cfg.IPWindow, Rate: cfg.IPRate},
+		IPChallenge:    service.CodeGuardRule{Interval: cfg.IPWindow, Rate: cfg.IPChallenge},
+		Device:         service.CodeGuardRule{Interval: cfg.DeviceWindow, Rate: cfg.DeviceRate},
+		Budget:         service.CodeGuardRule{Interval: cfg.BudgetWindow, Rate: cfg.Budget},
+	}
+}
+
+// InitLoginGuardConfig 读取 login.guard 配置
+func InitLoginGuardConfig() service.LoginGuardConfig {
+	type Config struct {
+		FailureWindow  time.Duration `yaml:"failureWindow"`
+		FreeAttempts   int64         `yaml:"freeAttempts"`
+		IPFreeAttempts int64         `yaml:"ipFreeAttempts"`
+		BaseDelay      time.Duration `yaml:"baseDelay"`
+		MaxDelay       time.Duration `yaml:"maxDelay"`
+		LockThreshold  int64         `yaml:"lockThreshold"`
+		LockDuration   time.Duration `yaml:"lockDuration"`
+	}
+	cfg := Config{
+		FailureWindow:  time.Minute * 30,
+		FreeAttempts:   3,
+		IPFreeAttempts: 20,
+		BaseDelay:      time.Second,
+		MaxDelay:       time.Minute,
+		LockThreshold:  10,
+		LockDuration:   time.Minute * 30,
+	}
+	if err := viper.UnmarshalKey("login.guard", &cfg); err != nil {
+		panic(err)
+	}
+	return service.LoginGuardConfig{
+		FailureWindow:  cfg.FailureWindow,
+		FreeAttempts:   cfg.FreeAttempts,
+		IPFreeAttempts: cfg.IPFreeAttempts,
+		BaseDelay:      cfg.BaseDelay,
+		MaxDelay:       cfg.MaxDelay,
+		LockThreshold:  cfg.LockThreshold,
+		LockDuration:   cfg.LockDuration,
+	}
+}
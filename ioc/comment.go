@@ -0,0 +1,26 @@
+package ioc
+
+import (
+	"archi/internal/service"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// InitCommentConfig 读取 comment 配置，没有配置的项使用默认值
+func InitCommentConfig() service.CommentConfig {
+	type Config struct {
+		EditWindow time.Duration `yaml:"editWindow"`
+		Admins     []int64       `yaml:"admins"`
+	}
+	cfg := Config{
+		EditWindow: time.Minute * 15,
+	}
+	if err := viper.UnmarshalKey("comment", &cfg); err != nil {
+		panic(err)
+	}
+	return service.CommentConfig{
+		EditWindow: cfg.EditWindow,
+		Admins:     cfg.Admins,
+	}
+}
@@ -1,18 +1,73 @@
 package ioc
 
 import (
+	"archi/internal/event/fanout"
 	"archi/internal/repository"
 	"archi/internal/service"
 	"archi/internal/service/feed"
+	"time"
+
+	"github.com/spf13/viper"
 )
 
-func RegisterFeedHandler(repo repository.FeedEventRepo, followSvc service.FollowRelationService) map[string]feed.Handler {
-	articleHandler := feed.NewArticleEventHandler(repo, followSvc)
+func RegisterFeedHandler(repo repository.FeedEventRepo, followSvc service.FollowRelationService,
+	producer fanout.Producer, cfg feed.FanoutConfig) map[string]feed.Handler {
+	articleHandler := feed.NewArticleEventHandler(repo, followSvc, producer, cfg)
 	followHandler := feed.NewFollowEventHandler(repo)
 	likeHandler := feed.NewLikeEventHandler(repo)
+	commentHandler := feed.NewCommentEventHandler(repo)
+	rewardHandler := feed.NewRewardEventHandler(repo)
+	collectHandler := feed.NewCollectEventHandler(repo)
 	return map[string]feed.Handler{
 		feed.ArticleEventName: articleHandler,
 		feed.FollowEventName:  followHandler,
 		feed.LikeEventName:    likeHandler,
+		feed.CommentEventName: commentHandler,
+		feed.RewardEventName:  rewardHandler,
+		feed.CollectEventName: collectHandler,
+	}
+}
+
+// InitFeedFanoutConfig 读取 feed.fanout 配置，没有配置的项使用默认值
+func InitFeedFanoutConfig() feed.FanoutConfig {
+	type Config struct {
+		PushAllThreshold int64         `yaml:"pushAllThreshold"`
+		ActiveWindow     time.Duration `yaml:"activeWindow"`
+		BatchSize        int64         `yaml:"batchSize"`
+	}
+	cfg := Config{
+		PushAllThreshold: 100,
+		ActiveWindow:     time.Hour * 24 * 7,
+		BatchSize:        500,
+	}
+	if err := viper.UnmarshalKey("feed.fanout", &cfg); err != nil {
+		panic(err)
+	}
+	return feed.FanoutConfig{
+		PushAllThreshold: cfg.PushAllThreshold,
+		ActiveWindow:     cfg.ActiveWindow,
+		BatchSize:        cfg.BatchSize,
+	}
+}
+
+// InitFeedRetentionConfig 读取 feed.retention 配置，没有配置的项使用默认值
+func InitFeedRetentionConfig() feed.RetentionConfig {
+	type Config struct {
+		PushTTL   time.Duration `yaml:"pushTTL"`
+		PullTTL   time.Duration `yaml:"pullTTL"`
+		BatchSize int           `yaml:"batchSize"`
+	}
+	cfg := Config{
+		PushTTL:   time.Hour * 24 * 30,
+		PullTTL:   time.Hour * 24 * 90,
+		BatchSize: 1000,
+	}
+	if err := viper.UnmarshalKey("feed.retention", &cfg); err != nil {
+		panic(err)
+	}
+	return feed.RetentionConfig{
+		PushTTL:   cfg.PushTTL,
+		PullTTL:   cfg.PullTTL,
+		BatchSize: cfg.BatchSize,
 	}
 }
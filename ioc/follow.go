@@ -0,0 +1,41 @@
+package ioc
+
+import (
+	"archi/internal/domain"
+	"archi/internal/service"
+
+	"github.com/spf13/viper"
+)
+
+// InitFollowRecommendConfig 读取 follow.recommend 配置，没有配置的项使用默认值
+func InitFollowRecommendConfig() service.FollowRecommendConfig {
+	type Config struct {
+		CandidateLimit     int     `yaml:"candidateLimit"`
+		Size               int     `yaml:"size"`
+		BatchSize          int     `yaml:"batchSize"`
+		SecondDegreeWeight float64 `yaml:"secondDegreeWeight"`
+		TagWeight          float64 `yaml:"tagWeight"`
+		LikedWeight        float64 `yaml:"likedWeight"`
+	}
+	cfg := Config{
+		CandidateLimit:     200,
+		Size:               100,
+		BatchSize:          500,
+		SecondDegreeWeight: 3,
+		TagWeight:          2,
+		LikedWeight:        1,
+	}
+	if err := viper.UnmarshalKey("follow.recommend", &cfg); err != nil {
+		panic(err)
+	}
+	return service.FollowRecommendConfig{
+		CandidateLimit: cfg.CandidateLimit,
+		Size:           cfg.Size,
+		BatchSize:      cfg.BatchSize,
+		Weights: map[domain.FollowRecommendReason]float64{
+			domain.FollowRecommendReasonSecondDegree: cfg.SecondDegreeWeight,
+			domain.FollowRecommendReasonTag:          cfg.TagWeight,
+			domain.FollowRecommendReasonLiked:        cfg.LikedWeight,
+		},
+	}
+}
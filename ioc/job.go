@@ -3,6 +3,7 @@ package ioc
 import (
 	"archi/internal/job"
 	"archi/internal/service"
+	"archi/internal/service/feed"
 	"archi/pkg/cronjobx"
 	"archi/pkg/logger"
 	"time"
@@ -15,7 +16,18 @@ func InitRankingJob(svc service.RankingService, client *rlock.Client, l logger.L
 	return job.NewRankingJob(svc, l, client, time.Second*30)
 }
 
-func InitJobs(l logger.Logger, rankingJob *job.RankingJob) *cron.Cron {
+// InitFeedArchiveJob 单次归档最多跑 10 分钟，剩下的留给下一次
+func InitFeedArchiveJob(svc feed.Service, client *rlock.Client, l logger.Logger) *job.FeedArchiveJob {
+	return job.NewFeedArchiveJob(svc, l, client, time.Minute*10)
+}
+
+// InitFollowRecommendJob 单次最多算 1 小时，没算到的用户沿用上一次的结果，下一次从断点继续
+func InitFollowRecommendJob(svc service.FollowRecommendService, client *rlock.Client, l logger.Logger) *job.FollowRecommendJob {
+	return job.NewFollowRecommendJob(svc, l, client, time.Hour)
+}
+
+func InitJobs(l logger.Logger, rankingJob *job.RankingJob, feedArchiveJob *job.FeedArchiveJob,
+	followRecommendJob *job.FollowRecommendJob) *cron.Cron {
 	builder := cronjobx.NewCronJobBuilder(l)
 
 	//timezone, _ := time.LoadLocation("Asia/Shanghai")
@@ -32,5 +44,13 @@ func InitJobs(l logger.Logger, rankingJob *job.RankingJob) *cron.Cron {
 	if err != nil {
 		panic(err)
 	}
+	_, err = expr.AddJob("@every 1h", builder.Build(feedArchiveJob))
+	if err != nil {
+		panic(err)
+	}
+	_, err = expr.AddJob("@every 6h", builder.Build(followRecommendJob))
+	if err != nil {
+		panic(err)
+	}
 	return expr
 }
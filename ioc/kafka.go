@@ -2,8 +2,10 @@ package ioc
 
 import (
 	"archi/internal/event"
+	evtai "archi/internal/event/ai"
 	"archi/internal/event/article"
 	"archi/internal/event/feed"
+	"archi/internal/event/notification"
 	"archi/internal/event/search"
 
 	"github.com/IBM/sarama"
@@ -49,6 +51,11 @@ func InitConsumers(
 	artSearchC *search.ArticleConsumer,
 	syncC *search.SyncDataEventConsumer,
 	followC *feed.FollowEventConsumer,
+	unfollowC *feed.UnfollowEventConsumer,
+	fanoutC *feed.FanoutEventConsumer,
+	feedC *feed.FeedEventConsumer,
+	moderationC *evtai.ModerationEventConsumer,
+	notificationC *notification.Consumer,
 ) []event.Consumer {
 	return []event.Consumer{
 		artReadC,
@@ -56,5 +63,10 @@ func InitConsumers(
 		artSearchC,
 		syncC,
 		followC,
+		unfollowC,
+		fanoutC,
+		feedC,
+		moderationC,
+		notificationC,
 	}
 }
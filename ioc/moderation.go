@@ -0,0 +1,56 @@
+package ioc
+
+import (
+	"archi/internal/domain"
+	"archi/internal/service"
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// InitModerationFilter 从配置 moderation.rules 中加载本地过滤规则
+func InitModerationFilter() *service.ModerationFilter {
+	type ruleConfig struct {
+		// Verdict review 或 block
+		Verdict  string   `yaml:"verdict"`
+		Reason   string   `yaml:"reason"`
+		Keywords []string `yaml:"keywords"`
+		Patterns []string `yaml:"patterns"`
+	}
+	var cfgs []ruleConfig
+	if err := viper.UnmarshalKey("moderation.rules", &cfgs); err != nil {
+		panic(fmt.Errorf("读取内容审核规则失败 %w", err))
+	}
+	rules := make([]service.ModerationRule, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		var verdict domain.ModerationVerdict
+		switch cfg.Verdict {
+		case "block":
+			verdict = domain.ModerationVerdictBlock
+		case "review":
+			verdict = domain.ModerationVerdictReview
+		default:
+			panic(fmt.Errorf("未知的内容审核结论 %q", cfg.Verdict))
+		}
+		rules = append(rules, service.ModerationRule{
+			Verdict:  verdict,
+			Reason:   cfg.Reason,
+			Keywords: cfg.Keywords,
+			Patterns: cfg.Patterns,
+		})
+	}
+	filter, err := service.NewModerationFilter(rules)
+	if err != nil {
+		panic(err)
+	}
+	return filter
+}
+
+// InitModerationReviewers 从配置 moderation.reviewers 中读取复审人员
+func InitModerationReviewers() service.ModerationReviewers {
+	var reviewers []int64
+	if err := viper.UnmarshalKey("moderation.reviewers", &reviewers); err != nil {
+		panic(fmt.Errorf("读取复审人员配置失败 %w", err))
+	}
+	return reviewers
+}
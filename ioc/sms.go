@@ -1,23 +1,179 @@
 package ioc
 
 import (
+	"archi/internal/repository"
+	"archi/internal/service"
 	"archi/internal/service/sms"
+	"archi/internal/service/sms/async"
+	"archi/internal/service/sms/failover"
 	"archi/internal/service/sms/memory"
 	"archi/internal/service/sms/opentelemetry"
+	"archi/internal/service/sms/template"
 	"archi/internal/service/sms/tencent"
+	"archi/pkg/logger"
+	"fmt"
 	"os"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
 	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
 	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
 	tencentSMS "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/sms/v20210111"
 )
 
-func InitSMSService() sms.Service {
+// InitSMSService 返回的异步短信服务同时负责发送转异步的短信，需要在 main 里面调用 Run
+func InitSMSService(providers *failover.HealthService, repo repository.AsyncSMSRepository, l logger.Logger) *async.Service {
 	//return ratelimit.NewRateLimitSMSService(localsms.NewService(), limiter.NewRedisSlidingWindowLimiter())
-	// 如果有需要，就可以用这个
-	//return initTencentSMSService()
-	//return memory.NewService()
-	return opentelemetry.NewService(memory.NewService())
+	return async.NewService(opentelemetry.NewService(providers), repo, l, initSMSAsyncConfig())
+}
+
+// InitSMSTemplates 从配置 sms.templates 中加载逻辑模板到各个服务商模板的映射
+func InitSMSTemplates() *template.Registry {
+	var templates []template.Template
+	if err := viper.UnmarshalKey("sms.templates", &templates); err != nil {
+		panic(fmt.Errorf("读取短信模板配置失败 %w", err))
+	}
+	registry, err := template.NewRegistry(templates)
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// InitSMSProviders 按熔断状态与健康分在多个服务商之间挑选，配置在 sms.breaker
+// 每个服务商外面包一层 template.Service，换了服务商之后使用的是这个服务商的模板
+func InitSMSProviders(templates *template.Registry) *failover.HealthService {
+	type Config struct {
+		Window          time.Duration `yaml:"window"`
+		Buckets         int           `yaml:"buckets"`
+		MinRequests     int64         `yaml:"minRequests"`
+		ErrorRate       float64       `yaml:"errorRate"`
+		OpenDuration    time.Duration `yaml:"openDuration"`
+		HalfOpenProbes  int           `yaml:"halfOpenProbes"`
+		LatencyWeight   float64       `yaml:"latencyWeight"`
+		ErrorWeight     float64       `yaml:"errorWeight"`
+		LatencyBaseline time.Duration `yaml:"latencyBaseline"`
+	}
+	cfg := Config{
+		Window:          time.Minute,
+		Buckets:         12,
+		MinRequests:     10,
+		ErrorRate:       0.5,
+		OpenDuration:    time.Second * 30,
+		HalfOpenProbes:  3,
+		LatencyWeight:   0.3,
+		ErrorWeight:     0.7,
+		LatencyBaseline: time.Second * 2,
+	}
+	if err := viper.UnmarshalKey("sms.breaker", &cfg); err != nil {
+		panic(err)
+	}
+	stateGauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "sinsoledad",
+		Subsystem: "archi",
+		Name:      "sms_provider_state",
+		Help:      "短信服务商的熔断状态，0 为关闭，1 为半开，2 为打开",
+	}, []string{"provider"})
+	scoreGauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "sinsoledad",
+		Subsystem: "archi",
+		Name:      "sms_provider_score",
+		Help:      "短信服务商的健康分，0 到 1",
+	}, []string{"provider"})
+	prometheus.MustRegister(stateGauge, scoreGauge)
+	providers := []failover.Provider{
+		{Name: "memory", Svc: template.NewService("memory", memory.NewService(), templates)},
+		// 如果有需要，就可以把腾讯的加进来
+		//{Name: "tencent", Svc: template.NewService("tencent", initTencentSMSService(), templates)},
+	}
+	return failover.NewHealthService(providers, failover.BreakerConfig{
+		Window:          cfg.Window,
+		Buckets:         cfg.Buckets,
+		MinRequests:     cfg.MinRequests,
+		ErrorRate:       cfg.ErrorRate,
+		OpenDuration:    cfg.OpenDuration,
+		HalfOpenProbes:  cfg.HalfOpenProbes,
+		LatencyWeight:   cfg.LatencyWeight,
+		ErrorWeight:     cfg.ErrorWeight,
+		LatencyBaseline: cfg.LatencyBaseline,
+	}, nil, stateGauge, scoreGauge)
+}
+
+// initSMSAsyncConfig 读取 sms.async 配置，没有配置的项使用默认值
+func initSMSAsyncConfig() async.Config {
+	type Config struct {
+		Window             time.Duration `yaml:"window"`
+		Buckets            int           `yaml:"buckets"`
+		AsyncDuration      time.Duration `yaml:"asyncDuration"`
+		ProbePercent       float64       `yaml:"probePercent"`
+		MinRequests        int64         `yaml:"minRequests"`
+		RecoverMinRequests int64         `yaml:"recoverMinRequests"`
+		ResponseTime       time.Duration `yaml:"responseTime"`
+		ErrorRate          float64       `yaml:"errorRate"`
+		Concurrency        int           `yaml:"concurrency"`
+		BatchSize          int           `yaml:"batchSize"`
+		PollInterval       time.Duration `yaml:"pollInterval"`
+		Lease              time.Duration `yaml:"lease"`
+		SendTimeout        time.Duration `yaml:"sendTimeout"`
+		MarkTimeout        time.Duration `yaml:"markTimeout"`
+		RetryMax           int           `yaml:"retryMax"`
+		BackoffBase        time.Duration `yaml:"backoffBase"`
+		BackoffMax         time.Duration `yaml:"backoffMax"`
+	}
+	cfg := Config{
+		Window:             time.Minute,
+		Buckets:            12,
+		AsyncDuration:      time.Minute * 5,
+		ProbePercent:       10,
+		MinRequests:        10,
+		RecoverMinRequests: 3,
+		ResponseTime:       time.Millisecond * 500,
+		ErrorRate:          0.2,
+		Concurrency:        4,
+		BatchSize:          20,
+		PollInterval:       time.Second,
+		Lease:              time.Minute,
+		SendTimeout:        time.Second * 5,
+		MarkTimeout:        time.Second,
+		RetryMax:           3,
+		BackoffBase:        time.Second * 10,
+		BackoffMax:         time.Minute * 10,
+	}
+	if err := viper.UnmarshalKey("sms.async", &cfg); err != nil {
+		panic(err)
+	}
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "sinsoledad",
+		Subsystem: "archi",
+		Name:      "sms_async_mode",
+		Help:      "短信发送模式，1 为异步，0 为同步",
+	})
+	prometheus.MustRegister(gauge)
+	return async.Config{
+		Deciders: []async.AsyncDecider{
+			async.ResponseTimeDecider{Threshold: cfg.ResponseTime, MinRequests: cfg.MinRequests},
+			async.ErrorRateDecider{Threshold: cfg.ErrorRate, MinRequests: cfg.MinRequests},
+		},
+		Window:        cfg.Window,
+		Buckets:       cfg.Buckets,
+		AsyncDuration: cfg.AsyncDuration,
+		ProbePercent:  cfg.ProbePercent,
+		// 探测请求太少的时候不能说明服务商已经恢复
+		RecoverMinRequests: cfg.RecoverMinRequests,
+		Gauge:              gauge,
+		Worker: async.WorkerConfig{
+			Concurrency:  cfg.Concurrency,
+			BatchSize:    cfg.BatchSize,
+			PollInterval: cfg.PollInterval,
+			Lease:        cfg.Lease,
+			SendTimeout:  cfg.SendTimeout,
+			MarkTimeout:  cfg.MarkTimeout,
+			RetryMax:     cfg.RetryMax,
+			BackoffBase:  cfg.BackoffBase,
+			BackoffMax:   cfg.BackoffMax,
+		},
+	}
 }
 
 func initTencentSMSService() sms.Service {
@@ -29,13 +185,32 @@ func initTencentSMSService() sms.Service {
 	if !ok {
 		panic("找不到腾讯 SMS 的 secret key")
 	}
+	type Config struct {
+		Region string `yaml:"region"`
+		AppId  string `yaml:"appId"`
+		// SignName 默认签名，模板里面配置了签名的时候使用模板的
+		SignName string `yaml:"signName"`
+	}
+	var cfg Config
+	if err := viper.UnmarshalKey("sms.tencent", &cfg); err != nil {
+		panic(err)
+	}
 	c, err := tencentSMS.NewClient(
 		common.NewCredential(secretId, secretKey),
-		"ap-nanjing",
+		cfg.Region,
 		profile.NewClientProfile(),
 	)
 	if err != nil {
 		panic(err)
 	}
-	return tencent.NewService(c, "1400842696", "妙影科技")
+	return tencent.NewService(c, cfg.AppId, cfg.SignName)
+}
+
+// InitSMSAdmins 从配置 sms.admins 中读取可以处理短信死信的管理员
+func InitSMSAdmins() service.SMSAdmins {
+	var admins []int64
+	if err := viper.UnmarshalKey("sms.admins", &admins); err != nil {
+		panic(fmt.Errorf("读取短信管理员配置失败 %w", err))
+	}
+	return admins
 }
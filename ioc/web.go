@@ -13,13 +13,16 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func InitWebEngine(middlewares []gin.HandlerFunc, l logger.Logger,
 	userHdl *web.UserHandler, artHdl *web.ArticleHandler, comHdl *web.CommentHandler,
 	fHdl *web.FollowHandler, tagHdl *web.TagHandler, searchHdl *web.SearchHandler,
-	feedHdl *web.FeedHandler) *gin.Engine {
+	feedHdl *web.FeedHandler, modHdl *web.ModerationHandler, notifHdl *web.NotificationHandler,
+	smsHdl *web.SMSHandler, captchaHdl *web.CaptchaHandler) *gin.Engine {
 	ginx.SetLogger(l)
 	ginx.InitMetricCounter(prometheus.CounterOpts{
 		Namespace: "sinsoledad",
@@ -39,19 +42,37 @@ func InitWebEngine(middlewares []gin.HandlerFunc, l logger.Logger,
 	tagHdl.RegisterRoutes(engine)
 	searchHdl.RegisterRoutes(engine)
 	feedHdl.RegisterRoutes(engine)
+	modHdl.RegisterRoutes(engine)
+	notifHdl.RegisterRoutes(engine)
+	smsHdl.RegisterRoutes(engine)
+	captchaHdl.RegisterRoutes(engine)
 	return engine
 }
 
+func InitJWTHandler(client redis.Cmdable) jwt.Handler {
+	type Config struct {
+		// MaxActive 每个用户最多同时登录的设备数，超过之后最早登录的设备被挤下线，0 表示不限制
+		MaxActive int `yaml:"maxActive"`
+	}
+	cfg := Config{
+		MaxActive: 5,
+	}
+	if err := viper.UnmarshalKey("session", &cfg); err != nil {
+		panic(err)
+	}
+	return jwt.NewRedisJWTHandler(client, cfg.MaxActive)
+}
+
 func InitGinMiddlewares(jwtHdl jwt.Handler, l logger.Logger) []gin.HandlerFunc {
 	corsMiddleware := cors.New(cors.Config{
 		// 在生产环境中，您应该将 AllowAllOrigins 设置为 false，并具体指定允许的前端域名
 		// 例如: AllowOrigins: []string{"http://your-frontend.com"},
 		AllowAllOrigins:  true,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"X-Jwt-Token", "X-Refresh-Token"}, // 允许前端访问后端设置的响应头
-		AllowCredentials: true,                                       // 允许携带 Cookie
-		MaxAge:           12 * time.Hour,                             // preflight 请求的缓存时间
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Last-Event-ID", "X-Device-Id", "X-Captcha-Token"},
+		ExposeHeaders:    []string{"X-Jwt-Token", "X-Refresh-Token", "X-Prompt-Version"}, // 允许前端访问后端设置的响应头
+		AllowCredentials: true,                                                           // 允许携带 Cookie
+		MaxAge:           12 * time.Hour,                                                 // preflight 请求的缓存时间
 	})
 
 	logFn := func(ctx context.Context, al ginxmw.AccessLog) {
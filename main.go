@@ -39,6 +39,18 @@ func main() {
 		}
 	}
 
+	// 退出的时候通知异步短信的 worker 停止抢占，并等正在发送的短信处理完
+	smsCtx, smsCancel := context.WithCancel(context.Background())
+	smsDone := make(chan struct{})
+	go func() {
+		defer close(smsDone)
+		app.asyncSMS.Run(smsCtx)
+	}()
+	defer func() {
+		smsCancel()
+		<-smsDone
+	}()
+
 	app.cron.Start()
 	defer func() {
 		<-app.cron.Stop().Done()
@@ -0,0 +1,60 @@
+package mojocn
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mojocn/base64Captcha"
+	"github.com/redis/go-redis/v9"
+)
+
+var _ base64Captcha.Store = &RedisStore{}
+
+// RedisStore 把验证码答案存在 Redis 里面，多个实例之间可以互相校验
+// base64Captcha.Store 的接口没有 context，这里每次操作使用单独的超时
+type RedisStore struct {
+	cmd        redis.Cmdable
+	prefix     string
+	expiration time.Duration
+	timeout    time.Duration
+}
+
+func NewRedisStore(cmd redis.Cmdable, expiration time.Duration) *RedisStore {
+	return &RedisStore{
+		cmd:        cmd,
+		prefix:     "captcha:answer:",
+		expiration: expiration,
+		timeout:    time.Second,
+	}
+}
+
+func (s *RedisStore) Set(id string, value string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.cmd.Set(ctx, s.prefix+id, value, s.expiration).Err()
+}
+
+func (s *RedisStore) Get(id string, clear bool) string {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	var (
+		val string
+		err error
+	)
+	if clear {
+		val, err = s.cmd.GetDel(ctx, s.prefix+id).Result()
+	} else {
+		val, err = s.cmd.Get(ctx, s.prefix+id).Result()
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return ""
+	}
+	return val
+}
+
+func (s *RedisStore) Verify(id, answer string, clear bool) bool {
+	val := s.Get(id, clear)
+	return val != "" && strings.EqualFold(val, answer)
+}
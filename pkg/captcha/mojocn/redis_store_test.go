@@ -0,0 +1,29 @@
+package mojocn
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisStore_Verify(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Minute)
+	require.NoError(t, store.Set("id", "AbCd"))
+
+	// 不区分大小写，不清除的时候可以重复校验
+	assert.True(t, store.Verify("id", "abcd", false))
+	assert.False(t, store.Verify("id", "abce", false))
+	// 清除之后答案就没了，同一个验证码只能通过一次
+	assert.True(t, store.Verify("id", "ABCD", true))
+	assert.False(t, store.Verify("id", "abcd", true))
+
+	require.NoError(t, store.Set("expired", "abcd"))
+	mr.FastForward(time.Minute * 2)
+	assert.False(t, store.Verify("expired", "abcd", true))
+	assert.Equal(t, "", store.Get("not_exist", false))
+}
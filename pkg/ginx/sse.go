@@ -0,0 +1,471 @@
+package ginx
+
+import (
+	"archi/pkg/logger"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// SSE 事件类型
+const (
+	SSEEventToken      = "token"
+	SSEEventToolCall   = "tool_call"
+	SSEEventToolResult = "tool_result"
+	SSEEventError      = "error"
+	SSEEventDone       = "done"
+)
+
+// sseHeartbeatInterval 心跳间隔，防止代理因为长时间没有数据断开连接
+const sseHeartbeatInterval = time.Second * 15
+
+type SSEEvent struct {
+	// ID 格式为 streamId:seq，客户端重连时通过 Last-Event-ID 带回
+	ID    string
+	Event string
+	Data  any
+}
+
+type SSEToken struct {
+	Content string `json:"content"`
+}
+
+type SSEToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type SSEToolResult struct {
+	CallID  string `json:"call_id"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+type SSEError struct {
+	Msg string `json:"msg"`
+}
+
+// SSEOwner Claims 实现了这个接口才支持断线补发，只有流的所有者可以补发，其他人拿到 Last-Event-ID 也没用
+type SSEOwner interface {
+	SSEOwner() string
+}
+
+// SSEStore 保存已经发送过的事件，客户端断线重连时按 Last-Event-ID 补发
+type SSEStore interface {
+	// Append 第一次追加的时候记录流的所有者
+	Append(streamId, owner string, evt SSEEvent)
+	// Finish 标记流已经正常结束
+	Finish(streamId string)
+	// After 返回序号 seq 之后的事件，found 为 false 说明流不存在、已过期或者不属于 owner
+	After(streamId, owner string, seq int) (events []SSEEvent, finished bool, found bool)
+}
+
+var sseStore SSEStore = NewMemorySSEStore(time.Minute * 5)
+
+func SetSSEStore(store SSEStore) {
+	sseStore = store
+}
+
+// WrapStreamBodyAndClaims 流式接口的包装，bizFn 返回的 reader 为 nil 时按普通 JSON 返回 Result
+// 客户端断开连接时会取消 ctx.Request 的 context，bizFn 需要把 ctx.Request.Context() 传给下游，
+// *gin.Context 本身感知不到取消
+func WrapStreamBodyAndClaims[Req any, Claims jwt.Claims](
+	bizFn func(ctx *gin.Context, req Req, uc Claims) (*schema.StreamReader[any], Result, error)) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		val, ok := ctx.Get("user")
+		if !ok {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		uc, ok := val.(Claims)
+		if !ok {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		owner, replayable := any(uc).(SSEOwner)
+		// 断线重连，能找到之前的流就直接补发，不再重新调用模型
+		if replayable && replaySSE(ctx, owner.SSEOwner()) {
+			return
+		}
+
+		var req Req
+		if err := ctx.ShouldBind(&req); err != nil {
+			log.Error("输入错误", logger.Error(err))
+			ctx.JSON(http.StatusOK, Result{
+				Code: http.StatusBadRequest,
+				Msg:  "请求体格式错误",
+			})
+			return
+		}
+
+		reqCtx, cancel := context.WithCancel(ctx.Request.Context())
+		defer cancel()
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+
+		reader, res, err := bizFn(ctx, req, uc)
+		if err != nil {
+			log.Error("执行业务逻辑失败", logger.Error(err))
+		}
+		if reader == nil {
+			vector.WithLabelValues(strconv.Itoa(res.Code)).Inc()
+			ctx.JSON(http.StatusOK, res)
+			return
+		}
+		defer reader.Close()
+		vector.WithLabelValues(strconv.Itoa(http.StatusOK)).Inc()
+
+		w := newSSEWriter(ctx, uuid.New().String())
+		if replayable {
+			w.owner = owner.SSEOwner()
+		}
+		w.writeHeaders()
+		streamSSE(reqCtx, w, reader)
+	}
+}
+
+// WrapEventStreamClaims 服务端主动推送的长连接，bizFn 返回的 channel 为 nil 时按普通 JSON 返回 Result
+// channel 关闭或者客户端断开时结束。推送的事件不保存，断线重连之后由客户端自己补拉
+func WrapEventStreamClaims[Claims jwt.Claims](
+	bizFn func(ctx *gin.Context, uc Claims) (<-chan SSEEvent, Result, error)) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		val, ok := ctx.Get("user")
+		if !ok {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		uc, ok := val.(Claims)
+		if !ok {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		reqCtx, cancel := context.WithCancel(ctx.Request.Context())
+		defer cancel()
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+
+		events, res, err := bizFn(ctx, uc)
+		if err != nil {
+			log.Error("执行业务逻辑失败", logger.Error(err))
+		}
+		if events == nil {
+			vector.WithLabelValues(strconv.Itoa(res.Code)).Inc()
+			ctx.JSON(http.StatusOK, res)
+			return
+		}
+		vector.WithLabelValues(strconv.Itoa(http.StatusOK)).Inc()
+
+		w := newSSEWriter(ctx, uuid.New().String())
+		w.writeHeaders()
+		// 先刷一次，让客户端尽快确认连接建立
+		if err = w.heartbeat(); err != nil {
+			return
+		}
+		ticker := time.NewTicker(sseHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-reqCtx.Done():
+				return
+			case <-ticker.C:
+				if err = w.heartbeat(); err != nil {
+					return
+				}
+			case evt, ok := <-events:
+				if !ok {
+					return
+				}
+				if err = w.push(evt.Event, evt.Data); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+type sseChunk struct {
+	val any
+	err error
+}
+
+func streamSSE(ctx context.Context, w *sseWriter, reader *schema.StreamReader[any]) {
+	chunks := make(chan sseChunk)
+	go func() {
+		for {
+			val, err := reader.Recv()
+			select {
+			case chunks <- sseChunk{val: val, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(sseHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// 客户端断开，返回后 cancel 会终止模型调用
+			log.Debug("SSE 客户端断开连接", logger.String("stream_id", w.streamId))
+			return
+		case <-ticker.C:
+			if err := w.heartbeat(); err != nil {
+				return
+			}
+		case c := <-chunks:
+			if errors.Is(c.err, io.EOF) {
+				if w.send(SSEEventDone, struct{}{}) == nil && w.owner != "" {
+					sseStore.Finish(w.streamId)
+				}
+				return
+			}
+			if c.err != nil {
+				log.Error("读取流式响应失败", logger.String("stream_id", w.streamId), logger.Error(c.err))
+				_ = w.send(SSEEventError, SSEError{Msg: "生成中断，请稍后重试"})
+				return
+			}
+			for _, evt := range toSSEEvents(c.val) {
+				if err := w.send(evt.Event, evt.Data); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// toSSEEvents 把流中的数据块转换为带类型的事件
+func toSSEEvents(chunk any) []SSEEvent {
+	switch v := chunk.(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []SSEEvent{{Event: SSEEventToken, Data: SSEToken{Content: v}}}
+	case *schema.Message:
+		if v == nil {
+			return nil
+		}
+		if v.Role == schema.Tool {
+			return []SSEEvent{{Event: SSEEventToolResult, Data: SSEToolResult{
+				CallID:  v.ToolCallID,
+				Name:    v.ToolName,
+				Content: v.Content,
+			}}}
+		}
+		evts := make([]SSEEvent, 0, len(v.ToolCalls)+1)
+		for _, tc := range v.ToolCalls {
+			evts = append(evts, SSEEvent{Event: SSEEventToolCall, Data: SSEToolCall{
+				ID:        tc.ID,
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments,
+			}})
+		}
+		if v.Content != "" {
+			evts = append(evts, SSEEvent{Event: SSEEventToken, Data: SSEToken{Content: v.Content}})
+		}
+		return evts
+	default:
+		return nil
+	}
+}
+
+// replaySSE 按 Last-Event-ID 补发 owner 自己的流，返回 false 说明需要重新生成
+func replaySSE(ctx *gin.Context, owner string) bool {
+	lastId := ctx.GetHeader("Last-Event-ID")
+	if lastId == "" {
+		return false
+	}
+	streamId, seq, ok := parseSSEEventID(lastId)
+	if !ok {
+		return false
+	}
+	events, finished, found := sseStore.After(streamId, owner, seq)
+	if !found {
+		return false
+	}
+	w := newSSEWriter(ctx, streamId)
+	w.writeHeaders()
+	for _, evt := range events {
+		if err := w.write(evt); err != nil {
+			return true
+		}
+	}
+	if !finished {
+		// 原来的连接断开时模型调用已经取消，只能告诉客户端重新提问
+		_ = w.write(SSEEvent{Event: SSEEventError, Data: SSEError{Msg: "生成已中断，请重新提问"}})
+	}
+	return true
+}
+
+func parseSSEEventID(id string) (string, int, bool) {
+	idx := strings.LastIndexByte(id, ':')
+	if idx <= 0 {
+		return "", 0, false
+	}
+	seq, err := strconv.Atoi(id[idx+1:])
+	if err != nil || seq < 0 {
+		return "", 0, false
+	}
+	return id[:idx], seq, true
+}
+
+type sseWriter struct {
+	ctx      *gin.Context
+	streamId string
+	// owner 为空时不保存事件，不支持断线补发
+	owner string
+	seq   int
+}
+
+func newSSEWriter(ctx *gin.Context, streamId string) *sseWriter {
+	return &sseWriter{ctx: ctx, streamId: streamId}
+}
+
+func (w *sseWriter) writeHeaders() {
+	w.ctx.Header("Content-Type", "text/event-stream")
+	w.ctx.Header("Cache-Control", "no-cache")
+	w.ctx.Header("Connection", "keep-alive")
+	// 禁用 Nginx 的缓冲，否则事件会被攒在一起下发
+	w.ctx.Header("X-Accel-Buffering", "no")
+	w.ctx.Status(http.StatusOK)
+}
+
+// send 分配序号，保存后发送
+func (w *sseWriter) send(event string, data any) error {
+	w.seq++
+	evt := SSEEvent{
+		ID:    fmt.Sprintf("%s:%d", w.streamId, w.seq),
+		Event: event,
+		Data:  data,
+	}
+	if w.owner != "" {
+		sseStore.Append(w.streamId, w.owner, evt)
+	}
+	return w.write(evt)
+}
+
+// push 分配序号后直接发送，不保存
+func (w *sseWriter) push(event string, data any) error {
+	w.seq++
+	return w.write(SSEEvent{
+		ID:    fmt.Sprintf("%s:%d", w.streamId, w.seq),
+		Event: event,
+		Data:  data,
+	})
+}
+
+func (w *sseWriter) write(evt SSEEvent) error {
+	data, err := json.Marshal(evt.Data)
+	if err != nil {
+		return err
+	}
+	var sb strings.Builder
+	if evt.ID != "" {
+		sb.WriteString("id: ")
+		sb.WriteString(evt.ID)
+		sb.WriteByte('\n')
+	}
+	sb.WriteString("event: ")
+	sb.WriteString(evt.Event)
+	sb.WriteString("\ndata: ")
+	sb.Write(data)
+	sb.WriteString("\n\n")
+	if _, err = w.ctx.Writer.WriteString(sb.String()); err != nil {
+		return err
+	}
+	w.ctx.Writer.Flush()
+	return nil
+}
+
+// heartbeat 使用 SSE 注释行保活，客户端会直接忽略
+func (w *sseWriter) heartbeat() error {
+	if _, err := w.ctx.Writer.WriteString(": ping\n\n"); err != nil {
+		return err
+	}
+	w.ctx.Writer.Flush()
+	return nil
+}
+
+// MemorySSEStore 单机内存版本，多实例部署时需要配合会话保持或者换成共享存储
+type MemorySSEStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	streams map[string]*sseStreamRecord
+}
+
+type sseStreamRecord struct {
+	owner    string
+	events   []SSEEvent
+	finished bool
+	expireAt time.Time
+}
+
+func NewMemorySSEStore(ttl time.Duration) *MemorySSEStore {
+	return &MemorySSEStore{
+		ttl:     ttl,
+		streams: make(map[string]*sseStreamRecord),
+	}
+}
+
+func (s *MemorySSEStore) Append(streamId, owner string, evt SSEEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	rec, ok := s.streams[streamId]
+	if !ok {
+		// 新建流的时候顺便清理过期数据
+		s.evict(now)
+		rec = &sseStreamRecord{owner: owner}
+		s.streams[streamId] = rec
+	}
+	rec.events = append(rec.events, evt)
+	rec.expireAt = now.Add(s.ttl)
+}
+
+func (s *MemorySSEStore) Finish(streamId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec, ok := s.streams[streamId]; ok {
+		rec.finished = true
+	}
+}
+
+func (s *MemorySSEStore) After(streamId, owner string, seq int) ([]SSEEvent, bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.streams[streamId]
+	if !ok || rec.owner != owner || time.Now().After(rec.expireAt) {
+		return nil, false, false
+	}
+	if seq > len(rec.events) {
+		seq = len(rec.events)
+	}
+	res := make([]SSEEvent, len(rec.events)-seq)
+	copy(res, rec.events[seq:])
+	return res, rec.finished, true
+}
+
+func (s *MemorySSEStore) evict(now time.Time) {
+	for id, rec := range s.streams {
+		if now.After(rec.expireAt) {
+			delete(s.streams, id)
+		}
+	}
+}
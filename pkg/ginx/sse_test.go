@@ -0,0 +1,62 @@
+package ginx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaySSE(t *testing.T) {
+	store := NewMemorySSEStore(time.Minute)
+	old := sseStore
+	SetSSEStore(store)
+	defer SetSSEStore(old)
+	store.Append("s1", "1", SSEEvent{ID: "s1:1", Event: SSEEventToken, Data: SSEToken{Content: "你"}})
+	store.Append("s1", "1", SSEEvent{ID: "s1:2", Event: SSEEventToken, Data: SSEToken{Content: "好"}})
+	store.Finish("s1")
+
+	testCases := []struct {
+		name       string
+		owner      string
+		lastId     string
+		wantReplay bool
+		wantBody   string
+	}{
+		{
+			name:       "所有者补发剩下的事件",
+			owner:      "1",
+			lastId:     "s1:1",
+			wantReplay: true,
+			wantBody:   "id: s1:2\nevent: token\ndata: {\"content\":\"好\"}\n\n",
+		},
+		{
+			name:   "其他用户不能补发",
+			owner:  "2",
+			lastId: "s1:0",
+		},
+		{
+			name:   "流不存在",
+			owner:  "1",
+			lastId: "s2:0",
+		},
+		{
+			name:   "Last-Event-ID 格式不对",
+			owner:  "1",
+			lastId: "s1",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/ai-qa", nil)
+			ctx.Request.Header.Set("Last-Event-ID", tc.lastId)
+			assert.Equal(t, tc.wantReplay, replaySSE(ctx, tc.owner))
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
@@ -0,0 +1,20 @@
+-- 同时检查多个滑动窗口，全部没有达到阈值才在每个窗口里面各记一次
+-- 任何一个窗口达到阈值时一个都不记，返回这个窗口的序号，从 1 开始；全部通过返回 0
+-- ARGV[1] 当前时间，ARGV[2] 这一次请求的 member，之后每两个参数是一个窗口的大小和阈值，和 KEYS 一一对应
+local now = tonumber(ARGV[1])
+local member = ARGV[2]
+
+for i, key in ipairs(KEYS) do
+    local window = tonumber(ARGV[1 + i * 2])
+    local threshold = tonumber(ARGV[2 + i * 2])
+    redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+    if redis.call('ZCARD', key) >= threshold then
+        return i
+    end
+end
+
+for i, key in ipairs(KEYS) do
+    redis.call('ZADD', key, now, member)
+    redis.call('PEXPIRE', key, ARGV[1 + i * 2])
+end
+return 0
@@ -9,6 +9,8 @@ local window = tonumber(ARGV[1])
 -- 阈值
 local threshold = tonumber( ARGV[2])
 local now = tonumber(ARGV[3])
+-- 同一毫秒内的多个请求要用不同的 member，不然会被合并成一个
+local member = ARGV[4] or now
 -- 窗口的起始时间
 local min = now - window
 
@@ -17,10 +19,10 @@ local cnt = redis.call('ZCOUNT', key, '-inf', '+inf')
 -- local cnt = redis.call('ZCOUNT', key, min, '+inf')
 if cnt >= threshold then
     -- 执行限流
-    return "true"
+    return 1
 else
-    -- 把 score 和 member 都设置成 now
-    redis.call('ZADD', key, now, now)
+    -- score 设置成 now
+    redis.call('ZADD', key, now, member)
     redis.call('PEXPIRE', key, window)
-    return "false"
+    return 0
 end
\ No newline at end of file
@@ -0,0 +1,60 @@
+package limiter
+
+import (
+	"context"
+	_ "embed"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+//go:embed lua/multi_slide_window.lua
+var luaMultiSlideWindow string
+
+var multiSlideWindowScript = redis.NewScript(luaMultiSlideWindow)
+
+// Rule 一个维度的滑动窗口，Interval 内最多 Rate 个请求
+type Rule struct {
+	Key      string
+	Interval time.Duration
+	Rate     int
+}
+
+// MultiLimiter 同时检查多个维度，全部没有触发限流才在每个维度上各记一次，
+// 被任何一个维度拒绝时都不记，避免被拒绝的请求消耗其它维度的次数
+type MultiLimiter interface {
+	// Limit 返回第一个触发限流的规则的下标，全部通过时返回 -1
+	Limit(ctx context.Context, rules ...Rule) (int, error)
+}
+
+// RedisMultiSlideWindowLimiter 一个 Lua 脚本里面完成检查和计数
+// 脚本同时操作多个 key，Redis Cluster 下这些 key 需要带同一个 hash tag
+type RedisMultiSlideWindowLimiter struct {
+	cmd redis.Cmdable
+}
+
+func NewRedisMultiSlideWindowLimiter(cmd redis.Cmdable) MultiLimiter {
+	return &RedisMultiSlideWindowLimiter{
+		cmd: cmd,
+	}
+}
+
+func (r *RedisMultiSlideWindowLimiter) Limit(ctx context.Context, rules ...Rule) (int, error) {
+	if len(rules) == 0 {
+		return -1, nil
+	}
+	keys := make([]string, 0, len(rules))
+	args := make([]any, 0, len(rules)*2+2)
+	// 同一毫秒内的多个请求要用不同的 member，不然会被合并成一个
+	args = append(args, time.Now().UnixMilli(), uuid.NewString())
+	for _, rule := range rules {
+		keys = append(keys, rule.Key)
+		args = append(args, rule.Interval.Milliseconds(), rule.Rate)
+	}
+	res, err := multiSlideWindowScript.Run(ctx, r.cmd, keys, args...).Int()
+	if err != nil {
+		return -1, err
+	}
+	return res - 1, nil
+}
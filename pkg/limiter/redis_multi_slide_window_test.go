@@ -0,0 +1,116 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedis(t *testing.T) (redis.Cmdable, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	return redis.NewClient(&redis.Options{Addr: mr.Addr()}), mr
+}
+
+func TestRedisSlideWindowLimiter_Limit(t *testing.T) {
+	client, _ := newTestRedis(t)
+	l := NewRedisSlideWindowLimiter(client, time.Minute, 3)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		limited, err := l.Limit(ctx, "limit:a")
+		require.NoError(t, err)
+		// 同一毫秒内的请求也要分别计数
+		assert.False(t, limited, "request %d", i)
+	}
+	limited, err := l.Limit(ctx, "limit:a")
+	require.NoError(t, err)
+	assert.True(t, limited)
+
+	// 不同的 key 互不影响
+	limited, err = l.Limit(ctx, "limit:b")
+	require.NoError(t, err)
+	assert.False(t, limited)
+}
+
+func TestRedisMultiSlideWindowLimiter_Limit(t *testing.T) {
+	testCases := []struct {
+		name string
+		// before 每个 key 预先已经有的请求数
+		before  map[string]int
+		rules   []Rule
+		wantIdx int
+		// wantCnt 调用之后每个 key 的请求数
+		wantCnt map[string]int
+	}{
+		{
+			name: "全部通过都计数",
+			rules: []Rule{
+				{Key: "{t}:ip", Interval: time.Minute, Rate: 2},
+				{Key: "{t}:phone", Interval: time.Minute, Rate: 2},
+			},
+			wantIdx: -1,
+			wantCnt: map[string]int{"{t}:ip": 1, "{t}:phone": 1},
+		},
+		{
+			name:   "第一个维度拒绝，其它维度不计数",
+			before: map[string]int{"{t}:ip": 2},
+			rules: []Rule{
+				{Key: "{t}:ip", Interval: time.Minute, Rate: 2},
+				{Key: "{t}:phone", Interval: time.Minute, Rate: 2},
+			},
+			wantIdx: 0,
+			wantCnt: map[string]int{"{t}:ip": 2, "{t}:phone": 0},
+		},
+		{
+			name:   "后面的维度拒绝，前面的也不计数",
+			before: map[string]int{"{t}:budget": 3},
+			rules: []Rule{
+				{Key: "{t}:phone", Interval: time.Minute, Rate: 2},
+				{Key: "{t}:budget", Interval: time.Minute, Rate: 3},
+			},
+			wantIdx: 1,
+			wantCnt: map[string]int{"{t}:phone": 0, "{t}:budget": 3},
+		},
+		{
+			name:    "没有规则",
+			wantIdx: -1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, mr := newTestRedis(t)
+			now := float64(time.Now().UnixMilli())
+			for key, cnt := range tc.before {
+				for i := 0; i < cnt; i++ {
+					_, err := mr.ZAdd(key, now, string(rune('a'+i)))
+					require.NoError(t, err)
+				}
+			}
+			idx, err := NewRedisMultiSlideWindowLimiter(client).Limit(context.Background(), tc.rules...)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantIdx, idx)
+			for key, cnt := range tc.wantCnt {
+				members, _ := mr.ZMembers(key)
+				assert.Len(t, members, cnt, key)
+			}
+		})
+	}
+}
+
+func TestRedisMultiSlideWindowLimiter_Expire(t *testing.T) {
+	client, mr := newTestRedis(t)
+	// 窗口之外的请求不算
+	_, err := mr.ZAdd("{t}:ip", float64(time.Now().Add(-time.Minute*2).UnixMilli()), "old")
+	require.NoError(t, err)
+	idx, err := NewRedisMultiSlideWindowLimiter(client).Limit(context.Background(),
+		Rule{Key: "{t}:ip", Interval: time.Minute, Rate: 1})
+	require.NoError(t, err)
+	assert.Equal(t, -1, idx)
+	members, _ := mr.ZMembers("{t}:ip")
+	assert.Len(t, members, 1)
+	assert.True(t, mr.TTL("{t}:ip") > 0)
+}
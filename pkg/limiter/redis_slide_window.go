@@ -5,6 +5,7 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"time"
 )
@@ -37,7 +38,7 @@ func NewRedisSlideWindowLimiter(cmd redis.Cmdable, interval time.Duration, rate
 func (r *RedisSlideWindowLimiter) Limit(ctx context.Context, key string) (bool, error) {
 	// 使用 slideWindowScript.Run 代替 r.cmd.Eval
 	res, err := slideWindowScript.Run(ctx, r.cmd, []string{key},
-		r.interval.Milliseconds(), r.rate, time.Now().UnixMilli()).Result()
+		r.interval.Milliseconds(), r.rate, time.Now().UnixMilli(), uuid.NewString()).Result()
 
 	if err != nil {
 		// 当脚本返回的不是整数时，go-redis的Bool()会报错，但这里Lua脚本返回的是0或1
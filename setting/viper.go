@@ -23,6 +23,8 @@ func InitViper() {
 		panic(err)
 	}
 	fmt.Println("配置文件读取成功", viper.ConfigFileUsed())
+	// 只在这里启动一次监听，需要热加载的模块通过 viper.OnConfigChange 注册回调
+	viper.WatchConfig()
 
 	// --- 开始打印配置 ---
 
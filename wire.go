@@ -3,10 +3,17 @@
 package main
 
 import (
+	evtai "archi/internal/event/ai"
 	"archi/internal/event/article"
+	"archi/internal/event/fanout"
 	evtfeed "archi/internal/event/feed"
+	"archi/internal/event/feedevent"
 	"archi/internal/event/follow"
+	"archi/internal/event/mention"
+	"archi/internal/event/moderation"
+	"archi/internal/event/notification"
 	searchCons "archi/internal/event/search"
+	"archi/internal/event/security"
 	"archi/internal/event/tag"
 	"archi/internal/event/user"
 	"archi/internal/repository"
@@ -17,8 +24,11 @@ import (
 	"archi/internal/service"
 	"archi/internal/service/ai"
 	"archi/internal/service/feed"
+	"archi/internal/service/sms"
+	"archi/internal/service/sms/async"
+	"archi/internal/service/sms/failover"
 	"archi/internal/web"
-	"archi/internal/web/middleware/jwt"
+	webmw "archi/internal/web/middleware"
 	"archi/ioc"
 
 	"github.com/google/wire"
@@ -38,13 +48,37 @@ var userSvcProviderSet = wire.NewSet(
 	dao.NewGORMUserDAO,
 	repository.NewCachedUserRepository,
 	service.NewUserService,
+	cache.NewRedisLoginGuardCache,
+	repository.NewCachedLoginGuardRepository,
+	ioc.InitLoginGuardConfig,
+	service.NewDefaultLoginGuardService,
 )
 
 var codeSvcProviderSet = wire.NewSet(
 	cache.NewRedisCodeCache,
 	repository.NewCachedCodeRepository,
+	dao.NewGORMAsyncSMSDAO,
+	repository.NewDefaultAsyncSMSRepository,
 	ioc.InitSMSService,
+	wire.Bind(new(sms.Service), new(*async.Service)),
+	ioc.InitSMSTemplates,
+	ioc.InitSMSProviders,
+	wire.Bind(new(service.SMSProviderReporter), new(*failover.HealthService)),
+	ioc.InitSMSAdmins,
+	service.NewDefaultSMSDeadLetterService,
+	service.NewDefaultSMSProviderService,
 	service.NewDefaultCodeService,
+	ioc.InitCodeGuardLimiter,
+	ioc.InitCodeGuardRules,
+	service.NewDefaultCodeGuardService,
+)
+
+var captchaSvcProviderSet = wire.NewSet(
+	cache.NewRedisCaptchaCache,
+	repository.NewCachedCaptchaRepository,
+	ioc.InitCaptchaService,
+	ioc.InitCaptchaConfig,
+	service.NewDefaultCaptchaService,
 )
 
 // var wechatSvc = wire.NewSet(
@@ -74,7 +108,9 @@ var rankingSvcProviderSet = wire.NewSet(
 
 var commentSvcProviderSet = wire.NewSet(
 	dao.NewGORMCommentDAO,
+	cache.NewRedisCommentCache,
 	repository.NewCachedCommentRepository,
+	ioc.InitCommentConfig,
 	service.NewDefaultCommentService,
 )
 
@@ -92,9 +128,47 @@ var tagSvcProviderSet = wire.NewSet(
 	service.NewDefaultTagService,
 )
 
+var blockSvcProviderSet = wire.NewSet(
+	cache.NewRedisBlockCache,
+	dao.NewGORMBlockRelationDAO,
+	repository.NewCachedBlockRepository,
+	service.NewDefaultBlockService,
+)
+
+var followRecommendSvcProviderSet = wire.NewSet(
+	cache.NewRedisFollowRecommendCache,
+	dao.NewGORMFollowRecommendDAO,
+	repository.NewCachedFollowRecommendRepository,
+	ioc.InitFollowRecommendConfig,
+	service.NewDefaultFollowRecommendService,
+)
+
+var moderationSvcProviderSet = wire.NewSet(
+	dao.NewGORMModerationDAO,
+	repository.NewDefaultModerationRepository,
+	ioc.InitModerationFilter,
+	ioc.InitModerationReviewers,
+	service.NewDefaultModerationService,
+)
+
+var mentionSvcProviderSet = wire.NewSet(
+	dao.NewGORMMentionDAO,
+	repository.NewDefaultMentionRepository,
+	service.NewDefaultMentionService,
+)
+
+var notificationSvcProviderSet = wire.NewSet(
+	cache.NewRedisNotificationCache,
+	dao.NewGORMNotificationDAO,
+	repository.NewCachedNotificationRepository,
+	service.NewDefaultNotificationService,
+)
+
 var aiSvcProviderSet = wire.NewSet(
 	cache.NewRedisAiCache,
+	dao.NewGORMAiDAO,
 	repository.NewCachedAiRepository,
+	ioc.InitPromptRegistry,
 	ioc.InitVolcanoModel,
 	ai.NewAiFactory,
 	ioc.InitAiProvider,
@@ -119,6 +193,8 @@ var feedSvcProviderSet = wire.NewSet(
 	dao.NewFeedPushEventDAO,
 	repository.NewFeedEventRepo,
 	feed.NewFeedService,
+	ioc.InitFeedFanoutConfig,
+	ioc.InitFeedRetentionConfig,
 	ioc.RegisterFeedHandler,
 )
 
@@ -138,10 +214,26 @@ var eventsProviderSet = wire.NewSet(
 	// feed-follow
 	follow.NewFollowEventProducer,
 	evtfeed.NewFollowEventConsumer,
+	evtfeed.NewUnfollowEventConsumer,
+	// feed-fanout
+	fanout.NewFanoutEventProducer,
+	evtfeed.NewFanoutEventConsumer,
+	// feed-comment/reward/collect
+	feedevent.NewFeedEventProducer,
+	evtfeed.NewFeedEventConsumer,
+	// content-moderation
+	moderation.NewModerationEventProducer,
+	evtai.NewModerationEventConsumer,
+	// mention
+	mention.NewMentionEventProducer,
+	// security-audit
+	security.NewAuditEventProducer,
+	// notification
+	notification.NewConsumer,
 )
 
 var handlerProviderSet = wire.NewSet(
-	jwt.NewRedisJWTHandler,
+	ioc.InitJWTHandler,
 	web.NewUserHandler,
 	//web.NewOAuth2WechatHandler,
 	web.NewArticleHandler,
@@ -150,10 +242,17 @@ var handlerProviderSet = wire.NewSet(
 	web.NewTagHandler,
 	web.NewSearchHandler,
 	web.NewFeedHandler,
+	web.NewModerationHandler,
+	web.NewNotificationHandler,
+	web.NewSMSHandler,
+	web.NewCaptchaHandler,
+	webmw.NewCaptchaBuilder,
 )
 
 var jobProviderSet = wire.NewSet(
 	ioc.InitRankingJob,
+	ioc.InitFeedArchiveJob,
+	ioc.InitFollowRecommendJob,
 	ioc.InitJobs,
 )
 
@@ -173,6 +272,12 @@ func InitApp() *App {
 		searchSvcProviderSet,
 		feedSvcProviderSet,
 		aiSvcProviderSet,
+		moderationSvcProviderSet,
+		notificationSvcProviderSet,
+		mentionSvcProviderSet,
+		blockSvcProviderSet,
+		followRecommendSvcProviderSet,
+		captchaSvcProviderSet,
 
 		handlerProviderSet,
 		jobProviderSet,
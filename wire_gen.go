@@ -7,10 +7,17 @@
 package main
 
 import (
+	ai2 "archi/internal/event/ai"
 	"archi/internal/event/article"
+	"archi/internal/event/fanout"
 	feed2 "archi/internal/event/feed"
+	"archi/internal/event/feedevent"
 	"archi/internal/event/follow"
+	"archi/internal/event/mention"
+	"archi/internal/event/moderation"
+	"archi/internal/event/notification"
 	search3 "archi/internal/event/search"
+	"archi/internal/event/security"
 	"archi/internal/event/tag"
 	"archi/internal/event/user"
 	"archi/internal/repository"
@@ -21,8 +28,11 @@ import (
 	"archi/internal/service"
 	"archi/internal/service/ai"
 	"archi/internal/service/feed"
+	"archi/internal/service/sms"
+	"archi/internal/service/sms/async"
+	"archi/internal/service/sms/failover"
 	"archi/internal/web"
-	"archi/internal/web/middleware/jwt"
+	"archi/internal/web/middleware"
 	"archi/ioc"
 	"github.com/google/wire"
 )
@@ -31,7 +41,7 @@ import (
 
 func InitApp() *App {
 	cmdable := ioc.InitRedis()
-	handler := jwt.NewRedisJWTHandler(cmdable)
+	handler := ioc.InitJWTHandler(cmdable)
 	logger := ioc.InitLogger()
 	v := ioc.InitGinMiddlewares(handler, logger)
 	db := ioc.InitMySQL(logger)
@@ -41,47 +51,98 @@ func InitApp() *App {
 	client := ioc.InitSaramaClient()
 	syncProducer := ioc.InitSyncProducer(client)
 	producer := user.NewSaramaSyncProducer(syncProducer)
-	userService := service.NewUserService(logger, userRepository, producer)
+	loginGuardCache := cache.NewRedisLoginGuardCache(cmdable)
+	loginGuardRepository := repository.NewCachedLoginGuardRepository(loginGuardCache)
 	codeCache := cache.NewRedisCodeCache(cmdable)
 	codeRepository := repository.NewCachedCodeRepository(codeCache)
-	smsService := ioc.InitSMSService()
-	codeService := service.NewDefaultCodeService(codeRepository, smsService)
-	userHandler := web.NewUserHandler(logger, userService, codeService, handler)
+	registry := ioc.InitSMSTemplates()
+	healthService := ioc.InitSMSProviders(registry)
+	asyncSMSDAO := dao.NewGORMAsyncSMSDAO(db)
+	asyncSMSRepository := repository.NewDefaultAsyncSMSRepository(asyncSMSDAO)
+	asyncService := ioc.InitSMSService(healthService, asyncSMSRepository, logger)
+	codeService := service.NewDefaultCodeService(codeRepository, asyncService, registry)
+	multiLimiter := ioc.InitCodeGuardLimiter(cmdable)
+	codeGuardRules := ioc.InitCodeGuardRules()
+	codeGuardService := service.NewDefaultCodeGuardService(multiLimiter, codeGuardRules)
+	securityProducer := security.NewAuditEventProducer(syncProducer)
+	loginGuardConfig := ioc.InitLoginGuardConfig()
+	loginGuardService := service.NewDefaultLoginGuardService(loginGuardRepository, userRepository, codeService, codeGuardService, securityProducer, loginGuardConfig, logger)
+	userService := service.NewUserService(logger, userRepository, producer, loginGuardService)
+	captchaCache := cache.NewRedisCaptchaCache(cmdable)
+	captchaRepository := repository.NewCachedCaptchaRepository(captchaCache)
+	captchaService := ioc.InitCaptchaService(cmdable)
+	captchaConfig := ioc.InitCaptchaConfig()
+	serviceCaptchaService := service.NewDefaultCaptchaService(captchaRepository, captchaService, captchaConfig)
+	captchaBuilder := middleware.NewCaptchaBuilder(serviceCaptchaService, logger)
+	feedPullEventDAO := dao.NewFeedPullEventDAO(db)
+	feedPushEventDAO := dao.NewFeedPushEventDAO(db)
+	feedEventCache := cache.NewFeedEventCache(cmdable)
+	feedEventRepo := repository.NewFeedEventRepo(feedPullEventDAO, feedPushEventDAO, feedEventCache)
+	followProducer := follow.NewFollowEventProducer(syncProducer)
+	followRelationDao := dao.NewGORMFollowRelationDAO(db)
+	followCache := cache.NewRedisFollowCache(cmdable)
+	followRepository := repository.NewCachedFollowRepository(followRelationDao, followCache, logger)
+	blockRelationDAO := dao.NewGORMBlockRelationDAO(db)
+	blockCache := cache.NewRedisBlockCache(cmdable)
+	blockRepository := repository.NewCachedBlockRepository(blockRelationDAO, blockCache, logger)
+	followRelationService := service.NewDefaultFollowRelationService(followProducer, followRepository, blockRepository, logger)
+	fanoutProducer := fanout.NewFanoutEventProducer(syncProducer)
+	fanoutConfig := ioc.InitFeedFanoutConfig()
+	v2 := ioc.RegisterFeedHandler(feedEventRepo, followRelationService, fanoutProducer, fanoutConfig)
 	articleDAO := dao.NewGORMArticleDAO(db)
 	articleCache := cache.NewRedisArticleCache(cmdable)
 	articleRepository := repository.NewCachedArticleRepository(articleDAO, userRepository, articleCache)
+	retentionConfig := ioc.InitFeedRetentionConfig()
+	feedService := feed.NewFeedService(feedEventRepo, v2, userRepository, articleRepository, blockRepository, fanoutConfig, retentionConfig)
+	userHandler := web.NewUserHandler(logger, userService, codeService, codeGuardService, loginGuardService, serviceCaptchaService, captchaBuilder, handler, feedService)
 	articleProducer := article.NewSaramaSyncProducer(syncProducer)
-	articleService := service.NewDefaultArticleService(articleRepository, articleProducer)
-	interactiveDAO := dao.NewGORMInteractiveDAO(db)
+	moderationDAO := dao.NewGORMModerationDAO(db)
+	moderationRepository := repository.NewDefaultModerationRepository(moderationDAO)
+	commentDAO := dao.NewGORMCommentDAO(db)
+	commentCache := cache.NewRedisCommentCache(cmdable)
 	interactiveCache := cache.NewRedisInteractiveCache(cmdable)
+	commentRepository := repository.NewCachedCommentRepository(commentDAO, commentCache, interactiveCache, logger)
+	mentionDAO := dao.NewGORMMentionDAO(db)
+	mentionRepository := repository.NewDefaultMentionRepository(mentionDAO)
+	mentionProducer := mention.NewMentionEventProducer(syncProducer)
+	mentionService := service.NewDefaultMentionService(mentionRepository, userRepository, mentionProducer, logger)
+	feedeventProducer := feedevent.NewFeedEventProducer(syncProducer)
+	moderationProducer := moderation.NewModerationEventProducer(syncProducer)
+	moderationFilter := ioc.InitModerationFilter()
+	moderationReviewers := ioc.InitModerationReviewers()
+	moderationService := service.NewDefaultModerationService(moderationRepository, articleRepository, commentRepository, mentionService, articleProducer, feedeventProducer, moderationProducer, moderationFilter, moderationReviewers, logger)
+	articleService := service.NewDefaultArticleService(articleRepository, articleProducer, moderationService, mentionService, logger)
+	interactiveDAO := dao.NewGORMInteractiveDAO(db)
 	interactiveRepository := repository.NewCachedInteractiveRepository(interactiveDAO, interactiveCache, logger)
-	interactiveService := service.NewDefaultInteractiveService(interactiveRepository)
+	interactiveService := service.NewDefaultInteractiveService(interactiveRepository, articleRepository, feedeventProducer, logger)
 	redisRankingCache := cache.NewRedisRankingCache(cmdable)
 	localRankingCache := cache.NewLocalRankingCache()
 	rankingRepository := repository.NewCachedRankingRepository(redisRankingCache, localRankingCache)
 	rankingService := service.NewBatchRankingService(interactiveService, articleService, rankingRepository)
 	toolCallingChatModel := ioc.InitVolcanoModel()
-	aiFactory := ai.NewAiFactory(toolCallingChatModel, articleRepository, rankingService, interactiveService)
-	aiProvider := ioc.InitAiProvider(aiFactory)
-	aiCache := cache.NewRedisAiCache(cmdable)
-	aiRepository := repository.NewCachedAiRepository(aiCache)
-	aiService := ai.NewAiService(aiProvider, aiRepository)
-	articleHandler := web.NewArticleHandler(articleService, interactiveService, rankingService, aiService, logger)
-	commentDAO := dao.NewGORMCommentDAO(db)
-	commentRepository := repository.NewCachedCommentRepository(commentDAO, logger)
-	commentService := service.NewDefaultCommentService(commentRepository)
-	commentHandler := web.NewCommentHandler(commentService, logger)
-	followProducer := follow.NewFollowEventProducer(syncProducer)
-	followRelationDao := dao.NewGORMFollowRelationDAO(db)
-	followCache := cache.NewRedisFollowCache(cmdable)
-	followRepository := repository.NewCachedFollowRepository(followRelationDao, followCache, logger)
-	followRelationService := service.NewDefaultFollowRelationService(followProducer, followRepository, logger)
-	followHandler := web.NewFollowHandler(followRelationService, logger)
 	tagDAO := dao.NewGORMTagDAO(db)
 	tagCache := cache.NewRedisTagCache(cmdable)
 	tagRepository := repository.NewCachedTagRepository(tagDAO, tagCache, logger)
 	tagProducer := tag.NewSaramaSyncProducer(syncProducer)
 	tagService := service.NewDefaultTagService(tagRepository, tagProducer, logger)
+	aiCache := cache.NewRedisAiCache(cmdable)
+	aiDAO := dao.NewGORMAiDAO(db)
+	aiRepository := repository.NewCachedAiRepository(aiCache, aiDAO)
+	aiFactory := ai.NewAiFactory(toolCallingChatModel, articleRepository, rankingService, interactiveService, tagService, aiRepository, logger)
+	aiProvider := ioc.InitAiProvider(aiFactory)
+	promptRegistry := ioc.InitPromptRegistry(logger)
+	aiService := ai.NewAiService(aiProvider, promptRegistry, aiRepository, articleService, tagService, logger)
+	articleHandler := web.NewArticleHandler(articleService, interactiveService, rankingService, aiService, logger)
+	commentConfig := ioc.InitCommentConfig()
+	commentService := service.NewDefaultCommentService(commentRepository, articleRepository, interactiveService, moderationService, mentionService, blockRepository, feedeventProducer, commentConfig, logger)
+	commentHandler := web.NewCommentHandler(commentService, logger)
+	blockService := service.NewDefaultBlockService(blockRepository, followRelationService)
+	followRecommendDAO := dao.NewGORMFollowRecommendDAO(db)
+	followRecommendCache := cache.NewRedisFollowRecommendCache(cmdable)
+	followRecommendRepository := repository.NewCachedFollowRecommendRepository(followRecommendDAO, followRecommendCache)
+	followRecommendConfig := ioc.InitFollowRecommendConfig()
+	followRecommendService := service.NewDefaultFollowRecommendService(followRecommendRepository, followRepository, blockRepository, followRecommendConfig, logger)
+	followHandler := web.NewFollowHandler(followRelationService, userService, blockService, followRecommendService, logger)
 	tagHandler := web.NewTagHandler(tagService, logger)
 	elasticClient := ioc.InitESClient()
 	searchUserDAO := search.NewESUserDAO(elasticClient)
@@ -89,16 +150,21 @@ func InitApp() *App {
 	searchArticleDAO := search.NewESArticleDAO(elasticClient)
 	searchTagDAO := search.NewESTagDAO(elasticClient)
 	searchArticleRepository := search2.NewDefaultArticleRepository(searchArticleDAO, searchTagDAO)
-	searchService := service.NewDefaultSearchService(searchUserRepository, searchArticleRepository)
+	searchService := service.NewDefaultSearchService(searchUserRepository, searchArticleRepository, blockRepository)
 	searchHandler := web.NewSearchHandler(searchService)
-	feedPullEventDAO := dao.NewFeedPullEventDAO(db)
-	feedPushEventDAO := dao.NewFeedPushEventDAO(db)
-	feedEventCache := cache.NewFeedEventCache(cmdable)
-	feedEventRepo := repository.NewFeedEventRepo(feedPullEventDAO, feedPushEventDAO, feedEventCache)
-	v2 := ioc.RegisterFeedHandler(feedEventRepo, followRelationService)
-	feedService := feed.NewFeedService(feedEventRepo, v2)
 	feedHandler := web.NewFeedHandler(feedService, logger)
-	engine := ioc.InitWebEngine(v, logger, userHandler, articleHandler, commentHandler, followHandler, tagHandler, searchHandler, feedHandler)
+	moderationHandler := web.NewModerationHandler(moderationService, logger)
+	notificationDAO := dao.NewGORMNotificationDAO(db)
+	notificationCache := cache.NewRedisNotificationCache(cmdable)
+	notificationRepository := repository.NewCachedNotificationRepository(notificationDAO, notificationCache)
+	notificationService := service.NewDefaultNotificationService(notificationRepository, userRepository, logger)
+	notificationHandler := web.NewNotificationHandler(notificationService, logger)
+	smsAdmins := ioc.InitSMSAdmins()
+	smsDeadLetterService := service.NewDefaultSMSDeadLetterService(asyncSMSRepository, smsAdmins)
+	smsProviderService := service.NewDefaultSMSProviderService(healthService, smsAdmins)
+	smsHandler := web.NewSMSHandler(smsDeadLetterService, smsProviderService, logger)
+	captchaHandler := web.NewCaptchaHandler(serviceCaptchaService, logger)
+	engine := ioc.InitWebEngine(v, logger, userHandler, articleHandler, commentHandler, followHandler, tagHandler, searchHandler, feedHandler, moderationHandler, notificationHandler, smsHandler, captchaHandler)
 	readEventConsumer := article.NewReadEventConsumer(interactiveRepository, client, logger)
 	anyDAO := search.NewESAnyDAO(elasticClient)
 	anyRepository := search2.NewDefaultAnyRepository(anyDAO)
@@ -107,14 +173,22 @@ func InitApp() *App {
 	articleConsumer := search3.NewArticleConsumer(client, logger, syncService)
 	syncDataEventConsumer := search3.NewSyncDataEventConsumer(syncService, client, logger)
 	followEventConsumer := feed2.NewFollowEventConsumer(feedService, client, logger)
-	v3 := ioc.InitConsumers(readEventConsumer, userConsumer, articleConsumer, syncDataEventConsumer, followEventConsumer)
+	unfollowEventConsumer := feed2.NewUnfollowEventConsumer(feedService, client, logger)
+	fanoutEventConsumer := feed2.NewFanoutEventConsumer(feedService, client, logger)
+	feedEventConsumer := feed2.NewFeedEventConsumer(feedService, client, logger)
+	moderationEventConsumer := ai2.NewModerationEventConsumer(aiService, moderationService, client, logger)
+	consumer := notification.NewConsumer(notificationService, client, logger)
+	v3 := ioc.InitConsumers(readEventConsumer, userConsumer, articleConsumer, syncDataEventConsumer, followEventConsumer, unfollowEventConsumer, fanoutEventConsumer, feedEventConsumer, moderationEventConsumer, consumer)
 	rlockClient := ioc.InitRlockClient(cmdable)
 	rankingJob := ioc.InitRankingJob(rankingService, rlockClient, logger)
-	cron := ioc.InitJobs(logger, rankingJob)
+	feedArchiveJob := ioc.InitFeedArchiveJob(feedService, rlockClient, logger)
+	followRecommendJob := ioc.InitFollowRecommendJob(followRecommendService, rlockClient, logger)
+	cron := ioc.InitJobs(logger, rankingJob, feedArchiveJob, followRecommendJob)
 	app := &App{
 		engine:    engine,
 		consumers: v3,
 		cron:      cron,
+		asyncSMS:  asyncService,
 	}
 	return app
 }
@@ -123,9 +197,11 @@ func InitApp() *App {
 
 var thirdPartyProviderSet = wire.NewSet(ioc.InitLogger, ioc.InitMySQL, ioc.InitRedis, ioc.InitRlockClient, ioc.InitSaramaClient, ioc.InitESClient)
 
-var userSvcProviderSet = wire.NewSet(cache.NewRedisUserCache, dao.NewGORMUserDAO, repository.NewCachedUserRepository, service.NewUserService)
+var userSvcProviderSet = wire.NewSet(cache.NewRedisUserCache, dao.NewGORMUserDAO, repository.NewCachedUserRepository, service.NewUserService, cache.NewRedisLoginGuardCache, repository.NewCachedLoginGuardRepository, ioc.InitLoginGuardConfig, service.NewDefaultLoginGuardService)
 
-var codeSvcProviderSet = wire.NewSet(cache.NewRedisCodeCache, repository.NewCachedCodeRepository, ioc.InitSMSService, service.NewDefaultCodeService)
+var codeSvcProviderSet = wire.NewSet(cache.NewRedisCodeCache, repository.NewCachedCodeRepository, dao.NewGORMAsyncSMSDAO, repository.NewDefaultAsyncSMSRepository, ioc.InitSMSService, wire.Bind(new(sms.Service), new(*async.Service)), ioc.InitSMSTemplates, ioc.InitSMSProviders, wire.Bind(new(service.SMSProviderReporter), new(*failover.HealthService)), ioc.InitSMSAdmins, service.NewDefaultSMSDeadLetterService, service.NewDefaultSMSProviderService, service.NewDefaultCodeService, ioc.InitCodeGuardLimiter, ioc.InitCodeGuardRules, service.NewDefaultCodeGuardService)
+
+var captchaSvcProviderSet = wire.NewSet(cache.NewRedisCaptchaCache, repository.NewCachedCaptchaRepository, ioc.InitCaptchaService, ioc.InitCaptchaConfig, service.NewDefaultCaptchaService)
 
 var articleSvcProviderSet = wire.NewSet(cache.NewRedisArticleCache, dao.NewGORMArticleDAO, repository.NewCachedArticleRepository, service.NewDefaultArticleService)
 
@@ -133,20 +209,30 @@ var interactiveSvcProviderSet = wire.NewSet(cache.NewRedisInteractiveCache, dao.
 
 var rankingSvcProviderSet = wire.NewSet(cache.NewRedisRankingCache, cache.NewLocalRankingCache, repository.NewCachedRankingRepository, service.NewBatchRankingService)
 
-var commentSvcProviderSet = wire.NewSet(dao.NewGORMCommentDAO, repository.NewCachedCommentRepository, service.NewDefaultCommentService)
+var commentSvcProviderSet = wire.NewSet(dao.NewGORMCommentDAO, cache.NewRedisCommentCache, repository.NewCachedCommentRepository, ioc.InitCommentConfig, service.NewDefaultCommentService)
 
 var followSvcProviderSet = wire.NewSet(cache.NewRedisFollowCache, dao.NewGORMFollowRelationDAO, repository.NewCachedFollowRepository, service.NewDefaultFollowRelationService)
 
 var tagSvcProviderSet = wire.NewSet(cache.NewRedisTagCache, dao.NewGORMTagDAO, repository.NewCachedTagRepository, service.NewDefaultTagService)
 
-var aiSvcProviderSet = wire.NewSet(cache.NewRedisAiCache, repository.NewCachedAiRepository, ioc.InitVolcanoModel, ai.NewAiFactory, ioc.InitAiProvider, ai.NewAiService)
+var blockSvcProviderSet = wire.NewSet(cache.NewRedisBlockCache, dao.NewGORMBlockRelationDAO, repository.NewCachedBlockRepository, service.NewDefaultBlockService)
+
+var followRecommendSvcProviderSet = wire.NewSet(cache.NewRedisFollowRecommendCache, dao.NewGORMFollowRecommendDAO, repository.NewCachedFollowRecommendRepository, ioc.InitFollowRecommendConfig, service.NewDefaultFollowRecommendService)
+
+var moderationSvcProviderSet = wire.NewSet(dao.NewGORMModerationDAO, repository.NewDefaultModerationRepository, ioc.InitModerationFilter, ioc.InitModerationReviewers, service.NewDefaultModerationService)
+
+var mentionSvcProviderSet = wire.NewSet(dao.NewGORMMentionDAO, repository.NewDefaultMentionRepository, service.NewDefaultMentionService)
+
+var notificationSvcProviderSet = wire.NewSet(cache.NewRedisNotificationCache, dao.NewGORMNotificationDAO, repository.NewCachedNotificationRepository, service.NewDefaultNotificationService)
+
+var aiSvcProviderSet = wire.NewSet(cache.NewRedisAiCache, dao.NewGORMAiDAO, repository.NewCachedAiRepository, ioc.InitPromptRegistry, ioc.InitVolcanoModel, ai.NewAiFactory, ioc.InitAiProvider, ai.NewAiService)
 
 var searchSvcProviderSet = wire.NewSet(search.NewESUserDAO, search.NewESTagDAO, search.NewESArticleDAO, search2.NewDefaultUserRepository, search2.NewDefaultArticleRepository, service.NewDefaultSearchService, search.NewESAnyDAO, search2.NewDefaultAnyRepository, service.NewDefaultSyncService)
 
-var feedSvcProviderSet = wire.NewSet(cache.NewFeedEventCache, dao.NewFeedPullEventDAO, dao.NewFeedPushEventDAO, repository.NewFeedEventRepo, feed.NewFeedService, ioc.RegisterFeedHandler)
+var feedSvcProviderSet = wire.NewSet(cache.NewFeedEventCache, dao.NewFeedPullEventDAO, dao.NewFeedPushEventDAO, repository.NewFeedEventRepo, feed.NewFeedService, ioc.InitFeedFanoutConfig, ioc.InitFeedRetentionConfig, ioc.RegisterFeedHandler)
 
-var eventsProviderSet = wire.NewSet(ioc.InitSyncProducer, ioc.InitConsumers, search3.NewSyncDataEventConsumer, article.NewSaramaSyncProducer, article.NewReadEventConsumer, search3.NewArticleConsumer, tag.NewSaramaSyncProducer, user.NewSaramaSyncProducer, search3.NewUserConsumer, follow.NewFollowEventProducer, feed2.NewFollowEventConsumer)
+var eventsProviderSet = wire.NewSet(ioc.InitSyncProducer, ioc.InitConsumers, search3.NewSyncDataEventConsumer, article.NewSaramaSyncProducer, article.NewReadEventConsumer, search3.NewArticleConsumer, tag.NewSaramaSyncProducer, user.NewSaramaSyncProducer, search3.NewUserConsumer, follow.NewFollowEventProducer, feed2.NewFollowEventConsumer, feed2.NewUnfollowEventConsumer, fanout.NewFanoutEventProducer, feed2.NewFanoutEventConsumer, feedevent.NewFeedEventProducer, feed2.NewFeedEventConsumer, moderation.NewModerationEventProducer, ai2.NewModerationEventConsumer, mention.NewMentionEventProducer, security.NewAuditEventProducer, notification.NewConsumer)
 
-var handlerProviderSet = wire.NewSet(jwt.NewRedisJWTHandler, web.NewUserHandler, web.NewArticleHandler, web.NewCommentHandler, web.NewFollowHandler, web.NewTagHandler, web.NewSearchHandler, web.NewFeedHandler)
+var handlerProviderSet = wire.NewSet(ioc.InitJWTHandler, web.NewUserHandler, web.NewArticleHandler, web.NewCommentHandler, web.NewFollowHandler, web.NewTagHandler, web.NewSearchHandler, web.NewFeedHandler, web.NewModerationHandler, web.NewNotificationHandler, web.NewSMSHandler, web.NewCaptchaHandler, middleware.NewCaptchaBuilder)
 
-var jobProviderSet = wire.NewSet(ioc.InitRankingJob, ioc.InitJobs)
+var jobProviderSet = wire.NewSet(ioc.InitRankingJob, ioc.InitFeedArchiveJob, ioc.InitFollowRecommendJob, ioc.InitJobs)